@@ -5,10 +5,16 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
 
 	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/search"
+	"github.com/perebaj/esaj/storage"
 	"github.com/perebaj/esaj/tracing"
 )
 
@@ -18,28 +24,44 @@ const GCPTraceHeader = "X-Cloud-Trace-Context"
 // Storage is an interface that defines the methods to deal with storage
 type Storage interface {
 	SaveProcessSeeds(ctx context.Context, ps []esaj.ProcessSeed) error
-	ProcessBasicInfoByOAB(ctx context.Context, oab string) ([]esaj.ProcessBasicInfo, error)
+	GetSeedsByOAB(ctx context.Context, oab esaj.OAB) ([]storage.ProcessSeed, error)
+	ReconcileSeeds(ctx context.Context, oab esaj.OAB, found []esaj.ProcessSeed) ([]string, error)
+	ProcessBasicInfoByOAB(ctx context.Context, oab esaj.OAB) ([]esaj.ProcessBasicInfo, error)
+	ProcessHistory(ctx context.Context, processID string) ([]storage.ProcessSnapshot, error)
+	QuerySeeds(ctx context.Context, q storage.SeedQuery) (storage.SeedPage, error)
+	QueryProcesses(ctx context.Context, q storage.ProcessQuery) (storage.ProcessPage, error)
+	SearchProcesses(ctx context.Context, q search.Query) ([]search.Result, error)
+	ProcessOABs(ctx context.Context, processID string) ([]esaj.OAB, error)
+	GetOrganization(ctx context.Context, id string) (storage.Organization, error)
+	GetMember(ctx context.Context, organizationID, userID string) (storage.Member, error)
 }
 
 type esajClient interface {
-	SearchByOAB(ctx context.Context, oab string) ([]esaj.ProcessSeed, error)
+	SearchByOAB(ctx context.Context, oab esaj.OAB) ([]esaj.ProcessSeed, error)
+	SearchByOABInForo(ctx context.Context, oab esaj.OAB, foroCode string) ([]esaj.ProcessSeed, error)
 }
 
-// Handler is a struct that holds the storage and esaj client
+// Handler is a struct that holds the storage and esaj client. Its handlers are scoped to the organization of
+// the caller (see UserIDHeader and OrganizationIDHeader): only the OABs owned by the organization, and the
+// processes found by them, are accepted. Each access to them is recorded by the auditor.
 type Handler struct {
 	storage Storage
 	esaj    esajClient
+	auditor Auditor
 }
 
-// NewHandler creates a new Handler struct
-func NewHandler(storage Storage, esaj esajClient) Handler {
+// NewHandler creates a new Handler struct. A nil auditor records nothing.
+func NewHandler(storage Storage, esaj esajClient, auditor Auditor) Handler {
 	return Handler{
 		storage: storage,
 		esaj:    esaj,
+		auditor: auditor,
 	}
 }
 
-// OabSeederHandler is a handler that receives a oab query parameter and search for the process seeds in the esaj website
+// OabSeederHandler is a handler that receives a oab query parameter and search for the process seeds in the esaj website.
+// A search of all the foros is reconciled with the stored seeds, unless it looks incomplete (see checkReconcile):
+// then it answers 409 Conflict, and force=true reconciles it anyway.
 func (h Handler) OabSeederHandler(w http.ResponseWriter, r *http.Request) {
 	traceID := r.Header.Get(GCPTraceHeader)
 	ctx := r.Context()
@@ -47,19 +69,57 @@ func (h Handler) OabSeederHandler(w http.ResponseWriter, r *http.Request) {
 	ctx = tracing.SetTraceIDInContext(ctx, traceID)
 
 	logger := slog.With("traceID", traceID)
-	oab := r.URL.Query().Get("oab")
-	if oab == "" {
-		http.Error(w, "oab is required", http.StatusBadRequest)
+	org, _, ok := callerOrganization(ctx, w, r, h.storage, logger)
+	if !ok {
 		return
 	}
-
-	seed, err := h.esaj.SearchByOAB(ctx, oab)
+	oab, err := oabFromRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkOAB(w, org, oab) {
+		return
+	}
+	// foro is optional and restricts the search to a single foro. Example: ?oab=123456&foro=0053
+	foro := r.URL.Query().Get("foro")
+	if foro != "" {
+		if _, err := esaj.NormalizeForoCode(foro); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	recordAccess(ctx, h.auditor, r, org.ID, storage.AccessWrite, storage.OABResource(oab))
+
+	var seed []esaj.ProcessSeed
+	if foro != "" {
+		seed, err = h.esaj.SearchByOABInForo(ctx, oab, foro)
+	} else {
+		seed, err = h.esaj.SearchByOAB(ctx, oab)
+	}
+	// only a search whose page says that there are no processes can remove all the processes of the OAB
+	noProcesses := errors.Is(err, esaj.ErrNoProcesses)
+	if err != nil && !noProcesses {
+		status := http.StatusInternalServerError
+		if errors.Is(err, esaj.ErrUnexpectedPage) {
+			status = http.StatusBadGateway
+		}
+		http.Error(w, err.Error(), status)
 		logger.Error("error searching by oab", "error", err)
 		return
 	}
 
+	// the stored seeds are read before saving the new ones, to compare the search with what was known
+	var stored []storage.ProcessSeed
+	if foro == "" {
+		stored, err = h.storage.GetSeedsByOAB(ctx, oab)
+		if err != nil {
+			logger.Error("error getting process seeds", "error", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	logger.Info("saving process seeds", "seeds", seed)
 	err = h.storage.SaveProcessSeeds(ctx, seed)
 	if err != nil {
@@ -68,11 +128,58 @@ func (h Handler) OabSeederHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	// only a search of all the foros has all the processes of the OAB, the others would remove the processes of
+	// the other foros
+	if foro == "" {
+		// force=true reconciles a search that looks incomplete, when the OAB really lost its processes
+		force := r.URL.Query().Get("force") == "true"
+		if err := checkReconcile(stored, len(seed), noProcesses); err != nil && !force {
+			logger.Warn("process seeds not reconciled", "oab", oab.String(), "error", err)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		removed, err := h.storage.ReconcileSeeds(ctx, oab, seed)
+		if err != nil {
+			logger.Error("error reconciling process seeds", "error", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		logger.Info("process seeds reconciled", "oab", oab.String(), "removed", removed)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
 }
 
-// ProcessesByOABHandler is a handler that receives a oab query parameter and search for the processes in the firestore database
+// minReconcileRatio is the smallest share of the stored seeds that a search must find to be reconciled. A
+// search that finds much less processes than before is more likely a failed search than a lawyer that lost
+// them.
+const minReconcileRatio = 0.5
+
+// checkReconcile returns an error when a search that found the given number of seeds shouldn't remove the
+// stored seeds that it didn't find: it found nothing, or much less than the stored seeds that weren't removed
+// yet, and its page didn't say that there are no processes.
+func checkReconcile(stored []storage.ProcessSeed, found int, noProcesses bool) error {
+	if noProcesses {
+		return nil
+	}
+	var active int
+	for _, s := range stored {
+		if s.RemovedAt.IsZero() {
+			active++
+		}
+	}
+	if active == 0 {
+		return nil
+	}
+	if found == 0 || float64(found) < float64(active)*minReconcileRatio {
+		return fmt.Errorf("the search found %d of the %d stored processes, so it was not reconciled", found, active)
+	}
+	return nil
+}
+
+// ProcessesByOABHandler is a handler that receives a oab query parameter and search for the processes in the storage
 func (h Handler) ProcessesByOABHandler(w http.ResponseWriter, r *http.Request) {
 	traceID := r.Header.Get(GCPTraceHeader)
 	ctx := r.Context()
@@ -80,11 +187,19 @@ func (h Handler) ProcessesByOABHandler(w http.ResponseWriter, r *http.Request) {
 	ctx = tracing.SetTraceIDInContext(ctx, traceID)
 
 	logger := slog.With("traceID", traceID)
-	oab := r.URL.Query().Get("oab")
-	if oab == "" {
-		http.Error(w, "oab is required", http.StatusBadRequest)
+	org, _, ok := callerOrganization(ctx, w, r, h.storage, logger)
+	if !ok {
 		return
 	}
+	oab, err := oabFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkOAB(w, org, oab) {
+		return
+	}
+	recordAccess(ctx, h.auditor, r, org.ID, storage.AccessRead, storage.OABResource(oab))
 
 	processes, err := h.storage.ProcessBasicInfoByOAB(ctx, oab)
 	if err != nil {
@@ -94,5 +209,323 @@ func (h Handler) ProcessesByOABHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	logger.Info("processes found", "processes", processes)
+
+	var resp any = processes
+	// group_by=comarca returns the processes grouped by the comarca of the foro, using the embedded catalog.
+	// processes whose foro is not in the catalog are grouped under esaj.UnknownComarca.
+	switch groupBy := r.URL.Query().Get("group_by"); groupBy {
+	case "":
+	case "comarca":
+		resp = groupByComarca(processes)
+	default:
+		http.Error(w, fmt.Sprintf("group_by %s not supported", groupBy), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		logger.Error("error encoding processes", "error", err)
+	}
+}
+
+// ProcessHistoryHandler is a handler that receives a process_id query parameter and returns the snapshots of the
+// process, from the oldest to the newest. Each snapshot has the fields that changed since the previous one.
+func (h Handler) ProcessHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	traceID := r.Header.Get(GCPTraceHeader)
+	ctx := r.Context()
+
+	ctx = tracing.SetTraceIDInContext(ctx, traceID)
+
+	logger := slog.With("traceID", traceID)
+	org, _, ok := callerOrganization(ctx, w, r, h.storage, logger)
+	if !ok {
+		return
+	}
+	processID := r.URL.Query().Get("process_id")
+	if processID == "" {
+		http.Error(w, "process_id is required", http.StatusBadRequest)
+		return
+	}
+	if !checkProcess(ctx, w, h.storage, org, processID, logger) {
+		return
+	}
+	recordAccess(ctx, h.auditor, r, org.ID, storage.AccessRead, storage.ProcessResource(processID))
+
+	history, err := h.storage.ProcessHistory(ctx, processID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error("error getting process history", "error", err, "process_id", processID)
+		return
+	}
+
+	if history == nil {
+		history = []storage.ProcessSnapshot{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(history)
+	if err != nil {
+		logger.Error("error encoding process history", "error", err)
+	}
+}
+
+// ProcessesPageHandler is a handler that returns a page of the processes of the oab query parameter.
+// The optional parameters are:
+//   - foro, class and situation: filter the processes by their foro code, class and situation
+//   - order_by: process_id (default), updated_at, class or foro; and desc=true for the descending order
+//   - page_size: the number of processes of the page, 50 by default and at most 500
+//   - cursor: the next_cursor of the previous page
+//
+// Example: GET /?oab=123456&situation=Em%20andamento&order_by=updated_at&desc=true&page_size=20
+func (h Handler) ProcessesPageHandler(w http.ResponseWriter, r *http.Request) {
+	traceID := r.Header.Get(GCPTraceHeader)
+	ctx := tracing.SetTraceIDInContext(r.Context(), traceID)
+
+	logger := slog.With("traceID", traceID)
+	org, _, ok := callerOrganization(ctx, w, r, h.storage, logger)
+	if !ok {
+		return
+	}
+	oab, err := oabFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkOAB(w, org, oab) {
+		return
+	}
+
+	query := r.URL.Query()
+	q := storage.ProcessQuery{
+		OAB:       oab,
+		Foro:      query.Get("foro"),
+		Class:     query.Get("class"),
+		Situation: query.Get("situation"),
+		OrderBy:   storage.Order(query.Get("order_by")),
+		Cursor:    query.Get("cursor"),
+	}
+	q.Desc, q.PageSize, err = pageFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recordAccess(ctx, h.auditor, r, org.ID, storage.AccessRead, storage.OABResource(oab))
+	page, err := h.storage.QueryProcesses(ctx, q)
+	if errors.Is(err, storage.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error("error querying processes", "error", err)
+		return
+	}
+
+	resp := struct {
+		Processes  []esaj.ProcessBasicInfo `json:"processes"`
+		NextCursor string                  `json:"next_cursor,omitempty"`
+	}{Processes: page.Processes, NextCursor: page.NextCursor}
+	if resp.Processes == nil {
+		resp.Processes = []esaj.ProcessBasicInfo{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error("error encoding processes", "error", err)
+	}
+}
+
+// SeedsPageHandler is a handler that returns a page of the process seeds of the oab query parameter.
+// The optional parameters are:
+//   - status: pending or ingested
+//   - order_by: process_id (default) or updated_at; and desc=true for the descending order
+//   - page_size: the number of seeds of the page, 50 by default and at most 500
+//   - cursor: the next_cursor of the previous page
+//
+// Example: GET /?oab=123456&status=pending&page_size=100
+func (h Handler) SeedsPageHandler(w http.ResponseWriter, r *http.Request) {
+	traceID := r.Header.Get(GCPTraceHeader)
+	ctx := tracing.SetTraceIDInContext(r.Context(), traceID)
+
+	logger := slog.With("traceID", traceID)
+	org, _, ok := callerOrganization(ctx, w, r, h.storage, logger)
+	if !ok {
+		return
+	}
+	oab, err := oabFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkOAB(w, org, oab) {
+		return
+	}
+
+	query := r.URL.Query()
+	q := storage.SeedQuery{
+		OAB:     oab,
+		Status:  query.Get("status"),
+		OrderBy: storage.Order(query.Get("order_by")),
+		Cursor:  query.Get("cursor"),
+	}
+	q.Desc, q.PageSize, err = pageFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recordAccess(ctx, h.auditor, r, org.ID, storage.AccessRead, storage.OABResource(oab))
+	page, err := h.storage.QuerySeeds(ctx, q)
+	if errors.Is(err, storage.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error("error querying seeds", "error", err)
+		return
+	}
+
+	resp := struct {
+		Seeds      []storage.ProcessSeed `json:"seeds"`
+		NextCursor string                `json:"next_cursor,omitempty"`
+	}{Seeds: page.Seeds, NextCursor: page.NextCursor}
+	if resp.Seeds == nil {
+		resp.Seeds = []storage.ProcessSeed{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error("error encoding seeds", "error", err)
+	}
+}
+
+// SearchHandler is a handler that searches the processes by the text of the q query parameter, in the party and
+// lawyer names, class, subject, judge and vara, ignoring the accents. The search is scoped by the oab query
+// parameter, repeated to search the processes of many OABs up to 30, and by all the OABs of the organization when
+// it's not informed.
+// The optional limit parameter is the number of results, 20 by default and at most 100.
+//
+// Example: GET /?q=joao%20execucao&oab=123456&oab=654321/RJ&limit=10
+func (h Handler) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	traceID := r.Header.Get(GCPTraceHeader)
+	ctx := tracing.SetTraceIDInContext(r.Context(), traceID)
+
+	logger := slog.With("traceID", traceID)
+	org, _, ok := callerOrganization(ctx, w, r, h.storage, logger)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	q := search.Query{Text: query.Get("q")}
+	for _, raw := range query["oab"] {
+		oab, err := esaj.ParseOAB(raw)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !checkOAB(w, org, oab) {
+			return
+		}
+		q.OABs = append(q.OABs, oab)
+	}
+	if len(query["oab"]) == 0 {
+		q.OABs = org.OABs
+	}
+	if v := query.Get("limit"); v != "" {
+		var err error
+		q.Limit, err = strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid limit %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	resources := make([]string, 0, len(q.OABs))
+	for _, oab := range q.OABs {
+		resources = append(resources, storage.OABResource(oab))
+	}
+	recordAccess(ctx, h.auditor, r, org.ID, storage.AccessRead, resources...)
+
+	results, err := h.storage.SearchProcesses(ctx, q)
+	if errors.Is(err, search.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error("error searching processes", "error", err)
+		return
+	}
+
+	resp := struct {
+		Results []search.Result `json:"results"`
+	}{Results: results}
+	if resp.Results == nil {
+		resp.Results = []search.Result{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error("error encoding search results", "error", err)
+	}
+}
+
+// writeJSON writes the value as the JSON response, with the status.
+func writeJSON(w http.ResponseWriter, logger *slog.Logger, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("error encoding response", "error", err)
+	}
+}
+
+// pageFromRequest parses the desc and page_size query parameters, both optional.
+func pageFromRequest(r *http.Request) (bool, int, error) {
+	query := r.URL.Query()
+
+	var desc bool
+	if v := query.Get("desc"); v != "" {
+		var err error
+		desc, err = strconv.ParseBool(v)
+		if err != nil {
+			return false, 0, fmt.Errorf("invalid desc %q", v)
+		}
+	}
+
+	var pageSize int
+	if v := query.Get("page_size"); v != "" {
+		var err error
+		pageSize, err = strconv.Atoi(v)
+		if err != nil {
+			return false, 0, fmt.Errorf("invalid page_size %q", v)
+		}
+	}
+	return desc, pageSize, nil
+}
+
+func groupByComarca(processes []esaj.ProcessBasicInfo) map[string][]esaj.ProcessBasicInfo {
+	groups := make(map[string][]esaj.ProcessBasicInfo)
+	for _, p := range processes {
+		comarca := esaj.ComarcaOf(p)
+		groups[comarca] = append(groups[comarca], p)
+	}
+	return groups
+}
+
+// oabFromRequest parses the oab query parameter, accepting any format supported by esaj.ParseOAB.
+func oabFromRequest(r *http.Request) (esaj.OAB, error) {
+	oab := r.URL.Query().Get("oab")
+	if oab == "" {
+		return esaj.OAB{}, errors.New("oab is required")
+	}
+
+	return esaj.ParseOAB(oab)
 }
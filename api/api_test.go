@@ -1,25 +1,485 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/perebaj/esaj/esaj"
 	"github.com/perebaj/esaj/mock"
+	"github.com/perebaj/esaj/search"
+	"github.com/perebaj/esaj/storage"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 )
 
+// callerOrg is the organization of the caller of the requests of the tests.
+var callerOrg = storage.Organization{
+	ID:   "firm",
+	Name: "Silva Advogados",
+	OABs: []esaj.OAB{{Number: "123", UF: "SP"}, {Number: "654321", UF: "RJ"}},
+}
+
+// newCallerRequest returns a request of a member of callerOrg.
+func newCallerRequest(method, target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set(UserIDHeader, "user_1")
+	req.Header.Set(OrganizationIDHeader, callerOrg.ID)
+	return req
+}
+
+// expectCaller expects the requests of a member of callerOrg.
+func expectCaller(storageMock *mock.MockStorage) {
+	storageMock.EXPECT().GetMember(gomock.Any(), callerOrg.ID, "user_1").
+		Return(storage.Member{OrganizationID: callerOrg.ID, UserID: "user_1", Role: storage.RoleMember}, nil).AnyTimes()
+	storageMock.EXPECT().GetOrganization(gomock.Any(), callerOrg.ID).Return(callerOrg, nil).AnyTimes()
+}
+
 func TestHandler_ProcessesByOABHandler(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	storageMock := mock.NewMockStorage(ctrl)
+	expectCaller(storageMock)
 
-	storageMock.EXPECT().ProcessBasicInfoByOAB(gomock.Any(), "123").Return(nil, nil)
-	req := httptest.NewRequest("POST", "/?oab=123", strings.NewReader(`{"oab": "123"}`))
+	storageMock.EXPECT().ProcessBasicInfoByOAB(gomock.Any(), esaj.OAB{Number: "123", UF: "SP"}).Return(nil, nil)
+	req := newCallerRequest("POST", "/?oab=123", strings.NewReader(`{"oab": "123"}`))
 	w := httptest.NewRecorder()
 
-	h := NewHandler(storageMock, nil)
+	h := NewHandler(storageMock, nil, nil)
 	h.ProcessesByOABHandler(w, req)
 
 	require.Equal(t, 200, w.Code)
 }
+
+func TestHandler_ProcessesByOABHandler_invalidOAB(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mock.NewMockStorage(ctrl)
+	expectCaller(storageMock)
+
+	req := newCallerRequest("POST", "/?oab=abc", nil)
+	w := httptest.NewRecorder()
+
+	h := NewHandler(storageMock, nil, nil)
+	h.ProcessesByOABHandler(w, req)
+
+	require.Equal(t, 400, w.Code)
+}
+
+func TestHandler_ProcessesByOABHandler_groupByComarca(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mock.NewMockStorage(ctrl)
+	expectCaller(storageMock)
+
+	processes := []esaj.ProcessBasicInfo{
+		{ProcessID: "1000001-02.2021.8.26.0053", ProcessForo: "53"},
+		{ProcessID: "1000002-02.2021.8.26.0114", ProcessForo: "114"},
+		{ProcessID: "1000003-02.2021.8.26.0100", ProcessForo: "100"},
+		{ProcessID: "1000004-02.2021.8.26.9998", ProcessForo: "9998", ForoName: "Foro de Teste"},
+	}
+	storageMock.EXPECT().ProcessBasicInfoByOAB(gomock.Any(), esaj.OAB{Number: "123", UF: "SP"}).Return(processes, nil)
+
+	req := newCallerRequest("GET", "/?oab=123&group_by=comarca", nil)
+	w := httptest.NewRecorder()
+
+	h := NewHandler(storageMock, nil, nil)
+	h.ProcessesByOABHandler(w, req)
+
+	require.Equal(t, 200, w.Code)
+
+	var got map[string][]esaj.ProcessBasicInfo
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	require.Len(t, got["São Paulo"], 2)
+	require.Len(t, got["Campinas"], 1)
+	require.Len(t, got[esaj.UnknownComarca], 1)
+}
+
+func TestHandler_OabSeederHandler_foro(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mock.NewMockStorage(ctrl)
+	expectCaller(storageMock)
+	esajMock := mock.NewMockesajClient(ctrl)
+
+	oab := esaj.OAB{Number: "123", UF: "SP"}
+	esajMock.EXPECT().SearchByOABInForo(gomock.Any(), oab, "0053").Return(nil, nil)
+	// the foros missing from the catalog are searched too
+	esajMock.EXPECT().SearchByOABInForo(gomock.Any(), oab, "9998").Return(nil, nil)
+	storageMock.EXPECT().SaveProcessSeeds(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+
+	req := newCallerRequest("POST", "/?oab=123&foro=0053", nil)
+	w := httptest.NewRecorder()
+
+	h := NewHandler(storageMock, esajMock, nil)
+	h.OabSeederHandler(w, req)
+	require.Equal(t, 200, w.Code)
+
+	req = newCallerRequest("POST", "/?oab=123&foro=9998", nil)
+	w = httptest.NewRecorder()
+	h.OabSeederHandler(w, req)
+	require.Equal(t, 200, w.Code)
+
+	req = newCallerRequest("POST", "/?oab=123&foro=abc", nil)
+	w = httptest.NewRecorder()
+	h.OabSeederHandler(w, req)
+	require.Equal(t, 400, w.Code)
+}
+
+func TestHandler_OabSeederHandler_reconcile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mock.NewMockStorage(ctrl)
+	expectCaller(storageMock)
+	esajMock := mock.NewMockesajClient(ctrl)
+
+	oab := esaj.OAB{Number: "123", UF: "SP"}
+	seeds := []esaj.ProcessSeed{{ProcessID: "1", OAB: oab}}
+	stored := []storage.ProcessSeed{{ProcessID: "1", OAB: oab}, {ProcessID: "2", OAB: oab}}
+	esajMock.EXPECT().SearchByOAB(gomock.Any(), oab).Return(seeds, nil).Times(2)
+	storageMock.EXPECT().GetSeedsByOAB(gomock.Any(), oab).Return(stored, nil).Times(2)
+	storageMock.EXPECT().SaveProcessSeeds(gomock.Any(), seeds).Return(nil).Times(2)
+	gomock.InOrder(
+		storageMock.EXPECT().ReconcileSeeds(gomock.Any(), oab, seeds).Return([]string{"2"}, nil),
+		storageMock.EXPECT().ReconcileSeeds(gomock.Any(), oab, seeds).Return(nil, fmt.Errorf("error reconciling")),
+	)
+
+	h := NewHandler(storageMock, esajMock, nil)
+
+	w := httptest.NewRecorder()
+	h.OabSeederHandler(w, newCallerRequest("POST", "/?oab=123", nil))
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	w = httptest.NewRecorder()
+	h.OabSeederHandler(w, newCallerRequest("POST", "/?oab=123", nil))
+	require.Equal(t, 500, w.Code)
+}
+
+func TestHandler_OabSeederHandler_incompleteSearch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mock.NewMockStorage(ctrl)
+	expectCaller(storageMock)
+	esajMock := mock.NewMockesajClient(ctrl)
+
+	oab := esaj.OAB{Number: "123", UF: "SP"}
+	stored := []storage.ProcessSeed{
+		{ProcessID: "1", OAB: oab},
+		{ProcessID: "2", OAB: oab},
+		{ProcessID: "3", OAB: oab},
+		{ProcessID: "4", OAB: oab, RemovedAt: time.Now()},
+	}
+	storageMock.EXPECT().GetSeedsByOAB(gomock.Any(), oab).Return(stored, nil).AnyTimes()
+	storageMock.EXPECT().SaveProcessSeeds(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	h := NewHandler(storageMock, esajMock, nil)
+
+	// a failed page of the eSAJ saves nothing
+	esajMock.EXPECT().SearchByOAB(gomock.Any(), oab).Return(nil, fmt.Errorf("%w: status code 500", esaj.ErrUnexpectedPage))
+	w := httptest.NewRecorder()
+	h.OabSeederHandler(w, newCallerRequest("POST", "/?oab=123", nil))
+	require.Equal(t, 502, w.Code)
+
+	// nothing, or much less than the stored seeds, is not reconciled
+	esajMock.EXPECT().SearchByOAB(gomock.Any(), oab).Return(nil, nil)
+	w = httptest.NewRecorder()
+	h.OabSeederHandler(w, newCallerRequest("POST", "/?oab=123", nil))
+	require.Equal(t, 409, w.Code)
+
+	esajMock.EXPECT().SearchByOAB(gomock.Any(), oab).Return([]esaj.ProcessSeed{{ProcessID: "1", OAB: oab}}, nil)
+	w = httptest.NewRecorder()
+	h.OabSeederHandler(w, newCallerRequest("POST", "/?oab=123", nil))
+	require.Equal(t, 409, w.Code)
+
+	// unless the eSAJ says that there are no processes, or it's forced
+	esajMock.EXPECT().SearchByOAB(gomock.Any(), oab).Return(nil, esaj.ErrNoProcesses)
+	storageMock.EXPECT().ReconcileSeeds(gomock.Any(), oab, nil).Return([]string{"1", "2", "3"}, nil)
+	w = httptest.NewRecorder()
+	h.OabSeederHandler(w, newCallerRequest("POST", "/?oab=123", nil))
+	require.Equal(t, 200, w.Code)
+
+	seeds := []esaj.ProcessSeed{{ProcessID: "1", OAB: oab}}
+	esajMock.EXPECT().SearchByOAB(gomock.Any(), oab).Return(seeds, nil)
+	storageMock.EXPECT().ReconcileSeeds(gomock.Any(), oab, seeds).Return([]string{"2", "3"}, nil)
+	w = httptest.NewRecorder()
+	h.OabSeederHandler(w, newCallerRequest("POST", "/?oab=123&force=true", nil))
+	require.Equal(t, 200, w.Code)
+}
+
+func TestHandler_ProcessHistoryHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mock.NewMockStorage(ctrl)
+	expectCaller(storageMock)
+
+	createdAt := time.Date(2024, 8, 1, 10, 0, 0, 0, time.UTC)
+	history := []storage.ProcessSnapshot{
+		{
+			ID:        "2024-08-01T10:00:00.000000000Z",
+			ProcessID: "1007573-30.2024.8.26.0229",
+			CreatedAt: createdAt,
+			TraceID:   "trace-1",
+			Process:   esaj.ProcessBasicInfo{ProcessID: "1007573-30.2024.8.26.0229", Judge: "Fulano"},
+		},
+		{
+			ID:        "2024-08-02T10:00:00.000000000Z",
+			ProcessID: "1007573-30.2024.8.26.0229",
+			CreatedAt: createdAt.AddDate(0, 0, 1),
+			TraceID:   "trace-2",
+			Process:   esaj.ProcessBasicInfo{ProcessID: "1007573-30.2024.8.26.0229", Judge: "Beltrano"},
+			Diff:      []storage.FieldChange{{Field: "judge", From: "Fulano", To: "Beltrano"}},
+		},
+	}
+	storageMock.EXPECT().ProcessOABs(gomock.Any(), gomock.Any()).Return(callerOrg.OABs, nil).Times(2)
+	storageMock.EXPECT().ProcessHistory(gomock.Any(), "1007573-30.2024.8.26.0229").Return(history, nil)
+	storageMock.EXPECT().ProcessHistory(gomock.Any(), "1016358-63.2020.8.26.0053").Return(nil, nil)
+
+	h := NewHandler(storageMock, nil, nil)
+
+	w := httptest.NewRecorder()
+	h.ProcessHistoryHandler(w, newCallerRequest("GET", "/?process_id=1007573-30.2024.8.26.0229", nil))
+	require.Equal(t, 200, w.Code)
+
+	var got []storage.ProcessSnapshot
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	require.Equal(t, history, got)
+
+	// a process without history is an empty list
+	w = httptest.NewRecorder()
+	h.ProcessHistoryHandler(w, newCallerRequest("GET", "/?process_id=1016358-63.2020.8.26.0053", nil))
+	require.Equal(t, 200, w.Code)
+	require.JSONEq(t, "[]", w.Body.String())
+
+	w = httptest.NewRecorder()
+	h.ProcessHistoryHandler(w, newCallerRequest("GET", "/", nil))
+	require.Equal(t, 400, w.Code)
+}
+
+func TestHandler_ProcessesPageHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mock.NewMockStorage(ctrl)
+	expectCaller(storageMock)
+
+	oab := esaj.OAB{Number: "123", UF: "SP"}
+	storageMock.EXPECT().QueryProcesses(gomock.Any(), storage.ProcessQuery{
+		OAB:       oab,
+		Foro:      "0053",
+		Situation: "Em andamento",
+		OrderBy:   storage.OrderUpdatedAt,
+		Desc:      true,
+		PageSize:  2,
+		Cursor:    "abc",
+	}).Return(storage.ProcessPage{
+		Processes:  []esaj.ProcessBasicInfo{{ProcessID: "1", OAB: oab}, {ProcessID: "2", OAB: oab}},
+		NextCursor: "def",
+	}, nil)
+
+	h := NewHandler(storageMock, nil, nil)
+
+	w := httptest.NewRecorder()
+	h.ProcessesPageHandler(w, newCallerRequest("GET",
+		"/?oab=123&foro=0053&situation=Em%20andamento&order_by=updated_at&desc=true&page_size=2&cursor=abc", nil))
+	require.Equal(t, 200, w.Code)
+
+	var got struct {
+		Processes  []esaj.ProcessBasicInfo `json:"processes"`
+		NextCursor string                  `json:"next_cursor"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	require.Len(t, got.Processes, 2)
+	require.Equal(t, "def", got.NextCursor)
+
+	// the last page has no cursor and an empty page is an empty list
+	storageMock.EXPECT().QueryProcesses(gomock.Any(), gomock.Any()).Return(storage.ProcessPage{}, nil)
+	w = httptest.NewRecorder()
+	h.ProcessesPageHandler(w, newCallerRequest("GET", "/?oab=123", nil))
+	require.Equal(t, 200, w.Code)
+	require.JSONEq(t, `{"processes": []}`, w.Body.String())
+}
+
+func TestHandler_ProcessesPageHandler_invalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mock.NewMockStorage(ctrl)
+	expectCaller(storageMock)
+	storageMock.EXPECT().QueryProcesses(gomock.Any(), gomock.Any()).
+		Return(storage.ProcessPage{}, fmt.Errorf("%w: malformed cursor", storage.ErrInvalidQuery))
+
+	h := NewHandler(storageMock, nil, nil)
+	for _, target := range []string{"/", "/?oab=abc", "/?oab=123&page_size=ten", "/?oab=123&desc=maybe", "/?oab=123&cursor=x"} {
+		w := httptest.NewRecorder()
+		h.ProcessesPageHandler(w, newCallerRequest("GET", target, nil))
+		require.Equal(t, 400, w.Code, target)
+	}
+}
+
+func TestHandler_SeedsPageHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mock.NewMockStorage(ctrl)
+	expectCaller(storageMock)
+
+	oab := esaj.OAB{Number: "123", UF: "SP"}
+	storageMock.EXPECT().QuerySeeds(gomock.Any(), storage.SeedQuery{OAB: oab, Status: storage.SeedPending, PageSize: 1}).
+		Return(storage.SeedPage{Seeds: []storage.ProcessSeed{{ID: "1", ProcessID: "1", OAB: oab}}, NextCursor: "abc"}, nil)
+	storageMock.EXPECT().QuerySeeds(gomock.Any(), storage.SeedQuery{OAB: oab, OrderBy: storage.OrderClass}).
+		Return(storage.SeedPage{}, storage.ErrInvalidQuery)
+
+	h := NewHandler(storageMock, nil, nil)
+
+	w := httptest.NewRecorder()
+	h.SeedsPageHandler(w, newCallerRequest("GET", "/?oab=123&status=pending&page_size=1", nil))
+	require.Equal(t, 200, w.Code)
+
+	var got struct {
+		Seeds      []storage.ProcessSeed `json:"seeds"`
+		NextCursor string                `json:"next_cursor"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	require.Len(t, got.Seeds, 1)
+	require.Equal(t, oab, got.Seeds[0].OAB)
+	require.Equal(t, "abc", got.NextCursor)
+
+	w = httptest.NewRecorder()
+	h.SeedsPageHandler(w, newCallerRequest("GET", "/?oab=123&order_by=class", nil))
+	require.Equal(t, 400, w.Code)
+}
+
+func TestHandler_SearchHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mock.NewMockStorage(ctrl)
+	expectCaller(storageMock)
+
+	oab, other := esaj.OAB{Number: "123", UF: "SP"}, esaj.OAB{Number: "654321", UF: "RJ"}
+	storageMock.EXPECT().SearchProcesses(gomock.Any(), search.Query{
+		Text:  "joão execução",
+		OABs:  []esaj.OAB{oab, other},
+		Limit: 10,
+	}).Return([]search.Result{
+		{Process: esaj.ProcessBasicInfo{ProcessID: "1", OAB: oab}, Score: 4.2, Fields: []search.Field{search.FieldParty}},
+	}, nil)
+
+	h := NewHandler(storageMock, nil, nil)
+
+	w := httptest.NewRecorder()
+	h.SearchHandler(w, newCallerRequest("GET", "/?q=jo%C3%A3o%20execu%C3%A7%C3%A3o&oab=123&oab=654321/RJ&limit=10", nil))
+	require.Equal(t, 200, w.Code)
+
+	var got struct {
+		Results []search.Result `json:"results"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	require.Len(t, got.Results, 1)
+	require.Equal(t, "1", got.Results[0].Process.ProcessID)
+	require.Equal(t, []search.Field{search.FieldParty}, got.Results[0].Fields)
+
+	// no results is an empty list
+	storageMock.EXPECT().SearchProcesses(gomock.Any(), gomock.Any()).Return(nil, nil)
+	w = httptest.NewRecorder()
+	h.SearchHandler(w, newCallerRequest("GET", "/?q=nada&oab=123", nil))
+	require.Equal(t, 200, w.Code)
+	require.JSONEq(t, `{"results": []}`, w.Body.String())
+}
+
+func TestHandler_SearchHandler_invalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mock.NewMockStorage(ctrl)
+	expectCaller(storageMock)
+	storageMock.EXPECT().SearchProcesses(gomock.Any(), gomock.Any()).
+		Return(nil, fmt.Errorf("%w: at least one oab is required", search.ErrInvalidQuery))
+
+	h := NewHandler(storageMock, nil, nil)
+	for _, target := range []string{"/?q=joao", "/?q=joao&oab=abc", "/?q=joao&oab=123&limit=ten"} {
+		w := httptest.NewRecorder()
+		h.SearchHandler(w, newCallerRequest("GET", target, nil))
+		require.Equal(t, 400, w.Code, target)
+	}
+}
+
+func TestHandler_scope(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mock.NewMockStorage(ctrl)
+	expectCaller(storageMock)
+	storageMock.EXPECT().GetMember(gomock.Any(), "other", "user_1").Return(storage.Member{}, storage.ErrNotFound)
+	storageMock.EXPECT().ProcessOABs(gomock.Any(), "1").Return([]esaj.OAB{{Number: "999", UF: "SP"}}, nil)
+	storageMock.EXPECT().ProcessOABs(gomock.Any(), "2").Return(nil, storage.ErrNotFound)
+
+	h := NewHandler(storageMock, nil, nil)
+
+	// the caller must be identified
+	w := httptest.NewRecorder()
+	h.ProcessesByOABHandler(w, httptest.NewRequest("GET", "/?oab=123", nil))
+	require.Equal(t, 401, w.Code)
+
+	// and be a member of the organization
+	req := newCallerRequest("GET", "/?oab=123", nil)
+	req.Header.Set(OrganizationIDHeader, "other")
+	w = httptest.NewRecorder()
+	h.ProcessesByOABHandler(w, req)
+	require.Equal(t, 403, w.Code)
+
+	// the OABs of the other organizations are forbidden
+	for name, handler := range map[string]http.HandlerFunc{
+		"ProcessesByOABHandler": h.ProcessesByOABHandler,
+		"ProcessesPageHandler":  h.ProcessesPageHandler,
+		"SeedsPageHandler":      h.SeedsPageHandler,
+		"OabSeederHandler":      h.OabSeederHandler,
+		"SearchHandler":         h.SearchHandler,
+	} {
+		w := httptest.NewRecorder()
+		handler(w, newCallerRequest("GET", "/?q=joao&oab=999", nil))
+		require.Equal(t, 403, w.Code, name)
+	}
+
+	// the processes of the other organizations are not found, as the ones that don't exist
+	for _, id := range []string{"1", "2"} {
+		w = httptest.NewRecorder()
+		h.ProcessHistoryHandler(w, newCallerRequest("GET", "/?process_id="+id, nil))
+		require.Equal(t, 404, w.Code, id)
+	}
+
+	// the search is scoped by all the OABs of the organization by default
+	storageMock.EXPECT().SearchProcesses(gomock.Any(), search.Query{Text: "joao", OABs: callerOrg.OABs}).Return(nil, nil)
+	w = httptest.NewRecorder()
+	h.SearchHandler(w, newCallerRequest("GET", "/?q=joao", nil))
+	require.Equal(t, 200, w.Code)
+}
+
+func TestHandler_audit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mock.NewMockStorage(ctrl)
+	auditorMock := mock.NewMockAuditor(ctrl)
+	expectCaller(storageMock)
+	storageMock.EXPECT().ProcessOABs(gomock.Any(), "1").Return(callerOrg.OABs[:1], nil)
+	storageMock.EXPECT().ProcessHistory(gomock.Any(), "1").Return(nil, nil)
+	storageMock.EXPECT().SearchProcesses(gomock.Any(), gomock.Any()).Return(nil, nil)
+
+	var got []storage.AccessEvent
+	auditorMock.EXPECT().Record(gomock.Any(), gomock.Any()).Do(func(_ context.Context, e storage.AccessEvent) {
+		got = append(got, e)
+	}).Times(3)
+
+	h := NewHandler(storageMock, nil, auditorMock)
+
+	w := httptest.NewRecorder()
+	h.ProcessHistoryHandler(w, newCallerRequest("GET", "/?process_id=1", nil))
+	require.Equal(t, 200, w.Code)
+
+	// a search reads the processes of each of its OABs
+	w = httptest.NewRecorder()
+	h.SearchHandler(w, newCallerRequest("GET", "/?q=joao", nil))
+	require.Equal(t, 200, w.Code)
+
+	// the denied requests read nothing
+	w = httptest.NewRecorder()
+	h.ProcessesByOABHandler(w, newCallerRequest("GET", "/?oab=999", nil))
+	require.Equal(t, 403, w.Code)
+
+	// and the rejected ones write nothing
+	w = httptest.NewRecorder()
+	h.OabSeederHandler(w, newCallerRequest("POST", "/?oab=123&foro=abc", nil))
+	require.Equal(t, 400, w.Code)
+
+	require.Equal(t, []storage.AccessEvent{
+		{UserID: "user_1", OrganizationID: "firm", Action: storage.AccessRead, Resource: "process:1"},
+		{UserID: "user_1", OrganizationID: "firm", Action: storage.AccessRead, Resource: "oab:123/SP"},
+		{UserID: "user_1", OrganizationID: "firm", Action: storage.AccessRead, Resource: "oab:654321/RJ"},
+	}, got)
+}
@@ -0,0 +1,197 @@
+// Package api audit.go records the accesses to process data, and has the handlers that query and export them.
+//
+//go:generate mockgen -source audit.go -destination ../mock/audit_mock.go -package mock
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/tracing"
+)
+
+// Auditor records the accesses to process data, implemented by audit.Recorder. Record must not block the
+// request.
+type Auditor interface {
+	Record(ctx context.Context, e storage.AccessEvent)
+}
+
+// recordAccess records the access of the caller of the request, acting for the organization, to the resources.
+// A nil auditor records nothing.
+func recordAccess(ctx context.Context, a Auditor, r *http.Request, organizationID, action string, resources ...string) {
+	if a == nil {
+		return
+	}
+	for _, resource := range resources {
+		a.Record(ctx, storage.AccessEvent{
+			UserID:         r.Header.Get(UserIDHeader),
+			OrganizationID: organizationID,
+			Action:         action,
+			Resource:       resource,
+		})
+	}
+}
+
+// AuditStorage queries the access log, and reads the organizations and the members of the callers
+type AuditStorage interface {
+	QueryAccessEvents(ctx context.Context, q storage.AccessQuery) (storage.AccessPage, error)
+	GetOrganization(ctx context.Context, id string) (storage.Organization, error)
+	GetMember(ctx context.Context, organizationID, userID string) (storage.Member, error)
+	ProcessOABs(ctx context.Context, processID string) ([]esaj.OAB, error)
+}
+
+// AuditHandler gather the handlers of the access log. The admins of the platform, with the admin token as a
+// bearer token, read the events of all the organizations. The owners and the admins of an organization read
+// only the events of their organization.
+type AuditHandler struct {
+	storage    AuditStorage
+	adminToken string
+}
+
+// NewAuditHandler creates a new AuditHandler. An empty admin token rejects the requests of the admins of the
+// platform.
+func NewAuditHandler(storage AuditStorage, adminToken string) AuditHandler {
+	return AuditHandler{
+		storage:    storage,
+		adminToken: adminToken,
+	}
+}
+
+// AccessEventsHandler returns a page of the access events, ordered by creation time. The optional parameters are:
+//   - organization_id: filters the events by organization, only for the admins of the platform
+//   - user_id and resource: filter the events by the caller and the accessed data. Example: process:123
+//   - since and until: filter the events created in [since, until), in RFC3339
+//   - page_size: the number of events of the page, 50 by default and at most 500
+//   - cursor: the next_cursor of the previous page
+//
+// Example: GET /?resource=oab:123456/SP&since=2024-08-01T00:00:00Z&page_size=100
+func (h AuditHandler) AccessEventsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, logger, q, ok := h.accessQuery(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := h.storage.QueryAccessEvents(ctx, q)
+	if errors.Is(err, storage.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error("error querying access events", "error", err)
+		return
+	}
+	if page.Events == nil {
+		page.Events = []storage.AccessEvent{}
+	}
+	writeJSON(w, logger, http.StatusOK, page)
+}
+
+// AccessExportHandler exports all the access events that match the filters of AccessEventsHandler, one JSON
+// object per line, ordered by creation time.
+//
+// Example: GET /?since=2024-08-01T00:00:00Z&until=2024-09-01T00:00:00Z
+func (h AuditHandler) AccessExportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, logger, q, ok := h.accessQuery(w, r)
+	if !ok {
+		return
+	}
+	q.PageSize = storage.MaxPageSize
+	q.Cursor = ""
+
+	// the first page is read before the response, so an invalid query still returns its status
+	page, err := h.storage.QueryAccessEvents(ctx, q)
+	if errors.Is(err, storage.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error("error querying access events", "error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	var exported int
+	for {
+		for _, e := range page.Events {
+			if err := enc.Encode(e); err != nil {
+				logger.Error("error writing access events", "error", err, "exported", exported)
+				return
+			}
+			exported++
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+		page, err = h.storage.QueryAccessEvents(ctx, q)
+		if err != nil {
+			// the status was already sent, the client finds the export truncated
+			logger.Error("error querying access events", "error", err, "exported", exported)
+			return
+		}
+	}
+	logger.Info("access events exported", "events", exported, "organization_id", q.OrganizationID)
+}
+
+// accessQuery authorizes the request and parses its query of the access events, writing the error when it's not
+// authorized or not valid. It returns the context with the trace ID and its logger.
+func (h AuditHandler) accessQuery(w http.ResponseWriter, r *http.Request) (context.Context, *slog.Logger,
+	storage.AccessQuery, bool) {
+	traceID := r.Header.Get(GCPTraceHeader)
+	ctx := tracing.SetTraceIDInContext(r.Context(), traceID)
+	logger := slog.With("traceID", traceID)
+
+	query := r.URL.Query()
+	q := storage.AccessQuery{
+		OrganizationID: query.Get("organization_id"),
+		UserID:         query.Get("user_id"),
+		Resource:       query.Get("resource"),
+		Cursor:         query.Get("cursor"),
+	}
+
+	if !isAdmin(r, h.adminToken) {
+		org, caller, ok := callerOrganization(ctx, w, r, h.storage, logger)
+		if !ok {
+			return nil, nil, q, false
+		}
+		if !caller.CanManage() {
+			http.Error(w, "only the owners and the admins read the access log", http.StatusForbidden)
+			return nil, nil, q, false
+		}
+		q.OrganizationID = org.ID
+	}
+
+	var err error
+	for _, param := range []struct {
+		name string
+		t    *time.Time
+	}{
+		{"since", &q.Since},
+		{"until", &q.Until},
+	} {
+		v := query.Get(param.name)
+		if v == "" {
+			continue
+		}
+		if *param.t, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid %s %q", param.name, v), http.StatusBadRequest)
+			return nil, nil, q, false
+		}
+	}
+	if _, q.PageSize, err = pageFromRequest(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, q, false
+	}
+	return ctx, logger, q, true
+}
@@ -0,0 +1,90 @@
+package api_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/perebaj/esaj/api"
+	"github.com/perebaj/esaj/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditHandler(t *testing.T) {
+	s := newFirms(t)
+	ctx := context.Background()
+	require.NoError(t, s.SaveMember(ctx, storage.Member{OrganizationID: "silva", UserID: "member", Role: storage.RoleMember}))
+
+	base := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+	var events []storage.AccessEvent
+	for i, org := range []string{"silva", "silva", "souza", "silva"} {
+		events = append(events, storage.AccessEvent{
+			ID:             fmt.Sprint(i),
+			UserID:         org + "_owner",
+			OrganizationID: org,
+			Action:         storage.AccessRead,
+			Resource:       storage.ProcessResource("1"),
+			CreatedAt:      base.Add(time.Duration(i) * time.Hour),
+		})
+	}
+	require.NoError(t, s.SaveAccessEvents(ctx, events))
+
+	h := api.NewAuditHandler(s, "admin-token")
+	query := func(req *http.Request) (int, storage.AccessPage) {
+		w := httptest.NewRecorder()
+		h.AccessEventsHandler(w, req)
+		var page storage.AccessPage
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+		}
+		return w.Code, page
+	}
+
+	// the owners read only the events of their organization, even when asking for another one
+	code, page := query(memberRequest("GET", "/?organization_id=souza&page_size=2", "", "silva", "silva_owner"))
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, page.Events, 2)
+	assert.Equal(t, "0", page.Events[0].ID)
+	require.NotEmpty(t, page.NextCursor)
+
+	code, page = query(memberRequest("GET", "/?cursor="+page.NextCursor, "", "silva", "silva_owner"))
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, page.Events, 1)
+	assert.Equal(t, "3", page.Events[0].ID)
+
+	// the members don't read the access log
+	code, _ = query(memberRequest("GET", "/", "", "silva", "member"))
+	require.Equal(t, http.StatusForbidden, code)
+
+	// the admins of the platform read all of them
+	code, page = query(adminRequest("GET", "/?since=2024-08-01T13:00:00Z&until=2024-08-01T15:00:00Z", ""))
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, page.Events, 2)
+	assert.Equal(t, "souza", page.Events[1].OrganizationID)
+
+	for _, target := range []string{"/?since=yesterday", "/?page_size=1000", "/?cursor=abc"} {
+		code, _ = query(adminRequest("GET", target, ""))
+		require.Equal(t, http.StatusBadRequest, code, target)
+	}
+
+	// the export has all the pages, one event per line
+	w := httptest.NewRecorder()
+	h.AccessExportHandler(w, adminRequest("GET", "/?organization_id=silva", ""))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	var ids []string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var e storage.AccessEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		ids = append(ids, e.ID)
+	}
+	assert.Equal(t, []string{"0", "1", "3"}, ids)
+}
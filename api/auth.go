@@ -0,0 +1,81 @@
+// Package api auth.go has the middleware that authenticates the callers of the API and sets their UserIDHeader.
+package api
+
+import (
+	"crypto/rsa"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/perebaj/esaj/clerk"
+)
+
+// GatewaySecretHeader is the shared secret of the gateway that verifies the clerk sessions before forwarding the
+// requests, setting UserIDHeader itself.
+const GatewaySecretHeader = "X-Gateway-Secret"
+
+// AuthConfig configures the Auth middleware. At least one of ClerkKey and GatewaySecret must be set, or only
+// the admins and the public paths are served.
+type AuthConfig struct {
+	// ClerkKey verifies the clerk session tokens, sent as bearer tokens. The subject of the token is the caller.
+	ClerkKey *rsa.PublicKey
+	// AuthorizedParties are the origins of the frontends whose tokens are accepted, all when empty.
+	AuthorizedParties []string
+	// GatewaySecret authenticates the gateway, that sends it in GatewaySecretHeader with the UserIDHeader of
+	// the session it verified. Empty disables the gateway.
+	GatewaySecret string
+	// AdminToken is the bearer token of the admins, that is passed to the handlers that check it.
+	AdminToken string
+	// Public are the paths served without authentication, like the webhooks that verify their own signatures.
+	Public []string
+}
+
+// Auth authenticates the callers of the API: a clerk session token, the secret of the gateway or the admin
+// token. UserIDHeader is never taken from the clients, it's removed and set from the session token, and only
+// kept when it comes from the gateway. The other requests are answered with 401, except the public paths.
+func Auth(config AuthConfig) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger := slog.With("traceID", r.Header.Get(GCPTraceHeader))
+
+			secret := r.Header.Get(GatewaySecretHeader)
+			r.Header.Del(GatewaySecretHeader)
+			if config.GatewaySecret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(config.GatewaySecret)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			r.Header.Del(UserIDHeader)
+
+			if slices.Contains(config.Public, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !found || token == "" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if isAdmin(r, config.AdminToken) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if config.ClerkKey == nil {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			claims, err := clerk.VerifySessionToken(token, config.ClerkKey, config.AuthorizedParties, time.Now())
+			if err != nil {
+				logger.Warn("invalid session token", "error", err, "path", r.URL.Path)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			r.Header.Set(UserIDHeader, claims.Subject)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// Package api middleware.go has the middlewares of the router, that add a behavior to all of its requests.
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/perebaj/esaj/storage"
+)
+
+// Middleware wraps a handler, adding a behavior to its requests.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps the handler with the middlewares, the first one being the outermost.
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// Recovery writes a 500 response, and logs the panic with its stack, when the handler panics. The
+// http.ErrAbortHandler panics are not recovered, since they abort the response on purpose.
+func Recovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			slog.Error("panic serving request", "error", fmt.Sprint(err), "method", r.Method, "path", r.URL.Path,
+				"traceID", r.Header.Get(GCPTraceHeader), "stack", string(debug.Stack()))
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Trace sets a random trace ID in the GCPTraceHeader of the requests without one, the ones that don't come
+// through the load balancer of GCP, so the handlers and their logs always have one. The trace ID is returned in
+// the same header of the response.
+func Trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID := r.Header.Get(GCPTraceHeader)
+		if traceID == "" {
+			var err error
+			if traceID, err = storage.NewID(); err != nil {
+				slog.Error("error creating trace ID", "error", err)
+			}
+			r.Header.Set(GCPTraceHeader, traceID)
+		}
+		w.Header().Set(GCPTraceHeader, traceID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Logging logs each request with its method, path, status and duration.
+func Logging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if sw.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(r.Context(), level, "request served", "method", r.Method, "path", r.URL.Path, "status", sw.status,
+			"duration", time.Since(start).String(), "traceID", r.Header.Get(GCPTraceHeader))
+	})
+}
+
+// statusWriter keeps the status of the response, for the logs.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the original writer, so http.ResponseController flushes the streamed responses, like the
+// exports.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// corsHeaders are the request headers accepted from the browsers. UserIDHeader is not one of them, since it's
+// only set by the gateway.
+var corsHeaders = []string{"Authorization", "Content-Type", OrganizationIDHeader, GCPTraceHeader}
+
+// CORS allows the browsers of the origins to call the API, "*" allowing all of them. The preflight requests of
+// the allowed origins are answered without calling the handler.
+func CORS(origins []string) Middleware {
+	allowAll := slices.Contains(origins, "*")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" || (!allowAll && !slices.Contains(origins, origin)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", GCPTraceHeader)
+			if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(corsHeaders, ", "))
+			w.Header().Set("Access-Control-Max-Age", "3600")
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
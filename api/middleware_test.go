@@ -0,0 +1,202 @@
+package api_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/perebaj/esaj/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	middleware := func(name string) api.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := api.Chain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		order = append(order, "handler")
+	}), middleware("first"), middleware("second"))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, []string{"first", "second", "handler"}, order)
+}
+
+func TestRecovery(t *testing.T) {
+	h := api.Recovery(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	abort := api.Recovery(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		abort.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
+
+func TestTrace(t *testing.T) {
+	var got string
+	h := api.Trace(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(api.GCPTraceHeader)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.NotEmpty(t, got)
+	assert.Equal(t, got, w.Header().Get(api.GCPTraceHeader))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(api.GCPTraceHeader, "105445aa7843bc8bf206b12000100000/1;o=1")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, "105445aa7843bc8bf206b12000100000/1;o=1", got)
+	assert.Equal(t, got, w.Header().Get(api.GCPTraceHeader))
+}
+
+func TestLogging(t *testing.T) {
+	h := api.Logging(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusTeapot, w.Code)
+}
+
+func TestCORS(t *testing.T) {
+	var called bool
+	h := api.CORS([]string{"https://app.blup.com.br"})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/search", nil)
+	req.Header.Set("Origin", "https://app.blup.com.br")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.False(t, called, "the preflight must not reach the handler")
+	assert.Equal(t, "https://app.blup.com.br", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), api.OrganizationIDHeader)
+	assert.NotContains(t, w.Header().Get("Access-Control-Allow-Headers"), api.UserIDHeader)
+
+	req = httptest.NewRequest(http.MethodGet, "/search", nil)
+	req.Header.Set("Origin", "https://app.blup.com.br")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.True(t, called)
+	assert.Equal(t, "https://app.blup.com.br", w.Header().Get("Access-Control-Allow-Origin"))
+
+	req = httptest.NewRequest(http.MethodGet, "/search", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	all := api.CORS([]string{"*"})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	w = httptest.NewRecorder()
+	all.ServeHTTP(w, req)
+	assert.Equal(t, "https://evil.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+// newSessionToken returns a clerk session token of the user, signed by the key.
+func newSessionToken(t *testing.T, key *rsa.PrivateKey, userID string) string {
+	t.Helper()
+	claims, err := json.Marshal(map[string]any{"sub": userID, "exp": time.Now().Add(time.Minute).Unix()})
+	require.NoError(t, err)
+
+	signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestAuth(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var userID string
+	var called bool
+	h := api.Auth(api.AuthConfig{
+		ClerkKey:      &key.PublicKey,
+		GatewaySecret: "gateway-secret",
+		AdminToken:    "admin-token",
+		Public:        []string{"/clerk-webhook"},
+	})(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		called = true
+		userID = r.Header.Get(api.UserIDHeader)
+	}))
+
+	serve := func(path string, headers map[string]string) int {
+		called, userID = false, ""
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// the user ID comes from the session token, never from the client
+	require.Equal(t, 200, serve("/process-history", map[string]string{
+		"Authorization":  "Bearer " + newSessionToken(t, key, "user_1"),
+		api.UserIDHeader: "user_2",
+	}))
+	assert.Equal(t, "user_1", userID)
+
+	// a client that only sends the user ID is not authenticated
+	require.Equal(t, 401, serve("/process-history", map[string]string{api.UserIDHeader: "user_2"}))
+	assert.False(t, called)
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	require.Equal(t, 401, serve("/process-history", map[string]string{
+		"Authorization": "Bearer " + newSessionToken(t, other, "user_1"),
+	}))
+	assert.False(t, called)
+
+	// the gateway sets the user ID of the session it verified
+	require.Equal(t, 200, serve("/process-history", map[string]string{
+		api.GatewaySecretHeader: "gateway-secret",
+		api.UserIDHeader:        "user_2",
+	}))
+	assert.Equal(t, "user_2", userID)
+
+	require.Equal(t, 401, serve("/process-history", map[string]string{
+		api.GatewaySecretHeader: "wrong",
+		api.UserIDHeader:        "user_2",
+	}))
+
+	// the admins are passed to the handlers, that check the token, without a user ID
+	require.Equal(t, 200, serve("/privacy-export", map[string]string{
+		"Authorization":  "Bearer admin-token",
+		api.UserIDHeader: "user_2",
+	}))
+	assert.Empty(t, userID)
+
+	// the public paths are served without the user ID
+	require.Equal(t, 200, serve("/clerk-webhook", map[string]string{api.UserIDHeader: "user_2"}))
+	assert.True(t, called)
+	assert.Empty(t, userID)
+}
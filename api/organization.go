@@ -0,0 +1,430 @@
+// Package api organization.go has the handlers of the organizations: their OABs, set by the admins of the
+// platform since they give access to the processes, their members and their private annotations.
+//
+//go:generate mockgen -source organization.go -destination ../mock/organization_mock.go -package mock
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/tracing"
+)
+
+// maxAnnotationLength is the maximum number of characters of an annotation.
+const maxAnnotationLength = 10000
+
+// OrganizationStorage is an interface that defines the methods to deal with the organizations in the storage
+type OrganizationStorage interface {
+	SaveOrganization(ctx context.Context, o storage.Organization) error
+	GetOrganization(ctx context.Context, id string) (storage.Organization, error)
+	SaveMember(ctx context.Context, m storage.Member) error
+	GetMember(ctx context.Context, organizationID, userID string) (storage.Member, error)
+	RemoveMember(ctx context.Context, organizationID, userID string) error
+	Members(ctx context.Context, organizationID string) ([]storage.Member, error)
+	UserMemberships(ctx context.Context, userID string) ([]storage.Member, error)
+	SaveAnnotation(ctx context.Context, a storage.Annotation) error
+	GetAnnotation(ctx context.Context, organizationID, id string) (storage.Annotation, error)
+	DeleteAnnotation(ctx context.Context, organizationID, id string) error
+	Annotations(ctx context.Context, organizationID, processID string) ([]storage.Annotation, error)
+	ProcessOABs(ctx context.Context, processID string) ([]esaj.OAB, error)
+}
+
+// OrganizationHandler gather the handlers of the organizations
+type OrganizationHandler struct {
+	storage    OrganizationStorage
+	adminToken string
+	auditor    Auditor
+}
+
+// NewOrganizationHandler creates a new OrganizationHandler. The admin token is required to create the
+// organizations and to change their OABs, an empty one rejects these requests. The accesses to the annotations
+// are recorded by the auditor, a nil one records nothing.
+func NewOrganizationHandler(storage OrganizationStorage, adminToken string, auditor Auditor) OrganizationHandler {
+	return OrganizationHandler{
+		storage:    storage,
+		adminToken: adminToken,
+		auditor:    auditor,
+	}
+}
+
+// organizationRequest is the body of the requests that create or change an organization.
+type organizationRequest struct {
+	Name string   `json:"name"`
+	OABs []string `json:"oabs"`
+	// OwnerID is the clerk user ID of the first owner, only used when the organization is created.
+	OwnerID string `json:"owner_id"`
+}
+
+// OrganizationsHandler creates an organization with a POST, or changes the name and the OABs of the organization
+// of the id query parameter with a PUT. Both require the admin token as a bearer token.
+//
+// Example: POST / {"name": "Silva Advogados", "oabs": ["123456/SP"], "owner_id": "user_123"}
+func (h OrganizationHandler) OrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	traceID := r.Header.Get(GCPTraceHeader)
+	ctx := tracing.SetTraceIDInContext(r.Context(), traceID)
+	logger := slog.With("traceID", traceID)
+
+	if !isAdmin(r, h.adminToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		logger.Warn("unauthorized organization request", "path", r.URL.Path)
+		return
+	}
+
+	var body organizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	org := storage.Organization{Name: strings.TrimSpace(body.Name)}
+	if org.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	for _, raw := range body.OABs {
+		oab, err := esaj.ParseOAB(raw)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !org.HasOAB(oab) {
+			org.OABs = append(org.OABs, oab)
+		}
+	}
+	if len(org.OABs) > storage.MaxOrganizationOABs {
+		http.Error(w, fmt.Sprintf("at most %d oabs are allowed", storage.MaxOrganizationOABs), http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusOK
+	switch r.Method {
+	case http.MethodPost:
+		if body.OwnerID == "" {
+			http.Error(w, "owner_id is required", http.StatusBadRequest)
+			return
+		}
+		var err error
+		org.ID, err = storage.NewID()
+		if err != nil {
+			organizationError(w, logger, "error creating organization", err)
+			return
+		}
+		status = http.StatusCreated
+	case http.MethodPut:
+		org.ID = r.URL.Query().Get("id")
+		if org.ID == "" {
+			http.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+		if _, err := h.storage.GetOrganization(ctx, org.ID); err != nil {
+			organizationError(w, logger, "error getting organization", err)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := h.storage.SaveOrganization(ctx, org); err != nil {
+		organizationError(w, logger, "error saving organization", err)
+		return
+	}
+	if r.Method == http.MethodPost {
+		owner := storage.Member{OrganizationID: org.ID, UserID: body.OwnerID, Role: storage.RoleOwner}
+		if err := h.storage.SaveMember(ctx, owner); err != nil {
+			organizationError(w, logger, "error saving the owner of the organization", err)
+			return
+		}
+	}
+
+	org, err := h.storage.GetOrganization(ctx, org.ID)
+	if err != nil {
+		organizationError(w, logger, "error getting organization", err)
+		return
+	}
+	logger.Info("organization saved", "organization_id", org.ID, "oabs", len(org.OABs))
+	writeJSON(w, logger, status, org)
+}
+
+// MembershipsHandler returns the memberships of the caller, so it can choose the organization it acts for
+func (h OrganizationHandler) MembershipsHandler(w http.ResponseWriter, r *http.Request) {
+	traceID := r.Header.Get(GCPTraceHeader)
+	ctx := tracing.SetTraceIDInContext(r.Context(), traceID)
+	logger := slog.With("traceID", traceID)
+
+	userID := r.Header.Get(UserIDHeader)
+	if userID == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	memberships, err := h.storage.UserMemberships(ctx, userID)
+	if err != nil {
+		organizationError(w, logger, "error getting memberships", err)
+		return
+	}
+	if memberships == nil {
+		memberships = []storage.Member{}
+	}
+	writeJSON(w, logger, http.StatusOK, struct {
+		Memberships []storage.Member `json:"memberships"`
+	}{Memberships: memberships})
+}
+
+// CurrentOrganizationHandler returns the organization of the caller, with its members
+func (h OrganizationHandler) CurrentOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	traceID := r.Header.Get(GCPTraceHeader)
+	ctx := tracing.SetTraceIDInContext(r.Context(), traceID)
+	logger := slog.With("traceID", traceID)
+
+	org, _, ok := callerOrganization(ctx, w, r, h.storage, logger)
+	if !ok {
+		return
+	}
+
+	members, err := h.storage.Members(ctx, org.ID)
+	if err != nil {
+		organizationError(w, logger, "error getting members", err)
+		return
+	}
+	if org.OABs == nil {
+		org.OABs = []esaj.OAB{}
+	}
+	writeJSON(w, logger, http.StatusOK, struct {
+		storage.Organization
+		Members []storage.Member `json:"members"`
+	}{Organization: org, Members: members})
+}
+
+// MembersHandler adds a member to the organization of the caller, or changes its role, with a PUT of
+// {"user_id": ..., "role": ...}, and removes the member of the user_id query parameter with a DELETE.
+// Only the owners and the admins manage the members, only the owners manage the other owners, and any member
+// can leave. The last owner can't be removed or demoted.
+func (h OrganizationHandler) MembersHandler(w http.ResponseWriter, r *http.Request) {
+	traceID := r.Header.Get(GCPTraceHeader)
+	ctx := tracing.SetTraceIDInContext(r.Context(), traceID)
+	logger := slog.With("traceID", traceID)
+
+	org, caller, ok := callerOrganization(ctx, w, r, h.storage, logger)
+	if !ok {
+		return
+	}
+
+	var target storage.Member
+	switch r.Method {
+	case http.MethodPut:
+		if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if target.UserID == "" || !storage.ValidRole(target.Role) {
+			http.Error(w, "user_id and a role of owner, admin or member are required", http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		target.UserID = r.URL.Query().Get("user_id")
+		if target.UserID == "" {
+			http.Error(w, "user_id is required", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	target.OrganizationID = org.ID
+
+	existing, err := h.storage.GetMember(ctx, org.ID, target.UserID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		organizationError(w, logger, "error getting member", err)
+		return
+	}
+	leaving := r.Method == http.MethodDelete && target.UserID == caller.UserID
+	touchesOwner := existing.Role == storage.RoleOwner || target.Role == storage.RoleOwner
+	if !leaving && (!caller.CanManage() || (touchesOwner && caller.Role != storage.RoleOwner)) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if existing.Role == storage.RoleOwner && target.Role != storage.RoleOwner {
+		if !h.checkOwners(ctx, w, org.ID, logger) {
+			return
+		}
+	}
+
+	if r.Method == http.MethodDelete {
+		err = h.storage.RemoveMember(ctx, org.ID, target.UserID)
+	} else {
+		err = h.storage.SaveMember(ctx, target)
+	}
+	if err != nil {
+		organizationError(w, logger, "error saving member", err)
+		return
+	}
+	logger.Info("member changed", "organization_id", org.ID, "user_id", target.UserID, "role", target.Role,
+		"by", caller.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkOwners writes the error and returns false when the organization has a single owner, that can't be
+// removed or demoted.
+func (h OrganizationHandler) checkOwners(ctx context.Context, w http.ResponseWriter, orgID string, logger *slog.Logger) bool {
+	members, err := h.storage.Members(ctx, orgID)
+	if err != nil {
+		organizationError(w, logger, "error getting members", err)
+		return false
+	}
+	owners := 0
+	for _, m := range members {
+		if m.Role == storage.RoleOwner {
+			owners++
+		}
+	}
+	if owners < 2 {
+		http.Error(w, "the organization must keep an owner", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// AnnotationsHandler manages the private annotations of the organization of the caller:
+//   - GET ?process_id=...: the annotations on the process, from the oldest to the newest
+//   - POST {"process_id": ..., "text": ...}: creates an annotation on the process
+//   - PUT {"id": ..., "text": ...}: changes the text of an annotation, only by its author
+//   - DELETE ?id=...: removes an annotation, by its author, an admin or an owner
+//
+// The annotations are only seen by the organization that wrote them, even when the process is also found by an
+// OAB of another organization.
+func (h OrganizationHandler) AnnotationsHandler(w http.ResponseWriter, r *http.Request) {
+	traceID := r.Header.Get(GCPTraceHeader)
+	ctx := tracing.SetTraceIDInContext(r.Context(), traceID)
+	logger := slog.With("traceID", traceID)
+
+	org, caller, ok := callerOrganization(ctx, w, r, h.storage, logger)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		processID := r.URL.Query().Get("process_id")
+		if processID == "" {
+			http.Error(w, "process_id is required", http.StatusBadRequest)
+			return
+		}
+		if !checkProcess(ctx, w, h.storage, org, processID, logger) {
+			return
+		}
+		recordAccess(ctx, h.auditor, r, org.ID, storage.AccessRead, storage.ProcessResource(processID))
+		annotations, err := h.storage.Annotations(ctx, org.ID, processID)
+		if err != nil {
+			organizationError(w, logger, "error getting annotations", err)
+			return
+		}
+		if annotations == nil {
+			annotations = []storage.Annotation{}
+		}
+		writeJSON(w, logger, http.StatusOK, struct {
+			Annotations []storage.Annotation `json:"annotations"`
+		}{Annotations: annotations})
+
+	case http.MethodPost, http.MethodPut:
+		var body storage.Annotation
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		text := strings.TrimSpace(body.Text)
+		if text == "" || utf8.RuneCountInString(text) > maxAnnotationLength {
+			http.Error(w, "text must have between 1 and 10000 characters", http.StatusBadRequest)
+			return
+		}
+
+		var a storage.Annotation
+		status := http.StatusOK
+		if r.Method == http.MethodPost {
+			if body.ProcessID == "" {
+				http.Error(w, "process_id is required", http.StatusBadRequest)
+				return
+			}
+			if !checkProcess(ctx, w, h.storage, org, body.ProcessID, logger) {
+				return
+			}
+			id, err := storage.NewID()
+			if err != nil {
+				organizationError(w, logger, "error creating annotation", err)
+				return
+			}
+			a = storage.Annotation{ID: id, OrganizationID: org.ID, ProcessID: body.ProcessID, AuthorID: caller.UserID}
+			status = http.StatusCreated
+		} else {
+			if body.ID == "" {
+				http.Error(w, "id is required", http.StatusBadRequest)
+				return
+			}
+			var err error
+			a, err = h.storage.GetAnnotation(ctx, org.ID, body.ID)
+			if err != nil {
+				organizationError(w, logger, "error getting annotation", err)
+				return
+			}
+			if a.AuthorID != caller.UserID {
+				http.Error(w, "only the author changes the annotation", http.StatusForbidden)
+				return
+			}
+		}
+		a.Text = text
+		recordAccess(ctx, h.auditor, r, org.ID, storage.AccessWrite, storage.ProcessResource(a.ProcessID))
+
+		if err := h.storage.SaveAnnotation(ctx, a); err != nil {
+			organizationError(w, logger, "error saving annotation", err)
+			return
+		}
+		a, err := h.storage.GetAnnotation(ctx, org.ID, a.ID)
+		if err != nil {
+			organizationError(w, logger, "error getting annotation", err)
+			return
+		}
+		writeJSON(w, logger, status, a)
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+		a, err := h.storage.GetAnnotation(ctx, org.ID, id)
+		if err != nil {
+			organizationError(w, logger, "error getting annotation", err)
+			return
+		}
+		if a.AuthorID != caller.UserID && !caller.CanManage() {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		recordAccess(ctx, h.auditor, r, org.ID, storage.AccessWrite, storage.ProcessResource(a.ProcessID))
+		if err := h.storage.DeleteAnnotation(ctx, org.ID, id); err != nil {
+			organizationError(w, logger, "error deleting annotation", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func organizationError(w http.ResponseWriter, logger *slog.Logger, msg string, err error) {
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+	logger.Error(msg, "error", err)
+}
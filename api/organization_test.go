@@ -0,0 +1,238 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/perebaj/esaj/api"
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/mock"
+	"github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func memberRequest(method, target, body, orgID, userID string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(api.UserIDHeader, userID)
+	req.Header.Set(api.OrganizationIDHeader, orgID)
+	return req
+}
+
+// newFirms saves two firms that share the OAB 123/SP through co-counsel, each one with an owner, and the
+// process 1 found by the shared OAB.
+func newFirms(t *testing.T) *memory.Storage {
+	ctx := context.Background()
+	s := memory.NewStorage()
+	shared := esaj.MustParseOAB("123")
+	for _, org := range []storage.Organization{
+		{ID: "silva", Name: "Silva Advogados", OABs: []esaj.OAB{shared, esaj.MustParseOAB("456")}},
+		{ID: "souza", Name: "Souza Advogados", OABs: []esaj.OAB{shared}},
+	} {
+		require.NoError(t, s.SaveOrganization(ctx, org))
+		require.NoError(t, s.SaveMember(ctx, storage.Member{OrganizationID: org.ID, UserID: org.ID + "_owner", Role: storage.RoleOwner}))
+	}
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{ProcessID: "1", OAB: shared}))
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{ProcessID: "2", OAB: esaj.MustParseOAB("456")}))
+	return s
+}
+
+func TestOrganizationHandler_OrganizationsHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mock.NewMockOrganizationStorage(ctrl)
+	h := api.NewOrganizationHandler(storageMock, "admin-token", nil)
+
+	// only the admins of the platform set the OABs
+	req := memberRequest("POST", "/", `{"name": "Silva", "oabs": ["123"], "owner_id": "u1"}`, "silva", "u1")
+	w := httptest.NewRecorder()
+	h.OrganizationsHandler(w, req)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	var saved storage.Organization
+	storageMock.EXPECT().SaveOrganization(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, o storage.Organization) error {
+			saved = o
+			return nil
+		})
+	storageMock.EXPECT().SaveMember(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, m storage.Member) error {
+			assert.Equal(t, saved.ID, m.OrganizationID)
+			assert.Equal(t, "u1", m.UserID)
+			assert.Equal(t, storage.RoleOwner, m.Role)
+			return nil
+		})
+	storageMock.EXPECT().GetOrganization(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, id string) (storage.Organization, error) {
+			return saved, nil
+		})
+
+	w = httptest.NewRecorder()
+	h.OrganizationsHandler(w, adminRequest("POST", "/", `{"name": " Silva ", "oabs": ["123", "123/SP", "456/RJ"], "owner_id": "u1"}`))
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var got storage.Organization
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	assert.NotEmpty(t, got.ID)
+	assert.Equal(t, "Silva", got.Name)
+	assert.Equal(t, []esaj.OAB{esaj.MustParseOAB("123"), esaj.MustParseOAB("456/RJ")}, got.OABs)
+
+	// the organization to change must exist
+	storageMock.EXPECT().GetOrganization(gomock.Any(), "missing").Return(storage.Organization{}, storage.ErrNotFound)
+	w = httptest.NewRecorder()
+	h.OrganizationsHandler(w, adminRequest("PUT", "/?id=missing", `{"name": "Silva"}`))
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	tooMany := make([]string, 0, storage.MaxOrganizationOABs+1)
+	for i := 0; i <= storage.MaxOrganizationOABs; i++ {
+		tooMany = append(tooMany, fmt.Sprintf(`"%d/SP"`, i+1))
+	}
+	for _, body := range []string{
+		`{"oabs": ["123"], "owner_id": "u1"}`,
+		`{"name": "Silva", "oabs": ["abc"], "owner_id": "u1"}`,
+		`{"name": "Silva"}`,
+		`{"name": "Silva", "oabs": [` + strings.Join(tooMany, ", ") + `], "owner_id": "u1"}`,
+	} {
+		w = httptest.NewRecorder()
+		h.OrganizationsHandler(w, adminRequest("POST", "/", body))
+		require.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+func TestOrganizationHandler_MembersHandler(t *testing.T) {
+	s := newFirms(t)
+	h := api.NewOrganizationHandler(s, "", nil)
+	ctx := context.Background()
+
+	put := func(caller, body string) int {
+		w := httptest.NewRecorder()
+		h.MembersHandler(w, memberRequest("PUT", "/", body, "silva", caller))
+		return w.Code
+	}
+	remove := func(caller, userID string) int {
+		w := httptest.NewRecorder()
+		h.MembersHandler(w, memberRequest("DELETE", "/?user_id="+userID, "", "silva", caller))
+		return w.Code
+	}
+
+	// the owner adds an admin, that adds a member
+	require.Equal(t, http.StatusNoContent, put("silva_owner", `{"user_id": "admin", "role": "admin"}`))
+	require.Equal(t, http.StatusNoContent, put("admin", `{"user_id": "member", "role": "member"}`))
+	require.Equal(t, http.StatusBadRequest, put("admin", `{"user_id": "other", "role": "boss"}`))
+
+	// the members don't manage the members, and the admins don't manage the owners
+	require.Equal(t, http.StatusForbidden, put("member", `{"user_id": "other", "role": "member"}`))
+	require.Equal(t, http.StatusForbidden, put("admin", `{"user_id": "member", "role": "owner"}`))
+	require.Equal(t, http.StatusForbidden, remove("admin", "silva_owner"))
+
+	// the owner of another firm is not a member
+	w := httptest.NewRecorder()
+	h.MembersHandler(w, memberRequest("PUT", "/", `{"user_id": "x", "role": "member"}`, "silva", "souza_owner"))
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	// the last owner can't leave, until there is another one
+	require.Equal(t, http.StatusConflict, remove("silva_owner", "silva_owner"))
+	require.Equal(t, http.StatusConflict, put("silva_owner", `{"user_id": "silva_owner", "role": "admin"}`))
+	require.Equal(t, http.StatusNoContent, put("silva_owner", `{"user_id": "admin", "role": "owner"}`))
+	require.Equal(t, http.StatusNoContent, remove("silva_owner", "silva_owner"))
+
+	// any member can leave
+	require.Equal(t, http.StatusNoContent, remove("member", "member"))
+	require.Equal(t, http.StatusNotFound, remove("admin", "member"))
+
+	members, err := s.Members(ctx, "silva")
+	require.NoError(t, err)
+	require.Len(t, members, 1)
+	assert.Equal(t, "admin", members[0].UserID)
+	assert.Equal(t, storage.RoleOwner, members[0].Role)
+
+	w = httptest.NewRecorder()
+	h.CurrentOrganizationHandler(w, memberRequest("GET", "/", "", "silva", "admin"))
+	require.Equal(t, http.StatusOK, w.Code)
+	var got struct {
+		storage.Organization
+		Members []storage.Member `json:"members"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	assert.Equal(t, "Silva Advogados", got.Name)
+	assert.Len(t, got.OABs, 2)
+	assert.Len(t, got.Members, 1)
+
+	w = httptest.NewRecorder()
+	h.MembershipsHandler(w, memberRequest("GET", "/", "", "", "admin"))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"organization_id":"silva"`)
+}
+
+func TestOrganizationHandler_AnnotationsHandler(t *testing.T) {
+	s := newFirms(t)
+	h := api.NewOrganizationHandler(s, "", nil)
+	require.NoError(t, s.SaveMember(context.Background(), storage.Member{OrganizationID: "silva", UserID: "member", Role: storage.RoleMember}))
+
+	annotate := func(method, target, body, orgID, userID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.AnnotationsHandler(w, memberRequest(method, target, body, orgID, userID))
+		return w
+	}
+	list := func(orgID, userID string) []storage.Annotation {
+		w := annotate("GET", "/?process_id=1", "", orgID, userID)
+		require.Equal(t, http.StatusOK, w.Code)
+		var got struct {
+			Annotations []storage.Annotation `json:"annotations"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+		return got.Annotations
+	}
+
+	// both firms annotate the shared process
+	w := annotate("POST", "/", `{"process_id": "1", "text": "prazo em 15 dias"}`, "silva", "member")
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created storage.Annotation
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, "member", created.AuthorID)
+	assert.Equal(t, "silva", created.OrganizationID)
+
+	w = annotate("POST", "/", `{"process_id": "1", "text": "estratégia"}`, "souza", "souza_owner")
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	// and only see their own annotations
+	silva := list("silva", "silva_owner")
+	require.Len(t, silva, 1)
+	assert.Equal(t, "prazo em 15 dias", silva[0].Text)
+	souza := list("souza", "souza_owner")
+	require.Len(t, souza, 1)
+	assert.Equal(t, "estratégia", souza[0].Text)
+
+	// the annotations of the other firm are not found by their ID
+	w = annotate("DELETE", "/?id="+souza[0].ID, "", "silva", "silva_owner")
+	require.Equal(t, http.StatusNotFound, w.Code)
+	w = annotate("PUT", "/", `{"id": "`+souza[0].ID+`", "text": "x"}`, "silva", "silva_owner")
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	// the process of an OAB of the other firm is not found
+	w = annotate("POST", "/", `{"process_id": "2", "text": "x"}`, "souza", "souza_owner")
+	require.Equal(t, http.StatusNotFound, w.Code)
+	w = annotate("GET", "/?process_id=2", "", "souza", "souza_owner")
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	// only the author edits, and the admins and owners delete
+	w = annotate("PUT", "/", `{"id": "`+created.ID+`", "text": "prazo em 10 dias"}`, "silva", "silva_owner")
+	require.Equal(t, http.StatusForbidden, w.Code)
+	w = annotate("PUT", "/", `{"id": "`+created.ID+`", "text": "prazo em 10 dias"}`, "silva", "member")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "prazo em 10 dias", list("silva", "member")[0].Text)
+
+	w = annotate("POST", "/", `{"process_id": "1", "text": "  "}`, "silva", "member")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = annotate("DELETE", "/?id="+created.ID, "", "silva", "silva_owner")
+	require.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, list("silva", "member"))
+	assert.Len(t, list("souza", "souza_owner"), 1)
+}
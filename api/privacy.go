@@ -0,0 +1,178 @@
+// Package api privacy.go has the admin handlers of the LGPD operations: the export of a user, the purge of the
+// deleted users, the anonymization of a party and the audit of these operations.
+//
+//go:generate mockgen -source privacy.go -destination ../mock/privacy_mock.go -package mock
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/perebaj/esaj/lgpd"
+	"github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/tracing"
+)
+
+// PrivacyService is an interface that defines the LGPD operations, implemented by lgpd.Service
+type PrivacyService interface {
+	Export(ctx context.Context, actor, userID string) (storage.UserExport, error)
+	Purge(ctx context.Context, actor string, grace time.Duration) ([]string, error)
+	Anonymize(ctx context.Context, actor, name string) ([]string, error)
+	Audits(ctx context.Context, subject string) ([]storage.PrivacyAudit, error)
+}
+
+// PrivacyHandler gather the admin handlers of the LGPD operations. All of them require the admin token as a
+// bearer token.
+type PrivacyHandler struct {
+	service    PrivacyService
+	adminToken string
+	auditor    Auditor
+}
+
+// NewPrivacyHandler creates a new PrivacyHandler. An empty admin token rejects all requests. The processes changed
+// by the anonymizations are recorded by the auditor, a nil one records nothing.
+func NewPrivacyHandler(service PrivacyService, adminToken string, auditor Auditor) PrivacyHandler {
+	return PrivacyHandler{
+		service:    service,
+		adminToken: adminToken,
+		auditor:    auditor,
+	}
+}
+
+// ExportUserHandler returns all the data tied to a user, for the user_id and actor query parameters
+func (h PrivacyHandler) ExportUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, logger, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	export, err := h.service.Export(ctx, query.Get("actor"), query.Get("user_id"))
+	if err != nil {
+		privacyError(w, logger, "error exporting user", err)
+		return
+	}
+	writeJSON(w, logger, http.StatusOK, export)
+}
+
+// PurgeUsersHandler removes the users deleted more than the grace_period query parameter ago, 720h by default
+func (h PrivacyHandler) PurgeUsersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, logger, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	grace := lgpd.DefaultGracePeriod
+	if v := query.Get("grace_period"); v != "" {
+		var err error
+		grace, err = time.ParseDuration(v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid grace_period %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	purged, err := h.service.Purge(ctx, query.Get("actor"), grace)
+	if err != nil {
+		privacyError(w, logger, "error purging users", err)
+		return
+	}
+	if purged == nil {
+		purged = []string{}
+	}
+	writeJSON(w, logger, http.StatusOK, struct {
+		Purged []string `json:"purged"`
+	}{Purged: purged})
+}
+
+// AnonymizePartyHandler replaces a party name in the saved processes, from a {"name": ..., "actor": ...} body
+func (h PrivacyHandler) AnonymizePartyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, logger, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Name  string `json:"name"`
+		Actor string `json:"actor"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	changed, err := h.service.Anonymize(ctx, body.Actor, body.Name)
+	if err != nil {
+		privacyError(w, logger, "error anonymizing party", err)
+		return
+	}
+	if h.auditor != nil {
+		// the admins of the platform act for no organization, and are identified by the actor
+		for _, processID := range changed {
+			h.auditor.Record(ctx, storage.AccessEvent{
+				UserID:   body.Actor,
+				Action:   storage.AccessWrite,
+				Resource: storage.ProcessResource(processID),
+			})
+		}
+	}
+	if changed == nil {
+		changed = []string{}
+	}
+	writeJSON(w, logger, http.StatusOK, struct {
+		Processes []string `json:"processes"`
+	}{Processes: changed})
+}
+
+// PrivacyAuditHandler returns the audit records of the subject query parameter, or all of them
+func (h PrivacyHandler) PrivacyAuditHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, logger, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	audits, err := h.service.Audits(ctx, r.URL.Query().Get("subject"))
+	if err != nil {
+		privacyError(w, logger, "error getting audits", err)
+		return
+	}
+	if audits == nil {
+		audits = []storage.PrivacyAudit{}
+	}
+	writeJSON(w, logger, http.StatusOK, struct {
+		Audits []storage.PrivacyAudit `json:"audits"`
+	}{Audits: audits})
+}
+
+// authorize checks the admin token of the request, writing the error when it's not authorized. It returns the
+// context with the trace ID and its logger.
+func (h PrivacyHandler) authorize(w http.ResponseWriter, r *http.Request) (context.Context, *slog.Logger, bool) {
+	traceID := r.Header.Get(GCPTraceHeader)
+	ctx := tracing.SetTraceIDInContext(r.Context(), traceID)
+	logger := slog.With("traceID", traceID)
+
+	if !isAdmin(r, h.adminToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		logger.Warn("unauthorized privacy request", "path", r.URL.Path)
+		return nil, nil, false
+	}
+	return ctx, logger, true
+}
+
+func privacyError(w http.ResponseWriter, logger *slog.Logger, msg string, err error) {
+	switch {
+	case errors.Is(err, lgpd.ErrInvalidRequest):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error(msg, "error", err)
+	}
+}
@@ -0,0 +1,154 @@
+package api_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perebaj/esaj/api"
+	"github.com/perebaj/esaj/lgpd"
+	"github.com/perebaj/esaj/mock"
+	"github.com/perebaj/esaj/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func adminRequest(method, target, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin-token")
+	return req
+}
+
+func TestPrivacyHandler_unauthorized(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	serviceMock := mock.NewMockPrivacyService(ctrl)
+
+	for _, tt := range []struct {
+		token  string
+		header string
+	}{
+		{token: "admin-token", header: ""},
+		{token: "admin-token", header: "Bearer other"},
+		{token: "admin-token", header: "admin-token"},
+		// an empty token rejects all requests
+		{token: "", header: "Bearer "},
+	} {
+		req := httptest.NewRequest("GET", "/?user_id=123&actor=admin", nil)
+		req.Header.Set("Authorization", tt.header)
+		w := httptest.NewRecorder()
+
+		api.NewPrivacyHandler(serviceMock, tt.token, nil).ExportUserHandler(w, req)
+		require.Equal(t, http.StatusUnauthorized, w.Code, tt.header)
+	}
+}
+
+func TestPrivacyHandler_ExportUserHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	serviceMock := mock.NewMockPrivacyService(ctrl)
+
+	serviceMock.EXPECT().Export(gomock.Any(), "admin", "123").Return(storage.UserExport{
+		User:          storage.User{ID: "123", FirstName: "John"},
+		MovementReads: []storage.MovementRead{{ProcessID: "1", MovementID: "a"}},
+	}, nil)
+	serviceMock.EXPECT().Export(gomock.Any(), "admin", "456").
+		Return(storage.UserExport{}, fmt.Errorf("error exporting user 456: %w", storage.ErrNotFound))
+	serviceMock.EXPECT().Export(gomock.Any(), "", "123").
+		Return(storage.UserExport{}, fmt.Errorf("%w: actor and user_id are required", lgpd.ErrInvalidRequest))
+
+	handler := api.NewPrivacyHandler(serviceMock, "admin-token", nil)
+
+	w := httptest.NewRecorder()
+	handler.ExportUserHandler(w, adminRequest("GET", "/?user_id=123&actor=admin", ""))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var export storage.UserExport
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&export))
+	assert.Equal(t, "John", export.User.FirstName)
+	require.Len(t, export.MovementReads, 1)
+	assert.Equal(t, "a", export.MovementReads[0].MovementID)
+
+	w = httptest.NewRecorder()
+	handler.ExportUserHandler(w, adminRequest("GET", "/?user_id=456&actor=admin", ""))
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ExportUserHandler(w, adminRequest("GET", "/?user_id=123", ""))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPrivacyHandler_PurgeUsersHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	serviceMock := mock.NewMockPrivacyService(ctrl)
+
+	serviceMock.EXPECT().Purge(gomock.Any(), "admin", lgpd.DefaultGracePeriod).Return(nil, nil)
+	serviceMock.EXPECT().Purge(gomock.Any(), "admin", 48*time.Hour).Return([]string{"123"}, nil)
+	serviceMock.EXPECT().Purge(gomock.Any(), "admin", time.Hour).Return(nil, errors.New("error purging"))
+
+	handler := api.NewPrivacyHandler(serviceMock, "admin-token", nil)
+
+	w := httptest.NewRecorder()
+	handler.PurgeUsersHandler(w, adminRequest("POST", "/?actor=admin", ""))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"purged": []}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.PurgeUsersHandler(w, adminRequest("POST", "/?actor=admin&grace_period=48h", ""))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"purged": ["123"]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.PurgeUsersHandler(w, adminRequest("POST", "/?actor=admin&grace_period=30d", ""))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.PurgeUsersHandler(w, adminRequest("POST", "/?actor=admin&grace_period=1h", ""))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestPrivacyHandler_AnonymizePartyHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	serviceMock := mock.NewMockPrivacyService(ctrl)
+
+	serviceMock.EXPECT().Anonymize(gomock.Any(), "dpo", "José da Silva").Return([]string{"1", "2"}, nil)
+
+	handler := api.NewPrivacyHandler(serviceMock, "admin-token", nil)
+
+	w := httptest.NewRecorder()
+	handler.AnonymizePartyHandler(w, adminRequest("POST", "/", `{"name": "José da Silva", "actor": "dpo"}`))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"processes": ["1", "2"]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.AnonymizePartyHandler(w, adminRequest("POST", "/", `{"name":`))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPrivacyHandler_PrivacyAuditHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	serviceMock := mock.NewMockPrivacyService(ctrl)
+
+	createdAt := time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)
+	serviceMock.EXPECT().Audits(gomock.Any(), "123").Return([]storage.PrivacyAudit{
+		{ID: "a", Operation: storage.PrivacyExport, Subject: "123", Actor: "admin", Records: []string{}, CreatedAt: createdAt},
+	}, nil)
+	serviceMock.EXPECT().Audits(gomock.Any(), "").Return(nil, nil)
+
+	handler := api.NewPrivacyHandler(serviceMock, "admin-token", nil)
+
+	w := httptest.NewRecorder()
+	handler.PrivacyAuditHandler(w, adminRequest("GET", "/?subject=123", ""))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"audits": [{"id": "a", "operation": "export", "subject": "123", "actor": "admin",
+		"records": [], "created_at": "2024-08-01T00:00:00Z", "trace_id": ""}]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.PrivacyAuditHandler(w, adminRequest("GET", "/", ""))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"audits": []}`, w.Body.String())
+}
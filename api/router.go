@@ -0,0 +1,57 @@
+// Package api router.go mounts all the handlers on a single router, to serve the API out of the Cloud Functions.
+package api
+
+import "net/http"
+
+// Handlers gather the handlers served by NewRouter.
+type Handlers struct {
+	Processes     Handler
+	Users         UserHandler
+	Privacy       PrivacyHandler
+	Organizations OrganizationHandler
+	Audit         AuditHandler
+}
+
+// NewRouter returns the router that serves each handler at the name of its Cloud Function, without the fn-
+// prefix, and only for the methods it accepts. The other methods are answered with 405.
+//
+// Example: GET /process-history?process_id=123, served by fn-process-history
+func NewRouter(h Handlers) *http.ServeMux {
+	routes := []struct {
+		methods []string
+		path    string
+		handler http.HandlerFunc
+	}{
+		{[]string{"POST"}, "/process-seeder", h.Processes.OabSeederHandler},
+		{[]string{"GET", "POST"}, "/processes-by-oab", h.Processes.ProcessesByOABHandler},
+		{[]string{"GET"}, "/process-history", h.Processes.ProcessHistoryHandler},
+		{[]string{"GET"}, "/processes-page", h.Processes.ProcessesPageHandler},
+		{[]string{"GET"}, "/seeds-page", h.Processes.SeedsPageHandler},
+		{[]string{"GET"}, "/search", h.Processes.SearchHandler},
+
+		{[]string{"POST"}, "/clerk-webhook", h.Users.ClerkWebHookHandler},
+		{[]string{"GET"}, "/get-user", h.Users.GetUserHandler},
+
+		{[]string{"GET"}, "/privacy-export", h.Privacy.ExportUserHandler},
+		{[]string{"POST"}, "/privacy-purge", h.Privacy.PurgeUsersHandler},
+		{[]string{"POST"}, "/privacy-anonymize", h.Privacy.AnonymizePartyHandler},
+		{[]string{"GET"}, "/privacy-audit", h.Privacy.PrivacyAuditHandler},
+
+		{[]string{"POST", "PUT"}, "/organizations", h.Organizations.OrganizationsHandler},
+		{[]string{"GET"}, "/memberships", h.Organizations.MembershipsHandler},
+		{[]string{"GET"}, "/organization", h.Organizations.CurrentOrganizationHandler},
+		{[]string{"PUT", "DELETE"}, "/organization-members", h.Organizations.MembersHandler},
+		{[]string{"GET", "POST", "PUT", "DELETE"}, "/annotations", h.Organizations.AnnotationsHandler},
+
+		{[]string{"GET"}, "/access-events", h.Audit.AccessEventsHandler},
+		{[]string{"GET"}, "/access-events-export", h.Audit.AccessExportHandler},
+	}
+
+	mux := http.NewServeMux()
+	for _, route := range routes {
+		for _, method := range route.methods {
+			mux.HandleFunc(method+" "+route.path, route.handler)
+		}
+	}
+	return mux
+}
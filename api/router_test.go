@@ -0,0 +1,80 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/perebaj/esaj/api"
+	"github.com/perebaj/esaj/lgpd"
+	"github.com/perebaj/esaj/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRouter() *http.ServeMux {
+	s := memory.NewStorage()
+	return api.NewRouter(api.Handlers{
+		Processes:     api.NewHandler(s, nil, nil),
+		Users:         api.NewUserHandler(s, "", ""),
+		Privacy:       api.NewPrivacyHandler(lgpd.NewService(s), "", nil),
+		Organizations: api.NewOrganizationHandler(s, "", nil),
+		Audit:         api.NewAuditHandler(s, ""),
+	})
+}
+
+func TestNewRouter(t *testing.T) {
+	router := newRouter()
+
+	for _, route := range []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/process-seeder"},
+		{http.MethodGet, "/processes-by-oab"},
+		{http.MethodPost, "/processes-by-oab"},
+		{http.MethodGet, "/process-history"},
+		{http.MethodGet, "/processes-page"},
+		{http.MethodGet, "/seeds-page"},
+		{http.MethodGet, "/search"},
+		{http.MethodPost, "/clerk-webhook"},
+		{http.MethodGet, "/get-user"},
+		{http.MethodGet, "/privacy-export"},
+		{http.MethodPost, "/privacy-purge"},
+		{http.MethodPost, "/privacy-anonymize"},
+		{http.MethodGet, "/privacy-audit"},
+		{http.MethodPost, "/organizations"},
+		{http.MethodPut, "/organizations"},
+		{http.MethodGet, "/memberships"},
+		{http.MethodGet, "/organization"},
+		{http.MethodPut, "/organization-members"},
+		{http.MethodDelete, "/organization-members"},
+		{http.MethodGet, "/annotations"},
+		{http.MethodPost, "/annotations"},
+		{http.MethodPut, "/annotations"},
+		{http.MethodDelete, "/annotations"},
+		{http.MethodGet, "/access-events"},
+		{http.MethodGet, "/access-events-export"},
+	} {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(route.method, route.path, nil))
+
+			// the requests are not valid, but they reach the handler
+			assert.NotEqual(t, http.StatusNotFound, w.Code)
+			assert.NotEqual(t, http.StatusMethodNotAllowed, w.Code)
+		})
+	}
+}
+
+func TestNewRouter_notAllowed(t *testing.T) {
+	router := newRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/process-history", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Contains(t, w.Header().Get("Allow"), http.MethodGet)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fn-process-history", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,96 @@
+// Package api scope.go resolves the organization of the caller, that scopes the requests to the OABs it owns.
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/storage"
+)
+
+const (
+	// UserIDHeader is the clerk user ID of the caller. It's set by the gateway, that verifies the clerk session
+	// before forwarding the request, or by the Auth middleware, and must not be accepted from the clients.
+	UserIDHeader = "X-User-ID"
+	// OrganizationIDHeader is the organization the caller acts for, since a user may be a member of many.
+	OrganizationIDHeader = "X-Organization-ID"
+)
+
+// scopeStorage reads the organizations, their members and the OABs of the processes. It's implemented by
+// Storage and OrganizationStorage.
+type scopeStorage interface {
+	GetOrganization(ctx context.Context, id string) (storage.Organization, error)
+	GetMember(ctx context.Context, organizationID, userID string) (storage.Member, error)
+	ProcessOABs(ctx context.Context, processID string) ([]esaj.OAB, error)
+}
+
+// callerOrganization returns the organization of the request and the membership of its caller. It writes the
+// error and returns false when the caller is not identified or is not a member of the organization.
+func callerOrganization(ctx context.Context, w http.ResponseWriter, r *http.Request, s scopeStorage,
+	logger *slog.Logger) (storage.Organization, storage.Member, bool) {
+	userID := r.Header.Get(UserIDHeader)
+	if userID == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return storage.Organization{}, storage.Member{}, false
+	}
+	orgID := r.Header.Get(OrganizationIDHeader)
+	if orgID == "" {
+		http.Error(w, OrganizationIDHeader+" is required", http.StatusBadRequest)
+		return storage.Organization{}, storage.Member{}, false
+	}
+
+	member, err := s.GetMember(ctx, orgID, userID)
+	if err == nil {
+		var org storage.Organization
+		org, err = s.GetOrganization(ctx, orgID)
+		if err == nil {
+			return org, member, true
+		}
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		logger.Warn("caller is not a member of the organization", "user_id", userID, "organization_id", orgID)
+	} else {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error("error getting the organization of the caller", "error", err, "organization_id", orgID)
+	}
+	return storage.Organization{}, storage.Member{}, false
+}
+
+// isAdmin reports whether the request has the admin token as its bearer token. An empty admin token rejects all
+// requests.
+func isAdmin(r *http.Request, adminToken string) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return adminToken != "" && found && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// checkOAB writes the error and returns false when the OAB is not owned by the organization.
+func checkOAB(w http.ResponseWriter, org storage.Organization, oab esaj.OAB) bool {
+	if !org.HasOAB(oab) {
+		http.Error(w, "oab "+oab.String()+" is not owned by the organization", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// checkProcess writes the error and returns false when the process is not found by any OAB owned by the
+// organization. The processes of the other organizations are not found, so their IDs are not disclosed.
+func checkProcess(ctx context.Context, w http.ResponseWriter, s scopeStorage, org storage.Organization,
+	processID string, logger *slog.Logger) bool {
+	oabs, err := s.ProcessOABs(ctx, processID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error("error getting the OABs of the process", "error", err, "process_id", processID)
+		return false
+	}
+	if !org.HasAnyOAB(oabs) {
+		http.Error(w, "process "+processID+" not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
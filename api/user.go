@@ -7,11 +7,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/perebaj/esaj/clerk"
-	"github.com/perebaj/esaj/firestore"
+	"github.com/perebaj/esaj/storage"
 	"github.com/perebaj/esaj/tracing"
 )
 
@@ -19,22 +21,32 @@ import (
 type UserStorage interface {
 	SaveUser(ctx context.Context, user clerk.WebHookEvent) error
 	DeleteUser(ctx context.Context, user clerk.WebHookEvent) error
-	GetUser(ctx context.Context, userID string) (firestore.User, error)
+	GetUser(ctx context.Context, userID string) (storage.User, error)
 }
 
+// maxWebhookSize is the largest body of a clerk webhook that is read.
+const maxWebhookSize = 1 << 20
+
 // UserHandler gather third party services to create an user
 type UserHandler struct {
-	storage UserStorage
+	storage       UserStorage
+	webhookSecret string
+	adminToken    string
 }
 
-// NewUserHandler creates a new UserHandler to deal with user management
-func NewUserHandler(storage UserStorage) UserHandler {
+// NewUserHandler creates a new UserHandler to deal with user management. The webhookSecret is the signing secret
+// of the clerk webhook endpoint, an empty one rejecting all webhooks, and adminToken is the bearer token of the
+// admins, that may get any user.
+func NewUserHandler(storage UserStorage, webhookSecret, adminToken string) UserHandler {
 	return UserHandler{
-		storage: storage,
+		storage:       storage,
+		webhookSecret: webhookSecret,
+		adminToken:    adminToken,
 	}
 }
 
-// ClerkWebHookHandler is a handler that receives a clerk webhook and create a user with the data
+// ClerkWebHookHandler is a handler that receives a clerk webhook and create a user with the data. The webhooks
+// without a valid svix signature are answered with 401.
 func (h UserHandler) ClerkWebHookHandler(w http.ResponseWriter, r *http.Request) {
 	traceID := r.Header.Get(GCPTraceHeader)
 	ctx := r.Context()
@@ -43,8 +55,20 @@ func (h UserHandler) ClerkWebHookHandler(w http.ResponseWriter, r *http.Request)
 
 	logger := slog.With("traceID", traceID)
 
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logger.Error("error reading clerk webhook", "error", err)
+		return
+	}
+	if err := clerk.VerifyWebhook(h.webhookSecret, r.Header, body, time.Now()); err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		logger.Warn("invalid clerk webhook", "error", err)
+		return
+	}
+
 	var clerkWebHook clerk.WebHookEvent
-	err := json.NewDecoder(r.Body).Decode(&clerkWebHook)
+	err = json.Unmarshal(body, &clerkWebHook)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		logger.Error("error decoding clerk webhook", "error", err)
@@ -90,7 +114,8 @@ func (h UserHandler) createUser(ctx context.Context, clerkWebHook clerk.WebHookE
 }
 
 // GetUserHandler is a handler that receives a user_id and return the user data
-// If the user does not exist, it will return a 404 status code
+// If the user does not exist, it will return a 404 status code. The callers only get themselves (see
+// UserIDHeader), and the admins get any user.
 func (h UserHandler) GetUserHandler(w http.ResponseWriter, r *http.Request) {
 	traceID := r.Header.Get(GCPTraceHeader)
 	ctx := r.Context()
@@ -106,6 +131,19 @@ func (h UserHandler) GetUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !isAdmin(r, h.adminToken) {
+		caller := r.Header.Get(UserIDHeader)
+		if caller == "" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if caller != userID {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			logger.Warn("caller is not the user", "user_id", userID, "caller", caller)
+			return
+		}
+	}
+
 	user, err := h.storage.GetUser(ctx, userID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
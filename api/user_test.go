@@ -1,28 +1,78 @@
 package api_test
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"io"
+	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/perebaj/esaj/api"
-	"github.com/perebaj/esaj/firestore"
 	"github.com/perebaj/esaj/mock"
+	"github.com/perebaj/esaj/storage"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 )
 
+// webhookSecret is the signing secret of the clerk webhook endpoint in the tests.
+const webhookSecret = "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw"
+
+// newWebhookRequest returns a clerk webhook request signed with webhookSecret.
+func newWebhookRequest(t *testing.T, body string) *http.Request {
+	t.Helper()
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(webhookSecret, "whsec_"))
+	require.NoError(t, err)
+
+	id, timestamp := "msg_1", strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + timestamp + "." + body))
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("svix-id", id)
+	req.Header.Set("svix-timestamp", timestamp)
+	req.Header.Set("svix-signature", "v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestUserHandler_ClerkWebHookHandler_invalidSignature(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	userStorageMock := mock.NewMockUserStorage(ctrl)
+	userHandler := api.NewUserHandler(userStorageMock, webhookSecret, "admin-token")
+
+	// unsigned
+	w := httptest.NewRecorder()
+	userHandler.ClerkWebHookHandler(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"type": "user.deleted"}`)))
+	require.Equal(t, 401, w.Code)
+
+	// signed, but changed after
+	req := newWebhookRequest(t, `{"type": "user.created"}`)
+	req.Body = io.NopCloser(strings.NewReader(`{"type": "user.deleted"}`))
+	w = httptest.NewRecorder()
+	userHandler.ClerkWebHookHandler(w, req)
+	require.Equal(t, 401, w.Code)
+
+	// an endpoint without secret rejects all webhooks
+	w = httptest.NewRecorder()
+	api.NewUserHandler(userStorageMock, "", "").ClerkWebHookHandler(w, newWebhookRequest(t, `{"type": "user.deleted"}`))
+	require.Equal(t, 401, w.Code)
+}
+
 func TestUserHandler_ClerkWebHookHandler_createUser(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	userStorageMock := mock.NewMockUserStorage(ctrl)
 
 	userStorageMock.EXPECT().SaveUser(gomock.Any(), gomock.Any()).Return(nil)
-	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"type": "user.created"}`))
+	req := newWebhookRequest(t, `{"type": "user.created"}`)
 	w := httptest.NewRecorder()
 
-	userHandler := api.NewUserHandler(userStorageMock)
+	userHandler := api.NewUserHandler(userStorageMock, webhookSecret, "admin-token")
 	userHandler.ClerkWebHookHandler(w, req)
 
 	require.Equal(t, 200, w.Code)
@@ -32,10 +82,10 @@ func TestUserHandler_ClerkWebHookHandler_invalidOperation(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	userStorageMock := mock.NewMockUserStorage(ctrl)
 
-	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"type": "invalid.operation"}`))
+	req := newWebhookRequest(t, `{"type": "invalid.operation"}`)
 	w := httptest.NewRecorder()
 
-	userHandler := api.NewUserHandler(userStorageMock)
+	userHandler := api.NewUserHandler(userStorageMock, webhookSecret, "admin-token")
 	userHandler.ClerkWebHookHandler(w, req)
 
 	require.Equal(t, 400, w.Code)
@@ -46,10 +96,10 @@ func TestUserHandler_ClerkWebHookHandler_errorCreatingUser(t *testing.T) {
 	userStorageMock := mock.NewMockUserStorage(ctrl)
 
 	userStorageMock.EXPECT().SaveUser(gomock.Any(), gomock.Any()).Return(errors.New("error saving user"))
-	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"type": "user.created"}`))
+	req := newWebhookRequest(t, `{"type": "user.created"}`)
 	w := httptest.NewRecorder()
 
-	userHandler := api.NewUserHandler(userStorageMock)
+	userHandler := api.NewUserHandler(userStorageMock, webhookSecret, "admin-token")
 	userHandler.ClerkWebHookHandler(w, req)
 
 	require.Equal(t, 500, w.Code)
@@ -59,10 +109,10 @@ func TestUserHandler_ClerkWebHookHandler_errorDecoding(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	userStorageMock := mock.NewMockUserStorage(ctrl)
 
-	req := httptest.NewRequest("POST", "/", strings.NewReader(`{`))
+	req := newWebhookRequest(t, `{`)
 	w := httptest.NewRecorder()
 
-	userHandler := api.NewUserHandler(userStorageMock)
+	userHandler := api.NewUserHandler(userStorageMock, webhookSecret, "admin-token")
 	userHandler.ClerkWebHookHandler(w, req)
 
 	require.Equal(t, 400, w.Code)
@@ -119,10 +169,10 @@ func TestUserHandler_ClerkWebHookHandler_updateUser(t *testing.T) {
 	userStorageMock := mock.NewMockUserStorage(ctrl)
 	userStorageMock.EXPECT().SaveUser(gomock.Any(), gomock.Any()).Return(nil)
 
-	req := httptest.NewRequest("POST", "/", strings.NewReader(event))
+	req := newWebhookRequest(t, event)
 	w := httptest.NewRecorder()
 
-	userHandler := api.NewUserHandler(userStorageMock)
+	userHandler := api.NewUserHandler(userStorageMock, webhookSecret, "admin-token")
 	userHandler.ClerkWebHookHandler(w, req)
 
 	require.Equal(t, 200, w.Code)
@@ -143,10 +193,10 @@ func TestUserHandler_ClerkWebHookHandler_deleteUser(t *testing.T) {
 	userStorageMock := mock.NewMockUserStorage(ctrl)
 	userStorageMock.EXPECT().DeleteUser(gomock.Any(), gomock.Any()).Return(nil)
 
-	req := httptest.NewRequest("POST", "/", strings.NewReader(event))
+	req := newWebhookRequest(t, event)
 	w := httptest.NewRecorder()
 
-	userHandler := api.NewUserHandler(userStorageMock)
+	userHandler := api.NewUserHandler(userStorageMock, webhookSecret, "admin-token")
 	userHandler.ClerkWebHookHandler(w, req)
 
 	require.Equal(t, 200, w.Code)
@@ -156,7 +206,7 @@ func TestUserHandler_GetUserHandler(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	userStorageMock := mock.NewMockUserStorage(ctrl)
 
-	user := firestore.User{
+	user := storage.User{
 		ID:             "123",
 		FirstName:      "John",
 		LastName:       "Doe",
@@ -172,18 +222,45 @@ func TestUserHandler_GetUserHandler(t *testing.T) {
 	userStorageMock.EXPECT().GetUser(gomock.Any(), "123").Return(user, nil)
 
 	req := httptest.NewRequest("GET", "/?user_id=123", nil)
+	req.Header.Set(api.UserIDHeader, "123")
 	w := httptest.NewRecorder()
 
-	userHandler := api.NewUserHandler(userStorageMock)
+	userHandler := api.NewUserHandler(userStorageMock, webhookSecret, "admin-token")
 	userHandler.GetUserHandler(w, req)
 
 	require.Equal(t, 200, w.Code)
-	var gotUser firestore.User
+	var gotUser storage.User
 	require.NoError(t, json.NewDecoder(w.Body).Decode(&gotUser))
 
 	require.Equal(t, user, gotUser)
 }
 
+func TestUserHandler_GetUserHandler_otherUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	userStorageMock := mock.NewMockUserStorage(ctrl)
+	userHandler := api.NewUserHandler(userStorageMock, webhookSecret, "admin-token")
+
+	// the caller must be identified
+	w := httptest.NewRecorder()
+	userHandler.GetUserHandler(w, httptest.NewRequest("GET", "/?user_id=123", nil))
+	require.Equal(t, 401, w.Code)
+
+	// and only gets itself
+	req := httptest.NewRequest("GET", "/?user_id=123", nil)
+	req.Header.Set(api.UserIDHeader, "456")
+	w = httptest.NewRecorder()
+	userHandler.GetUserHandler(w, req)
+	require.Equal(t, 403, w.Code)
+
+	// the admins get any user
+	userStorageMock.EXPECT().GetUser(gomock.Any(), "123").Return(storage.User{ID: "123"}, nil)
+	req = httptest.NewRequest("GET", "/?user_id=123", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	w = httptest.NewRecorder()
+	userHandler.GetUserHandler(w, req)
+	require.Equal(t, 200, w.Code)
+}
+
 func TestUserHandler_GetUserHandler_emptyUserID(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	userStorageMock := mock.NewMockUserStorage(ctrl)
@@ -191,7 +268,7 @@ func TestUserHandler_GetUserHandler_emptyUserID(t *testing.T) {
 	req := httptest.NewRequest("GET", "/", nil)
 	w := httptest.NewRecorder()
 
-	userHandler := api.NewUserHandler(userStorageMock)
+	userHandler := api.NewUserHandler(userStorageMock, webhookSecret, "admin-token")
 	userHandler.GetUserHandler(w, req)
 
 	require.Equal(t, 400, w.Code)
@@ -201,12 +278,13 @@ func TestUserHandler_GetUserHandler_userNotFound(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	userStorageMock := mock.NewMockUserStorage(ctrl)
 
-	userStorageMock.EXPECT().GetUser(gomock.Any(), "123").Return(firestore.User{}, nil)
+	userStorageMock.EXPECT().GetUser(gomock.Any(), "123").Return(storage.User{}, nil)
 
 	req := httptest.NewRequest("GET", "/?user_id=123", nil)
+	req.Header.Set(api.UserIDHeader, "123")
 	w := httptest.NewRecorder()
 
-	userHandler := api.NewUserHandler(userStorageMock)
+	userHandler := api.NewUserHandler(userStorageMock, webhookSecret, "admin-token")
 	userHandler.GetUserHandler(w, req)
 
 	require.Equal(t, 404, w.Code)
@@ -216,7 +294,7 @@ func TestUserHandler_GetUserHandler_userDeleted(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	userStorageMock := mock.NewMockUserStorage(ctrl)
 
-	user := firestore.User{
+	user := storage.User{
 		ID:        "123",
 		DeletedAt: "2022-01-01T00:00:00Z",
 	}
@@ -224,9 +302,10 @@ func TestUserHandler_GetUserHandler_userDeleted(t *testing.T) {
 	userStorageMock.EXPECT().GetUser(gomock.Any(), "123").Return(user, nil)
 
 	req := httptest.NewRequest("GET", "/?user_id=123", nil)
+	req.Header.Set(api.UserIDHeader, "123")
 	w := httptest.NewRecorder()
 
-	userHandler := api.NewUserHandler(userStorageMock)
+	userHandler := api.NewUserHandler(userStorageMock, webhookSecret, "admin-token")
 	userHandler.GetUserHandler(w, req)
 
 	require.Equal(t, 404, w.Code)
@@ -0,0 +1,162 @@
+// Package audit records the accesses to process data, through the API and the CLI, in the append-only access log
+// of the storage. The events are written in the background and in batches, so recording an access never blocks
+// the request that made it.
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/perebaj/esaj/metrics"
+	"github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/tracing"
+)
+
+// DefaultBuffer is the number of events waiting to be written, above which the new events are dropped.
+const DefaultBuffer = 1024
+
+const (
+	// batchSize is the maximum number of events written at once.
+	batchSize = 100
+	// flushInterval is how long an event waits for a full batch before being written.
+	flushInterval = time.Second
+	// writeTimeout limits each write of a batch.
+	writeTimeout = 10 * time.Second
+	// writeAttempts is the number of times a batch is written before its events are lost. The writes of the
+	// storage ignore the events already saved, so a batch partially written is written again.
+	writeAttempts = 3
+)
+
+// Recorder writes the access events in the background. Record never blocks: when the storage is slower than
+// the requests and the buffer is full, the events are dropped and counted in metrics.AuditEvents. A nil Recorder
+// records nothing.
+type Recorder struct {
+	storage storage.AuditRepository
+	events  chan storage.AccessEvent
+	done    chan struct{}
+	// mu guards closed, so no event is sent to the closed channel.
+	mu      sync.RWMutex
+	closed  bool
+	now     func() time.Time
+	backoff time.Duration
+}
+
+// NewRecorder creates a Recorder that buffers up to buffer events, and starts writing them. Close must be called
+// to write the buffered events before the process exits.
+func NewRecorder(s storage.AuditRepository, buffer int) *Recorder {
+	r := &Recorder{
+		storage: s,
+		events:  make(chan storage.AccessEvent, buffer),
+		done:    make(chan struct{}),
+		now:     time.Now,
+		backoff: 100 * time.Millisecond,
+	}
+	go r.run()
+	return r
+}
+
+// Record queues the event to be written. Its ID and creation time are set, and its trace ID is taken from the
+// context when empty.
+func (r *Recorder) Record(ctx context.Context, e storage.AccessEvent) {
+	if r == nil {
+		return
+	}
+
+	id, err := storage.NewID()
+	if err != nil {
+		metrics.AuditEvents.WithLabelValues("failed").Inc()
+		slog.Error("error recording access event", "error", err, "resource", e.Resource)
+		return
+	}
+	e.ID = id
+	e.CreatedAt = r.now()
+	if e.TraceID == "" {
+		e.TraceID = tracing.GetTraceIDFromContext(ctx)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.closed {
+		select {
+		case r.events <- e:
+			return
+		default:
+		}
+	}
+	metrics.AuditEvents.WithLabelValues("dropped").Inc()
+	slog.Warn("access event dropped", "user_id", e.UserID, "action", e.Action, "resource", e.Resource,
+		"trace_id", e.TraceID)
+}
+
+// Close stops recording and writes the buffered events. It returns the error of the context when it's done
+// before all of them are written.
+func (r *Recorder) Close(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.events)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run writes the events in batches, when the batch is full or every flushInterval, until the recorder is closed.
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []storage.AccessEvent
+	for {
+		select {
+		case e, ok := <-r.events:
+			if !ok {
+				r.write(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) == batchSize {
+				r.write(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			r.write(batch)
+			batch = nil
+		}
+	}
+}
+
+func (r *Recorder) write(batch []storage.AccessEvent) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var err error
+	for attempt := 0; attempt < writeAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(r.backoff << (attempt - 1))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+		err = r.storage.SaveAccessEvents(ctx, batch)
+		cancel()
+		if err == nil {
+			metrics.AuditEvents.WithLabelValues("saved").Add(float64(len(batch)))
+			return
+		}
+	}
+	metrics.AuditEvents.WithLabelValues("failed").Add(float64(len(batch)))
+	slog.Error("error writing access events", "error", err, "events", len(batch))
+}
@@ -0,0 +1,94 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/perebaj/esaj/audit"
+	"github.com/perebaj/esaj/metrics"
+	"github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/storage/memory"
+	"github.com/perebaj/esaj/tracing"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingStorage blocks the writes until unblock is closed, and fails them after it.
+type blockingStorage struct {
+	storage.AuditRepository
+	unblock chan struct{}
+}
+
+func (s blockingStorage) SaveAccessEvents(ctx context.Context, _ []storage.AccessEvent) error {
+	select {
+	case <-s.unblock:
+		return errors.New("unavailable")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	ctx := tracing.SetTraceIDInContext(context.Background(), "test-trace-id")
+	s := memory.NewStorage()
+	r := audit.NewRecorder(s, audit.DefaultBuffer)
+
+	for _, resource := range []string{storage.ProcessResource("1"), storage.ProcessResource("2")} {
+		r.Record(ctx, storage.AccessEvent{
+			UserID: "u1", OrganizationID: "silva", Action: storage.AccessRead, Resource: resource,
+		})
+	}
+	require.NoError(t, r.Close(context.Background()))
+	// the events recorded after the recorder is closed are dropped
+	r.Record(ctx, storage.AccessEvent{UserID: "u1", Action: storage.AccessRead})
+
+	page, err := s.QueryAccessEvents(ctx, storage.AccessQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Events, 2)
+	for _, e := range page.Events {
+		assert.NotEmpty(t, e.ID)
+		assert.Equal(t, "u1", e.UserID)
+		assert.Equal(t, "silva", e.OrganizationID)
+		assert.Equal(t, "test-trace-id", e.TraceID)
+		assert.False(t, e.CreatedAt.IsZero())
+	}
+	assert.NotEqual(t, page.Events[0].ID, page.Events[1].ID)
+
+	var nilRecorder *audit.Recorder
+	nilRecorder.Record(ctx, storage.AccessEvent{})
+	require.NoError(t, nilRecorder.Close(ctx))
+}
+
+func TestRecorder_neverBlocks(t *testing.T) {
+	s := blockingStorage{unblock: make(chan struct{})}
+	r := audit.NewRecorder(s, 1)
+	dropped := testutil.ToFloat64(metrics.AuditEvents.WithLabelValues("dropped"))
+
+	// the storage doesn't write anything, so the events above the buffer are dropped without waiting
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			r.Record(context.Background(), storage.AccessEvent{UserID: "u1", Action: storage.AccessRead})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Record blocked")
+	}
+	assert.GreaterOrEqual(t, testutil.ToFloat64(metrics.AuditEvents.WithLabelValues("dropped"))-dropped, 8.0)
+
+	// Close waits for the buffered events, until its context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, r.Close(ctx), context.DeadlineExceeded)
+
+	failed := testutil.ToFloat64(metrics.AuditEvents.WithLabelValues("failed"))
+	close(s.unblock)
+	require.NoError(t, r.Close(context.Background()))
+	assert.Greater(t, testutil.ToFloat64(metrics.AuditEvents.WithLabelValues("failed")), failed)
+}
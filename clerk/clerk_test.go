@@ -0,0 +1,96 @@
+package clerk_test
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/perebaj/esaj/clerk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signToken returns a session token with the header and the claims, signed by the key.
+func signToken(t *testing.T, key *rsa.PrivateKey, header, claims map[string]any) string {
+	t.Helper()
+	h, err := json.Marshal(header)
+	require.NoError(t, err)
+	c, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerifySessionToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	public, err := clerk.ParsePublicKey(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	require.NoError(t, err)
+
+	now := time.Now()
+	rs256 := map[string]any{"alg": "RS256", "typ": "JWT"}
+	valid := map[string]any{"sub": "user_1", "azp": "https://app.example.com", "exp": now.Add(time.Minute).Unix(),
+		"nbf": now.Add(-time.Minute).Unix()}
+
+	claims, err := clerk.VerifySessionToken(signToken(t, key, rs256, valid), public, []string{"https://app.example.com"}, now)
+	require.NoError(t, err)
+	assert.Equal(t, "user_1", claims.Subject)
+
+	for name, token := range map[string]string{
+		"other key":   signToken(t, other, rs256, valid),
+		"expired":     signToken(t, key, rs256, map[string]any{"sub": "user_1", "exp": now.Add(-time.Minute).Unix()}),
+		"no subject":  signToken(t, key, rs256, map[string]any{"exp": now.Add(time.Minute).Unix()}),
+		"none":        signToken(t, key, map[string]any{"alg": "none"}, valid),
+		"malformed":   "abc.def",
+		"other party": signToken(t, key, rs256, map[string]any{"sub": "user_1", "azp": "https://evil.example.com", "exp": now.Add(time.Minute).Unix()}),
+	} {
+		_, err := clerk.VerifySessionToken(token, public, []string{"https://app.example.com"}, now)
+		require.ErrorIs(t, err, clerk.ErrInvalidToken, name)
+	}
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	const secret = "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw"
+	key, err := base64.StdEncoding.DecodeString(secret[len("whsec_"):])
+	require.NoError(t, err)
+
+	now := time.Now()
+	body := []byte(`{"type": "user.created"}`)
+	sign := func(timestamp time.Time) http.Header {
+		ts := strconv.FormatInt(timestamp.Unix(), 10)
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte("msg_1." + ts + "."))
+		mac.Write(body)
+		header := http.Header{}
+		header.Set("svix-id", "msg_1")
+		header.Set("svix-timestamp", ts)
+		// the signature of a rotated secret comes first
+		header.Set("svix-signature", "v1,b2xk v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+		return header
+	}
+
+	require.NoError(t, clerk.VerifyWebhook(secret, sign(now), body, now))
+	require.ErrorIs(t, clerk.VerifyWebhook(secret, sign(now), []byte(`{"type": "user.deleted"}`), now), clerk.ErrInvalidSignature)
+	require.ErrorIs(t, clerk.VerifyWebhook(secret, sign(now.Add(-time.Hour)), body, now), clerk.ErrInvalidSignature)
+	require.ErrorIs(t, clerk.VerifyWebhook(secret, http.Header{}, body, now), clerk.ErrInvalidSignature)
+	require.ErrorIs(t, clerk.VerifyWebhook("", sign(now), body, now), clerk.ErrInvalidSignature)
+}
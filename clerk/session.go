@@ -0,0 +1,110 @@
+// Package clerk session.go verifies the session tokens of clerk, the JWTs that its frontend sends to the API.
+package clerk
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// clockSkew is the difference accepted between the clock of clerk and ours when checking the expiration of a token.
+const clockSkew = 5 * time.Second
+
+// ErrInvalidToken is an error that occurs when a session token is malformed, has a wrong signature or is expired.
+var ErrInvalidToken = errors.New("invalid session token")
+
+// SessionClaims are the claims of a session token used by the API.
+type SessionClaims struct {
+	// Subject is the clerk user ID.
+	Subject string `json:"sub"`
+	// AuthorizedParty is the origin of the frontend that requested the token.
+	AuthorizedParty string `json:"azp"`
+	Expiration      int64  `json:"exp"`
+	NotBefore       int64  `json:"nbf"`
+}
+
+// ParsePublicKey parses the PEM of the JWT public key of the clerk instance, found in the API keys of its
+// dashboard.
+func ParsePublicKey(data string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("the clerk public key is not a PEM")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the clerk public key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("the clerk public key is a %T, not an RSA key", key)
+	}
+	return rsaKey, nil
+}
+
+// VerifySessionToken verifies the RS256 signature and the expiration of a session token, returning its claims.
+// When authorizedParties is not empty, the token must have been requested by one of them.
+func VerifySessionToken(token string, key *rsa.PublicKey, authorizedParties []string, now time.Time) (SessionClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return SessionClaims{}, fmt.Errorf("%w: it must have 3 parts", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return SessionClaims{}, err
+	}
+	// the algorithm is fixed, so a token can't choose a weaker one, like none or HS256
+	if header.Alg != "RS256" {
+		return SessionClaims{}, fmt.Errorf("%w: unexpected algorithm %q", ErrInvalidToken, header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return SessionClaims{}, fmt.Errorf("%w: error decoding signature: %w", ErrInvalidToken, err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return SessionClaims{}, fmt.Errorf("%w: wrong signature", ErrInvalidToken)
+	}
+
+	var claims SessionClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return SessionClaims{}, err
+	}
+	if claims.Subject == "" {
+		return SessionClaims{}, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	if claims.Expiration == 0 || now.Add(-clockSkew).After(time.Unix(claims.Expiration, 0)) {
+		return SessionClaims{}, fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if claims.NotBefore != 0 && now.Add(clockSkew).Before(time.Unix(claims.NotBefore, 0)) {
+		return SessionClaims{}, fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+	if len(authorizedParties) > 0 && !slices.Contains(authorizedParties, claims.AuthorizedParty) {
+		return SessionClaims{}, fmt.Errorf("%w: unauthorized party %q", ErrInvalidToken, claims.AuthorizedParty)
+	}
+	return claims, nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a token.
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: error decoding segment: %w", ErrInvalidToken, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: error parsing segment: %w", ErrInvalidToken, err)
+	}
+	return nil
+}
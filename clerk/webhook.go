@@ -0,0 +1,65 @@
+// Package clerk webhook.go verifies the signatures of the clerk webhooks, that are sent through svix.
+package clerk
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// webhookTolerance is how old, or how far in the future, the timestamp of a webhook may be. Older webhooks are
+// rejected, so a captured one can't be replayed later.
+const webhookTolerance = 5 * time.Minute
+
+// ErrInvalidSignature is an error that occurs when a webhook is not signed with the secret of its endpoint.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// VerifyWebhook verifies the svix signature of a webhook body, sent in the svix-id, svix-timestamp and
+// svix-signature headers. The secret is the signing secret of the endpoint, in the whsec_ format of the clerk
+// dashboard.
+func VerifyWebhook(secret string, header http.Header, body []byte, now time.Time) error {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, "whsec_"))
+	if err != nil || len(key) == 0 {
+		return fmt.Errorf("%w: the webhook secret is not valid", ErrInvalidSignature)
+	}
+
+	id := header.Get("svix-id")
+	timestamp := header.Get("svix-timestamp")
+	signatures := header.Get("svix-signature")
+	if id == "" || timestamp == "" || signatures == "" {
+		return fmt.Errorf("%w: missing svix headers", ErrInvalidSignature)
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp %q", ErrInvalidSignature, timestamp)
+	}
+	if sent := time.Unix(seconds, 0); sent.Before(now.Add(-webhookTolerance)) || sent.After(now.Add(webhookTolerance)) {
+		return fmt.Errorf("%w: timestamp out of tolerance", ErrInvalidSignature)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+
+	// the header has a signature per active secret of the endpoint, like "v1,<base64> v1,<base64>" while a secret
+	// is rotated
+	for _, s := range strings.Fields(signatures) {
+		version, sig, found := strings.Cut(s, ",")
+		if !found || version != "v1" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(sig)
+		if err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
@@ -0,0 +1,200 @@
+// Package cmd audit.go gather the commands that read the access log of the process data, and records the accesses
+// of the other commands in it.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"text/tabwriter"
+	"time"
+
+	"github.com/perebaj/esaj/audit"
+	"github.com/perebaj/esaj/storage"
+	"github.com/spf13/cobra"
+)
+
+// recordTimeout limits the time the commands wait for their access events to be written before exiting.
+const recordTimeout = 10 * time.Second
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Read the access log of the process data",
+	Long: `Read the access log of the process data.
+
+Each read and write of process data through the API and the commands is recorded with the user, the
+organization, the trace ID, the action, the resource and the time. The commands are recorded as the "cli:" user
+of the system.`,
+}
+
+var auditQueryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "List a page of the access events, ordered by time",
+	Example: `  esaj audit query --organization 0f1e2d3c --since 2024-08-01T00:00:00Z
+  esaj audit query --resource oab:123456/SP --page-size 100 --cursor eyJj...`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		q, err := accessQuery(cmd)
+		if err != nil {
+			return err
+		}
+		q.PageSize, _ = cmd.Flags().GetInt("page-size")
+		q.Cursor, _ = cmd.Flags().GetString("cursor")
+
+		s, closeFn, err := firestoreStorage(cmd)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		page, err := s.QueryAccessEvents(cmd.Context(), q)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CREATED\tUSER\tORGANIZATION\tACTION\tRESOURCE\tTRACE")
+		for _, e := range page.Events {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				e.CreatedAt.Format(time.RFC3339), e.UserID, e.OrganizationID, e.Action, e.Resource, e.TraceID)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if page.NextCursor != "" {
+			fmt.Fprintf(cmd.ErrOrStderr(), "next page: --cursor %s\n", page.NextCursor)
+		}
+		return nil
+	},
+}
+
+var auditExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the access events to NDJSON, one event per line",
+	Example: `  esaj audit export --since 2024-08-01T00:00:00Z --until 2024-09-01T00:00:00Z --output access.ndjson
+  esaj audit export --organization 0f1e2d3c`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		q, err := accessQuery(cmd)
+		if err != nil {
+			return err
+		}
+		q.PageSize = storage.MaxPageSize
+
+		w := cmd.OutOrStdout()
+		if output, _ := cmd.Flags().GetString("output"); output != "" {
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("error creating %s: %w", output, err)
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+			w = f
+		}
+
+		s, closeFn, err := firestoreStorage(cmd)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		exported, err := exportAccessEvents(cmd.Context(), s, q, w)
+		fmt.Fprintf(cmd.ErrOrStderr(), "%d events exported\n", exported)
+		return err
+	},
+}
+
+// exportAccessEvents writes the events of all the pages of the query as NDJSON, and returns how many were written.
+func exportAccessEvents(ctx context.Context, s storage.AuditRepository, q storage.AccessQuery, w io.Writer) (int, error) {
+	enc := json.NewEncoder(w)
+	var exported int
+	for {
+		page, err := s.QueryAccessEvents(ctx, q)
+		if err != nil {
+			return exported, err
+		}
+		for _, e := range page.Events {
+			if err := enc.Encode(e); err != nil {
+				return exported, fmt.Errorf("error writing access event %s: %w", e.ID, err)
+			}
+			exported++
+		}
+		if page.NextCursor == "" {
+			return exported, nil
+		}
+		q.Cursor = page.NextCursor
+	}
+}
+
+// accessQuery returns the query of the filter flags.
+func accessQuery(cmd *cobra.Command) (storage.AccessQuery, error) {
+	var q storage.AccessQuery
+	q.OrganizationID, _ = cmd.Flags().GetString("organization")
+	q.UserID, _ = cmd.Flags().GetString("user")
+	q.Resource, _ = cmd.Flags().GetString("resource")
+	for _, flag := range []struct {
+		name string
+		t    *time.Time
+	}{
+		{"since", &q.Since},
+		{"until", &q.Until},
+	} {
+		v, _ := cmd.Flags().GetString(flag.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return q, fmt.Errorf("invalid --%s %q, use RFC3339", flag.name, v)
+		}
+		*flag.t = t
+	}
+	return q, nil
+}
+
+// recordAccess records the action of the command on the resources in the access log, in the background. The
+// returned function writes the recorded events, and must run before the storage is closed.
+func recordAccess(cmd *cobra.Command, s storage.AuditRepository, action string, resources ...string) func() {
+	recorder := audit.NewRecorder(s, audit.DefaultBuffer)
+	for _, resource := range resources {
+		recorder.Record(cmd.Context(), storage.AccessEvent{
+			UserID:   cliUser(),
+			Action:   action,
+			Resource: resource,
+		})
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+		defer cancel()
+		if err := recorder.Close(ctx); err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "error writing the access log: %v\n", err)
+		}
+	}
+}
+
+// cliUser identifies the commands in the access log, by the user of the system that runs them.
+func cliUser() string {
+	u, err := user.Current()
+	if err != nil {
+		return "cli"
+	}
+	return "cli:" + u.Username
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.AddCommand(auditQueryCmd, auditExportCmd)
+	auditCmd.PersistentFlags().String("project", "blup-432616", "GCP project of the Firestore database")
+	auditCmd.PersistentFlags().String("database", "blup-db", "Firestore database")
+	auditCmd.PersistentFlags().String("organization", "", "Only the events of the organization")
+	auditCmd.PersistentFlags().String("user", "", "Only the events of the user")
+	auditCmd.PersistentFlags().String("resource", "", "Only the events of the resource. Example: process:123")
+	auditCmd.PersistentFlags().String("since", "", "Only the events created since the time, in RFC3339")
+	auditCmd.PersistentFlags().String("until", "", "Only the events created before the time, in RFC3339")
+
+	auditQueryCmd.Flags().Int("page-size", storage.DefaultPageSize, "Number of events of the page")
+	auditQueryCmd.Flags().String("cursor", "", "The cursor of the next page, printed by the previous one")
+	auditExportCmd.Flags().StringP("output", "o", "", "File of the export, the standard output by default")
+}
@@ -0,0 +1,221 @@
+// Package cmd backup.go gather the export and import commands, that copy the Firestore collections to NDJSON
+// files and back.
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/firestore"
+	"github.com/perebaj/esaj/storage"
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export [collection]",
+	Short: "Export a Firestore collection, with its subcollections, to NDJSON",
+	Long: `Export a Firestore collection, with its subcollections, to NDJSON.
+
+Each line is a document with its path, so the document IDs are kept, and its fields, with the timestamps and the
+other values JSON doesn't represent wrapped as {"$time": "..."}. The collection is one of ` +
+		strings.Join(firestore.BackupCollections, ", ") + `.
+
+The documents are exported in the order of their IDs, so an interrupted export to a file continues with --resume:
+the last document, that may be incomplete, is exported again with the ones after it. Set FIRESTORE_EMULATOR_HOST
+to export from the emulator.`,
+	Example: `  esaj export process_basic_info --output processes.ndjson
+  esaj export process_seeds --oab 123456/SP --output seeds.ndjson --resume`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, _ := cmd.Flags().GetString("output")
+		resume, _ := cmd.Flags().GetBool("resume")
+		oab, err := backupOAB(cmd)
+		if err != nil {
+			return err
+		}
+		opts := firestore.ExportOptions{Collection: args[0], OAB: oab}
+
+		w := cmd.OutOrStdout()
+		if output != "" {
+			f, err := openExport(output, resume, &opts)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+			w = f
+		} else if resume {
+			return errors.New("--resume requires --output")
+		}
+
+		s, closeFn, err := firestoreStorage(cmd)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+		defer recordAccess(cmd, s, storage.AccessRead, backupResources(opts.Collection, oab)...)()
+
+		written, err := s.Export(cmd.Context(), w, opts)
+		fmt.Fprintf(cmd.ErrOrStderr(), "%d documents exported\n", written)
+		return err
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import [file]",
+	Short: "Import the NDJSON of an export to Firestore",
+	Long: `Import the NDJSON of an export to Firestore.
+
+The documents are saved with their paths, replacing the ones that exist. Firestore sets their create and update
+times, while the timestamps in their fields are kept. The lines are saved in batches, and the number of saved
+lines is written to the [file].checkpoint file after each of them, so an interrupted import continues with
+--resume. Set FIRESTORE_EMULATOR_HOST to import to the emulator.`,
+	Example: `  esaj import processes.ndjson
+  esaj import seeds.ndjson --oab 123456/SP --resume`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resume, _ := cmd.Flags().GetBool("resume")
+		oab, err := backupOAB(cmd)
+		if err != nil {
+			return err
+		}
+
+		input := args[0]
+		checkpoint := input + ".checkpoint"
+		opts := firestore.ImportOptions{
+			OAB: oab,
+			Checkpoint: func(lines int) error {
+				return os.WriteFile(checkpoint, []byte(strconv.Itoa(lines)), 0o600)
+			},
+		}
+		if resume {
+			opts.Skip, err = readCheckpoint(checkpoint)
+			if err != nil {
+				return err
+			}
+		}
+
+		f, err := os.Open(input)
+		if err != nil {
+			return fmt.Errorf("error opening %s: %w", input, err)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		collection, err := importCollection(f)
+		if err != nil {
+			return err
+		}
+
+		s, closeFn, err := firestoreStorage(cmd)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+		defer recordAccess(cmd, s, storage.AccessWrite, backupResources(collection, oab)...)()
+
+		lines, err := s.Import(cmd.Context(), f, opts)
+		if err != nil {
+			return batchErr(cmd, err, "documents were not imported, run it again with --resume")
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "%d lines imported, %d skipped\n", lines-opts.Skip, opts.Skip)
+		return os.Remove(checkpoint)
+	},
+}
+
+// backupOAB returns the OAB flag, zero when it's not set.
+func backupOAB(cmd *cobra.Command) (esaj.OAB, error) {
+	raw, _ := cmd.Flags().GetString("oab")
+	if raw == "" {
+		return esaj.OAB{}, nil
+	}
+	return esaj.ParseOAB(raw)
+}
+
+// backupResources returns the resources of the access log read by an export or written by an import: the
+// collection, and the OAB that filters it when it's not zero.
+func backupResources(collection string, oab esaj.OAB) []string {
+	resources := []string{storage.CollectionResource(collection)}
+	if !oab.IsZero() {
+		resources = append(resources, storage.OABResource(oab))
+	}
+	return resources
+}
+
+// importCollection returns the collection of the file of an export, from the path of its first document, and
+// rewinds the file. Each export has a single collection, with its subcollections.
+func importCollection(f *os.File) (string, error) {
+	var first firestore.Record
+	if err := json.NewDecoder(f).Decode(&first); err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("error reading %s: %w", f.Name(), err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("error reading %s: %w", f.Name(), err)
+	}
+	collection, _, _ := strings.Cut(first.Path, "/")
+	return collection, nil
+}
+
+// openExport opens the file of an export. When resuming, the file is truncated before the last exported
+// document, that may be incomplete, and the export continues from it.
+func openExport(path string, resume bool, opts *firestore.ExportOptions) (*os.File, error) {
+	if !resume {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("error creating %s: %w", path, err)
+		}
+		return f, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", path, err)
+	}
+	after, size, err := firestore.ResumeExport(f)
+	if err == nil {
+		err = f.Truncate(size)
+	}
+	if err == nil {
+		_, err = f.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("error resuming %s: %w", path, err)
+	}
+	opts.After = after
+	return f, nil
+}
+
+// readCheckpoint returns the number of lines saved by an interrupted import, zero when there is no checkpoint.
+func readCheckpoint(path string) (int, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading checkpoint: %w", err)
+	}
+	lines, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	return lines, nil
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd, importCmd)
+	for _, c := range []*cobra.Command{exportCmd, importCmd} {
+		c.Flags().String("project", "blup-432616", "GCP project of the Firestore database")
+		c.Flags().String("database", "blup-db", "Firestore database")
+		c.Flags().String("oab", "", "Only the seeds, the processes or the organizations of the OAB, with their subcollections")
+		c.Flags().Bool("resume", false, "Continue an interrupted run")
+	}
+	exportCmd.Flags().StringP("output", "o", "", "File of the export, the standard output by default")
+}
@@ -0,0 +1,147 @@
+// Package cmd download.go gather the download command, that downloads the PDF documents of a process with the
+// sessions of the eSAJ accounts.
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/spf13/cobra"
+)
+
+var downloadCmd = &cobra.Command{
+	Use:   "download",
+	Short: "Download all PDFs documents related to a specific process",
+	Long: `Download all PDFs documents related to a specific process, saved in the tmp directory.
+
+The documents are downloaded with the sessions of the accounts of ESAJ_ACCOUNTS, or ESAJ_USERNAME and
+ESAJ_PASSWORD, used in rotation. An account that is locked or throttled is left out of the rotation for the
+cooldown, and an expired session is created again by the provider. When ESAJ_SESSION_SECRET is set, the sessions
+saved by esaj session login are reused, and the new ones are saved. With --proxy, each session is created through
+a proxy of the rotation and all its requests are kept in it.`,
+	Example: `  esaj download --process 1016358-63.2020.8.26.0053
+  esaj download --process 1016358-63.2020.8.26.0053 --provider cas --account 12345678900`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		processID, _ := cmd.Flags().GetString("process")
+		account, _ := cmd.Flags().GetString("account")
+		cooldown, _ := cmd.Flags().GetDuration("cooldown")
+
+		proxies, err := proxyPool(cmd)
+		if err != nil {
+			return err
+		}
+		if proxies != nil {
+			go proxies.Run(cmd.Context())
+		}
+
+		accounts, closeFn, err := downloadAccounts(cmd, processID, proxies)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		pool, err := esaj.NewAccountPool(accounts...)
+		if err != nil {
+			return err
+		}
+		pool.Cooldown = cooldown
+		// only the account can access the process, like the account of the lawyer of the case
+		if account != "" {
+			if err := pool.Pin(processID, account); err != nil {
+				return err
+			}
+		}
+
+		eClient := esaj.New(esaj.Config{}, &http.Client{
+			Timeout:   90 * time.Second,
+			Transport: proxyTransport(proxies),
+		})
+		eClient.Accounts = pool
+
+		if err := os.MkdirAll("tmp", 0o755); err != nil {
+			return fmt.Errorf("error creating the tmp directory: %w", err)
+		}
+		err = eClient.Run(cmd.Context(), processID)
+		if statsErr := printAccountStats(cmd.ErrOrStderr(), pool.Stats()); statsErr != nil {
+			return errors.Join(err, statsErr)
+		}
+		return err
+	},
+}
+
+// downloadAccounts returns an account for each credential of the env, whose sessions are created by the
+// provider flag through the proxies, when not nil, and the function that releases their providers.
+func downloadAccounts(cmd *cobra.Command, processID string, proxies *esaj.ProxyPool) ([]esaj.Account, func(), error) {
+	name, _ := cmd.Flags().GetString("provider")
+	showBrowser, _ := cmd.Flags().GetBool("show-browser")
+
+	logins, err := esaj.LoginsFromEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var store *esaj.SessionStore
+	if os.Getenv("ESAJ_SESSION_SECRET") != "" {
+		s, err := sessionStore(cmd)
+		if err != nil {
+			return nil, nil, err
+		}
+		store = &s
+	}
+
+	var closers []func()
+	closeFn := func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+
+	accounts := make([]esaj.Account, 0, len(logins))
+	for _, login := range logins {
+		provider, closeProvider, err := loginProvider(cmd.Context(), name, login, processID, !showBrowser, proxies)
+		if err != nil {
+			closeFn()
+			return nil, nil, err
+		}
+		closers = append(closers, closeProvider)
+
+		m := esaj.NewSessionManager(provider)
+		m.Store = store
+		m.Account = login.Username
+		m.Proxies = proxies
+		accounts = append(accounts, esaj.Account{Name: login.Username, Session: m})
+	}
+	return accounts, closeFn, nil
+}
+
+// printAccountStats prints the usage of the accounts of the pool.
+func printAccountStats(w io.Writer, stats []esaj.AccountStats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACCOUNT\tUSES\tFAILURES\tCOOLDOWN UNTIL\tLAST ERROR")
+	for _, s := range stats {
+		cooldown := "-"
+		if !s.CooldownUntil.IsZero() {
+			cooldown = s.CooldownUntil.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\n", s.Name, s.Uses, s.Failures, cooldown, s.LastError)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	downloadCmd.Flags().StringP("process", "p", "", "Process whose documents are downloaded. Example: 1016358-63.2020.8.26.0053")
+	downloadCmd.Flags().String("provider", "browser", "How the accounts log in: headless, browser or cas")
+	downloadCmd.Flags().Bool("show-browser", false, "Show the browser of the headless and browser providers")
+	downloadCmd.Flags().StringP("account", "a", "", "Account of the env pinned to the process, the only one used to access it. Example: the eSAJ username")
+	downloadCmd.Flags().Duration("cooldown", 30*time.Minute, "How long a locked or throttled account is left out of the rotation")
+	downloadCmd.Flags().StringSlice("proxy", nil, "HTTP or SOCKS proxy used in rotation, can be repeated. The headless and browser providers only accept proxies without credentials. Example: socks5://10.0.0.2:1080")
+	downloadCmd.Flags().String("session-dir", "", "Directory of the saved sessions. Default: ESAJ_SESSION_DIR or the user config dir")
+	_ = downloadCmd.MarkFlagRequired("process")
+	downloadCmd.SilenceUsage = true
+}
@@ -0,0 +1,76 @@
+// Package cmd migrate.go gather the migrate command, that updates the Firestore documents to the current schema.
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"text/tabwriter"
+
+	fs "cloud.google.com/go/firestore"
+	"github.com/perebaj/esaj/firestore"
+	"github.com/perebaj/esaj/storage"
+	"github.com/spf13/cobra"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate the Firestore documents to the current schema version",
+	Long: `Migrate the Firestore documents to the current schema version.
+
+The documents of the process_seeds, process_basic_info, users and anonymized_parties collections with a
+schema_version lower than the current one are changed by the migrations of their version, in order. Running it again only changes the
+documents written after the last run by old versions of the collector. The seeds keyed by their process only are moved
+to the key of their process and OAB.`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		projectID, _ := cmd.Flags().GetString("project")
+		database, _ := cmd.Flags().GetString("database")
+		ctx := cmd.Context()
+
+		client, err := fs.NewClientWithDatabase(ctx, projectID, database)
+		if err != nil {
+			return fmt.Errorf("error creating firestore client: %w", err)
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+
+		s := firestore.NewStorage(client, projectID)
+		results, err := s.Migrate(ctx, dryRun)
+		var resources []string
+		for _, r := range results {
+			if r.Migrated > 0 && !dryRun {
+				resources = append(resources, storage.CollectionResource(r.Collection))
+			}
+		}
+		recordAccess(cmd, s, storage.AccessWrite, resources...)()
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "COLLECTION\tSCANNED\tMIGRATED")
+		for _, r := range results {
+			fmt.Fprintf(w, "%s\t%d\t%d\n", r.Collection, r.Scanned, r.Migrated)
+		}
+		if flushErr := w.Flush(); flushErr != nil {
+			return flushErr
+		}
+		if dryRun {
+			fmt.Fprintln(cmd.ErrOrStderr(), "dry run, no document was changed")
+		}
+
+		var batchErr *storage.BatchError
+		if errors.As(err, &batchErr) {
+			for id, failure := range batchErr.Failures {
+				fmt.Fprintf(cmd.ErrOrStderr(), "%s: %v\n", id, failure)
+			}
+			return fmt.Errorf("%d documents were not migrated", len(batchErr.Failures))
+		}
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.Flags().Bool("dry-run", false, "Show how many documents would be migrated, without changing them")
+	migrateCmd.Flags().String("project", "blup-432616", "GCP project of the Firestore database")
+	migrateCmd.Flags().String("database", "blup-db", "Firestore database")
+}
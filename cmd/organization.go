@@ -0,0 +1,154 @@
+// Package cmd organization.go gather the commands that manage the organizations (law firms) and the OABs they
+// own.
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/storage"
+	"github.com/spf13/cobra"
+)
+
+var organizationCmd = &cobra.Command{
+	Use:   "organization",
+	Short: "Manage the organizations and the OABs they own",
+	Long: `Manage the organizations and the OABs they own.
+
+The members of an organization only see the processes of its OABs, so the OABs must be checked before they are
+set. The members and the annotations are managed by the owners and the admins of the organization, through the
+API.`,
+}
+
+var organizationCreateCmd = &cobra.Command{
+	Use:     "create",
+	Short:   "Create an organization with its OABs and its first owner",
+	Example: `  esaj organization create --name "Silva Advogados" --oab 123456/SP --oab 654321/RJ --owner user_123`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		name, _ := cmd.Flags().GetString("name")
+		owner, _ := cmd.Flags().GetString("owner")
+		oabs, err := organizationOABs(cmd)
+		if err != nil {
+			return err
+		}
+		id, err := storage.NewID()
+		if err != nil {
+			return err
+		}
+
+		s, closeFn, err := firestoreStorage(cmd)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		ctx := cmd.Context()
+		org := storage.Organization{ID: id, Name: strings.TrimSpace(name), OABs: oabs}
+		if err := s.SaveOrganization(ctx, org); err != nil {
+			return err
+		}
+		if err := s.SaveMember(ctx, storage.Member{OrganizationID: id, UserID: owner, Role: storage.RoleOwner}); err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), id)
+		return nil
+	},
+}
+
+var organizationOABsCmd = &cobra.Command{
+	Use:     "oabs [organization-id]",
+	Short:   "Replace the OABs of an organization",
+	Example: `  esaj organization oabs 0f1e2d3c --oab 123456/SP`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		oabs, err := organizationOABs(cmd)
+		if err != nil {
+			return err
+		}
+		s, closeFn, err := firestoreStorage(cmd)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		org, err := s.GetOrganization(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+		org.OABs = oabs
+		return s.SaveOrganization(cmd.Context(), org)
+	},
+}
+
+var organizationShowCmd = &cobra.Command{
+	Use:   "show [organization-id]",
+	Short: "Show an organization with its OABs and members",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, closeFn, err := firestoreStorage(cmd)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		org, err := s.GetOrganization(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+		members, err := s.Members(cmd.Context(), org.ID)
+		if err != nil {
+			return err
+		}
+
+		oabs := make([]string, 0, len(org.OABs))
+		for _, oab := range org.OABs {
+			oabs = append(oabs, oab.String())
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%s (%s)\nOABs: %s\n\n", org.Name, org.ID, strings.Join(oabs, ", "))
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "USER\tROLE\tSINCE")
+		for _, m := range members {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", m.UserID, m.Role, m.CreatedAt.Format(time.RFC3339))
+		}
+		return w.Flush()
+	},
+}
+
+// organizationOABs parses the oab flags, without the repeated ones, up to storage.MaxOrganizationOABs.
+func organizationOABs(cmd *cobra.Command) ([]esaj.OAB, error) {
+	raw, _ := cmd.Flags().GetStringArray("oab")
+	var oabs []esaj.OAB
+	for _, r := range raw {
+		oab, err := esaj.ParseOAB(r)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(oabs, oab) {
+			oabs = append(oabs, oab)
+		}
+	}
+	if len(oabs) > storage.MaxOrganizationOABs {
+		return nil, fmt.Errorf("at most %d oabs are allowed", storage.MaxOrganizationOABs)
+	}
+	return oabs, nil
+}
+
+func init() {
+	rootCmd.AddCommand(organizationCmd)
+	organizationCmd.AddCommand(organizationCreateCmd, organizationOABsCmd, organizationShowCmd)
+	organizationCmd.PersistentFlags().String("project", "blup-432616", "GCP project of the Firestore database")
+	organizationCmd.PersistentFlags().String("database", "blup-db", "Firestore database")
+
+	for _, c := range []*cobra.Command{organizationCreateCmd, organizationOABsCmd} {
+		c.Flags().StringArray("oab", nil, "OAB owned by the organization, repeated for many of them")
+	}
+	organizationCreateCmd.Flags().String("name", "", "Name of the organization")
+	organizationCreateCmd.Flags().String("owner", "", "Clerk user ID of the first owner")
+	_ = organizationCreateCmd.MarkFlagRequired("name")
+	_ = organizationCreateCmd.MarkFlagRequired("owner")
+}
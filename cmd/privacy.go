@@ -0,0 +1,166 @@
+// Package cmd privacy.go gather the LGPD commands, that export the data of a user, purge the deleted users,
+// anonymize a party and list the audit of these operations.
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/perebaj/esaj/lgpd"
+	"github.com/perebaj/esaj/storage"
+	"github.com/spf13/cobra"
+)
+
+var privacyCmd = &cobra.Command{
+	Use:   "privacy",
+	Short: "Run the LGPD operations on personal data",
+	Long: `Run the LGPD operations on personal data.
+
+Each operation is recorded in the privacy audit with the actor that requested it, without the personal data
+itself.`,
+}
+
+var privacyExportCmd = &cobra.Command{
+	Use:   "export [user-id]",
+	Short: "Export all the data tied to a user as JSON",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		actor, _ := cmd.Flags().GetString("actor")
+		svc, closeFn, err := privacyService(cmd)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		export, err := svc.Export(cmd.Context(), actor, args[0])
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(export)
+	},
+}
+
+var privacyPurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Remove the users deleted more than the grace period ago",
+	Long: `Remove the users deleted more than the grace period ago, with the movements they read.
+
+A deleted user is only marked as deleted, so it can still be restored during the grace period.`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		actor, _ := cmd.Flags().GetString("actor")
+		grace, _ := cmd.Flags().GetDuration("grace-period")
+		svc, closeFn, err := privacyService(cmd)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		purged, err := svc.Purge(cmd.Context(), actor, grace)
+		for _, id := range purged {
+			fmt.Fprintln(cmd.OutOrStdout(), id)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%d users purged\n", len(purged))
+		return batchErr(cmd, err, "documents were not purged")
+	},
+}
+
+var privacyAnonymizeCmd = &cobra.Command{
+	Use:   "anonymize [name]",
+	Short: "Replace a party name in the saved processes and in the ones saved later",
+	Long: `Replace a party name in the saved processes and in the ones saved later.
+
+The name is replaced by ` + storage.Anonymized + ` in the parties of the processes, in their history and in their
+movements, matching whole words regardless of case, accents and spaces. The audit keeps a hash of the name.`,
+	Example: `  esaj privacy anonymize "José da Silva" --actor dpo@example.com`,
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		actor, _ := cmd.Flags().GetString("actor")
+		s, closeFn, err := firestoreStorage(cmd)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		changed, err := lgpd.NewService(s).Anonymize(cmd.Context(), actor, strings.Join(args, " "))
+		resources := make([]string, 0, len(changed))
+		for _, id := range changed {
+			resources = append(resources, storage.ProcessResource(id))
+		}
+		recordAccess(cmd, s, storage.AccessWrite, resources...)()
+		for _, id := range changed {
+			fmt.Fprintln(cmd.OutOrStdout(), id)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%d processes anonymized\n", len(changed))
+		return batchErr(cmd, err, "documents were not anonymized")
+	},
+}
+
+var privacyAuditCmd = &cobra.Command{
+	Use:   "audit [subject]",
+	Short: "List the audit of the LGPD operations, of a user ID or anonymized name hash",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var subject string
+		if len(args) > 0 {
+			subject = args[0]
+		}
+		svc, closeFn, err := privacyService(cmd)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		audits, err := svc.Audits(cmd.Context(), subject)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CREATED\tOPERATION\tSUBJECT\tACTOR\tRECORDS")
+		for _, a := range audits {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n",
+				a.CreatedAt.Format(time.RFC3339), a.Operation, a.Subject, a.Actor, len(a.Records))
+		}
+		return w.Flush()
+	},
+}
+
+// privacyService returns the LGPD service of the Firestore storage, and the function that closes its client.
+func privacyService(cmd *cobra.Command) (lgpd.Service, func(), error) {
+	s, closeFn, err := firestoreStorage(cmd)
+	if err != nil {
+		return lgpd.Service{}, nil, err
+	}
+	return lgpd.NewService(s), closeFn, nil
+}
+
+// batchErr prints the failures of a *storage.BatchError, returning a summary of them.
+func batchErr(cmd *cobra.Command, err error, msg string) error {
+	var batchErr *storage.BatchError
+	if errors.As(err, &batchErr) {
+		for id, failure := range batchErr.Failures {
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s: %v\n", id, failure)
+		}
+		return fmt.Errorf("%d %s", len(batchErr.Failures), msg)
+	}
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(privacyCmd)
+	privacyCmd.AddCommand(privacyExportCmd, privacyPurgeCmd, privacyAnonymizeCmd, privacyAuditCmd)
+	privacyCmd.PersistentFlags().String("project", "blup-432616", "GCP project of the Firestore database")
+	privacyCmd.PersistentFlags().String("database", "blup-db", "Firestore database")
+
+	for _, c := range []*cobra.Command{privacyExportCmd, privacyPurgeCmd, privacyAnonymizeCmd} {
+		c.Flags().String("actor", "", "Who requested the operation, recorded in the audit")
+		_ = c.MarkFlagRequired("actor")
+	}
+	privacyPurgeCmd.Flags().Duration("grace-period", lgpd.DefaultGracePeriod, "How long a deleted user is kept")
+}
@@ -3,12 +3,14 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"time"
 
 	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/metrics"
 	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
 )
@@ -30,6 +32,7 @@ var collectCmd = &cobra.Command{
 		oab, _ := cmd.Flags().GetString("oab")
 		processID, _ := cmd.Flags().GetString("process")
 		output, _ := cmd.Flags().GetString("output")
+		foro, _ := cmd.Flags().GetString("foro")
 		ctx := cmd.Context()
 		if oab == "" && processID == "" {
 			fmt.Println("Error: You must provide either an OAB number or a process ID")
@@ -37,14 +40,36 @@ var collectCmd = &cobra.Command{
 			return
 		}
 
-		eClient := esaj.New(esaj.Config{}, &http.Client{
-			Timeout: 30 * time.Second,
+		eClient := esaj.New(esaj.ConfigFromEnv(), &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: metrics.Transport(nil),
 		})
 
+		proxies, err := proxyPool(cmd)
+		if err != nil {
+			fmt.Println("Error creating proxy pool:", err)
+			return
+		}
+		if proxies != nil {
+			go proxies.Run(ctx)
+			eClient.Client.Transport = metrics.Transport(proxies)
+		}
+
+		metricsAddr, _ := cmd.Flags().GetString("metrics-addr")
+		if metricsAddr != "" {
+			go serveMetrics(metricsAddr)
+		}
+		defer printMetricsSummary()
+
 		if oab != "" {
-			fmt.Println("Collecting data for OAB number:", oab)
-			seed, err := eClient.SearchByOAB(ctx, oab)
+			parsedOAB, err := esaj.ParseOAB(oab)
 			if err != nil {
+				fmt.Println("Error parsing OAB:", err)
+				return
+			}
+			fmt.Println("Collecting data for OAB number:", parsedOAB)
+			seed, err := eClient.SearchByOABInForo(ctx, parsedOAB, foro)
+			if err != nil && !errors.Is(err, esaj.ErrNoProcesses) {
 				fmt.Println("Error searching by OAB:", err)
 				return
 			}
@@ -56,7 +81,7 @@ var collectCmd = &cobra.Command{
 					fmt.Println("Error fetching basic process info:", err)
 					return
 				}
-				processBasicInfo.OAB = oab
+				processBasicInfo.OAB = parsedOAB
 				allProcesses = append(allProcesses, *processBasicInfo)
 				_ = bar.Add(1)
 			}
@@ -89,7 +114,7 @@ var collectCmd = &cobra.Command{
 				return
 			}
 			fmt.Println("Collecting data for Process ID:", processID)
-			processCode, err := eClient.ProcessCodeByProcessID(processID)
+			processCode, err := eClient.ProcessCodeByProcessID(ctx, processID)
 			if err != nil {
 				fmt.Println("Error getting process code:", err)
 				return
@@ -114,18 +139,49 @@ var collectCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(collectCmd)
 	rootCmd.AddCommand(downloadCmd)
-	collectCmd.Flags().StringP("oab", "o", "", "OAB number to search")
+	collectCmd.Flags().StringP("oab", "o", "", "OAB number to search. Example: 103289/SP, when the UF is omitted SP is used")
 	collectCmd.Flags().StringP("process", "p", "", "Process ID to search")
 	collectCmd.Flags().StringP("output", "O", "processes.json", "Output file")
+	collectCmd.Flags().StringP("foro", "f", "", "Restrict the OAB search to a foro code. Example: 0053")
+	collectCmd.Flags().String("metrics-addr", "", "Address to expose the /metrics endpoint while collecting. Example: :9090")
+	collectCmd.Flags().StringSlice("proxy", nil, "HTTP or SOCKS proxy used in rotation, can be repeated. Example: socks5://10.0.0.2:1080")
 }
 
-var downloadCmd = &cobra.Command{
-	Use:   "download",
-	Short: "Download all PDFs documents related to a specific process",
-	Long:  `Download all PDFs documents related to a specific process`,
-	Run: func(_ *cobra.Command, _ []string) {
-		// Do Stuff Here
-	},
+// proxyPool returns the pool of the proxies of the --proxy flag, or nil without proxies.
+func proxyPool(cmd *cobra.Command) (*esaj.ProxyPool, error) {
+	proxies, _ := cmd.Flags().GetStringSlice("proxy")
+	if len(proxies) == 0 {
+		return nil, nil
+	}
+	return esaj.NewProxyPool(proxies...)
+}
+
+// proxyTransport returns the transport of the requests sent through the pool, or directly when it's nil,
+// recorded by the metrics.
+func proxyTransport(proxies *esaj.ProxyPool) http.RoundTripper {
+	if proxies == nil {
+		return metrics.Transport(nil)
+	}
+	return metrics.Transport(proxies)
+}
+
+// serveMetrics exposes the /metrics endpoint, used by the long running commands.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	if err := server.ListenAndServe(); err != nil {
+		fmt.Println("Error serving metrics:", err)
+	}
+}
+
+// printMetricsSummary prints the metrics collected by the command.
+func printMetricsSummary() {
+	fmt.Println("Metrics summary:")
+	if err := metrics.Summary(os.Stdout); err != nil {
+		fmt.Println("Error printing metrics summary:", err)
+	}
 }
 
 // Execute is the entry point for the command line interface.
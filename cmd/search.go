@@ -0,0 +1,118 @@
+// Package cmd search.go gather the search commands, that rebuild the search index and query it.
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	fs "cloud.google.com/go/firestore"
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/firestore"
+	"github.com/perebaj/esaj/search"
+	"github.com/perebaj/esaj/storage"
+	"github.com/spf13/cobra"
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search",
+	Short: "Search the processes by party, lawyer, class, subject, judge or vara",
+}
+
+var searchRebuildCmd = &cobra.Command{
+	Use:   "rebuild",
+	Short: "Rebuild the search index from the saved processes",
+	Long: `Rebuild the search index from the saved processes.
+
+Each saved process is indexed again and the search documents of the processes that don't exist anymore are
+deleted. The processes are indexed when they are saved, so it's only needed when the indexing changes or when
+the processes were saved by a version without the search.`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		ctx := cmd.Context()
+		s, closeFn, err := firestoreStorage(cmd)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+		defer recordAccess(cmd, s, storage.AccessWrite, storage.CollectionResource("search_index"))()
+
+		indexed, err := s.RebuildSearchIndex(ctx)
+		fmt.Fprintf(cmd.OutOrStdout(), "%d processes indexed\n", indexed)
+
+		return batchErr(cmd, err, "processes were not indexed")
+	},
+}
+
+var searchQueryCmd = &cobra.Command{
+	Use:   "query [text]",
+	Short: "Search the processes of the OABs",
+	Example: `  esaj search query "joao execucao" --oab 123456/SP
+  esaj search query "banco" --oab 123456/SP --oab 654321/RJ --limit 5`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rawOABs, _ := cmd.Flags().GetStringSlice("oab")
+		limit, _ := cmd.Flags().GetInt("limit")
+		ctx := cmd.Context()
+
+		q := search.Query{Text: strings.Join(args, " "), Limit: limit}
+		var resources []string
+		for _, raw := range rawOABs {
+			oab, err := esaj.ParseOAB(raw)
+			if err != nil {
+				return err
+			}
+			q.OABs = append(q.OABs, oab)
+			resources = append(resources, storage.OABResource(oab))
+		}
+
+		s, closeFn, err := firestoreStorage(cmd)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+		defer recordAccess(cmd, s, storage.AccessRead, resources...)()
+
+		results, err := s.SearchProcesses(ctx, q)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PROCESS\tOAB\tSCORE\tFIELDS\tCLASS")
+		for _, r := range results {
+			fields := make([]string, 0, len(r.Fields))
+			for _, f := range r.Fields {
+				fields = append(fields, string(f))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%.3f\t%s\t%s\n",
+				r.Process.ProcessID, r.Process.OAB, r.Score, strings.Join(fields, ","), r.Process.Class)
+		}
+		return w.Flush()
+	},
+}
+
+// firestoreStorage returns the Firestore storage of the project and database flags, and the function that
+// closes its client.
+func firestoreStorage(cmd *cobra.Command) (*firestore.Storage, func(), error) {
+	projectID, _ := cmd.Flags().GetString("project")
+	database, _ := cmd.Flags().GetString("database")
+
+	client, err := fs.NewClientWithDatabase(cmd.Context(), projectID, database)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating firestore client: %w", err)
+	}
+	return firestore.NewStorage(client, projectID), func() {
+		_ = client.Close()
+	}, nil
+}
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+	searchCmd.AddCommand(searchRebuildCmd, searchQueryCmd)
+	searchCmd.PersistentFlags().String("project", "blup-432616", "GCP project of the Firestore database")
+	searchCmd.PersistentFlags().String("database", "blup-db", "Firestore database")
+
+	searchQueryCmd.Flags().StringSlice("oab", nil, "OAB whose processes are searched, repeated for many OABs")
+	searchQueryCmd.Flags().Int("limit", search.DefaultLimit, "Maximum number of results")
+	_ = searchQueryCmd.MarkFlagRequired("oab")
+}
@@ -0,0 +1,242 @@
+// Package cmd serve.go gather the serve command, that serves all the handlers of the Cloud Functions on a single
+// server.
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	fs "cloud.google.com/go/firestore"
+	"github.com/perebaj/esaj/api"
+	"github.com/perebaj/esaj/audit"
+	"github.com/perebaj/esaj/clerk"
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/firestore"
+	"github.com/perebaj/esaj/lgpd"
+	"github.com/perebaj/esaj/logger"
+	"github.com/perebaj/esaj/metrics"
+	"github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/storage/memory"
+	"github.com/perebaj/esaj/storage/sqlite"
+	"github.com/spf13/cobra"
+)
+
+// The storage backends of the serve command.
+const (
+	storageFirestore = "firestore"
+	storageSQLite    = "sqlite"
+	storageMemory    = "memory"
+)
+
+// middlewares are the middlewares of the serve command by name, in the order they wrap the router, the first
+// being the outermost. auth is inside cors, so the preflight requests are answered without credentials.
+var middlewares = []string{"recovery", "trace", "logging", "cors", "auth"}
+
+// publicPaths are served without authentication by the auth middleware. The clerk webhook verifies its own
+// signature.
+var publicPaths = []string{"/clerk-webhook", "/metrics", "/healthz"}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve all the handlers of the API on a single server",
+	Long: `Serve all the handlers of the API on a single server.
+
+Each HTTP Cloud Function is served at its name without the fn- prefix, only for the methods it accepts. Example:
+fn-process-history is served at GET /process-history. The fn-fetch-process-on-written function is triggered by
+the Firestore events, so it's not served. GET /metrics and GET /healthz are served too.
+
+The flags default to the ESAJ_* environment variables, and ESAJ_ADMIN_TOKEN is the bearer token of the admins of
+the platform. The auth middleware, on by default, authenticates the callers with a clerk session token, verified
+with the PEM public key in ESAJ_CLERK_JWT_KEY, or with the ESAJ_GATEWAY_SECRET of a gateway that verified the
+session, and sets X-User-ID from them. ESAJ_CLERK_WEBHOOK_SECRET verifies the signatures of the clerk webhooks.
+The server stops on SIGINT or SIGTERM, waiting for the requests in progress and writing the
+buffered access events before exiting.`,
+	Example: `  esaj serve --addr :8080 --storage sqlite --sqlite-path esaj.db
+  ESAJ_STORAGE=memory esaj serve --middleware recovery,trace,logging,cors,auth --cors-origin http://localhost:3000`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		addr, _ := cmd.Flags().GetString("addr")
+		enabled, _ := cmd.Flags().GetStringSlice("middleware")
+		origins, _ := cmd.Flags().GetStringSlice("cors-origin")
+		logLevel, _ := cmd.Flags().GetString("log-level")
+		logFormat, _ := cmd.Flags().GetString("log-format")
+		shutdownTimeout, _ := cmd.Flags().GetDuration("shutdown-timeout")
+		authorizedParties, _ := cmd.Flags().GetStringSlice("clerk-authorized-party")
+
+		for _, name := range enabled {
+			if !slices.Contains(middlewares, name) {
+				return fmt.Errorf("invalid middleware %q, use one of %v", name, middlewares)
+			}
+		}
+
+		auth := api.AuthConfig{
+			AuthorizedParties: authorizedParties,
+			GatewaySecret:     os.Getenv("ESAJ_GATEWAY_SECRET"),
+			AdminToken:        os.Getenv("ESAJ_ADMIN_TOKEN"),
+			Public:            publicPaths,
+		}
+		if key := os.Getenv("ESAJ_CLERK_JWT_KEY"); key != "" {
+			var err error
+			if auth.ClerkKey, err = clerk.ParsePublicKey(key); err != nil {
+				return fmt.Errorf("error parsing ESAJ_CLERK_JWT_KEY: %w", err)
+			}
+		}
+		if slices.Contains(enabled, "auth") && auth.ClerkKey == nil && auth.GatewaySecret == "" {
+			return errors.New("the auth middleware needs ESAJ_CLERK_JWT_KEY or ESAJ_GATEWAY_SECRET")
+		}
+
+		l, err := logger.NewLoggerSlog(logger.ConfigLogger{Level: logLevel, Format: logFormat})
+		if err != nil {
+			return fmt.Errorf("error initializing logger: %w", err)
+		}
+		slog.SetDefault(l)
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		s, closeFn, err := openStorage(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		esajClient := esaj.New(esaj.Config{}, &http.Client{
+			Timeout:   90 * time.Second,
+			Transport: metrics.Transport(nil),
+		})
+		recorder := audit.NewRecorder(s, audit.DefaultBuffer)
+		adminToken := os.Getenv("ESAJ_ADMIN_TOKEN")
+
+		mux := http.NewServeMux()
+		mux.Handle("/", api.NewRouter(api.Handlers{
+			Processes:     api.NewHandler(s, esajClient, recorder),
+			Users:         api.NewUserHandler(s, os.Getenv("ESAJ_CLERK_WEBHOOK_SECRET"), adminToken),
+			Privacy:       api.NewPrivacyHandler(lgpd.NewService(s), adminToken, recorder),
+			Organizations: api.NewOrganizationHandler(s, adminToken, recorder),
+			Audit:         api.NewAuditHandler(s, adminToken),
+		}))
+		mux.Handle("GET /metrics", metrics.Handler())
+		mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+
+		var chain []api.Middleware
+		for _, name := range middlewares {
+			if !slices.Contains(enabled, name) {
+				continue
+			}
+			switch name {
+			case "recovery":
+				chain = append(chain, api.Recovery)
+			case "trace":
+				chain = append(chain, api.Trace)
+			case "logging":
+				chain = append(chain, api.Logging)
+			case "cors":
+				chain = append(chain, api.CORS(origins))
+			case "auth":
+				chain = append(chain, api.Auth(auth))
+			}
+		}
+
+		server := &http.Server{
+			Addr:              addr,
+			Handler:           api.Chain(mux, chain...),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		serveErr := make(chan error, 1)
+		go func() {
+			serveErr <- server.ListenAndServe()
+		}()
+		slog.Info("serving the API", "addr", addr, "storage", cmd.Flag("storage").Value.String(), "middlewares", enabled)
+
+		select {
+		case err := <-serveErr:
+			if !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("error serving the API: %w", err)
+			}
+		case <-ctx.Done():
+			slog.Info("shutting down the API", "timeout", shutdownTimeout)
+		}
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("error shutting down the server", "error", err)
+		}
+		if err := recorder.Close(shutdownCtx); err != nil {
+			slog.Error("error writing the buffered access events", "error", err)
+		}
+		return nil
+	},
+}
+
+// openStorage returns the storage of the storage flag, and the function that closes it.
+func openStorage(ctx context.Context, cmd *cobra.Command) (storage.Storage, func(), error) {
+	backend, _ := cmd.Flags().GetString("storage")
+	switch backend {
+	case storageFirestore:
+		projectID, _ := cmd.Flags().GetString("project")
+		database, _ := cmd.Flags().GetString("database")
+		client, err := fs.NewClientWithDatabase(ctx, projectID, database)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error creating firestore client: %w", err)
+		}
+		return firestore.NewStorage(client, projectID), func() {
+			_ = client.Close()
+		}, nil
+	case storageSQLite:
+		path, _ := cmd.Flags().GetString("sqlite-path")
+		s, err := sqlite.Open(ctx, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, func() {
+			if err := s.Close(); err != nil {
+				slog.Error("error closing sqlite storage", "error", err)
+			}
+		}, nil
+	case storageMemory:
+		return memory.NewStorage(), func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("invalid storage %q, use %s, %s or %s",
+			backend, storageFirestore, storageSQLite, storageMemory)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().String("addr", esaj.GetEnvWithDefault("ESAJ_ADDR", ":8080"), "Address of the server")
+	serveCmd.Flags().String("storage", esaj.GetEnvWithDefault("ESAJ_STORAGE", storageFirestore),
+		"Storage backend: firestore, sqlite or memory")
+	serveCmd.Flags().String("project", esaj.GetEnvWithDefault("ESAJ_PROJECT", "blup-432616"),
+		"GCP project of the Firestore database")
+	serveCmd.Flags().String("database", esaj.GetEnvWithDefault("ESAJ_DATABASE", "blup-db"), "Firestore database")
+	serveCmd.Flags().String("sqlite-path", esaj.GetEnvWithDefault("ESAJ_SQLITE_PATH", "esaj.db"),
+		"File of the SQLite database")
+	serveCmd.Flags().StringSlice("middleware",
+		strings.Split(esaj.GetEnvWithDefault("ESAJ_MIDDLEWARES", "recovery,trace,logging,auth"), ","),
+		"Middlewares of the server: recovery, trace, logging, cors and auth. They always wrap the server in this order")
+	serveCmd.Flags().StringSlice("cors-origin", strings.Split(esaj.GetEnvWithDefault("ESAJ_CORS_ORIGINS", "*"), ","),
+		"Origins allowed by the cors middleware, * for all")
+	var authorizedParties []string
+	if parties := os.Getenv("ESAJ_CLERK_AUTHORIZED_PARTIES"); parties != "" {
+		authorizedParties = strings.Split(parties, ",")
+	}
+	serveCmd.Flags().StringSlice("clerk-authorized-party", authorizedParties,
+		"Origins of the frontends whose clerk session tokens are accepted by the auth middleware, all when empty")
+	serveCmd.Flags().String("log-level", esaj.GetEnvWithDefault("ESAJ_LOG_LEVEL", logger.LevelInfo),
+		"Log level: debug, info, warn or error")
+	serveCmd.Flags().String("log-format", esaj.GetEnvWithDefault("ESAJ_LOG_FORMAT", logger.FormatJSON),
+		"Log format: logfmt, json or gcp")
+	serveCmd.Flags().Duration("shutdown-timeout", 15*time.Second,
+		"How long the server waits for the requests in progress when stopping")
+}
@@ -0,0 +1,415 @@
+// Package cmd session.go gather the session command, used by the operators to debug the eSAJ sessions.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/spf13/cobra"
+)
+
+var sessionCmd = &cobra.Command{
+	Use:   "session",
+	Short: "Manage the eSAJ sessions used by the authenticated requests",
+	Long: `Manage the eSAJ sessions used by the authenticated requests.
+
+The sessions are saved encrypted in the session dir, one per account. ESAJ_SESSION_SECRET must be set to
+save and load them. The credentials are read from ESAJ_ACCOUNTS or ESAJ_USERNAME and ESAJ_PASSWORD.`,
+}
+
+var sessionLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in the eSAJ website and save the session",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		if err := validateSessionFormat(format); err != nil {
+			return err
+		}
+
+		store, err := sessionStore(cmd)
+		if err != nil {
+			return err
+		}
+
+		proxies, err := proxyPool(cmd)
+		if err != nil {
+			return err
+		}
+
+		provider, account, closeProvider, err := sessionProvider(cmd, proxies)
+		if err != nil {
+			return err
+		}
+		defer closeProvider()
+
+		// the session is bound to the proxy that created it, like the sessions of esaj.SessionManager
+		ctx := cmd.Context()
+		var proxy string
+		if proxies != nil {
+			proxy, err = proxies.Pick()
+			if err != nil {
+				return err
+			}
+			ctx = esaj.WithProxy(ctx, proxy)
+		}
+
+		cookies, err := provider.NewSession(ctx)
+		if err != nil {
+			return fmt.Errorf("error logging in: %w", err)
+		}
+
+		jar, err := esaj.NewJar(esaj.ESAJURL)
+		if err != nil {
+			return err
+		}
+		jar.Proxy = proxy
+		jar.Add(cookies...)
+
+		if err := store.Save(account, jar); err != nil {
+			return fmt.Errorf("error saving session: %w", err)
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "session of %s saved in %s\n", account, store.Dir)
+
+		return printSessionConfig(cmd.OutOrStdout(), format, jar.Config())
+	},
+}
+
+var sessionShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the cookies of the saved session",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		if format != "table" && format != "json" {
+			return fmt.Errorf("invalid format %q, use table or json", format)
+		}
+
+		jar, account, err := loadSession(cmd)
+		if err != nil {
+			return err
+		}
+
+		cookies := jar.All()
+		sort.Slice(cookies, func(i, j int) bool {
+			if cookies[i].Path != cookies[j].Path {
+				return cookies[i].Path < cookies[j].Path
+			}
+			return cookies[i].Name < cookies[j].Name
+		})
+
+		if format == "json" {
+			type cookie struct {
+				Name    string     `json:"name"`
+				Value   string     `json:"value"`
+				Path    string     `json:"path"`
+				Expires *time.Time `json:"expires,omitempty"`
+			}
+			out := struct {
+				Account string   `json:"account"`
+				Cookies []cookie `json:"cookies"`
+			}{Account: account}
+			for _, c := range cookies {
+				cc := cookie{Name: c.Name, Value: c.Value, Path: c.Path}
+				if !c.Expires.IsZero() {
+					cc.Expires = &c.Expires
+				}
+				out.Cookies = append(out.Cookies, cc)
+			}
+			return writeJSON(cmd.OutOrStdout(), out)
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "account: %s\n", account)
+		fmt.Fprintln(w, "PATH\tNAME\tVALUE\tEXPIRES")
+		for _, c := range cookies {
+			expires := "session"
+			if !c.Expires.IsZero() {
+				expires = c.Expires.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Path, c.Name, c.Value, expires)
+		}
+		return w.Flush()
+	},
+}
+
+var sessionExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print the saved session as env exports or JSON",
+	Long: `Print the saved session as env exports or JSON. The exports are read by the collect command. Example:
+
+	eval "$(esaj session export --account 12345678900)"`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		if err := validateSessionFormat(format); err != nil {
+			return err
+		}
+
+		jar, _, err := loadSession(cmd)
+		if err != nil {
+			return err
+		}
+
+		return printSessionConfig(cmd.OutOrStdout(), format, jar.Config())
+	},
+}
+
+var sessionCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check if the saved session is still valid",
+	Long:  `Check if the saved session is still valid, opening the pasta digital of a process that the account can access`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		processID, _ := cmd.Flags().GetString("process")
+		if processID == "" {
+			return errors.New("--process is required")
+		}
+
+		jar, account, err := loadSession(cmd)
+		if err != nil {
+			return err
+		}
+
+		proxies, err := proxyPool(cmd)
+		if err != nil {
+			return err
+		}
+		// the session is checked through the proxy that created it, even without --proxy
+		if proxies == nil && jar.Proxy != "" {
+			proxies, err = esaj.NewProxyPool(jar.Proxy)
+			if err != nil {
+				return err
+			}
+		}
+
+		eClient := esaj.New(jar.Config(), &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: proxyTransport(proxies),
+		})
+
+		err = eClient.CheckSession(cmd.Context(), processID)
+		if errors.Is(err, esaj.ErrSessionExpired) {
+			return fmt.Errorf("session of %s expired, run esaj session login", account)
+		}
+		if err != nil {
+			return fmt.Errorf("error checking session: %w", err)
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "session of %s is valid\n", account)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sessionCmd)
+	sessionCmd.AddCommand(sessionLoginCmd, sessionShowCmd, sessionExportCmd, sessionCheckCmd)
+
+	sessionCmd.PersistentFlags().StringP("account", "a", "", "Account of the session, the eSAJ username. Default: the first account of the env")
+	sessionCmd.PersistentFlags().String("session-dir", "", "Directory of the saved sessions. Default: ESAJ_SESSION_DIR or the user config dir")
+
+	sessionLoginCmd.Flags().String("provider", "headless", "How to log in: headless, browser, cas or certificate")
+	sessionLoginCmd.Flags().StringP("process", "p", "", "Process that the account can access, required by the headless and browser providers. Example: 1016358-63.2020.8.26.0053")
+	sessionLoginCmd.Flags().Bool("show-browser", false, "Show the browser of the headless provider")
+	sessionLoginCmd.Flags().String("cert", "", "A1 certificate file (.pfx or .p12) of the certificate provider, its password is read from ESAJ_CERT_PASSWORD")
+	sessionLoginCmd.Flags().StringP("format", "F", "json", "Output format: json or env")
+	sessionLoginCmd.Flags().StringSlice("proxy", nil, "HTTP or SOCKS proxy of the session, one of them is picked. The headless and browser providers only accept proxies without credentials. Example: socks5://10.0.0.2:1080")
+
+	sessionShowCmd.Flags().StringP("format", "F", "table", "Output format: table or json")
+	sessionExportCmd.Flags().StringP("format", "F", "env", "Output format: env or json")
+	sessionCheckCmd.Flags().StringP("process", "p", "", "Process that the account can access. Example: 1016358-63.2020.8.26.0053")
+	sessionCheckCmd.Flags().StringSlice("proxy", nil, "HTTP or SOCKS proxy used to check the session. Default: the proxy that created it")
+
+	// the errors are printed by Execute.
+	for _, c := range sessionCmd.Commands() {
+		c.SilenceUsage = true
+		c.SilenceErrors = true
+	}
+}
+
+// sessionStore returns the store of the saved sessions.
+func sessionStore(cmd *cobra.Command) (esaj.SessionStore, error) {
+	secret := os.Getenv("ESAJ_SESSION_SECRET")
+	if secret == "" {
+		return esaj.SessionStore{}, errors.New("ESAJ_SESSION_SECRET not set")
+	}
+
+	dir, _ := cmd.Flags().GetString("session-dir")
+	if dir == "" {
+		dir = os.Getenv("ESAJ_SESSION_DIR")
+	}
+	if dir == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return esaj.SessionStore{}, fmt.Errorf("error getting user config dir: %w", err)
+		}
+		dir = filepath.Join(configDir, "esaj", "sessions")
+	}
+
+	return esaj.SessionStore{Dir: dir, Secret: []byte(secret)}, nil
+}
+
+// sessionLogin returns the credentials of the --account flag, or the first one of the env.
+func sessionLogin(cmd *cobra.Command) (esaj.Login, error) {
+	account, _ := cmd.Flags().GetString("account")
+
+	logins, err := esaj.LoginsFromEnv()
+	if err != nil {
+		return esaj.Login{}, err
+	}
+
+	if account == "" {
+		return logins[0], nil
+	}
+	for _, l := range logins {
+		if l.Username == account {
+			return l, nil
+		}
+	}
+	return esaj.Login{}, fmt.Errorf("account %s not found in the env", account)
+}
+
+// sessionProvider returns the provider of the --provider flag, that logs in through the proxies when not nil,
+// the account that it logs in and the function that releases the provider.
+func sessionProvider(cmd *cobra.Command, proxies *esaj.ProxyPool) (esaj.SessionProvider, string, func(), error) {
+	name, _ := cmd.Flags().GetString("provider")
+
+	if name != "certificate" {
+		processID, _ := cmd.Flags().GetString("process")
+		showBrowser, _ := cmd.Flags().GetBool("show-browser")
+		login, err := sessionLogin(cmd)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		provider, closeFn, err := loginProvider(cmd.Context(), name, login, processID, !showBrowser, proxies)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return provider, login.Username, closeFn, nil
+	}
+
+	cert, _ := cmd.Flags().GetString("cert")
+	if cert == "" {
+		return nil, "", nil, errors.New("--cert is required by the certificate provider")
+	}
+
+	provider, err := esaj.NewCertificateProvider(cert, os.Getenv("ESAJ_CERT_PASSWORD"))
+	if err != nil {
+		return nil, "", nil, err
+	}
+	provider.Client = sessionHTTPClient(proxies)
+
+	account, _ := cmd.Flags().GetString("account")
+	if account == "" {
+		account = provider.Certificate.Leaf.Subject.CommonName
+	}
+	return provider, account, func() {}, nil
+}
+
+// loginProvider returns the provider that logs in the account with its credentials, and the function that
+// releases it. The headless and the browser providers open the pasta digital of the process, to get its cookies.
+// The providers log in through the proxy bound to the context of the login, one of the proxies when not nil.
+func loginProvider(ctx context.Context, name string, login esaj.Login, processID string, headless bool, proxies *esaj.ProxyPool) (esaj.SessionProvider, func(), error) {
+	switch name {
+	case "headless", "browser":
+		if processID == "" {
+			return nil, nil, fmt.Errorf("--process is required by the %s provider", name)
+		}
+		if err := chromeProxies(proxies); err != nil {
+			return nil, nil, fmt.Errorf("the %s provider can't use the proxies: %w", name, err)
+		}
+		if name == "headless" {
+			return esaj.HeadlessProvider{Login: login, Headless: headless, ProcessID: processID}, func() {}, nil
+		}
+		pool := esaj.NewBrowserPool(ctx, esaj.BrowserPoolConfig{Login: login, Headless: headless, ProcessID: processID})
+		return pool, pool.Close, nil
+	case "cas":
+		return esaj.CASProvider{Login: login, Client: sessionHTTPClient(proxies)}, func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("invalid provider %q, use headless, browser, cas or certificate", name)
+	}
+}
+
+// chromeProxies returns an error when a proxy of the pool can't be used by Chrome, like the ones with credentials.
+func chromeProxies(proxies *esaj.ProxyPool) error {
+	if proxies == nil {
+		return nil
+	}
+	for _, s := range proxies.Stats() {
+		if _, err := esaj.ChromeProxyServer(s.URL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sessionHTTPClient returns the client of the login requests, sent through the proxies when not nil, recorded
+// by the metrics.
+func sessionHTTPClient(proxies *esaj.ProxyPool) *http.Client {
+	return &http.Client{Timeout: 30 * time.Second, Transport: proxyTransport(proxies)}
+}
+
+// loadSession loads the saved session of the account.
+func loadSession(cmd *cobra.Command) (*esaj.Jar, string, error) {
+	store, err := sessionStore(cmd)
+	if err != nil {
+		return nil, "", err
+	}
+
+	account, _ := cmd.Flags().GetString("account")
+	if account == "" {
+		login, err := sessionLogin(cmd)
+		if err != nil {
+			return nil, "", fmt.Errorf("--account is required: %w", err)
+		}
+		account = login.Username
+	}
+
+	jar, err := store.Load(account)
+	if errors.Is(err, esaj.ErrSessionNotFound) {
+		return nil, "", fmt.Errorf("no session saved for %s, run esaj session login", account)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return jar, account, nil
+}
+
+func validateSessionFormat(format string) error {
+	if format != "env" && format != "json" {
+		return fmt.Errorf("invalid format %q, use env or json", format)
+	}
+	return nil
+}
+
+// printSessionConfig prints the cookies in the format of the esaj.Config.
+func printSessionConfig(w io.Writer, format string, config esaj.Config) error {
+	if format == "json" {
+		return writeJSON(w, map[string]string{
+			"cookie_session":     config.CookieSession,
+			"cookie_pdf_session": config.CookiePDFSession,
+		})
+	}
+
+	_, err := fmt.Fprintf(w, "export ESAJ_COOKIE_SESSION=%s\nexport ESAJ_COOKIE_PDF_SESSION=%s\n",
+		shellQuote(config.CookieSession), shellQuote(config.CookiePDFSession))
+	return err
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// shellQuote quotes s to be used in a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,256 @@
+// Package esaj account.go gather the pool of eSAJ accounts, used to spread the authenticated requests between many credentials.
+package esaj
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/perebaj/esaj/metrics"
+)
+
+const (
+	defaultAccountCooldown    = 30 * time.Minute
+	defaultAccountMaxFailures = 3
+)
+
+var (
+	// ErrAccountLocked is an error that occurs when the eSAJ website blocks the access of the account.
+	ErrAccountLocked = errors.New("account locked")
+	// ErrThrottled is an error that occurs when the eSAJ website refuses the requests because of their rate.
+	ErrThrottled = errors.New("too many requests")
+	// ErrNoAccountAvailable is an error that occurs when all accounts of the pool are cooling down.
+	ErrNoAccountAvailable = errors.New("no account available")
+	// ErrAccountNotFound is an error that occurs when the pool has no account with the given name or OAB.
+	ErrAccountNotFound = errors.New("account not found")
+)
+
+// lockedMessages are the messages shown by the eSAJ website when the access of an account is blocked.
+var lockedMessages = []string{
+	"usuário bloqueado",
+	"acesso bloqueado",
+	"conta bloqueada",
+}
+
+// accessError returns ErrThrottled or ErrAccountLocked when the response shows that the account can't be used
+// for a while. Otherwise, nil is returned.
+func accessError(statusCode int, body []byte) error {
+	if statusCode == http.StatusTooManyRequests {
+		return ErrThrottled
+	}
+
+	lower := strings.ToLower(string(body))
+	for _, msg := range lockedMessages {
+		if strings.Contains(lower, msg) {
+			return ErrAccountLocked
+		}
+	}
+	return nil
+}
+
+// Account is an eSAJ account of the AccountPool.
+type Account struct {
+	// Name identifies the account in the pool, like the eSAJ username.
+	Name string
+	// OAB is optional, it's the OAB of the lawyer that owns the account. The processes of the lawyer can be
+	// pinned to this account with PinOAB.
+	OAB     OAB
+	Session *SessionManager
+}
+
+// AccountStats is the usage of an account of the pool.
+type AccountStats struct {
+	Name     string
+	Uses     int
+	Failures int
+	// ConsecutiveFailures is reset after a request without errors.
+	ConsecutiveFailures int
+	LastError           string
+	// CooldownUntil is the time until the account stays out of the rotation. Zero if the account is available.
+	CooldownUntil time.Time
+}
+
+type accountState struct {
+	Account
+	stats AccountStats
+}
+
+// AccountPool holds many eSAJ accounts and picks one of them for each authenticated request. The accounts are
+// used in rotation, and an account that is locked, throttled or failing is left out of the rotation for a while.
+// AccountPool is safe for concurrent use across goroutines.
+type AccountPool struct {
+	// Cooldown is how long an account stays out of the rotation after being locked or throttled. Default: 30 minutes.
+	Cooldown time.Duration
+	// MaxFailures is the number of consecutive failures, of any kind, that puts an account in cooldown. Default: 3.
+	MaxFailures int
+
+	mu       sync.Mutex
+	accounts []*accountState
+	// pins maps a process ID to the name of the account that must be used to access it.
+	pins map[string]string
+	next int
+	now  func() time.Time
+}
+
+// NewAccountPool creates a new AccountPool. The names of the accounts must be unique.
+func NewAccountPool(accounts ...Account) (*AccountPool, error) {
+	if len(accounts) == 0 {
+		return nil, errors.New("account pool without accounts")
+	}
+
+	pool := &AccountPool{
+		Cooldown:    defaultAccountCooldown,
+		MaxFailures: defaultAccountMaxFailures,
+		pins:        make(map[string]string),
+		now:         time.Now,
+	}
+
+	names := make(map[string]bool)
+	for _, a := range accounts {
+		if a.Name == "" || a.Session == nil {
+			return nil, errors.New("account without name or session")
+		}
+		if names[a.Name] {
+			return nil, fmt.Errorf("duplicated account %q", a.Name)
+		}
+		names[a.Name] = true
+		pool.accounts = append(pool.accounts, &accountState{Account: a, stats: AccountStats{Name: a.Name}})
+	}
+	return pool, nil
+}
+
+// Pin makes all requests of the process use the account, useful when only that account has access to the
+// process, like the account of the lawyer of the case.
+// - processID example: 1016358-63.2020.8.26.0053
+func (p *AccountPool) Pin(processID, account string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, a := range p.accounts {
+		if a.Name == account {
+			p.pins[processID] = account
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrAccountNotFound, account)
+}
+
+// PinOAB pins the process to the account of the lawyer with the given OAB.
+func (p *AccountPool) PinOAB(processID string, oab OAB) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, a := range p.accounts {
+		if !a.OAB.IsZero() && a.OAB == oab {
+			p.pins[processID] = a.Name
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: oab %s", ErrAccountNotFound, oab)
+}
+
+// Unpin removes the pin of the process, it goes back to the rotation.
+func (p *AccountPool) Unpin(processID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.pins, processID)
+}
+
+// Stats returns the usage of all accounts, in the order they were added to the pool.
+func (p *AccountPool) Stats() []AccountStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := make([]AccountStats, 0, len(p.accounts))
+	for _, a := range p.accounts {
+		stats = append(stats, a.stats)
+	}
+	return stats
+}
+
+// pick returns the account that must be used by the process. If the process is pinned, its account is returned
+// even if it's not available, since no other account can access the process. Otherwise, the next available
+// account of the rotation is returned. The second return is true when the process is pinned.
+func (p *AccountPool) pick(processID string) (*accountState, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+
+	if name, ok := p.pins[processID]; ok && processID != "" {
+		for _, a := range p.accounts {
+			if a.Name != name {
+				continue
+			}
+			if now.Before(a.stats.CooldownUntil) {
+				return nil, true, fmt.Errorf("%w: the account %s of the process %s is cooling down until %s",
+					ErrNoAccountAvailable, name, processID, a.stats.CooldownUntil.Format(time.RFC3339))
+			}
+			return a, true, nil
+		}
+	}
+
+	for i := 0; i < len(p.accounts); i++ {
+		a := p.accounts[(p.next+i)%len(p.accounts)]
+		if now.Before(a.stats.CooldownUntil) {
+			continue
+		}
+		p.next = (p.next + i + 1) % len(p.accounts)
+		return a, false, nil
+	}
+	return nil, false, ErrNoAccountAvailable
+}
+
+// report updates the usage of the account after a request.
+func (p *AccountPool) report(a *accountState, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	a.stats.Uses++
+	if err == nil {
+		a.stats.ConsecutiveFailures = 0
+		return
+	}
+
+	a.stats.Failures++
+	a.stats.ConsecutiveFailures++
+	a.stats.LastError = err.Error()
+
+	if errors.Is(err, ErrAccountLocked) || errors.Is(err, ErrThrottled) || a.stats.ConsecutiveFailures >= p.MaxFailures {
+		a.stats.CooldownUntil = p.now().Add(p.Cooldown)
+		slog.Warn("esaj account in cooldown", "account", a.Name, "until", a.stats.CooldownUntil, "error", err)
+	}
+}
+
+// withAccount runs fn with the session of an account of the pool. When the account is locked or throttled, fn
+// is retried with the next account, unless the process is pinned to it.
+func (ec Client) withAccount(ctx context.Context, fn func(config Config) error) error {
+	processID, _ := getContextWithProcessID(ctx, ProcessIDContextKey)
+
+	var err error
+	for i := 0; i < len(ec.Accounts.accounts); i++ {
+		account, pinned, pickErr := ec.Accounts.pick(processID)
+		if pickErr != nil {
+			if err != nil {
+				return errors.Join(err, pickErr)
+			}
+			return pickErr
+		}
+
+		err = withSessionManager(ctx, account.Session, fn)
+		ec.Accounts.report(account, err)
+
+		if pinned || !(errors.Is(err, ErrAccountLocked) || errors.Is(err, ErrThrottled)) {
+			return err
+		}
+		slog.Info("rotating esaj account", "account", account.Name, "error", err, "processID", processID)
+		metrics.Retries.WithLabelValues("account_rotation").Inc()
+	}
+	return err
+}
@@ -0,0 +1,224 @@
+package esaj
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// accountProvider returns a session whose cookies have the name of the account.
+type accountProvider string
+
+func (p accountProvider) NewSession(_ context.Context) ([]*http.Cookie, error) {
+	return []*http.Cookie{
+		{Name: "JSESSIONID", Value: string(p) + ".cpopg1", Path: "/cpopg"},
+		{Name: "JSESSIONID", Value: string(p) + ".pasta1", Path: "/pastadigital"},
+	}, nil
+}
+
+func newTestAccountPool(t *testing.T, url string, names ...string) *AccountPool {
+	var accounts []Account
+	for _, name := range names {
+		m := NewSessionManager(accountProvider(name))
+		m.URL = url
+		accounts = append(accounts, Account{Name: name, Session: m})
+	}
+
+	pool, err := NewAccountPool(accounts...)
+	require.NoError(t, err)
+	return pool
+}
+
+func Test_AccountPool_rotation(t *testing.T) {
+	pool := newTestAccountPool(t, ESAJURL, "a", "b", "c")
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		a, pinned, err := pool.pick("")
+		require.NoError(t, err)
+		assert.False(t, pinned)
+		got = append(got, a.Name)
+		pool.report(a, nil)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "a", "b", "c"}, got)
+
+	for _, s := range pool.Stats() {
+		assert.Equal(t, 2, s.Uses)
+	}
+}
+
+func Test_AccountPool_cooldown(t *testing.T) {
+	pool := newTestAccountPool(t, ESAJURL, "a", "b")
+	now := time.Date(2024, 8, 1, 10, 0, 0, 0, time.UTC)
+	pool.now = func() time.Time { return now }
+	pool.Cooldown = time.Hour
+
+	a, _, err := pool.pick("")
+	require.NoError(t, err)
+	pool.report(a, ErrThrottled)
+
+	// only b is available
+	for i := 0; i < 3; i++ {
+		b, _, err := pool.pick("")
+		require.NoError(t, err)
+		assert.Equal(t, "b", b.Name)
+	}
+
+	b, _, _ := pool.pick("")
+	pool.report(b, ErrAccountLocked)
+	_, _, err = pool.pick("")
+	require.ErrorIs(t, err, ErrNoAccountAvailable)
+
+	// after the cooldown the accounts are back to the rotation
+	now = now.Add(time.Hour)
+	_, _, err = pool.pick("")
+	require.NoError(t, err)
+
+	stats := pool.Stats()
+	assert.Equal(t, 1, stats[0].Failures)
+	assert.Equal(t, "too many requests", stats[0].LastError)
+}
+
+func Test_AccountPool_maxFailures(t *testing.T) {
+	pool := newTestAccountPool(t, ESAJURL, "a")
+	pool.MaxFailures = 2
+
+	a, _, err := pool.pick("")
+	require.NoError(t, err)
+	pool.report(a, errors.New("timeout"))
+	pool.report(a, nil)
+	pool.report(a, errors.New("timeout"))
+
+	_, _, err = pool.pick("")
+	require.NoError(t, err, "the failures are not consecutive")
+
+	pool.report(a, errors.New("timeout"))
+	_, _, err = pool.pick("")
+	require.ErrorIs(t, err, ErrNoAccountAvailable)
+}
+
+func Test_AccountPool_pin(t *testing.T) {
+	pool := newTestAccountPool(t, ESAJURL, "a", "b")
+	processID := "1016358-63.2020.8.26.0053"
+
+	require.ErrorIs(t, pool.Pin(processID, "unknown"), ErrAccountNotFound)
+	require.NoError(t, pool.Pin(processID, "b"))
+
+	for i := 0; i < 3; i++ {
+		a, pinned, err := pool.pick(processID)
+		require.NoError(t, err)
+		assert.True(t, pinned)
+		assert.Equal(t, "b", a.Name)
+	}
+
+	// a pinned process can't use other account, even if its account is cooling down
+	b, _, _ := pool.pick(processID)
+	pool.report(b, ErrAccountLocked)
+	_, _, err := pool.pick(processID)
+	require.ErrorIs(t, err, ErrNoAccountAvailable)
+
+	pool.Unpin(processID)
+	a, _, err := pool.pick(processID)
+	require.NoError(t, err)
+	assert.Equal(t, "a", a.Name)
+}
+
+func Test_AccountPool_PinOAB(t *testing.T) {
+	oab := MustParseOAB("103289/SP")
+	pool, err := NewAccountPool(
+		Account{Name: "a", Session: NewSessionManager(accountProvider("a"))},
+		Account{Name: "b", OAB: oab, Session: NewSessionManager(accountProvider("b"))},
+	)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, pool.PinOAB("1016358-63.2020.8.26.0053", MustParseOAB("1/SP")), ErrAccountNotFound)
+	require.NoError(t, pool.PinOAB("1016358-63.2020.8.26.0053", oab))
+
+	a, _, err := pool.pick("1016358-63.2020.8.26.0053")
+	require.NoError(t, err)
+	assert.Equal(t, "b", a.Name)
+}
+
+func Test_NewAccountPool_invalid(t *testing.T) {
+	_, err := NewAccountPool()
+	require.Error(t, err)
+
+	m := NewSessionManager(accountProvider("a"))
+	_, err = NewAccountPool(Account{Name: "a", Session: m}, Account{Name: "a", Session: m})
+	require.ErrorContains(t, err, "duplicated account")
+}
+
+func Test_Client_pastaDigitalURL_rotateThrottledAccount(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the account a is throttled
+		if strings.Contains(r.Header.Get("Cookie"), "a.cpopg1") {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`<body>https://esaj.tjsp.jus.br/pastadigital/abrirPastaProcessoDigital.do</body>`))
+	}))
+	defer server.Close()
+
+	c := New(Config{}, &http.Client{Timeout: 2 * time.Second})
+	c.URL = server.URL
+	c.Accounts = newTestAccountPool(t, server.URL, "a", "b")
+
+	got, err := c.pastaDigitalURL(context.Background(), "PROCESSCODE")
+	require.NoError(t, err)
+	assert.Equal(t, "/pastadigital/abrirPastaProcessoDigital.do", got)
+
+	stats := c.Accounts.Stats()
+	assert.Equal(t, 1, stats[0].Failures)
+	assert.False(t, stats[0].CooldownUntil.IsZero())
+	assert.Equal(t, 1, stats[1].Uses)
+	assert.Equal(t, 0, stats[1].Failures)
+}
+
+func Test_Client_pastaDigitalURL_pinnedAccountLocked(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`<body>Usuário bloqueado. Procure o administrador.</body>`))
+	}))
+	defer server.Close()
+
+	c := New(Config{}, &http.Client{Timeout: 2 * time.Second})
+	c.URL = server.URL
+	c.Accounts = newTestAccountPool(t, server.URL, "a", "b")
+	require.NoError(t, c.Accounts.Pin("1016358-63.2020.8.26.0053", "a"))
+
+	ctx := context.WithValue(context.Background(), ProcessIDContextKey, "1016358-63.2020.8.26.0053")
+	_, err := c.pastaDigitalURL(ctx, "PROCESSCODE")
+	require.ErrorIs(t, err, ErrAccountLocked)
+
+	// the process is not tried with the other account
+	assert.Equal(t, 0, c.Accounts.Stats()[1].Uses)
+}
+
+func Test_LoginsFromEnv(t *testing.T) {
+	t.Setenv("ESAJ_ACCOUNTS", "")
+	t.Setenv("ESAJ_USERNAME", "user")
+	t.Setenv("ESAJ_PASSWORD", "pass")
+
+	logins, err := LoginsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, []Login{{Username: "user", Password: "pass"}}, logins)
+
+	t.Setenv("ESAJ_ACCOUNTS", `[{"username": "a", "password": "1"}, {"username": "b", "password": "2"}]`)
+	logins, err = LoginsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, []Login{{Username: "a", Password: "1"}, {Username: "b", Password: "2"}}, logins)
+
+	t.Setenv("ESAJ_ACCOUNTS", `[{"username": "a"}]`)
+	_, err = LoginsFromEnv()
+	require.Error(t, err)
+
+	t.Setenv("ESAJ_ACCOUNTS", `[]`)
+	_, err = LoginsFromEnv()
+	require.Error(t, err)
+}
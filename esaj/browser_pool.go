@@ -0,0 +1,356 @@
+// Package esaj browser_pool.go gather the pool of headless browsers, used to get many sessions without launching a Chrome for each one.
+package esaj
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/storage"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	defaultBrowserPoolSize    = 2
+	defaultBrowserPoolMaxUses = 50
+)
+
+var (
+	// ErrBrowserPoolClosed is an error that occurs when the BrowserPool is used after Close.
+	ErrBrowserPoolClosed = errors.New("browser pool closed")
+)
+
+// BrowserPoolConfig is the configuration of a BrowserPool.
+type BrowserPoolConfig struct {
+	Login Login
+	// Size is the maximum number of browser contexts used at the same time. Default: 2.
+	Size int
+	// MaxUses is the number of times that a browser context is used before being replaced by a new one. Default: 50.
+	MaxUses int
+	// Headless defines if the browser should be headless or not. For production, it must be true.
+	Headless bool
+	// ProcessID is a process that the account can access, its pasta digital is opened by NewSession to create
+	// the pasta digital cookies when the context has no process. Example: 1016358-63.2020.8.26.0053
+	ProcessID string
+}
+
+// browserTab is a browser context with its own cookies. It exists to test the BrowserPool without a Chrome.
+type browserTab interface {
+	// login logs in the eSAJ website.
+	login(ctx context.Context) error
+	// cookies returns the cookies of the browser. If processID is not empty, the pasta digital of the process
+	// is opened before, to create the pasta digital cookies.
+	cookies(ctx context.Context, processID string) ([]*network.Cookie, error)
+	close()
+}
+
+type pooledTab struct {
+	tab browserTab
+	// proxy is the proxy of the browser context, its requests are sent through it. Empty without a proxy.
+	proxy    string
+	loggedIn bool
+	uses     int
+}
+
+// BrowserPool keeps a single Chrome process with a few warm browser contexts, each one logged in the eSAJ
+// website. A context is reused across many processes, and it's replaced after a failure or after MaxUses uses.
+// The contexts are created in the proxy of the context of the caller, set by WithProxy, when there is one.
+// BrowserPool is safe for concurrent use and implements the SessionProvider interface.
+type BrowserPool struct {
+	config BrowserPoolConfig
+	newTab func(proxy string) (browserTab, error)
+	// cancel stops the Chrome process.
+	cancel context.CancelFunc
+
+	// slots is a semaphore that limits the number of contexts in use.
+	slots chan struct{}
+	idle  chan *pooledTab
+
+	mu     sync.Mutex
+	closed bool
+	// inUse tracks the contexts in use, Close waits them to be released.
+	inUse sync.WaitGroup
+}
+
+// NewBrowserPool creates a new BrowserPool. Chrome is started lazily, in the first use of the pool.
+// Close must be called to stop it.
+func NewBrowserPool(ctx context.Context, config BrowserPoolConfig) *BrowserPool {
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(ctx, allocatorOptions(config.Headless)...)
+
+	chrome := &chromeBrowser{allocCtx: allocCtx, login: config.Login}
+
+	pool := newBrowserPool(config, chrome.newTab)
+	pool.cancel = func() {
+		chrome.close()
+		cancelAlloc()
+	}
+	return pool
+}
+
+func newBrowserPool(config BrowserPoolConfig, newTab func(proxy string) (browserTab, error)) *BrowserPool {
+	if config.Size <= 0 {
+		config.Size = defaultBrowserPoolSize
+	}
+	if config.MaxUses <= 0 {
+		config.MaxUses = defaultBrowserPoolMaxUses
+	}
+
+	return &BrowserPool{
+		config: config,
+		newTab: newTab,
+		cancel: func() {},
+		slots:  make(chan struct{}, config.Size),
+		idle:   make(chan *pooledTab, config.Size),
+	}
+}
+
+// GetCookies returns the cookie session and the cookie PDF session, like the GetCookies function, but using a
+// logged in browser context of the pool.
+// - processoID example: 1016358-63.2020.8.26.0053
+func (p *BrowserPool) GetCookies(ctx context.Context, processoID string) (string, string, error) {
+	var cookies []*network.Cookie
+	err := p.use(ctx, false, func(t *pooledTab) error {
+		var err error
+		cookies, err = t.tab.cookies(ctx, processoID)
+		return err
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	cookieSession, cookiePDFSession := parseCookies(toHTTPCookies(cookies))
+	return cookieSession, cookiePDFSession, nil
+}
+
+// NewSession implements the SessionProvider interface. It's called when the current session expired, so a new
+// browser context is always used to log in again. The pasta digital of the process of the context, set by the
+// Client, or of the ProcessID of the config is opened, so the session has the pasta digital cookies.
+func (p *BrowserPool) NewSession(ctx context.Context) ([]*http.Cookie, error) {
+	processID, _ := getContextWithProcessID(ctx, ProcessIDContextKey)
+	if processID == "" {
+		processID = p.config.ProcessID
+	}
+	if processID == "" {
+		return nil, errors.New("a process ID is required to open the pasta digital of the new session")
+	}
+
+	var cookies []*network.Cookie
+	err := p.use(ctx, true, func(t *pooledTab) error {
+		var err error
+		cookies, err = t.tab.cookies(ctx, processID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toHTTPCookies(cookies), nil
+}
+
+// Close waits the contexts in use to be released and stops the Chrome process.
+func (p *BrowserPool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	p.inUse.Wait()
+
+	for {
+		select {
+		case t := <-p.idle:
+			t.tab.close()
+		default:
+			p.cancel()
+			return
+		}
+	}
+}
+
+// use runs fn with a logged in browser context in the proxy of the context. When fresh is true, an idle context
+// is not reused.
+func (p *BrowserPool) use(ctx context.Context, fresh bool, fn func(t *pooledTab) error) error {
+	t, err := p.acquire(ctx, fresh, ProxyFromContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	err = p.run(ctx, t, fn)
+	p.release(t, err)
+	return err
+}
+
+func (p *BrowserPool) run(ctx context.Context, t *pooledTab, fn func(t *pooledTab) error) error {
+	if !t.loggedIn {
+		if err := t.tab.login(ctx); err != nil {
+			return fmt.Errorf("error logging in the browser: %w", err)
+		}
+		t.loggedIn = true
+	}
+
+	t.uses++
+	return fn(t)
+}
+
+func (p *BrowserPool) acquire(ctx context.Context, fresh bool, proxy string) (*pooledTab, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrBrowserPoolClosed
+	}
+	p.inUse.Add(1)
+	p.mu.Unlock()
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		p.inUse.Done()
+		return nil, ctx.Err()
+	}
+
+	select {
+	case t := <-p.idle:
+		// the context of another proxy can't be used, its session would be bound to the other address.
+		if !fresh && t.proxy == proxy {
+			return t, nil
+		}
+		t.tab.close()
+	default:
+	}
+
+	tab, err := p.newTab(proxy)
+	if err != nil {
+		<-p.slots
+		p.inUse.Done()
+		return nil, fmt.Errorf("error creating browser context: %w", err)
+	}
+	return &pooledTab{tab: tab, proxy: proxy}, nil
+}
+
+// release returns the context to the pool, or closes it when it failed or reached the maximum number of uses.
+func (p *BrowserPool) release(t *pooledTab, err error) {
+	defer p.inUse.Done()
+	defer func() { <-p.slots }()
+
+	if err != nil || t.uses >= p.config.MaxUses {
+		slog.Debug("recycling browser context", "uses", t.uses, "error", err)
+		t.tab.close()
+		return
+	}
+
+	p.idle <- t
+}
+
+// chromeBrowser creates the browser contexts in a single Chrome process.
+type chromeBrowser struct {
+	allocCtx context.Context
+	login    Login
+
+	mu sync.Mutex
+	// ctx is the context of the Chrome process, nil until it starts. A failed start is not kept, so the next
+	// tab tries to start it again, like after a transient error.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// start starts the Chrome process, if it's not running yet, and returns its context.
+func (b *chromeBrowser) start() (context.Context, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ctx != nil {
+		return b.ctx, nil
+	}
+
+	// the first run on the browser context starts the Chrome process.
+	ctx, cancel := chromedp.NewContext(b.allocCtx)
+	if err := chromedp.Run(ctx); err != nil {
+		cancel()
+		return nil, fmt.Errorf("could not start the browser: %w", err)
+	}
+	b.ctx, b.cancel = ctx, cancel
+	return ctx, nil
+}
+
+// close stops the Chrome process, when it was started.
+func (b *chromeBrowser) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel != nil {
+		b.cancel()
+	}
+}
+
+func (b *chromeBrowser) newTab(proxy string) (browserTab, error) {
+	proxyServer, err := ChromeProxyServer(proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	browserCtx, err := b.start()
+	if err != nil {
+		return nil, err
+	}
+
+	// each tab has its own browser context, this way the cookies of a recycled tab are discarded. The proxy is
+	// set in the browser context, so the tabs of a single Chrome use different proxies.
+	ctx, cancel := chromedp.NewContext(browserCtx, chromedp.WithNewBrowserContext(
+		func(params *target.CreateBrowserContextParams) *target.CreateBrowserContextParams {
+			if proxyServer == "" {
+				return params
+			}
+			return params.WithProxyServer(proxyServer)
+		},
+	))
+	return &chromeTab{ctx: ctx, cancel: cancel, esajLogin: b.login}, nil
+}
+
+type chromeTab struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	esajLogin Login
+}
+
+func (t *chromeTab) login(ctx context.Context) error {
+	// a canceled run leaves the tab in an unknown state, the tab is closed and recycled by the pool.
+	stop := context.AfterFunc(ctx, t.cancel)
+	defer stop()
+
+	return chromedp.Run(t.ctx, loginActions(t.esajLogin))
+}
+
+func (t *chromeTab) cookies(ctx context.Context, processID string) ([]*network.Cookie, error) {
+	stop := context.AfterFunc(ctx, t.cancel)
+	defer stop()
+
+	var cookies []*network.Cookie
+	if processID == "" {
+		err := chromedp.Run(t.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+			var err error
+			cookies, err = storage.GetCookies().Do(ctx)
+			return err
+		}))
+		return cookies, err
+	}
+
+	pastaDigital, err := pastaDigitalCookiesAction(processID, &cookies)
+	if err != nil {
+		return nil, err
+	}
+
+	runCtx := context.WithValue(t.ctx, ProcessIDContextKey, processID)
+	if err := chromedp.Run(runCtx, pastaDigital); err != nil {
+		return nil, fmt.Errorf("could not get cookies: %v", err)
+	}
+	return cookies, nil
+}
+
+func (t *chromeTab) close() {
+	t.cancel()
+}
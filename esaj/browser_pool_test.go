@@ -0,0 +1,263 @@
+package esaj
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBrowser creates fake tabs and counts how they were used.
+type fakeBrowser struct {
+	created atomic.Int32
+	closed  atomic.Int32
+	logins  atomic.Int32
+	active  atomic.Int32
+	// maxActive is the maximum number of tabs running at the same time.
+	maxActive atomic.Int32
+	delay     time.Duration
+	// fail makes the cookies of the process fail.
+	fail string
+	// opened is the last process whose pasta digital was opened.
+	opened atomic.Value
+	// proxy is the proxy of the last tab used.
+	proxy atomic.Value
+}
+
+func (b *fakeBrowser) newTab(proxy string) (browserTab, error) {
+	n := b.created.Add(1)
+	return &fakeTab{browser: b, id: n, proxy: proxy}, nil
+}
+
+type fakeTab struct {
+	browser *fakeBrowser
+	id      int32
+	proxy   string
+}
+
+func (t *fakeTab) login(_ context.Context) error {
+	t.browser.logins.Add(1)
+	return nil
+}
+
+func (t *fakeTab) cookies(_ context.Context, processID string) ([]*network.Cookie, error) {
+	active := t.browser.active.Add(1)
+	defer t.browser.active.Add(-1)
+	for {
+		current := t.browser.maxActive.Load()
+		if active <= current || t.browser.maxActive.CompareAndSwap(current, active) {
+			break
+		}
+	}
+	time.Sleep(t.browser.delay)
+	t.browser.proxy.Store(t.proxy)
+
+	if processID != "" && processID == t.browser.fail {
+		return nil, errors.New("pasta digital not found")
+	}
+
+	cookies := []*network.Cookie{{Name: "JSESSIONID", Value: fmt.Sprintf("tab%d.cpopg1", t.id), Path: "/cpopg"}}
+	if processID != "" {
+		t.browser.opened.Store(processID)
+		cookies = append(cookies, &network.Cookie{Name: "JSESSIONID", Value: fmt.Sprintf("tab%d.pasta1", t.id), Path: "/pastadigital"})
+	}
+	return cookies, nil
+}
+
+func (t *fakeTab) close() {
+	t.browser.closed.Add(1)
+}
+
+func Test_BrowserPool_reuse(t *testing.T) {
+	browser := &fakeBrowser{}
+	pool := newBrowserPool(BrowserPoolConfig{Size: 2}, browser.newTab)
+	defer pool.Close()
+
+	for i := 0; i < 10; i++ {
+		cookieSession, cookiePDFSession, err := pool.GetCookies(context.Background(), "1016358-63.2020.8.26.0053")
+		require.NoError(t, err)
+		assert.Equal(t, "JSESSIONID=tab1.cpopg1;", cookieSession)
+		assert.Equal(t, "JSESSIONID=tab1.pasta1;", cookiePDFSession)
+	}
+
+	assert.Equal(t, int32(1), browser.created.Load())
+	assert.Equal(t, int32(1), browser.logins.Load())
+}
+
+func Test_BrowserPool_maxUses(t *testing.T) {
+	browser := &fakeBrowser{}
+	pool := newBrowserPool(BrowserPoolConfig{Size: 1, MaxUses: 3}, browser.newTab)
+
+	for i := 0; i < 7; i++ {
+		_, _, err := pool.GetCookies(context.Background(), "1016358-63.2020.8.26.0053")
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, int32(3), browser.created.Load())
+	assert.Equal(t, int32(3), browser.logins.Load())
+	assert.Equal(t, int32(2), browser.closed.Load())
+
+	pool.Close()
+	assert.Equal(t, int32(3), browser.closed.Load())
+}
+
+func Test_BrowserPool_recycleOnFailure(t *testing.T) {
+	browser := &fakeBrowser{fail: "0000000-00.0000.8.26.0000"}
+	pool := newBrowserPool(BrowserPoolConfig{Size: 1}, browser.newTab)
+	defer pool.Close()
+
+	_, _, err := pool.GetCookies(context.Background(), "0000000-00.0000.8.26.0000")
+	require.ErrorContains(t, err, "pasta digital not found")
+	assert.Equal(t, int32(1), browser.closed.Load())
+
+	cookieSession, _, err := pool.GetCookies(context.Background(), "1016358-63.2020.8.26.0053")
+	require.NoError(t, err)
+	assert.Equal(t, "JSESSIONID=tab2.cpopg1;", cookieSession)
+}
+
+func Test_BrowserPool_concurrency(t *testing.T) {
+	browser := &fakeBrowser{delay: 5 * time.Millisecond}
+	pool := newBrowserPool(BrowserPoolConfig{Size: 3}, browser.newTab)
+	defer pool.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := pool.GetCookies(context.Background(), "1016358-63.2020.8.26.0053")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, browser.maxActive.Load(), int32(3))
+	assert.LessOrEqual(t, browser.created.Load(), int32(3))
+}
+
+func Test_BrowserPool_NewSession(t *testing.T) {
+	browser := &fakeBrowser{}
+	pool := newBrowserPool(BrowserPoolConfig{Size: 1, ProcessID: "1016358-63.2020.8.26.0053"}, browser.newTab)
+	defer pool.Close()
+
+	_, _, err := pool.GetCookies(context.Background(), "1016358-63.2020.8.26.0053")
+	require.NoError(t, err)
+
+	// a new session must not reuse the logged in context, its session may be expired.
+	cookies, err := pool.NewSession(context.Background())
+	require.NoError(t, err)
+	require.Len(t, cookies, 2)
+	assert.Equal(t, "tab2.cpopg1", cookies[0].Value)
+	assert.Equal(t, "/pastadigital", cookies[1].Path)
+	assert.Equal(t, int32(2), browser.logins.Load())
+	assert.Equal(t, int32(1), browser.closed.Load())
+
+	// the process of the context, set by the Client, is preferred
+	ctx := context.WithValue(context.Background(), ProcessIDContextKey, "0000001-02.2021.8.26.0000")
+	_, err = pool.NewSession(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "0000001-02.2021.8.26.0000", browser.opened.Load())
+
+	_, err = newBrowserPool(BrowserPoolConfig{Size: 1}, browser.newTab).NewSession(context.Background())
+	require.Error(t, err)
+}
+
+func Test_BrowserPool_proxy(t *testing.T) {
+	browser := &fakeBrowser{}
+	pool := newBrowserPool(BrowserPoolConfig{Size: 1, ProcessID: "1016358-63.2020.8.26.0053"}, browser.newTab)
+	defer pool.Close()
+
+	_, _, err := pool.GetCookies(context.Background(), "1016358-63.2020.8.26.0053")
+	require.NoError(t, err)
+	assert.Equal(t, "", browser.proxy.Load())
+
+	// the session bound to a proxy is created in a context of the proxy
+	ctx := WithProxy(context.Background(), "http://10.0.0.1:3128")
+	_, err = pool.NewSession(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "http://10.0.0.1:3128", browser.proxy.Load())
+
+	_, _, err = pool.GetCookies(ctx, "1016358-63.2020.8.26.0053")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), browser.created.Load())
+
+	// the idle context of another proxy is not reused
+	_, _, err = pool.GetCookies(context.Background(), "1016358-63.2020.8.26.0053")
+	require.NoError(t, err)
+	assert.Equal(t, "", browser.proxy.Load())
+	assert.Equal(t, int32(3), browser.created.Load())
+	assert.Equal(t, int32(2), browser.closed.Load())
+}
+
+func Test_BrowserPool_Close(t *testing.T) {
+	browser := &fakeBrowser{delay: 50 * time.Millisecond}
+	pool := newBrowserPool(BrowserPoolConfig{Size: 1}, browser.newTab)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _, err := pool.GetCookies(context.Background(), "1016358-63.2020.8.26.0053")
+		assert.NoError(t, err)
+	}()
+	// wait the goroutine to acquire the context
+	time.Sleep(10 * time.Millisecond)
+
+	// Close waits the context in use
+	pool.Close()
+	<-done
+	assert.Equal(t, int32(1), browser.closed.Load())
+
+	_, _, err := pool.GetCookies(context.Background(), "1016358-63.2020.8.26.0053")
+	require.ErrorIs(t, err, ErrBrowserPoolClosed)
+}
+
+func Test_BrowserPool_contextCanceled(t *testing.T) {
+	browser := &fakeBrowser{delay: 100 * time.Millisecond}
+	pool := newBrowserPool(BrowserPoolConfig{Size: 1}, browser.newTab)
+	defer pool.Close()
+
+	go func() {
+		_, _, _ = pool.GetCookies(context.Background(), "1016358-63.2020.8.26.0053")
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, _, err := pool.GetCookies(ctx, "1016358-63.2020.8.26.0053")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func Test_chromeBrowser_retryStart(t *testing.T) {
+	// the browser is unreachable, so every start fails after connecting to it
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	allocCtx, cancel := chromedp.NewRemoteAllocator(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http"))
+	defer cancel()
+	chrome := &chromeBrowser{allocCtx: allocCtx}
+	defer chrome.close()
+
+	_, err := chrome.newTab("")
+	require.Error(t, err)
+	_, err = chrome.newTab("")
+	require.Error(t, err)
+
+	// the failed start is not kept, each tab tries again
+	assert.Equal(t, int32(2), attempts.Load())
+}
@@ -0,0 +1,259 @@
+// Package esaj cas.go gather the login in the eSAJ website using only HTTP requests, without a browser.
+package esaj
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	// ErrLoginFailed is an error that occurs when the eSAJ website refuses the credentials.
+	ErrLoginFailed = errors.New("login failed")
+)
+
+// casServices are the eSAJ applications that need a service ticket. Each application validates its ticket and
+// creates its own session cookie, scoped by the application path.
+var casServices = []string{
+	"/cpopg/j_spring_cas_security_check",
+	"/pastadigital/j_spring_cas_security_check",
+}
+
+// CASProvider is a SessionProvider that logs in the eSAJ website through the sajcas/login flow using only
+// HTTP requests. It's lighter than the HeadlessProvider, because it doesn't need a Chrome binary.
+type CASProvider struct {
+	Login Login
+	// URL is the base URL of the eSAJ website. Default: ESAJURL.
+	URL string
+	// Client is the http client used in the requests. Default: http.DefaultClient.
+	// Its Jar is replaced by a new one in each login.
+	Client *http.Client
+}
+
+// NewSession logs in the eSAJ website and asks a service ticket for each eSAJ application, returning the
+// session cookies of all of them.
+func (p CASProvider) NewSession(ctx context.Context) ([]*http.Cookie, error) {
+	baseURL := casBaseURL(p.URL)
+
+	client, jar, err := newCASClient(baseURL, p.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := casGet(ctx, client, casLoginURL(baseURL, "/sajcas/login", casServices[0]))
+	if err != nil {
+		return nil, fmt.Errorf("error getting the login page: %w", err)
+	}
+
+	form, err := loginForm(page, p.Login)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err = casPostForm(ctx, client, form.action, form.values)
+	if err != nil {
+		return nil, fmt.Errorf("error posting the login form: %w", err)
+	}
+
+	// after a valid login, CAS redirects to the service with a ticket. The login page is shown again otherwise.
+	if page.hasLoginForm() {
+		msg := page.loginError()
+		if err := accessError(http.StatusOK, []byte(msg)); err != nil {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrLoginFailed, msg)
+	}
+
+	return casServiceTickets(ctx, client, jar, baseURL)
+}
+
+// casServiceTickets asks the tickets of the other eSAJ applications after the login. The ticket granting cookie
+// created in the login allows CAS to issue them without asking the credentials again.
+func casServiceTickets(ctx context.Context, client *http.Client, jar *Jar, baseURL string) ([]*http.Cookie, error) {
+	for _, service := range casServices[1:] {
+		page, err := casGet(ctx, client, casLoginURL(baseURL, "/sajcas/login", service))
+		if err != nil {
+			return nil, fmt.Errorf("error getting the service ticket of %s: %w", service, err)
+		}
+		if page.hasLoginForm() {
+			return nil, fmt.Errorf("%w: the service ticket of %s was not issued", ErrLoginFailed, service)
+		}
+	}
+
+	// a ticket refused by the application, like an invalid ticket page, doesn't show the login form, but the
+	// application doesn't create its session either.
+	cookies := jar.All()
+	for _, service := range casServices {
+		if !hasServiceSession(cookies, service) {
+			return nil, fmt.Errorf("%w: %s didn't create a session", ErrLoginFailed, path.Dir(service))
+		}
+	}
+	slog.Debug("esaj cas login finished", "cookies", len(cookies))
+	return cookies, nil
+}
+
+// hasServiceSession reports whether the cookies have a session of the application of the service, the
+// JSESSIONID or K-JSESSIONID-* cookies scoped by its path.
+func hasServiceSession(cookies []*http.Cookie, service string) bool {
+	appPath := path.Dir(service)
+	for _, c := range cookies {
+		if c.Path != appPath && !strings.HasPrefix(c.Path, appPath+"/") {
+			continue
+		}
+		if c.Name == "JSESSIONID" || strings.HasPrefix(c.Name, "K-JSESSIONID-") {
+			return true
+		}
+	}
+	return false
+}
+
+func casBaseURL(baseURL string) string {
+	if baseURL == "" {
+		return ESAJURL
+	}
+	return baseURL
+}
+
+// casLoginURL returns the URL of a CAS login path that redirects to service after the login.
+func casLoginURL(baseURL, loginPath, service string) string {
+	return baseURL + loginPath + "?service=" + url.QueryEscape(baseURL+service)
+}
+
+// newCASClient returns a copy of base with a new Jar, so each login starts without cookies.
+func newCASClient(baseURL string, base *http.Client) (*http.Client, *Jar, error) {
+	jar, err := NewJar(baseURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client := http.Client{}
+	if base != nil {
+		client = *base
+	}
+	client.Jar = jar
+	return &client, jar, nil
+}
+
+// casPage is a page returned in the CAS flow, after following all redirects.
+type casPage struct {
+	url *url.URL
+	doc *goquery.Document
+}
+
+// loginFormSelector finds the form of the login page. The form is found by the username field, because its
+// id and action change between the eSAJ versions.
+const loginFormSelector = "form:has(#usernameForm)"
+
+func (p casPage) hasLoginForm() bool {
+	return p.doc.Find(loginFormSelector).Length() > 0
+}
+
+// loginError returns the message shown by the login page, when there is one.
+func (p casPage) loginError() string {
+	msg := strings.TrimSpace(p.doc.Find("#mensagemRetorno").Text())
+	if msg == "" {
+		msg = strings.TrimSpace(p.doc.Find(".alert, .errors").First().Text())
+	}
+	if msg == "" {
+		return "the login page was shown again"
+	}
+	return strings.Join(strings.Fields(msg), " ")
+}
+
+type casForm struct {
+	action string
+	values url.Values
+}
+
+// loginForm fills the login form with the credentials, keeping the hidden tokens of the form, like the
+// lt and execution fields that CAS requires to accept the login.
+func loginForm(page casPage, login Login) (casForm, error) {
+	form := page.doc.Find(loginFormSelector).First()
+	if form.Length() == 0 {
+		return casForm{}, errors.New("login form not found")
+	}
+
+	values := url.Values{}
+	form.Find("input[name]").Each(func(_ int, s *goquery.Selection) {
+		name, _ := s.Attr("name")
+		typ := strings.ToLower(s.AttrOr("type", "text"))
+		if typ == "checkbox" || typ == "radio" {
+			if _, checked := s.Attr("checked"); !checked {
+				return
+			}
+		}
+		values.Set(name, s.AttrOr("value", ""))
+	})
+
+	username := form.Find("#usernameForm").AttrOr("name", "username")
+	password := form.Find("#passwordForm").AttrOr("name", "password")
+	values.Set(username, login.Username)
+	values.Set(password, login.Password)
+
+	action, err := page.url.Parse(form.AttrOr("action", ""))
+	if err != nil {
+		return casForm{}, fmt.Errorf("error parsing the login form action: %w", err)
+	}
+
+	return casForm{action: action.String(), values: values}, nil
+}
+
+func casGet(ctx context.Context, client *http.Client, url string) (casPage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return casPage{}, fmt.Errorf("error creating request: %w", err)
+	}
+	return casDo(client, req)
+}
+
+func casPostForm(ctx context.Context, client *http.Client, url string, values url.Values) (casPage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(values.Encode()))
+	if err != nil {
+		return casPage{}, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return casDo(client, req)
+}
+
+// casDo sends the request following the redirects, the cookies of each step are saved in the client jar.
+func casDo(client *http.Client, req *http.Request) (casPage, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return casPage{}, fmt.Errorf("error sending request: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return casPage{}, fmt.Errorf("error reading the page: %w", err)
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return casPage{}, fmt.Errorf("error parsing the page: %w", err)
+	}
+	page := casPage{url: resp.Request.URL, doc: doc}
+
+	// CAS answers an invalid login with 401 and the login page, that must still be parsed to find the error
+	// message. Any other status out of 2xx, like a 403 of a refused ticket, fails the flow.
+	if resp.StatusCode == http.StatusUnauthorized && page.hasLoginForm() {
+		return page, nil
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		if err := accessError(resp.StatusCode, body); err != nil {
+			return casPage{}, fmt.Errorf("%w: status code %d in %s", err, resp.StatusCode, resp.Request.URL.Path)
+		}
+		return casPage{}, fmt.Errorf("unexpected status code %d in %s", resp.StatusCode, resp.Request.URL.Path)
+	}
+	return page, nil
+}
@@ -0,0 +1,213 @@
+package esaj
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCAS simulates the sajcas/login flow and the eSAJ applications that validate the service tickets.
+type fakeCAS struct {
+	mu      sync.Mutex
+	n       int
+	tickets map[string]string
+	server  *httptest.Server
+	// refused is the application that refuses its tickets, answering refusedStatus without a session.
+	refused       string
+	refusedStatus int
+}
+
+func newFakeCAS(t *testing.T) *fakeCAS {
+	cas := &fakeCAS{tickets: map[string]string{}}
+	cas.server = httptest.NewServer(cas.handler())
+	t.Cleanup(cas.server.Close)
+	return cas
+}
+
+func (c *fakeCAS) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sajcas/login", c.login)
+	for _, app := range []string{"cpopg", "pastadigital"} {
+		app := app
+		mux.HandleFunc("/"+app+"/j_spring_cas_security_check", func(w http.ResponseWriter, r *http.Request) {
+			c.mu.Lock()
+			service, ok := c.tickets[r.URL.Query().Get("ticket")]
+			delete(c.tickets, r.URL.Query().Get("ticket"))
+			c.mu.Unlock()
+
+			if !ok || service != c.server.URL+r.URL.Path {
+				http.Error(w, "invalid ticket", http.StatusForbidden)
+				return
+			}
+			if app == c.refused {
+				w.WriteHeader(c.refusedStatus)
+				_, _ = w.Write([]byte(`<html><body>Ticket inválido</body></html>`))
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: app + "-session", Path: "/" + app})
+			http.Redirect(w, r, "/"+app+"/open.do", http.StatusFound)
+		})
+		mux.HandleFunc("/"+app+"/open.do", func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(`<html><body><a class="linkLogo"></a></body></html>`))
+		})
+	}
+	return mux
+}
+
+func (c *fakeCAS) login(w http.ResponseWriter, r *http.Request) {
+	service := r.URL.Query().Get("service")
+
+	if r.Method == http.MethodGet {
+		if tgc, err := r.Cookie("CASTGC"); err == nil && tgc.Value == "TGT-1" {
+			c.redirectWithTicket(w, r, service)
+			return
+		}
+		c.loginPage(w, service, "", http.StatusOK)
+		return
+	}
+
+	_ = r.ParseForm()
+	if r.PostForm.Get("lt") != "LT-1" || r.PostForm.Get("execution") != "e1s1" || r.PostForm.Get("_eventId") != "submit" {
+		c.loginPage(w, service, "Token inválido", http.StatusOK)
+		return
+	}
+	if r.PostForm.Get("username") != "user" || r.PostForm.Get("password") != "pass" {
+		c.loginPage(w, service, "Usuário e/ou senha inválidos.", http.StatusUnauthorized)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: "CASTGC", Value: "TGT-1", Path: "/sajcas"})
+	c.redirectWithTicket(w, r, service)
+}
+
+func (c *fakeCAS) redirectWithTicket(w http.ResponseWriter, r *http.Request, service string) {
+	c.mu.Lock()
+	c.n++
+	ticket := fmt.Sprintf("ST-%d", c.n)
+	c.tickets[ticket] = service
+	c.mu.Unlock()
+
+	http.Redirect(w, r, service+"?ticket="+ticket, http.StatusFound)
+}
+
+func (c *fakeCAS) loginPage(w http.ResponseWriter, service, msg string, status int) {
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, `<html><body>
+<div id="mensagemRetorno">%s</div>
+<form method="post" action="login?service=%s">
+	<input type="text" id="usernameForm" name="username" value="">
+	<input type="password" id="passwordForm" name="password" value="">
+	<input type="hidden" name="lt" value="LT-1">
+	<input type="hidden" name="execution" value="e1s1">
+	<input type="hidden" name="_eventId" value="submit">
+	<input type="checkbox" name="remember" value="on">
+	<input type="submit" id="pbEntrar" value="Entrar">
+</form>
+</body></html>`, msg, url.QueryEscape(service))
+}
+
+func Test_CASProvider_NewSession(t *testing.T) {
+	cas := newFakeCAS(t)
+
+	provider := CASProvider{
+		Login:  Login{Username: "user", Password: "pass"},
+		URL:    cas.server.URL,
+		Client: &http.Client{Timeout: 2 * time.Second},
+	}
+
+	cookies, err := provider.NewSession(context.Background())
+	require.NoError(t, err)
+
+	got := map[string]string{}
+	for _, c := range cookies {
+		got[c.Path+";"+c.Name] = c.Value
+	}
+	assert.Equal(t, "cpopg-session", got["/cpopg;JSESSIONID"])
+	assert.Equal(t, "pastadigital-session", got["/pastadigital;JSESSIONID"])
+	assert.Equal(t, "TGT-1", got["/sajcas;CASTGC"])
+
+	// all tickets were consumed
+	assert.Empty(t, cas.tickets)
+}
+
+func Test_CASProvider_invalidCredentials(t *testing.T) {
+	cas := newFakeCAS(t)
+
+	provider := CASProvider{
+		Login: Login{Username: "user", Password: "wrong"},
+		URL:   cas.server.URL,
+	}
+
+	_, err := provider.NewSession(context.Background())
+	require.ErrorIs(t, err, ErrLoginFailed)
+	assert.ErrorContains(t, err, "Usuário e/ou senha inválidos.")
+}
+
+func Test_CASProvider_refusedTicket(t *testing.T) {
+	for _, tt := range []struct {
+		app    string
+		status int
+	}{
+		{app: "cpopg", status: http.StatusForbidden},
+		{app: "pastadigital", status: http.StatusForbidden},
+		// a page without the login form and without the session isn't a login either
+		{app: "pastadigital", status: http.StatusOK},
+	} {
+		t.Run(fmt.Sprintf("%s %d", tt.app, tt.status), func(t *testing.T) {
+			cas := newFakeCAS(t)
+			cas.refused, cas.refusedStatus = tt.app, tt.status
+
+			provider := CASProvider{
+				Login: Login{Username: "user", Password: "pass"},
+				URL:   cas.server.URL,
+			}
+
+			cookies, err := provider.NewSession(context.Background())
+			require.Error(t, err)
+			assert.Empty(t, cookies)
+		})
+	}
+}
+
+func Test_CASProvider_SessionManager(t *testing.T) {
+	cas := newFakeCAS(t)
+
+	m := NewSessionManager(CASProvider{
+		Login: Login{Username: "user", Password: "pass"},
+		URL:   cas.server.URL,
+	})
+	m.URL = cas.server.URL
+
+	config, _, err := m.Current(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "JSESSIONID=cpopg-session;", config.CookieSession)
+	assert.Equal(t, "JSESSIONID=pastadigital-session;", config.CookiePDFSession)
+}
+
+func Test_loginForm(t *testing.T) {
+	cas := newFakeCAS(t)
+
+	page, err := casGet(context.Background(), http.DefaultClient, cas.server.URL+"/sajcas/login?service=x")
+	require.NoError(t, err)
+
+	form, err := loginForm(page, Login{Username: "user", Password: "pass"})
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(form.action, cas.server.URL+"/sajcas/login?service="))
+	assert.Equal(t, "user", form.values.Get("username"))
+	assert.Equal(t, "pass", form.values.Get("password"))
+	assert.Equal(t, "LT-1", form.values.Get("lt"))
+	assert.Equal(t, "e1s1", form.values.Get("execution"))
+	// unchecked checkboxes are not sent
+	_, ok := form.values["remember"]
+	assert.False(t, ok)
+}
@@ -0,0 +1,166 @@
+// Package esaj certificate.go gather the login in the eSAJ website using an ICP-Brasil A1 digital certificate.
+package esaj
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// defaultCertificateLoginPath is the CAS path that authenticates the user by the TLS client certificate.
+const defaultCertificateLoginPath = "/sajcas/login/certificado"
+
+// LoadPKCS12 decodes an A1 certificate (PKCS#12, .pfx or .p12 file) protected by password, returning the
+// certificate and its chain ready to be used in a TLS client authentication. Both the files encrypted with AES
+// (PBES2), the default of the current ICP-Brasil issuers and of OpenSSL 3, and the legacy ones (3DES/RC2) are
+// supported.
+func LoadPKCS12(data []byte, password string) (tls.Certificate, error) {
+	key, first, rest, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("error decoding pkcs12: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return tls.Certificate{}, fmt.Errorf("pkcs12 private key %T can't sign", key)
+	}
+	public, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return tls.Certificate{}, fmt.Errorf("pkcs12 public key %T is not supported", signer.Public())
+	}
+
+	// the order of the certificates in the file is not defined, the leaf is the one that matches the private key.
+	certs := append([]*x509.Certificate{first}, rest...)
+	for i, leaf := range certs {
+		if !public.Equal(leaf.PublicKey) {
+			continue
+		}
+
+		if time.Now().After(leaf.NotAfter) {
+			return tls.Certificate{}, fmt.Errorf("certificate %q expired at %s", leaf.Subject.CommonName, leaf.NotAfter.Format(time.DateOnly))
+		}
+
+		cert := tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: key, Leaf: leaf}
+		for j, c := range certs {
+			if j != i {
+				cert.Certificate = append(cert.Certificate, c.Raw)
+			}
+		}
+		return cert, nil
+	}
+
+	return tls.Certificate{}, errors.New("pkcs12 has no certificate matching the private key")
+}
+
+// CertificateProvider is a SessionProvider that logs in the eSAJ website with an A1 digital certificate, using
+// the certificate in the TLS client authentication of the CAS login.
+type CertificateProvider struct {
+	Certificate tls.Certificate
+	// URL is the base URL of the eSAJ website. Default: ESAJURL.
+	URL string
+	// LoginPath is the CAS path of the certificate login. Default: /sajcas/login/certificado.
+	LoginPath string
+	// Client is the http client used in the requests. Its transport is rebuilt with the certificate in its
+	// innermost transports, so it must be a *http.Transport, a ProxyPool or a TransportWrapper around one of
+	// them, like metrics.Transport. Default: http.DefaultClient.
+	Client *http.Client
+}
+
+// NewCertificateProvider creates a CertificateProvider from a PKCS#12 file protected by password.
+func NewCertificateProvider(path, password string) (CertificateProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return CertificateProvider{}, fmt.Errorf("error reading certificate file: %w", err)
+	}
+
+	cert, err := LoadPKCS12(data, password)
+	if err != nil {
+		return CertificateProvider{}, err
+	}
+	return CertificateProvider{Certificate: cert}, nil
+}
+
+// NewSession logs in the eSAJ website presenting the certificate and asks a service ticket for each eSAJ
+// application, returning the session cookies of all of them.
+func (p CertificateProvider) NewSession(ctx context.Context) ([]*http.Cookie, error) {
+	if len(p.Certificate.Certificate) == 0 {
+		return nil, errors.New("certificate is empty")
+	}
+
+	baseURL := casBaseURL(p.URL)
+	loginPath := p.LoginPath
+	if loginPath == "" {
+		loginPath = defaultCertificateLoginPath
+	}
+
+	client, jar, err := newCASClient(baseURL, p.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	client.Transport, err = certificateTransport(client.Transport, p.Certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	// the user is authenticated in the TLS handshake, so CAS redirects to the service with a ticket, without
+	// showing the login form.
+	page, err := casGet(ctx, client, casLoginURL(baseURL, loginPath, casServices[0]))
+	if err != nil {
+		return nil, fmt.Errorf("error logging in with certificate: %w", err)
+	}
+	if page.hasLoginForm() {
+		return nil, fmt.Errorf("%w: the certificate was not accepted: %s", ErrLoginFailed, page.loginError())
+	}
+
+	return casServiceTickets(ctx, client, jar, baseURL)
+}
+
+// TransportWrapper is implemented by the round trippers that wrap another one, like metrics.Transport. The
+// client certificate is added to the innermost transport, and the wrappers are rebuilt around it.
+type TransportWrapper interface {
+	// Unwrap returns the wrapped round tripper.
+	Unwrap() http.RoundTripper
+	// Rewrap returns a copy of the wrapper around next.
+	Rewrap(next http.RoundTripper) http.RoundTripper
+}
+
+// certificateTransport returns a copy of the transport that presents the client certificate. The certificate is
+// added to the innermost transports: the *http.Transport itself, the transports of the proxies of a ProxyPool,
+// or the transport of a TransportWrapper, that is rebuilt around it. The transport is never changed.
+func certificateTransport(rt http.RoundTripper, cert tls.Certificate) (http.RoundTripper, error) {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	switch t := rt.(type) {
+	case *http.Transport:
+		return withClientCertificate(t, cert), nil
+	case *ProxyPool:
+		return t.withClientCertificate(cert), nil
+	case TransportWrapper:
+		next, err := certificateTransport(t.Unwrap(), cert)
+		if err != nil {
+			return nil, err
+		}
+		return t.Rewrap(next), nil
+	}
+	return nil, fmt.Errorf("the transport %T can't be used with a client certificate", rt)
+}
+
+// withClientCertificate clones the transport adding the client certificate to its TLS config.
+func withClientCertificate(t *http.Transport, cert tls.Certificate) *http.Transport {
+	t = t.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	t.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	return t
+}
@@ -0,0 +1,173 @@
+package esaj
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/perebaj/esaj/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// newFakeCASTLS starts the fake CAS in a TLS server that requires a client certificate signed by the test CA.
+// The certificate login path accepts only the e-CPF of testdata/ecpf.p12.
+func newFakeCASTLS(t *testing.T) (*fakeCAS, *http.Client) {
+	caPEM, err := os.ReadFile("testdata/ecpf_ca.pem")
+	require.NoError(t, err)
+	clientCAs := x509.NewCertPool()
+	require.True(t, clientCAs.AppendCertsFromPEM(caPEM))
+
+	cas := &fakeCAS{tickets: map[string]string{}}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", cas.handler())
+	mux.HandleFunc("/sajcas/login/certificado", func(w http.ResponseWriter, r *http.Request) {
+		service := r.URL.Query().Get("service")
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "FULANO DE TAL:12345678900" {
+			cas.loginPage(w, service, "Certificado inválido", http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "CASTGC", Value: "TGT-1", Path: "/sajcas"})
+		cas.redirectWithTicket(w, r, service)
+	})
+
+	cas.server = httptest.NewUnstartedServer(mux)
+	cas.server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	cas.server.StartTLS()
+	t.Cleanup(cas.server.Close)
+
+	// the client trusts the server, but doesn't have a client certificate.
+	client := cas.server.Client()
+	client.Timeout = 2 * time.Second
+	return cas, client
+}
+
+func Test_LoadPKCS12(t *testing.T) {
+	data, err := os.ReadFile("testdata/ecpf.p12")
+	require.NoError(t, err)
+
+	cert, err := LoadPKCS12(data, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "FULANO DE TAL:12345678900", cert.Leaf.Subject.CommonName)
+	// leaf and the CA
+	assert.Len(t, cert.Certificate, 2)
+
+	_, err = LoadPKCS12(data, "wrong")
+	require.Error(t, err)
+}
+
+func Test_LoadPKCS12_aes(t *testing.T) {
+	data, err := os.ReadFile("testdata/ecpf.p12")
+	require.NoError(t, err)
+	legacy, err := LoadPKCS12(data, "secret")
+	require.NoError(t, err)
+
+	// the current issuers encrypt the file with AES (PBES2), and put the CA before the leaf
+	ca, err := x509.ParseCertificate(legacy.Certificate[1])
+	require.NoError(t, err)
+	data, err = pkcs12.Modern.Encode(legacy.PrivateKey, ca, []*x509.Certificate{legacy.Leaf}, "secret")
+	require.NoError(t, err)
+
+	cert, err := LoadPKCS12(data, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "FULANO DE TAL:12345678900", cert.Leaf.Subject.CommonName)
+	assert.Equal(t, legacy.Certificate, cert.Certificate)
+}
+
+func Test_CertificateProvider_NewSession(t *testing.T) {
+	cas, client := newFakeCASTLS(t)
+
+	provider, err := NewCertificateProvider(filepath.Join("testdata", "ecpf.p12"), "secret")
+	require.NoError(t, err)
+	provider.URL = cas.server.URL
+	provider.Client = client
+
+	cookies, err := provider.NewSession(context.Background())
+	require.NoError(t, err)
+
+	got := map[string]string{}
+	for _, c := range cookies {
+		got[c.Path+";"+c.Name] = c.Value
+	}
+	assert.Equal(t, "cpopg-session", got["/cpopg;JSESSIONID"])
+	assert.Equal(t, "pastadigital-session", got["/pastadigital;JSESSIONID"])
+
+	// the client of the provider was not changed
+	transport, ok := client.Transport.(*http.Transport)
+	require.True(t, ok)
+	assert.Empty(t, transport.TLSClientConfig.Certificates)
+	assert.Nil(t, client.Jar)
+}
+
+func Test_CertificateProvider_metricsTransport(t *testing.T) {
+	cas, client := newFakeCASTLS(t)
+
+	provider, err := NewCertificateProvider(filepath.Join("testdata", "ecpf.p12"), "secret")
+	require.NoError(t, err)
+	provider.URL = cas.server.URL
+	provider.Client = &http.Client{Transport: metrics.Transport(client.Transport)}
+
+	// the certificate is added to the transport recorded by the metrics
+	cookies, err := provider.NewSession(context.Background())
+	require.NoError(t, err)
+	assert.NotEmpty(t, cookies)
+}
+
+func Test_certificateTransport_proxyPool(t *testing.T) {
+	p1 := newFakeProxy(t, "p1")
+	pool, err := NewProxyPool(p1.server.URL)
+	require.NoError(t, err)
+
+	cert, err := NewCertificateProvider(filepath.Join("testdata", "ecpf.p12"), "secret")
+	require.NoError(t, err)
+	rt, err := certificateTransport(metrics.Transport(pool), cert.Certificate)
+	require.NoError(t, err)
+
+	// the requests go through the proxies of the pool, and are reported to it
+	body, err := get(context.Background(), t, &http.Client{Transport: rt}, "http://esaj.test/cpopg/open.do")
+	require.NoError(t, err)
+	assert.Equal(t, "p1", body)
+	assert.Equal(t, 1, pool.Stats()[0].Requests)
+
+	certPool, ok := rt.(TransportWrapper).Unwrap().(certificateProxyPool)
+	require.True(t, ok)
+	for proxy, transport := range certPool.transports {
+		assert.Len(t, transport.TLSClientConfig.Certificates, 1)
+		if proxy.transport.TLSClientConfig != nil {
+			assert.Empty(t, proxy.transport.TLSClientConfig.Certificates, "the transports of the pool were not changed")
+		}
+	}
+
+	_, err = certificateTransport(roundTripper(nil), cert.Certificate)
+	require.Error(t, err)
+}
+
+// roundTripper is a transport unknown to certificateTransport.
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func Test_CertificateProvider_withoutCertificate(t *testing.T) {
+	cas, client := newFakeCASTLS(t)
+
+	// the server refuses the TLS handshake without a client certificate
+	_, err := casGet(context.Background(), client, cas.server.URL+"/sajcas/login/certificado")
+	require.Error(t, err)
+
+	provider := CertificateProvider{URL: cas.server.URL, Client: client}
+	_, err = provider.NewSession(context.Background())
+	require.ErrorContains(t, err, "certificate is empty")
+}
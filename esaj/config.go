@@ -2,7 +2,12 @@
 // Don't know if is the best name, but it's a good start.
 package esaj
 
-import "os"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
 
 // GetEnvWithDefault returns the value of the environment variable key if it exists, otherwise it returns defaultValue.
 // The validation if the env key must be filled or not is up to the caller.
@@ -13,3 +18,44 @@ func GetEnvWithDefault(key, defaultValue string) string {
 	}
 	return value
 }
+
+// LoginsFromEnv returns the eSAJ credentials of the environment. ESAJ_ACCOUNTS has precedence and holds many
+// credentials as a JSON list, example: [{"username": "123.456.789-00", "password": "secret"}].
+// Without it, the single ESAJ_USERNAME and ESAJ_PASSWORD pair is used.
+func LoginsFromEnv() ([]Login, error) {
+	if accounts := os.Getenv("ESAJ_ACCOUNTS"); accounts != "" {
+		var logins []Login
+		if err := json.Unmarshal([]byte(accounts), &logins); err != nil {
+			return nil, fmt.Errorf("error parsing ESAJ_ACCOUNTS: %w", err)
+		}
+		if len(logins) == 0 {
+			return nil, errors.New("ESAJ_ACCOUNTS without accounts")
+		}
+
+		for i, l := range logins {
+			if l.Username == "" || l.Password == "" {
+				return nil, fmt.Errorf("ESAJ_ACCOUNTS: account %d without username or password", i)
+			}
+		}
+		return logins, nil
+	}
+
+	login := Login{
+		Username: GetEnvWithDefault("ESAJ_USERNAME", ""),
+		Password: GetEnvWithDefault("ESAJ_PASSWORD", ""),
+	}
+	if login.Username == "" || login.Password == "" {
+		return nil, errors.New("ESAJ_ACCOUNTS or ESAJ_USERNAME and ESAJ_PASSWORD not set")
+	}
+	return []Login{login}, nil
+}
+
+// ConfigFromEnv returns the Config of the session cookies of the environment, ESAJ_COOKIE_SESSION and
+// ESAJ_COOKIE_PDF_SESSION, like the ones printed by `esaj session export`. They're empty when not set, and the
+// requests are sent without a session.
+func ConfigFromEnv() Config {
+	return Config{
+		CookieSession:    GetEnvWithDefault("ESAJ_COOKIE_SESSION", ""),
+		CookiePDFSession: GetEnvWithDefault("ESAJ_COOKIE_PDF_SESSION", ""),
+	}
+}
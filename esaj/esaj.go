@@ -17,8 +17,10 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/perebaj/esaj/metrics"
 	"github.com/perebaj/esaj/tracing"
 )
 
@@ -33,6 +35,11 @@ var (
 var (
 	// ErrSessionExpired is an error that occurs when the access to the TJSP website is expired.
 	ErrSessionExpired = errors.New("session expired")
+	// ErrNoProcesses is an error that occurs when the OAB search says that there are no processes.
+	ErrNoProcesses = errors.New("no processes found")
+	// ErrUnexpectedPage is an error that occurs when the OAB search doesn't return a page of the search, like
+	// an error page, a CAPTCHA or a changed markup.
+	ErrUnexpectedPage = errors.New("unexpected page of the search")
 )
 
 // availableProcessStatus is a slice of strings that contains the status of the process that contains information about the deadline.
@@ -49,12 +56,21 @@ type Config struct {
 	// CookiePDFSession is used for the route the download a PDF.
 	// CookiePDFSession example: "JSESSION=8A1F3DCE0D4DC510FFF3305E44ABCC4E.pasta3; K-JSESSIONID-phoaambo=0E4D006FFD78524DBABA78F02E1633FA"
 	CookiePDFSession string
+	// Jar is optional. When set, it is used to send and receive the cookies of all requests, and
+	// CookieSession and CookiePDFSession are ignored.
+	Jar *Jar
 }
 
 // Client is a struct that contains the configuration of the client to interact with the TJSP website.
 type Client struct {
 	Config Config
-	Client *http.Client
+	// Session is optional. When set, the authenticated requests use its cookies instead of the Config ones
+	// and the session is refreshed transparently when it expires.
+	Session *SessionManager
+	// Accounts is optional. When set, the authenticated requests are spread between its accounts and the
+	// Session is ignored.
+	Accounts *AccountPool
+	Client   *http.Client
 	// URL is the base URL of the TJSP website.
 	URL string
 }
@@ -64,18 +80,41 @@ func New(config Config, client *http.Client) *Client {
 	return &Client{
 		Config: config,
 		Client: client,
-		URL:    "https://esaj.tjsp.jus.br",
+		URL:    ESAJURL,
 	}
 }
 
+// do sends the request using the cookies of the config. When the config has a Jar, it is used to send and
+// receive the cookies, including the ones set in the redirects, and the request is bound to the proxy of the
+// jar. Otherwise, the cookie string is sent in the Cookie header.
+func (ec Client) do(config Config, req *http.Request, cookie string) (*http.Response, error) {
+	if config.Jar == nil {
+		if cookie != "" {
+			req.Header.Set("Cookie", cookie)
+		}
+		return ec.Client.Do(req)
+	}
+
+	if config.Jar.Proxy != "" {
+		req = req.WithContext(WithProxy(req.Context(), config.Jar.Proxy))
+	}
+
+	client := *ec.Client
+	client.Jar = config.Jar
+	return client.Do(req)
+}
+
 // Run is the main function of the Client. It searches for the process in the TJSP website and download the PDF documents.
 func (ec Client) Run(ctx context.Context, processID string) error {
-	processCode, err := ec.ProcessCodeByProcessID(processID)
+	// the processID is used to pick the account pinned to the process.
+	ctx = context.WithValue(ctx, ProcessIDContextKey, processID)
+
+	processCode, err := ec.ProcessCodeByProcessID(ctx, processID)
 	if err != nil {
 		return fmt.Errorf("error searching process: %w", err)
 	}
 
-	processes, err := ec.abrirPastaProcessoDigital(processCode)
+	processes, err := ec.abrirPastaProcessoDigital(ctx, processCode)
 	if err != nil {
 		return fmt.Errorf("error opening digital folder: %w", err)
 	}
@@ -93,7 +132,7 @@ func (ec Client) Run(ctx context.Context, processID string) error {
 
 // ProcessCodeByProcessID searches for a specific process in the TJSP website and return the processCode. An ID in the format 1H000H91J0000.
 // processID: The process ID in the format = 0000001-02.2021.8.26.0000
-func (ec Client) ProcessCodeByProcessID(processID string) (string, error) {
+func (ec Client) ProcessCodeByProcessID(ctx context.Context, processID string) (string, error) {
 	numeroDigitoAnoUnificado, err := numeroDigitoAnoUnificado(processID)
 	if err != nil {
 		return "", err
@@ -106,13 +145,12 @@ func (ec Client) ProcessCodeByProcessID(processID string) (string, error) {
 
 	urlFormated := ec.URL + fmt.Sprintf(`/cpopg/search.do?conversationId=&cbPesquisa=NUMPROC&numeroDigitoAnoUnificado=%s&foroNumeroUnificado=%s&dadosConsulta.valorConsultaNuUnificado=%s&dadosConsulta.valorConsultaNuUnificado=UNIFICADO&dadosConsulta.valorConsulta=&dadosConsulta.tipoNuProcesso=UNIFICADO`, numeroDigitoAnoUnificado, foroNumeroUnificado, processID)
 
-	req, err := http.NewRequest("GET", urlFormated, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", urlFormated, nil)
 	if err != nil {
 		return "", fmt.Errorf("error creating request: %w", err)
 	}
-	req.Header.Set("Cookie", ec.Config.CookieSession)
 
-	resp, err := ec.Client.Do(req)
+	resp, err := ec.do(ec.Config, req, ec.Config.CookieSession)
 	if err != nil {
 		return "", fmt.Errorf("error doing request: %w", err)
 	}
@@ -145,6 +183,7 @@ func (ec Client) ProcessCodeByProcessID(processID string) (string, error) {
 	regex := regexp.MustCompile(`processo.codigo=(\w+)`)
 	matches := regex.FindStringSubmatch(link)
 	if len(matches) == 0 {
+		metrics.ParseFailure("process_code")
 		return "", fmt.Errorf("no matches found when searching for processCode")
 	}
 
@@ -155,19 +194,30 @@ func (ec Client) ProcessCodeByProcessID(processID string) (string, error) {
 // abrirPastaProcessoDigital fetches the digital folder page where all structured data of the process can be found.
 // This data is used to download the PDF documents related to the process.
 // - processCode: The process code in the format: 1H000H91J0000
-func (ec Client) abrirPastaProcessoDigital(processCode string) ([]Process, error) {
-	url, err := ec.pastaDigitalURL(processCode)
-	if err != nil {
-		return nil, fmt.Errorf("error getting pasta digital url: %w", err)
-	}
+func (ec Client) abrirPastaProcessoDigital(ctx context.Context, processCode string) ([]Process, error) {
+	var processes []Process
+	err := ec.withSession(ctx, func(config Config) error {
+		url, err := ec.fetchPastaDigitalURL(ctx, config, processCode)
+		if err != nil {
+			return fmt.Errorf("error getting pasta digital url: %w", err)
+		}
 
+		processes, err = ec.fetchPastaProcessoDigital(config, url)
+		return err
+	})
+	return processes, err
+}
+
+// fetchPastaProcessoDigital parses the structured data of the process from the digital folder page.
+// - url: The path returned by the pastaDigitalURL. Example: /pastadigital/abrirPastaProcessoDigital.do?...
+func (ec Client) fetchPastaProcessoDigital(config Config, url string) ([]Process, error) {
 	slog.Debug(fmt.Sprintf("fetching abrir pasta processo digital url: %s", ec.URL+url))
 	req, err := http.NewRequest("GET", ec.URL+url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
-	resp, err := ec.Client.Do(req)
+	resp, err := ec.do(config, req, "")
 	if err != nil {
 		return nil, fmt.Errorf("error doing request: %w", err)
 	}
@@ -180,6 +230,11 @@ func (ec Client) abrirPastaProcessoDigital(processCode string) ([]Process, error
 	if err != nil {
 		return nil, fmt.Errorf("error reading body: %w", err)
 	}
+
+	if err := accessError(resp.StatusCode, bodyByte); err != nil {
+		return nil, err
+	}
+
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(bodyByte)))
 	if err != nil {
 		return nil, fmt.Errorf("error initializing goquery new document from reader: %w", err)
@@ -193,18 +248,21 @@ func (ec Client) abrirPastaProcessoDigital(processCode string) ([]Process, error
 	})
 
 	if scriptContent == "" {
+		metrics.ParseFailure("pasta_digital_script")
 		return nil, fmt.Errorf("no script content found")
 	}
 
 	regex := regexp.MustCompile(`var requestScope = (.*);`)
 	matches := regex.FindStringSubmatch(scriptContent)
 	if len(matches) == 0 {
+		metrics.ParseFailure("pasta_digital_request_scope")
 		return nil, fmt.Errorf("no matches found when searching for requestScope")
 	}
 
 	var processes []Process
 	err = json.Unmarshal([]byte(matches[1]), &processes)
 	if err != nil {
+		metrics.ParseFailure("pasta_digital_json")
 		return nil, fmt.Errorf("error unmarshalling json: %w", err)
 	}
 
@@ -212,17 +270,21 @@ func (ec Client) abrirPastaProcessoDigital(processCode string) ([]Process, error
 }
 
 // GetPDF fetch the pdf document from the TJSP website.
-func (ec Client) GetPDF(_ context.Context, processID string, cData ChildrenData) error {
+func (ec Client) GetPDF(ctx context.Context, processID string, cData ChildrenData) error {
+	ctx = context.WithValue(ctx, ProcessIDContextKey, processID)
+	return ec.withSession(ctx, func(config Config) error {
+		return ec.getPDF(config, processID, cData)
+	})
+}
+
+func (ec Client) getPDF(config Config, processID string, cData ChildrenData) error {
 	hrefGetPDF := ec.URL + "/pastadigital/getPDF.do?" + cData.Parametros
 
 	req, err := http.NewRequest("GET", hrefGetPDF, nil)
 	if err != nil {
 		return fmt.Errorf("error creating request: %w", err)
 	}
-	req.Header.Set("Cookie", ec.Config.CookiePDFSession)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := ec.do(config, req, config.CookiePDFSession)
 	if err != nil {
 		return fmt.Errorf("error doing request %w", err)
 	}
@@ -236,6 +298,10 @@ func (ec Client) GetPDF(_ context.Context, processID string, cData ChildrenData)
 		return fmt.Errorf("error reading body: %w", err)
 	}
 
+	if err := accessError(resp.StatusCode, bodyByte); err != nil {
+		return err
+	}
+
 	if strings.Contains(string(bodyByte), "Sua sessão expirou") {
 		return ErrSessionExpired
 	}
@@ -246,27 +312,35 @@ func (ec Client) GetPDF(_ context.Context, processID string, cData ChildrenData)
 		return fmt.Errorf("error writing file: %w", err)
 	}
 	slog.Info(fmt.Sprintf("pdf downloaded successfully and saved in: %s", fileName))
+	metrics.DocumentsDownloaded.Inc()
 
 	return nil
 }
 
 // FetchBasicProcessInfo fetch the html page of the process that contains basic information about legal action.
 func (ec Client) FetchBasicProcessInfo(ctx context.Context, u string, processID string) (*ProcessBasicInfo, error) {
+	pBasic, _, err := ec.FetchProcess(ctx, u, processID)
+	return pBasic, err
+}
+
+// FetchProcess works like FetchBasicProcessInfo, but also returns the movements shown in the page of the process.
+func (ec Client) FetchProcess(ctx context.Context, u string, processID string) (*ProcessBasicInfo, []Movement, error) {
 	traceID := tracing.GetTraceIDFromContext(ctx)
 	logger := slog.With("traceID", traceID, "processID", processID)
 	parsedURL, err := url.Parse(u)
 
 	if err != nil {
 		logger.Error("error parsing the url", "url", u, "error", err)
-		return nil, err
+		return nil, nil, err
 	}
 
 	processCode := parsedURL.Query().Get("processo.codigo")
 	processForo := parsedURL.Query().Get("processo.foro")
 
 	if processCode == "" || processForo == "" {
+		metrics.ParseFailure("process_url")
 		logger.Error(fmt.Sprintf("error parsing the url: %s. processo.codigo or processo.foro is empty", u))
-		return nil, err
+		return nil, nil, err
 	}
 
 	logger.Info("fetching process basic information")
@@ -279,14 +353,13 @@ func (ec Client) FetchBasicProcessInfo(ctx context.Context, u string, processID
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		logger.Error("error creating request", "error", err, "url", url)
-		return nil, err
+		return nil, nil, err
 	}
-	req.Header.Set("Cookie", ec.Config.CookieSession)
 
-	resp, err := ec.Client.Do(req)
+	resp, err := ec.do(ec.Config, req, ec.Config.CookieSession)
 	if err != nil {
 		logger.Error("error doing request", "error", err, "url", url)
-		return nil, err
+		return nil, nil, err
 	}
 
 	defer func() {
@@ -296,13 +369,13 @@ func (ec Client) FetchBasicProcessInfo(ctx context.Context, u string, processID
 	bodyByte, err := io.ReadAll(resp.Body)
 	if err != nil {
 		logger.Error("error reading body", "error", err, "url", url)
-		return nil, err
+		return nil, nil, err
 	}
 
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(bodyByte)))
 	if err != nil {
 		logger.Error("error initializing goquery new document from reader", "error", err, "url", url)
-		return nil, err
+		return nil, nil, err
 	}
 
 	var processClass string
@@ -325,6 +398,16 @@ func (ec Client) FetchBasicProcessInfo(ctx context.Context, u string, processID
 		judge = s.Text()
 	})
 
+	var subject string
+	doc.Find("#assuntoProcesso").Each(func(_ int, s *goquery.Selection) {
+		subject = strings.TrimSpace(s.Text())
+	})
+
+	var situation string
+	doc.Find("#labelSituacaoProcesso").Each(func(_ int, s *goquery.Selection) {
+		situation = strings.TrimSpace(s.Text())
+	})
+
 	var parties []string
 	doc.Find("td.nomeParteEAdvogado").Each(func(_ int, s *goquery.Selection) {
 		p := s.Text()
@@ -333,17 +416,27 @@ func (ec Client) FetchBasicProcessInfo(ctx context.Context, u string, processID
 		parties = append(parties, p)
 	})
 
+	// the foro name is not always rendered in the page, in this case the catalog is used as fallback.
+	if strings.TrimSpace(foroName) == "" {
+		if foro, err := ForoByCode(processForo); err == nil {
+			foroName = foro.Name
+		}
+	}
+
 	if len(parties) < 2 {
+		metrics.ParseFailure("parties")
 		logger.Error("error parsing parties", "url", url)
-		return nil, fmt.Errorf("error parsing parties")
+		return nil, nil, fmt.Errorf("error parsing parties")
 	}
 
 	pBasic := &ProcessBasicInfo{
 		ProcessID:   processID,
 		ProcessForo: processForo,
 		Class:       processClass,
+		Subject:     subject,
 		Vara:        vara,
 		Judge:       judge,
+		Situation:   situation,
 		ForoName:    foroName,
 		ProcessCode: processCode,
 		// TODO(@perebaj) maybe im accessing an index that does not exist. Or maybe the parties are not in the correct order.
@@ -352,45 +445,89 @@ func (ec Client) FetchBasicProcessInfo(ctx context.Context, u string, processID
 		URL:       u,
 	}
 
-	return pBasic, nil
+	movements := parseMovements(doc, logger)
+
+	metrics.ProcessesFetched.Inc()
+	return pBasic, movements, nil
+}
+
+// parseMovements returns the movements of the table with all the movements of the process page. The title of a
+// movement is the text of its description, that can be a link to its document, and its text is the italic span
+// below the title. A movement with an invalid date is skipped.
+func parseMovements(doc *goquery.Document, logger *slog.Logger) []Movement {
+	var movements []Movement
+	doc.Find("#tabelaTodasMovimentacoes tr.containerMovimentacao").Each(func(_ int, s *goquery.Selection) {
+		rawDate := strings.TrimSpace(s.Find("td.dataMovimentacao").Text())
+		date, err := time.Parse("02/01/2006", rawDate)
+		if err != nil {
+			metrics.ParseFailure("movement_date")
+			logger.Warn("skipping movement with invalid date", "date", rawDate, "error", err)
+			return
+		}
+
+		description := s.Find("td.descricaoMovimentacao")
+		text := description.Find("span").Text()
+		title := strings.Replace(description.Text(), text, "", 1)
+		movements = append(movements, Movement{
+			Date:  date,
+			Title: strings.Join(strings.Fields(title), " "),
+			Text:  strings.Join(strings.Fields(text), " "),
+		})
+	})
+	return movements
 }
 
 // ProcessSeed is the start point to scrape all processes related to a specific OAB number
 type ProcessSeed struct {
 	ProcessID string `db:"process_id" json:"process_id"`
-	OAB       string `db:"oab" json:"oab"`
+	OAB       OAB    `db:"oab" json:"oab"`
 	URL       string `db:"url" json:"url"`
 }
 
 // SearchByOAB is a seeder function that searches for all processes related to a specific OAB number.
 // to get all processes hrefs its not necessary to have a valid session.
-func (ec Client) SearchByOAB(ctx context.Context, oab string) ([]ProcessSeed, error) {
-	traceID := tracing.GetTraceIDFromContext(ctx)
-	logger := slog.With("traceID", traceID, "oab", oab)
-	// paginaConsulta=1000000000 is a way to find the last page, so we can iterate over all pages.
-	// using this output as a range limit.
-	fetchURL := ec.URL + fmt.Sprintf("/cpopg/trocarPagina.do?paginaConsulta=1000000000&conversationId=&cbPesquisa=NUMOAB&dadosConsulta.valorConsulta=%s&cdForo=-1", oab)
+func (ec Client) SearchByOAB(ctx context.Context, oab OAB) ([]ProcessSeed, error) {
+	return ec.SearchByOABInForo(ctx, oab, "")
+}
 
-	req, err := http.NewRequest("GET", fetchURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
-	}
+// SearchByOABInForo works like SearchByOAB, but restricts the search to a single foro.
+// - foroCode example: "53" or "0053". If empty, all foros are searched. The catalog doesn't have all the foros of
+// the TJSP, so any well-formed code is searched, even if it's not in the catalog.
+//
+// ErrNoProcesses is returned when the eSAJ says that the OAB has no processes, and ErrUnexpectedPage when a page
+// isn't a page of the search, so an empty result is never a failed search.
+func (ec Client) SearchByOABInForo(ctx context.Context, oab OAB, foroCode string) ([]ProcessSeed, error) {
+	traceID := tracing.GetTraceIDFromContext(ctx)
+	logger := slog.With("traceID", traceID, "oab", oab.String())
 
-	logger.Info(fmt.Sprintf("searching by all process related to OAB: %s", oab), "url", fetchURL)
-	resp, err := ec.Client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("error doing request: %w", err)
+	if err := oab.Validate(); err != nil {
+		return nil, err
 	}
 
-	bodyByte, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading body: %w", err)
+	// cdForo=-1 means all foros.
+	cdForo := "-1"
+	if foroCode != "" {
+		code, err := NormalizeForoCode(foroCode)
+		if err != nil {
+			return nil, err
+		}
+		// the eSAJ website expects the foro code without the leading zeros.
+		cdForo = strings.TrimLeft(code, "0")
+		logger = logger.With("foro", code)
 	}
 
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(bodyByte)))
+	query := url.QueryEscape(oab.ESAJQuery())
+	// paginaConsulta=1000000000 is a way to find the last page, so we can iterate over all pages.
+	// using this output as a range limit.
+	fetchURL := ec.URL + fmt.Sprintf("/cpopg/trocarPagina.do?paginaConsulta=1000000000&conversationId=&cbPesquisa=NUMOAB&dadosConsulta.valorConsulta=%s&cdForo=%s", query, cdForo)
 
+	logger.Info(fmt.Sprintf("searching by all process related to OAB: %s", oab), "url", fetchURL)
+	doc, err := ec.searchPage(ctx, fetchURL)
 	if err != nil {
-		return nil, fmt.Errorf("error initializing goquery new document from reader: %w", err)
+		if errors.Is(err, ErrNoProcesses) {
+			logger.Info("the search says that the OAB has no processes")
+		}
+		return nil, err
 	}
 
 	// the pagination element in the esaj HTML just contains the penultimate page.
@@ -404,10 +541,9 @@ func (ec Client) SearchByOAB(ctx context.Context, oab string) ([]ProcessSeed, er
 	replacer := strings.NewReplacer("\n", "", "\t", "", " ", "")
 	penultimatePage = replacer.Replace(penultimatePage)
 
-	// if the penultimatePage is empty, it means that there is only one page.
+	// if the penultimatePage is empty, it means that there is only one page. searchPage already made sure
+	// that the page is a page of the search.
 	var penultimatePageInt int
-	// TODO(@perebaj) Maybe if the request failed to retrive the HTML, this value will be empty, so, to avoid
-	// miss flow, we need to get different values to have sure that the code its working properly.
 	if penultimatePage == "" {
 		logger.Info("only one page found, seeting page seek start point to 1")
 		penultimatePageInt = 1
@@ -415,6 +551,7 @@ func (ec Client) SearchByOAB(ctx context.Context, oab string) ([]ProcessSeed, er
 		logger.Info(fmt.Sprintf("penultimate page found: %s", penultimatePage))
 		penultimatePageInt, err = strconv.Atoi(penultimatePage)
 		if err != nil {
+			metrics.ParseFailure("oab_pagination")
 			return nil, fmt.Errorf("error converting text to number: %w", err)
 		}
 	}
@@ -425,29 +562,23 @@ func (ec Client) SearchByOAB(ctx context.Context, oab string) ([]ProcessSeed, er
 	var seeds []ProcessSeed
 	// the first page 1 and 0 refers to the same page, so, to avoid duplicate data, we are starting from 1.
 	for i := 1; i <= lastPage; i++ {
-		fetchURL := ec.URL + fmt.Sprintf("/cpopg/trocarPagina.do?paginaConsulta=%d&cbPesquisa=NUMOAB&dadosConsulta.valorConsulta=%s&cdForo=-1", i, oab)
+		fetchURL := ec.URL + fmt.Sprintf("/cpopg/trocarPagina.do?paginaConsulta=%d&cbPesquisa=NUMOAB&dadosConsulta.valorConsulta=%s&cdForo=%s", i, query, cdForo)
 		logger.Info(fmt.Sprintf("fetching page: %d", i), "url", fetchURL)
-		req, err := http.NewRequest("GET", fetchURL, nil)
-		if err != nil {
-			return nil, fmt.Errorf("error creating request: %w", err)
+		doc, err := ec.searchPage(ctx, fetchURL)
+		if errors.Is(err, ErrNoProcesses) {
+			// the first page had processes, so a page without them means the search changed in between.
+			return nil, fmt.Errorf("%w: page %d has no processes", ErrUnexpectedPage, i)
 		}
-
-		resp, err := ec.Client.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("error doing request: %w", err)
-		}
-
-		bodyByte, err := io.ReadAll(resp.Body)
 		if err != nil {
-			return nil, fmt.Errorf("error reading body: %w", err)
+			return nil, fmt.Errorf("error fetching page %d: %w", i, err)
 		}
 
-		doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(bodyByte)))
-		if err != nil {
-			return nil, fmt.Errorf("error initializing goquery new document from reader: %w", err)
+		links := doc.Find("a.linkProcesso")
+		if links.Length() == 0 {
+			metrics.ParseFailure("oab_search")
+			return nil, fmt.Errorf("%w: page %d has no processes", ErrUnexpectedPage, i)
 		}
-
-		doc.Find("a.linkProcesso").Each(func(_ int, s *goquery.Selection) {
+		links.Each(func(_ int, s *goquery.Selection) {
 			href, _ := s.Attr("href")
 			processID := s.Text()
 			// remove all spaces, tabs and new lines.
@@ -463,22 +594,79 @@ func (ec Client) SearchByOAB(ctx context.Context, oab string) ([]ProcessSeed, er
 		logger.Info(fmt.Sprintf("number of processes found: %d", len(seeds)))
 	}
 
+	metrics.SeedsDiscovered.Add(float64(len(seeds)))
 	return seeds, nil
 }
 
+// noProcessesMessage is the part of the message of the OAB search without processes: "Não existem informações
+// disponíveis para os parâmetros informados". Only the ASCII part is matched, so the charset of the page doesn't matter.
+const noProcessesMessage = "o existem informa"
+
+// searchPage fetches and parses a page of the OAB search. A page is only returned when it has processes or
+// pagination, so a CAPTCHA, an error page or a changed markup isn't taken as a search without processes. When
+// the page says that there are no processes, ErrNoProcesses is returned.
+func (ec Client) searchPage(ctx context.Context, fetchURL string) (*goquery.Document, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fetchURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := ec.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error doing request: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	bodyByte, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if err := accessError(resp.StatusCode, bodyByte); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrUnexpectedPage, err)
+		}
+		return nil, fmt.Errorf("%w: status code %d", ErrUnexpectedPage, resp.StatusCode)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(bodyByte)))
+	if err != nil {
+		return nil, fmt.Errorf("error initializing goquery new document from reader: %w", err)
+	}
+
+	if doc.Find("a.linkProcesso, a.paginacao, .paginaAtual").Length() > 0 {
+		return doc, nil
+	}
+	if strings.Contains(doc.Text(), noProcessesMessage) {
+		return nil, ErrNoProcesses
+	}
+	metrics.ParseFailure("oab_search")
+	return nil, fmt.Errorf("%w: the page has no processes, pagination or message of no processes", ErrUnexpectedPage)
+}
+
 // pastaDigitalURL fetch the html page and return the URL where the pdf documents can be downloaded.
 // - processCode: The process code in the format: 1H000H91J0000
-func (ec Client) pastaDigitalURL(processCode string) (string, error) {
+func (ec Client) pastaDigitalURL(ctx context.Context, processCode string) (string, error) {
+	var link string
+	err := ec.withSession(ctx, func(config Config) error {
+		var err error
+		link, err = ec.fetchPastaDigitalURL(ctx, config, processCode)
+		return err
+	})
+	return link, err
+}
+
+func (ec Client) fetchPastaDigitalURL(ctx context.Context, config Config, processCode string) (string, error) {
 	formatedURL := ec.URL + fmt.Sprintf("/cpopg/abrirPastaDigital.do?processo.codigo=%s", processCode)
 
-	req, err := http.NewRequest("GET", formatedURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", formatedURL, nil)
 	if err != nil {
 		return "", fmt.Errorf("error creating request: %w", err)
 	}
 
-	req.Header.Set("Cookie", ec.Config.CookieSession)
-
-	resp, err := ec.Client.Do(req)
+	resp, err := ec.do(config, req, config.CookieSession)
 	if err != nil {
 		return "", fmt.Errorf("error doing request: %w", err)
 	}
@@ -488,6 +676,10 @@ func (ec Client) pastaDigitalURL(processCode string) (string, error) {
 		return "", fmt.Errorf("error reading body: %w", err)
 	}
 
+	if err := accessError(resp.StatusCode, bodyByte); err != nil {
+		return "", err
+	}
+
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(bodyByte)))
 	if err != nil {
 		return "", fmt.Errorf("error initializing goquery new document from reader: %w", err)
@@ -499,6 +691,7 @@ func (ec Client) pastaDigitalURL(processCode string) (string, error) {
 	})
 
 	if link == "" {
+		metrics.ParseFailure("pasta_digital_url")
 		return "", fmt.Errorf("no link found")
 	}
 
@@ -511,6 +704,7 @@ func (ec Client) pastaDigitalURL(processCode string) (string, error) {
 
 	linkHREF := strings.Split(link, "https://esaj.tjsp.jus.br")
 	if len(linkHREF) < 2 {
+		metrics.ParseFailure("pasta_digital_url")
 		return "", fmt.Errorf("no link found")
 	}
 
@@ -57,7 +57,7 @@ func Test_Client_ProcessCodeByProcessID_ErrNoMatchesFound(t *testing.T) {
 	esajClient.URL = server.URL
 
 	processID := "1029989-06.2022.8.26.0053"
-	_, err := esajClient.ProcessCodeByProcessID(processID)
+	_, err := esajClient.ProcessCodeByProcessID(context.Background(), processID)
 	require.Error(t, err)
 }
 
@@ -106,7 +106,7 @@ func Test_Client_ProcessCodeByProcessID(t *testing.T) {
 	esajClient.URL = server.URL
 
 	processID := "1029989-06.2022.8.26.0053"
-	got, err := esajClient.ProcessCodeByProcessID(processID)
+	got, err := esajClient.ProcessCodeByProcessID(context.Background(), processID)
 	require.NoError(t, err)
 
 	wantProcessCode := "THISONE"
@@ -136,7 +136,7 @@ func Test_Client_pastaDigitalURL_NoLinkFound(t *testing.T) {
 	esajClient.URL = server.URL
 
 	processCode := "PROCESSCODE"
-	_, err := esajClient.pastaDigitalURL(processCode)
+	_, err := esajClient.pastaDigitalURL(context.Background(), processCode)
 	require.Error(t, err)
 
 	want := "no link found"
@@ -179,7 +179,7 @@ func Test_Client_pastaDigitalURL_invalidAccess(t *testing.T) {
 	esajClient.URL = server.URL
 
 	processCode := "PROCESSCODE"
-	_, err := esajClient.pastaDigitalURL(processCode)
+	_, err := esajClient.pastaDigitalURL(context.Background(), processCode)
 	require.Error(t, err)
 	require.ErrorIs(t, err, ErrSessionExpired)
 }
@@ -292,7 +292,7 @@ func Test_Client_AbrirPastaDigital(t *testing.T) {
 
 	processCode := "PROCESSCODE"
 
-	processes, err := esajClient.abrirPastaProcessoDigital(processCode)
+	processes, err := esajClient.abrirPastaProcessoDigital(context.Background(), processCode)
 	require.NoError(t, err)
 
 	assert.Len(t, processes, 1)
@@ -337,7 +337,7 @@ func Test_Client_pastaDigitalURL(t *testing.T) {
 	esajClient.URL = server.URL
 
 	processCode := "PROCESSCODE"
-	got, err := esajClient.pastaDigitalURL(processCode)
+	got, err := esajClient.pastaDigitalURL(context.Background(), processCode)
 	require.NoError(t, err)
 
 	assert.Contains(t, got, "/pastadigital/abrirPastaProcessoDigital.do")
@@ -421,6 +421,64 @@ func Test_Client_FetchBasicProcessInfo(t *testing.T) {
 	require.Error(t, err)
 }
 
+func Test_Client_FetchProcess(t *testing.T) {
+	c := New(Config{
+		CookieSession: "test",
+	}, &http.Client{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`<html><body>
+			<span id="classeProcesso">Procedimento Comum Cível</span>
+			<span id="assuntoProcesso"> Indenização por Dano Moral </span>
+			<span id="labelSituacaoProcesso" class="unj-tag">
+				Em andamento
+			</span>
+			<span id="foroProcesso">Foro Central - Fazenda Pública/Acidentes</span>
+			<span id="varaProcesso">1ª Vara de Fazenda Pública</span>
+			<span id="juizProcesso">Fulano de Tal</span>
+			<table><tr><td class="nomeParteEAdvogado">Claimant</td><td class="nomeParteEAdvogado">Defendant</td></tr></table>
+			<table><tbody id="tabelaTodasMovimentacoes">
+				<tr class="containerMovimentacao">
+					<td class="dataMovimentacao"> 13/08/2024 </td>
+					<td class="descricaoMovimentacao">
+						<a class="linkMovVincProc" href="#">Certidão de  Publicação Expedida</a>
+						<br/><span style="font-style: italic;">Relação: 0640/2024
+						Teor do ato: Vistos.</span>
+					</td>
+				</tr>
+				<tr class="containerMovimentacao">
+					<td class="dataMovimentacao">sem data</td>
+					<td class="descricaoMovimentacao">Conclusos</td>
+				</tr>
+				<tr class="containerMovimentacao">
+					<td class="dataMovimentacao">01/08/2024</td>
+					<td class="descricaoMovimentacao"> Conclusos para Despacho </td>
+				</tr>
+			</tbody></table>
+		</body></html>`))
+	}))
+	defer server.Close()
+
+	c.URL = server.URL
+
+	got, movements, err := c.FetchProcess(context.TODO(), server.URL+"/cpopg/show.do?processo.codigo=1HZX5Q48A0000&processo.foro=53", "1016358-63.2020.8.26.0053")
+	require.NoError(t, err)
+	require.Equal(t, "Procedimento Comum Cível", got.Class)
+	require.Equal(t, "Em andamento", got.Situation)
+	require.Equal(t, "Indenização por Dano Moral", got.Subject)
+	require.Equal(t, "Fulano de Tal", got.Judge)
+	require.Equal(t, "Claimant", got.Claimant)
+	require.Equal(t, []Movement{
+		{
+			Date:  time.Date(2024, 8, 13, 0, 0, 0, 0, time.UTC),
+			Title: "Certidão de Publicação Expedida",
+			Text:  "Relação: 0640/2024 Teor do ato: Vistos.",
+		},
+		{Date: time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC), Title: "Conclusos para Despacho"},
+	}, movements)
+}
+
 func Test_Client_SearchByOAB(t *testing.T) {
 	c := New(Config{
 		CookieSession: "test",
@@ -431,6 +489,10 @@ func Test_Client_SearchByOAB(t *testing.T) {
 			t.Errorf("expected %s, got %s", http.MethodGet, r.Method)
 		}
 
+		if got := r.URL.Query().Get("dadosConsulta.valorConsulta"); got != "472135SP" {
+			t.Errorf("expected %s, got %s", "472135SP", got)
+		}
+
 		paginaConsulta := r.URL.Query().Get("paginaConsulta")
 		if paginaConsulta == "1000000000" {
 			w.WriteHeader(http.StatusOK)
@@ -459,12 +521,84 @@ func Test_Client_SearchByOAB(t *testing.T) {
 	c.URL = server.URL
 
 	wantSeed := []ProcessSeed{
-		{ProcessID: "1037499-17.2015.8.26.0053", OAB: "472135", URL: server.URL + "/cpopg/show.do?processo.codigo=1H0008CTD0000&processo.foro=53&paginaConsulta=1&cbPesquisa=NUMOAB&dadosConsulta.valorConsulta=472135&cdForo=-1"},
-		{ProcessID: "1019126-69.2014.8.26.0053", OAB: "472135", URL: server.URL + "/cpopg/show.do?processo.codigo=1H0006MLR0000&processo.foro=53&paginaConsulta=2&cbPesquisa=NUMOAB&dadosConsulta.valorConsulta=472135&cdForo=-1"},
+		{ProcessID: "1037499-17.2015.8.26.0053", OAB: OAB{Number: "472135", UF: "SP"}, URL: server.URL + "/cpopg/show.do?processo.codigo=1H0008CTD0000&processo.foro=53&paginaConsulta=1&cbPesquisa=NUMOAB&dadosConsulta.valorConsulta=472135&cdForo=-1"},
+		{ProcessID: "1019126-69.2014.8.26.0053", OAB: OAB{Number: "472135", UF: "SP"}, URL: server.URL + "/cpopg/show.do?processo.codigo=1H0006MLR0000&processo.foro=53&paginaConsulta=2&cbPesquisa=NUMOAB&dadosConsulta.valorConsulta=472135&cdForo=-1"},
 	}
 
-	seeds, err := c.SearchByOAB(context.Background(), "472135")
+	seeds, err := c.SearchByOAB(context.Background(), MustParseOAB("472135"))
 	require.NoError(t, err)
 
 	assert.Equal(t, wantSeed, seeds)
 }
+
+func Test_Client_SearchByOABInForo(t *testing.T) {
+	c := New(Config{}, &http.Client{})
+
+	var cdForo string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdForo = r.URL.Query().Get("cdForo")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`<html><body><td id="mensagemRetorno">Não existem informações disponíveis para os parâmetros informados.</td></body></html>`))
+	}))
+	defer server.Close()
+
+	c.URL = server.URL
+
+	seeds, err := c.SearchByOABInForo(context.Background(), MustParseOAB("472135"), "0053")
+	require.ErrorIs(t, err, ErrNoProcesses)
+	assert.Empty(t, seeds)
+	assert.Equal(t, "53", cdForo)
+
+	// the foros missing from the catalog are searched too
+	_, err = c.SearchByOABInForo(context.Background(), MustParseOAB("472135"), "9998")
+	require.ErrorIs(t, err, ErrNoProcesses)
+	assert.Equal(t, "9998", cdForo)
+
+	_, err = c.SearchByOABInForo(context.Background(), MustParseOAB("472135"), "abc")
+	require.Error(t, err)
+}
+
+func Test_Client_SearchByOAB_unexpectedPage(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr error
+	}{
+		{name: "server error", status: http.StatusInternalServerError, body: "error", wantErr: ErrUnexpectedPage},
+		{name: "throttled", status: http.StatusTooManyRequests, wantErr: ErrThrottled},
+		{name: "captcha", status: http.StatusOK, body: `<html><body><div class="g-recaptcha"></div></body></html>`, wantErr: ErrUnexpectedPage},
+		{name: "empty page", status: http.StatusOK, wantErr: ErrUnexpectedPage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			c := New(Config{}, &http.Client{})
+			c.URL = server.URL
+
+			seeds, err := c.SearchByOAB(context.Background(), MustParseOAB("472135"))
+			require.ErrorIs(t, err, tt.wantErr)
+			assert.Empty(t, seeds)
+		})
+	}
+}
+
+func Test_Client_SearchByOAB_pageWithoutProcesses(t *testing.T) {
+	// every page has the pagination, but none of them has processes
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(golden.Get(t, "searchByOABPenultimatePage.golden"))
+	}))
+	defer server.Close()
+
+	c := New(Config{}, &http.Client{})
+	c.URL = server.URL
+
+	_, err := c.SearchByOAB(context.Background(), MustParseOAB("472135"))
+	require.ErrorIs(t, err, ErrUnexpectedPage)
+}
@@ -0,0 +1,128 @@
+// Package esaj foro.go gather the embedded catalog of the TJSP foros and the functions to query it.
+package esaj
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// foros.json is the catalog of the TJSP foros. The codes are the same used in the last four digits of the
+// CNJ number and in the processo.foro/cdForo parameters of the eSAJ website.
+// To add a new foro, just append it to the file keeping the code with four digits. The catalog doesn't have all
+// the foros, so the codes missing from it are never rejected, and their processes are grouped under UnknownComarca.
+//
+//go:embed foros.json
+var forosJSON []byte
+
+var (
+	// ErrForoNotFound is an error that occurs when the foro code is not present in the catalog.
+	ErrForoNotFound = errors.New("foro not found")
+)
+
+// Foro is a TJSP court house. Each comarca has one or more foros, the comarcas are grouped in
+// circunscrições and those in administrative regions (RAJ).
+type Foro struct {
+	// Code example: "0053"
+	Code string `json:"code"`
+	// Name example: "Foro Central - Fazenda Pública/Acidentes"
+	Name string `json:"name"`
+	// Comarca example: "São Paulo"
+	Comarca string `json:"comarca"`
+	// Circunscricao is the name of the seat of the judicial circunscrição. Example: "Campinas"
+	Circunscricao string `json:"circunscricao"`
+	// Region is the administrative region of the TJSP. Example: "4ª RAJ - Campinas"
+	Region string `json:"region"`
+}
+
+// loadForos parses the embedded catalog only once, the first time that it is needed.
+var loadForos = sync.OnceValue(func() map[string]Foro {
+	var foros []Foro
+	if err := json.Unmarshal(forosJSON, &foros); err != nil {
+		panic(fmt.Sprintf("esaj: invalid embedded foros catalog: %v", err))
+	}
+
+	catalog := make(map[string]Foro, len(foros))
+	for _, f := range foros {
+		catalog[f.Code] = f
+	}
+	return catalog
+})
+
+// NormalizeForoCode returns the foro code with four digits. The eSAJ website uses "53" and "0053" for the same foro.
+func NormalizeForoCode(code string) (string, error) {
+	code = strings.TrimSpace(code)
+	n, err := strconv.Atoi(code)
+	if err != nil || n <= 0 || n > 9999 {
+		return "", fmt.Errorf("invalid foro code: %q", code)
+	}
+	return fmt.Sprintf("%04d", n), nil
+}
+
+// ForoByCode returns the foro given its code. Example: "53" or "0053"
+func ForoByCode(code string) (Foro, error) {
+	normalized, err := NormalizeForoCode(code)
+	if err != nil {
+		return Foro{}, err
+	}
+
+	foro, ok := loadForos()[normalized]
+	if !ok {
+		return Foro{}, fmt.Errorf("%w: %s", ErrForoNotFound, normalized)
+	}
+	return foro, nil
+}
+
+// ForoByProcessID returns the foro of a process given its CNJ number. Example: 1016358-63.2020.8.26.0053
+func ForoByProcessID(processID string) (Foro, error) {
+	code, err := ForoNumeroUnificado(processID)
+	if err != nil {
+		return Foro{}, err
+	}
+	return ForoByCode(code)
+}
+
+// Foros returns all foros of the catalog ordered by code.
+func Foros() []Foro {
+	foros := make([]Foro, 0, len(loadForos()))
+	for _, f := range loadForos() {
+		foros = append(foros, f)
+	}
+
+	slices.SortFunc(foros, func(a, b Foro) int {
+		return strings.Compare(a.Code, b.Code)
+	})
+	return foros
+}
+
+// ForosByComarca returns all foros of a comarca ordered by code. The comparison is case insensitive.
+func ForosByComarca(comarca string) []Foro {
+	var foros []Foro
+	for _, f := range Foros() {
+		if strings.EqualFold(f.Comarca, comarca) {
+			foros = append(foros, f)
+		}
+	}
+	return foros
+}
+
+// UnknownComarca is the comarca of the processes whose foro is not in the catalog.
+const UnknownComarca = "Não catalogada"
+
+// ComarcaOf returns the comarca of a process, looking first to the foro code and then to the CNJ number.
+// If the foro is not in the catalog, UnknownComarca is returned.
+func ComarcaOf(p ProcessBasicInfo) string {
+	if foro, err := ForoByCode(p.ProcessForo); err == nil {
+		return foro.Comarca
+	}
+
+	if foro, err := ForoByProcessID(p.ProcessID); err == nil {
+		return foro.Comarca
+	}
+	return UnknownComarca
+}
@@ -0,0 +1,76 @@
+package esaj
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ForoByCode(t *testing.T) {
+	want := Foro{
+		Code:          "0053",
+		Name:          "Foro Central - Fazenda Pública/Acidentes",
+		Comarca:       "São Paulo",
+		Circunscricao: "São Paulo",
+		Region:        "1ª RAJ - Grande São Paulo",
+	}
+
+	got, err := ForoByCode("53")
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	got, err = ForoByCode("0053")
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	_, err = ForoByCode("9998")
+	require.ErrorIs(t, err, ErrForoNotFound)
+
+	_, err = ForoByCode("abc")
+	require.Error(t, err)
+}
+
+func Test_ForoByProcessID(t *testing.T) {
+	got, err := ForoByProcessID("1007573-30.2024.8.26.0229")
+	require.NoError(t, err)
+	assert.Equal(t, "Hortolândia", got.Comarca)
+
+	_, err = ForoByProcessID("invalid")
+	require.Error(t, err)
+}
+
+func Test_Foros(t *testing.T) {
+	foros := Foros()
+	require.NotEmpty(t, foros)
+
+	for i, f := range foros {
+		normalized, err := NormalizeForoCode(f.Code)
+		require.NoError(t, err)
+		assert.Equal(t, normalized, f.Code, "foro codes must have four digits")
+		assert.NotEmpty(t, f.Name)
+		assert.NotEmpty(t, f.Comarca)
+		assert.NotEmpty(t, f.Circunscricao)
+		assert.NotEmpty(t, f.Region)
+		if i > 0 {
+			assert.Less(t, foros[i-1].Code, f.Code)
+		}
+	}
+}
+
+func Test_ForosByComarca(t *testing.T) {
+	foros := ForosByComarca("são paulo")
+	require.NotEmpty(t, foros)
+	for _, f := range foros {
+		assert.Equal(t, "São Paulo", f.Comarca)
+	}
+
+	assert.Empty(t, ForosByComarca("Atlântida"))
+}
+
+func Test_ComarcaOf(t *testing.T) {
+	assert.Equal(t, "Campinas", ComarcaOf(ProcessBasicInfo{ProcessForo: "114"}))
+	assert.Equal(t, "Santos", ComarcaOf(ProcessBasicInfo{ProcessID: "1000001-02.2021.8.26.0562"}))
+	assert.Equal(t, UnknownComarca, ComarcaOf(ProcessBasicInfo{ProcessForo: "9998", ForoName: "Foro Regional de Santana"}))
+	assert.Equal(t, UnknownComarca, ComarcaOf(ProcessBasicInfo{}))
+}
@@ -5,8 +5,10 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/cdproto/storage"
@@ -15,22 +17,38 @@ import (
 
 // Login is a struct that holds the login information for the ESAJ website.
 type Login struct {
-	Username string
-	Password string
+	Username string `json:"username"`
+	Password string `json:"password"`
 }
 
 // GetCookies use a headless browser to simulate the login and all the steps to retrive the cookies from the ESAJ website.
 // - headless is a boolean that defines if the browser should be headless or not. For production, it must be true.
 // - processoID example: 1016358-63.2020.8.26.0053
 func GetCookies(ctx context.Context, esajLogin Login, headless bool, processoID string) (string, string, error) {
+	cookies, err := getCookies(ctx, esajLogin, headless, processoID)
+	if err != nil {
+		return "", "", err
+	}
+
+	cookieSession, cookiePDFSession := parseCookies(toHTTPCookies(cookies))
+
+	return cookieSession, cookiePDFSession, nil
+}
+
+// getCookies runs the headless flow of GetCookies and returns all cookies of the browser.
+func getCookies(ctx context.Context, esajLogin Login, headless bool, processoID string) ([]*network.Cookie, error) {
 	logger := slog.With("processID", processoID)
 
 	logger.Debug(fmt.Sprintf("GetCookies headless initialized with the headless option: %v", headless))
 
-	opts := append(chromedp.DefaultExecAllocatorOptions[:],
-		chromedp.DisableGPU,
-		chromedp.Flag("headless", headless),
-	)
+	opts := allocatorOptions(headless)
+	proxy, err := ChromeProxyServer(ProxyFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if proxy != "" {
+		opts = append(opts, chromedp.ProxyServer(proxy))
+	}
 
 	allocCtx, cancel := chromedp.NewExecAllocator(ctx, opts...)
 	defer cancel()
@@ -40,13 +58,30 @@ func GetCookies(ctx context.Context, esajLogin Login, headless bool, processoID
 
 	var cookies []*network.Cookie
 
-	searchDo, err := searchDoURL(processoID)
+	pastaDigital, err := pastaDigitalCookiesAction(processoID, &cookies)
 	if err != nil {
-		return "", "", fmt.Errorf("bulding the searchDoURL: %v", err)
+		return nil, err
 	}
-	logger.Debug("searchDoURL", "url", searchDo)
 
-	err = chromedp.Run(ctx,
+	err = chromedp.Run(ctx, loginActions(esajLogin), pastaDigital)
+	if err != nil {
+		return nil, fmt.Errorf("could not get cookies: %v", err)
+	}
+
+	return cookies, nil
+}
+
+// allocatorOptions are the options used to start the Chrome process.
+func allocatorOptions(headless bool) []chromedp.ExecAllocatorOption {
+	return append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.DisableGPU,
+		chromedp.Flag("headless", headless),
+	)
+}
+
+// loginActions simulate the login in the sajcas page. After them, the browser has a valid cpopg session.
+func loginActions(esajLogin Login) chromedp.Tasks {
+	return chromedp.Tasks{
 		chromedp.Navigate(`https://esaj.tjsp.jus.br/sajcas/login`),
 		chromedp.WaitVisible(`#usernameForm`, chromedp.ByID),
 		chromedp.SendKeys(`#usernameForm`, esajLogin.Username),
@@ -56,12 +91,28 @@ func GetCookies(ctx context.Context, esajLogin Login, headless bool, processoID
 		chromedp.WaitVisible(`h1.esajTituloPagina`, chromedp.ByQuery),
 		chromedp.Navigate("https://esaj.tjsp.jus.br/cpopg/open.do"),
 		chromedp.WaitVisible(`a.linkLogo`, chromedp.ByQuery),
+	}
+}
+
+// pastaDigitalCookiesAction navigates from the process page to its pasta digital, where the PDF session cookies
+// are created, and saves all browser cookies in cookies. The browser must be logged in.
+// - processoID example: 1016358-63.2020.8.26.0053
+func pastaDigitalCookiesAction(processoID string, cookies *[]*network.Cookie) (chromedp.Action, error) {
+	logger := slog.With("processID", processoID)
+
+	searchDo, err := searchDoURL(processoID)
+	if err != nil {
+		return nil, fmt.Errorf("bulding the searchDoURL: %v", err)
+	}
+	logger.Debug("searchDoURL", "url", searchDo)
+
+	return chromedp.Tasks{
 		// navigate through the searchDo page to extract the process.codigo, key to follow the next steps.
 		chromedp.Navigate(searchDo),
 		chromedp.ActionFunc(func(ctx context.Context) error {
 			// Extracting the current URL, thi one contains the process.codigo, the necessary key to follow the next steps.
 			var searchDoURLWithProcessCode string
-			err = chromedp.Location(&searchDoURLWithProcessCode).Do(ctx)
+			err := chromedp.Location(&searchDoURLWithProcessCode).Do(ctx)
 			if err != nil {
 				return fmt.Errorf("could not get the url: %v", err)
 			}
@@ -115,22 +166,14 @@ func GetCookies(ctx context.Context, esajLogin Login, headless bool, processoID
 
 			logger.Debug("parsed pasta digital href", "href", pastaDigitalHREF)
 
-			cookies, err = navigatePastaVirtualURL(ctx, "https://esaj.tjsp.jus.br/pastadigital/abrirPastaProcessoDigital.do?"+pastaDigitalHREF)
+			*cookies, err = navigatePastaVirtualURL(ctx, "https://esaj.tjsp.jus.br/pastadigital/abrirPastaProcessoDigital.do?"+pastaDigitalHREF)
 			if err != nil {
 				return fmt.Errorf("could not navigate to pastaVirtualURL: %v", err)
 			}
 
 			return nil
 		}),
-	)
-
-	if err != nil {
-		return "", "", fmt.Errorf("could not get cookies: %v", err)
-	}
-
-	cookieSession, cookiePDFSession := parseCookies(cookies)
-
-	return cookieSession, cookiePDFSession, nil
+	}, nil
 }
 
 // parseCookies receives a slice of cookies and returns two strings that contains the cookieSession and cookiePDFSession.
@@ -138,7 +181,9 @@ func GetCookies(ctx context.Context, esajLogin Login, headless bool, processoID
 // the first string return is the cookieSession and the second is the cookiePDFSession
 // cookiesSession example: "JSESSIONID=EACA3333A48456D7953B6331999A4F80.cas11; K-JSESSIONID-nckcjpip=0E4D006FFD78524DBABA78F02E1633FA"
 // cookiesPDFSession example: "JSESSION=8A1F3DCE0D4DC510FFF3305E44ABCC4E.pasta3; K-JSESSIONID-phoaambo=0E4D006FFD78524DBABA78F02E1633FA"
-func parseCookies(cookies []*network.Cookie) (string, string) {
+// The suffix of the K-JSESSIONID cookies changes between the eSAJ nodes, so they are matched by the path.
+// Prefer to use a Jar, that doesn't depend on the cookie names.
+func parseCookies(cookies []*http.Cookie) (string, string) {
 	var cookieSession string
 	var cookiePDFSession string
 	for _, cookie := range cookies {
@@ -146,7 +191,7 @@ func parseCookies(cookies []*network.Cookie) (string, string) {
 			cookieSession = fmt.Sprintf("%s=%s;", cookie.Name, cookie.Value)
 		}
 
-		if strings.Contains(cookie.Name, "K-JSESSIONID-knbbofpc") {
+		if strings.HasPrefix(cookie.Name, "K-JSESSIONID-") && strings.HasPrefix(cookie.Path, "/cpopg") {
 			cookieSession = fmt.Sprintf("%s %s=%s;", cookieSession, cookie.Name, cookie.Value)
 		}
 
@@ -154,13 +199,35 @@ func parseCookies(cookies []*network.Cookie) (string, string) {
 			cookiePDFSession = fmt.Sprintf("%s=%s;", cookie.Name, cookie.Value)
 		}
 
-		if strings.Contains(cookie.Name, "K-JSESSIONID-phoaambo") {
+		if strings.HasPrefix(cookie.Name, "K-JSESSIONID-") && strings.HasPrefix(cookie.Path, "/pastadigital") {
 			cookiePDFSession = fmt.Sprintf("%s %s=%s;", cookiePDFSession, cookie.Name, cookie.Value)
 		}
 	}
 	return cookieSession, cookiePDFSession
 }
 
+// toHTTPCookies converts the cookies of the browser to the net/http representation.
+func toHTTPCookies(cookies []*network.Cookie) []*http.Cookie {
+	httpCookies := make([]*http.Cookie, 0, len(cookies))
+	for _, c := range cookies {
+		httpCookie := &http.Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			Secure:   c.Secure,
+			HttpOnly: c.HTTPOnly,
+		}
+
+		// session cookies have a negative expiration in the devtools protocol.
+		if c.Expires > 0 {
+			httpCookie.Expires = time.Unix(int64(c.Expires), 0)
+		}
+		httpCookies = append(httpCookies, httpCookie)
+	}
+	return httpCookies
+}
+
 // showDoURL is the page that retreive the specific information about a process.
 // - processoCodigo example: 1H000H91J0000. Important to mentioned that this ID does not have a defined pattern, it's a internal ID from the ESAJ
 // the only thing that we can assume is that it is a string with 13 characters.
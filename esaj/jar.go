@@ -0,0 +1,364 @@
+// Package esaj jar.go gather the cookie jar used to keep the eSAJ session and the encrypted store to persist it.
+package esaj
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// ESAJURL is the base URL of the TJSP eSAJ website.
+const ESAJURL = "https://esaj.tjsp.jus.br"
+
+var (
+	// ErrSessionNotFound is an error that occurs when there is no saved session for an account.
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// Jar is a http.CookieJar scoped to the host of the eSAJ website. Cookies from other hosts are ignored and the
+// path scoping (/cpopg, /pastadigital, /sajcas) is done by the standard library jar, this way the session
+// doesn't depend on the names of the cookies, that change between the eSAJ nodes.
+// Besides the standard behavior, Jar keeps track of the cookies that were set, so they can be persisted.
+type Jar struct {
+	// Proxy is the proxy that created the session, the requests that use the jar are sent through it.
+	// Empty when the session was created without a ProxyPool.
+	Proxy string
+
+	base *url.URL
+
+	mu      sync.Mutex
+	jar     *cookiejar.Jar
+	cookies map[string]*http.Cookie
+}
+
+// NewJar creates a new Jar scoped to the host of baseURL. Example: https://esaj.tjsp.jus.br
+func NewJar(baseURL string) (*Jar, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing base url: %w", err)
+	}
+
+	if base.Host == "" {
+		return nil, fmt.Errorf("base url %q has no host", baseURL)
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cookie jar: %w", err)
+	}
+
+	return &Jar{
+		base:    base,
+		jar:     jar,
+		cookies: make(map[string]*http.Cookie),
+	}, nil
+}
+
+// SetCookies implements the http.CookieJar interface. Cookies from hosts other than the eSAJ one are ignored.
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	if !j.inScope(u) {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.jar.SetCookies(u, cookies)
+	for _, c := range cookies {
+		stored := *c
+		if stored.Path == "" {
+			stored.Path = defaultCookiePath(u.Path)
+		}
+		if stored.MaxAge > 0 {
+			stored.Expires = time.Now().Add(time.Duration(stored.MaxAge) * time.Second)
+			stored.MaxAge = 0
+		}
+
+		key := stored.Domain + ";" + stored.Path + ";" + stored.Name
+		if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(time.Now())) {
+			delete(j.cookies, key)
+			continue
+		}
+		j.cookies[key] = &stored
+	}
+}
+
+// Cookies implements the http.CookieJar interface.
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	if !j.inScope(u) {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.jar.Cookies(u)
+}
+
+// All returns all cookies that are not expired, with their domain and path.
+func (j *Jar) All() []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	var cookies []*http.Cookie
+	for _, c := range j.cookies {
+		if !c.Expires.IsZero() && c.Expires.Before(now) {
+			continue
+		}
+		stored := *c
+		cookies = append(cookies, &stored)
+	}
+	return cookies
+}
+
+// Add adds cookies that don't come from an http response, like the ones obtained by a headless browser.
+// The cookies are placed in the URL formed by the eSAJ host and the path of the cookie.
+func (j *Jar) Add(cookies ...*http.Cookie) {
+	for _, c := range cookies {
+		u := *j.base
+		u.Path = c.Path
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		j.SetCookies(&u, []*http.Cookie{c})
+	}
+}
+
+// Config returns a Config that uses this jar, the legacy cookie strings are filled as well.
+func (j *Jar) Config() Config {
+	cookieSession, cookiePDFSession := parseCookies(j.All())
+	return Config{
+		CookieSession:    cookieSession,
+		CookiePDFSession: cookiePDFSession,
+		Jar:              j,
+	}
+}
+
+func (j *Jar) inScope(u *url.URL) bool {
+	host := u.Hostname()
+	baseHost := j.base.Hostname()
+	return host == baseHost || strings.HasSuffix(host, "."+baseHost)
+}
+
+// defaultCookiePath follows the RFC 6265 section 5.1.4.
+func defaultCookiePath(path string) string {
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// SessionStore saves and loads the eSAJ sessions in encrypted files, one per account. The files are encrypted
+// with AES-GCM using a key derived from Secret, and the account is authenticated together with the content,
+// so a session file can't be used by another account.
+type SessionStore struct {
+	// Dir is the directory where the session files are saved.
+	Dir string
+	// Secret is used to derive the encryption key. It must be the same to save and load a session.
+	Secret []byte
+}
+
+// storedSession is the content of the session file before the encryption.
+type storedSession struct {
+	BaseURL string         `json:"base_url"`
+	Proxy   string         `json:"proxy,omitempty"`
+	SavedAt time.Time      `json:"saved_at"`
+	Cookies []storedCookie `json:"cookies"`
+}
+
+type storedCookie struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain,omitempty"`
+	Path     string    `json:"path"`
+	Expires  time.Time `json:"expires,omitempty"`
+	Secure   bool      `json:"secure,omitempty"`
+	HTTPOnly bool      `json:"http_only,omitempty"`
+}
+
+// sessionFileMagic identifies the format of the session file, allowing to change it in the future.
+var sessionFileMagic = []byte("ESAJSESSION1")
+
+const (
+	sessionSaltSize = 16
+	scryptR         = 8
+	scryptP         = 1
+)
+
+// scryptN is the cost parameter recommended for interactive logins. It's a variable only to speed up the tests.
+var scryptN = 32768
+
+// Save encrypts and saves all cookies of the jar in the session file of the account.
+func (s SessionStore) Save(account string, jar *Jar) error {
+	if len(s.Secret) == 0 {
+		return errors.New("session store secret is empty")
+	}
+
+	session := storedSession{
+		BaseURL: jar.base.String(),
+		Proxy:   jar.Proxy,
+		SavedAt: time.Now().UTC(),
+	}
+	for _, c := range jar.All() {
+		session.Cookies = append(session.Cookies, storedCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Expires:  c.Expires,
+			Secure:   c.Secure,
+			HTTPOnly: c.HttpOnly,
+		})
+	}
+
+	plaintext, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("error marshalling session: %w", err)
+	}
+
+	salt := make([]byte, sessionSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return fmt.Errorf("error generating salt: %w", err)
+	}
+
+	gcm, err := s.cipher(salt)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(sessionFileMagic)
+	buf.Write(salt)
+	buf.Write(nonce)
+	buf.Write(gcm.Seal(nil, nonce, plaintext, []byte(account)))
+
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return fmt.Errorf("error creating session dir: %w", err)
+	}
+
+	// write in a temporary file and rename it, to avoid a corrupted session if the process dies in the middle.
+	path := s.path(account)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("error writing session file: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load decrypts the session file of the account and returns a jar with its cookies.
+// If the account has no saved session, ErrSessionNotFound is returned.
+func (s SessionStore) Load(account string) (*Jar, error) {
+	data, err := os.ReadFile(s.path(account))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading session file: %w", err)
+	}
+
+	if !bytes.HasPrefix(data, sessionFileMagic) {
+		return nil, errors.New("invalid session file")
+	}
+	data = data[len(sessionFileMagic):]
+
+	if len(data) < sessionSaltSize {
+		return nil, errors.New("invalid session file")
+	}
+	salt, data := data[:sessionSaltSize], data[sessionSaltSize:]
+
+	gcm, err := s.cipher(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("invalid session file")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(account))
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting session file, the secret or the account don't match: %w", err)
+	}
+
+	var session storedSession
+	if err := json.Unmarshal(plaintext, &session); err != nil {
+		return nil, fmt.Errorf("error unmarshalling session: %w", err)
+	}
+
+	jar, err := NewJar(session.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	jar.Proxy = session.Proxy
+
+	for _, c := range session.Cookies {
+		jar.Add(&http.Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Expires:  c.Expires,
+			Secure:   c.Secure,
+			HttpOnly: c.HTTPOnly,
+		})
+	}
+	return jar, nil
+}
+
+// Delete removes the session file of the account. It's not an error if the file doesn't exist.
+func (s SessionStore) Delete(account string) error {
+	err := os.Remove(s.path(account))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// path returns the session file of the account. The account is hashed to avoid leaking it in the file name.
+func (s SessionStore) path(account string) string {
+	sum := sha256.Sum256([]byte(account))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:16])+".session")
+}
+
+func (s SessionStore) cipher(salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(s.Secret, salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
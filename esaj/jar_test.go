@@ -0,0 +1,141 @@
+package esaj
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Jar_scope(t *testing.T) {
+	jar, err := NewJar(ESAJURL)
+	require.NoError(t, err)
+
+	cpopg, _ := url.Parse("https://esaj.tjsp.jus.br/cpopg/show.do")
+	pasta, _ := url.Parse("https://esaj.tjsp.jus.br/pastadigital/getPDF.do")
+	other, _ := url.Parse("https://example.com/cpopg/show.do")
+
+	jar.SetCookies(cpopg, []*http.Cookie{{Name: "JSESSIONID", Value: "cpopg", Path: "/cpopg"}})
+	jar.SetCookies(pasta, []*http.Cookie{{Name: "JSESSIONID", Value: "pasta", Path: "/pastadigital"}})
+	jar.SetCookies(other, []*http.Cookie{{Name: "tracker", Value: "1"}})
+
+	got := jar.Cookies(cpopg)
+	require.Len(t, got, 1)
+	assert.Equal(t, "cpopg", got[0].Value)
+
+	got = jar.Cookies(pasta)
+	require.Len(t, got, 1)
+	assert.Equal(t, "pasta", got[0].Value)
+
+	assert.Empty(t, jar.Cookies(other))
+	assert.Len(t, jar.All(), 2)
+}
+
+func Test_Jar_expiredCookies(t *testing.T) {
+	jar, err := NewJar(ESAJURL)
+	require.NoError(t, err)
+
+	u, _ := url.Parse("https://esaj.tjsp.jus.br/cpopg/show.do")
+	jar.SetCookies(u, []*http.Cookie{{Name: "JSESSIONID", Value: "1", Path: "/cpopg"}})
+	require.Len(t, jar.All(), 1)
+
+	jar.SetCookies(u, []*http.Cookie{{Name: "JSESSIONID", Value: "1", Path: "/cpopg", MaxAge: -1}})
+	assert.Empty(t, jar.All())
+	assert.Empty(t, jar.Cookies(u))
+}
+
+// fastScrypt reduces the cost of the key derivation during a test.
+func fastScrypt(t *testing.T) {
+	n := scryptN
+	scryptN = 1024
+	t.Cleanup(func() {
+		scryptN = n
+	})
+}
+
+func Test_SessionStore(t *testing.T) {
+	fastScrypt(t)
+	store := SessionStore{Dir: t.TempDir(), Secret: []byte("secret")}
+
+	jar, err := NewJar(ESAJURL)
+	require.NoError(t, err)
+	jar.Add(
+		&http.Cookie{Name: "JSESSIONID", Value: "cpopg", Path: "/cpopg"},
+		&http.Cookie{Name: "K-JSESSIONID-abcdefgh", Value: "pasta", Path: "/pastadigital", Expires: time.Now().Add(time.Hour)},
+	)
+
+	_, err = store.Load("user")
+	require.ErrorIs(t, err, ErrSessionNotFound)
+
+	require.NoError(t, store.Save("user", jar))
+
+	got, err := store.Load("user")
+	require.NoError(t, err)
+
+	u, _ := url.Parse("https://esaj.tjsp.jus.br/pastadigital/getPDF.do")
+	cookies := got.Cookies(u)
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "K-JSESSIONID-abcdefgh", cookies[0].Name)
+	assert.Len(t, got.All(), 2)
+
+	// the session of an account can't be read with other secret
+	wrongSecret := SessionStore{Dir: store.Dir, Secret: []byte("other")}
+	_, err = wrongSecret.Load("user")
+	require.Error(t, err)
+
+	require.NoError(t, store.Delete("user"))
+	_, err = store.Load("user")
+	require.ErrorIs(t, err, ErrSessionNotFound)
+}
+
+func Test_SessionManager_Store(t *testing.T) {
+	fastScrypt(t)
+	store := &SessionStore{Dir: t.TempDir(), Secret: []byte("secret")}
+
+	provider := &fakeProvider{}
+	m := NewSessionManager(provider)
+	m.Store = store
+	m.Account = "user"
+
+	_, _, err := m.Current(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), provider.calls.Load())
+
+	// a new manager, like in a new run of the CLI, reuses the saved session
+	m = NewSessionManager(provider)
+	m.Store = store
+	m.Account = "user"
+
+	config, _, err := m.Current(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), provider.calls.Load())
+	assert.Equal(t, "JSESSIONID=session1.cpopg1;", config.CookieSession)
+}
+
+func Test_Client_jar(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the cookie must be sent by the jar, scoped by the /cpopg path.
+		c, err := r.Cookie("JSESSIONID")
+		if err != nil || c.Value != "first" {
+			t.Errorf("expected JSESSIONID=first, got %v", c)
+		}
+		_, _ = w.Write([]byte(`<body>https://esaj.tjsp.jus.br/pastadigital/abrirPastaProcessoDigital.do</body>`))
+	}))
+	defer server.Close()
+
+	jar, err := NewJar(server.URL)
+	require.NoError(t, err)
+	jar.Add(&http.Cookie{Name: "JSESSIONID", Value: "first", Path: "/cpopg"})
+
+	c := New(jar.Config(), &http.Client{Timeout: 2 * time.Second})
+	c.URL = server.URL
+
+	got, err := c.pastaDigitalURL(context.Background(), "PROCESSCODE")
+	require.NoError(t, err)
+	assert.Equal(t, "/pastadigital/abrirPastaProcessoDigital.do", got)
+}
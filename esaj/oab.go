@@ -0,0 +1,158 @@
+// Package esaj oab.go gather functions to parse, validate and format OAB registrations.
+package esaj
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultUF is the UF assumed when an OAB registration is informed without one. TJSP is the court that
+// this package scrapes, so the registrations without UF are, by far, from São Paulo.
+const DefaultUF = "SP"
+
+var (
+	// ErrInvalidOAB is an error that occurs when a string can't be parsed as an OAB registration.
+	ErrInvalidOAB = errors.New("invalid oab")
+)
+
+// ufs is the list of the brazilian states, each one has its own OAB section.
+var ufs = []string{
+	"AC", "AL", "AM", "AP", "BA", "CE", "DF", "ES", "GO", "MA", "MG", "MS", "MT", "PA",
+	"PB", "PE", "PI", "PR", "RJ", "RN", "RO", "RR", "RS", "SC", "SE", "SP", "TO",
+}
+
+// oabRegex matches the formats of OAB registration commonly found in petitions and in the user input.
+// Examples: "103289", "103289/SP", "103.289-SP", "SP103289", "SP/103.289", "103289-A/SP", "103289SP"
+// the groups are: 1 - prefixed UF, 2 - number, 3 - suffix, 4 - UF.
+var oabRegex = regexp.MustCompile(`^(?:([A-Z]{2})[\s/\-:]*)?(\d[\d.]*)(?:[\s\-]*([A-Z]))?(?:[\s/\-]*([A-Z]{2}))?$`)
+
+// oabNoise are the words that can surround an OAB registration and don't carry any information.
+var oabNoise = strings.NewReplacer("OAB", "", "Nº", "", "N°", "", "NO.", "", "N.", "")
+
+// OAB is a registration in the Ordem dos Advogados do Brasil. A lawyer has one main registration and can hold
+// supplementary ones in other states, that's why the UF is part of the identity of the registration.
+type OAB struct {
+	// Number is the registration number without dots or leading zeros. Example: "103289"
+	Number string
+	// UF is the state where the registration was made. Example: "SP"
+	UF string
+	// Suffix is the letter that some registrations carry after the number. Example: "A" for "103289-A/SP"
+	Suffix string
+}
+
+// ParseOAB parses a free string into an OAB registration. The parse is case and punctuation insensitive, so
+// "103289", "103289/SP" and "OAB 103.289-SP" are all the same registration.
+// When the UF is not informed, DefaultUF is used.
+func ParseOAB(s string) (OAB, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(s))
+	normalized = strings.Trim(oabNoise.Replace(normalized), " /-:")
+
+	matches := oabRegex.FindStringSubmatch(normalized)
+	if len(matches) == 0 {
+		return OAB{}, fmt.Errorf("%w: %q", ErrInvalidOAB, s)
+	}
+
+	prefixUF, number, suffix, uf := matches[1], matches[2], matches[3], matches[4]
+	if prefixUF != "" && uf != "" && prefixUF != uf {
+		return OAB{}, fmt.Errorf("%w: %q has two different UFs", ErrInvalidOAB, s)
+	}
+
+	if uf == "" {
+		uf = prefixUF
+	}
+
+	if uf == "" {
+		uf = DefaultUF
+	}
+
+	oab := OAB{
+		Number: strings.TrimLeft(strings.ReplaceAll(number, ".", ""), "0"),
+		UF:     uf,
+		Suffix: suffix,
+	}
+
+	if err := oab.Validate(); err != nil {
+		return OAB{}, fmt.Errorf("%w. input: %q", err, s)
+	}
+
+	return oab, nil
+}
+
+// MustParseOAB is like ParseOAB but panics if the string can't be parsed. Useful for constants and tests.
+func MustParseOAB(s string) OAB {
+	oab, err := ParseOAB(s)
+	if err != nil {
+		panic(err)
+	}
+	return oab
+}
+
+// Validate checks if the OAB registration has a valid number, UF and suffix.
+func (o OAB) Validate() error {
+	if o.Number == "" || len(o.Number) > 6 {
+		return fmt.Errorf("%w: number must have between 1 and 6 digits, got %q", ErrInvalidOAB, o.Number)
+	}
+
+	for _, r := range o.Number {
+		if r < '0' || r > '9' {
+			return fmt.Errorf("%w: number must contain only digits, got %q", ErrInvalidOAB, o.Number)
+		}
+	}
+
+	if strings.Trim(o.Number, "0") == "" {
+		return fmt.Errorf("%w: number can't be zero", ErrInvalidOAB)
+	}
+
+	if !slices.Contains(ufs, o.UF) {
+		return fmt.Errorf("%w: unknown uf %q", ErrInvalidOAB, o.UF)
+	}
+
+	if len(o.Suffix) > 1 || (o.Suffix != "" && (o.Suffix[0] < 'A' || o.Suffix[0] > 'Z')) {
+		return fmt.Errorf("%w: suffix must be a single letter, got %q", ErrInvalidOAB, o.Suffix)
+	}
+
+	return nil
+}
+
+// IsZero reports whether the OAB registration is empty.
+func (o OAB) IsZero() bool {
+	return o == OAB{}
+}
+
+// String returns the canonical format of the registration, used as identifier in the storage.
+// Example: "103289/SP" or "103289A/SP" when the registration has a suffix.
+func (o OAB) String() string {
+	if o.IsZero() {
+		return ""
+	}
+	return o.Number + o.Suffix + "/" + o.UF
+}
+
+// ESAJQuery returns the registration in the format expected by the dadosConsulta.valorConsulta parameter of
+// the eSAJ search by OAB. Example: "103289SP"
+func (o OAB) ESAJQuery() string {
+	return o.Number + o.Suffix + o.UF
+}
+
+// MarshalText encodes the OAB in its canonical format, this way it is a plain string in JSON.
+func (o OAB) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText parses the OAB from any of the formats accepted by ParseOAB.
+func (o *OAB) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*o = OAB{}
+		return nil
+	}
+
+	oab, err := ParseOAB(string(text))
+	if err != nil {
+		return err
+	}
+	*o = oab
+	return nil
+}
@@ -0,0 +1,77 @@
+package esaj
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseOAB(t *testing.T) {
+	tests := []struct {
+		input string
+		want  OAB
+	}{
+		{input: "103289", want: OAB{Number: "103289", UF: "SP"}},
+		{input: "103289/SP", want: OAB{Number: "103289", UF: "SP"}},
+		{input: "OAB 103.289-SP", want: OAB{Number: "103289", UF: "SP"}},
+		{input: "oab/rj 103.289", want: OAB{Number: "103289", UF: "RJ"}},
+		{input: "OAB/MG nº 12.345", want: OAB{Number: "12345", UF: "MG"}},
+		{input: "103289SP", want: OAB{Number: "103289", UF: "SP"}},
+		{input: "SP103289", want: OAB{Number: "103289", UF: "SP"}},
+		{input: "103289-A/SP", want: OAB{Number: "103289", UF: "SP", Suffix: "A"}},
+		{input: "103289A", want: OAB{Number: "103289", UF: "SP", Suffix: "A"}},
+		{input: " 003289 / PR ", want: OAB{Number: "3289", UF: "PR"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseOAB(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_ParseOAB_invalid(t *testing.T) {
+	inputs := []string{
+		"",
+		"abc",
+		"000000",
+		"1234567/SP",
+		"103289/XX",
+		"RJ103289/SP",
+		"103289/SP/RJ",
+	}
+
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			_, err := ParseOAB(input)
+			require.ErrorIs(t, err, ErrInvalidOAB)
+		})
+	}
+}
+
+func Test_OAB_String(t *testing.T) {
+	assert.Equal(t, "103289/SP", MustParseOAB("OAB 103.289-SP").String())
+	assert.Equal(t, "103289A/SP", MustParseOAB("103289-A/SP").String())
+	assert.Equal(t, "", OAB{}.String())
+}
+
+func Test_OAB_ESAJQuery(t *testing.T) {
+	assert.Equal(t, "103289SP", MustParseOAB("103289").ESAJQuery())
+	assert.Equal(t, "103289ARJ", MustParseOAB("103289-A/RJ").ESAJQuery())
+}
+
+func Test_OAB_JSON(t *testing.T) {
+	seed := ProcessSeed{ProcessID: "1", OAB: MustParseOAB("103289")}
+
+	b, err := json.Marshal(seed)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"process_id":"1","oab":"103289/SP","url":""}`, string(b))
+
+	var got ProcessSeed
+	require.NoError(t, json.Unmarshal([]byte(`{"process_id":"1","oab":"OAB 103.289-SP"}`), &got))
+	assert.Equal(t, seed, got)
+}
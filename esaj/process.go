@@ -1,6 +1,8 @@
 // Package esaj from process.go follow the same naming convention as the original API.
 package esaj
 
+import "time"
+
 // Process ...
 type Process struct {
 	Children []Children `json:"children"`
@@ -65,8 +67,8 @@ type ChildrenData struct {
 
 // ProcessBasicInfo as the name says, is the basic information of a process.
 type ProcessBasicInfo struct {
-	// OAB is the OAB of the process.
-	OAB string `json:"oab"`
+	// OAB is the OAB registration that was used to find the process.
+	OAB OAB `json:"oab"`
 	// ProcessID example: "1007573-30.2024.8.26.0229"
 	ProcessID string `json:"process_id"`
 	// ProcessForo example: "0053"
@@ -79,13 +81,28 @@ type ProcessBasicInfo struct {
 	Judge string `json:"judge"`
 	// Class is the class of the process. Example: "Habilitação de Crédito"
 	Class string `json:"class"`
+	// Subject is the subject (assunto) of the process. Example: "Indenização por Dano Moral"
+	Subject string `json:"subject"`
 	// Claimant is who is claiming for something in the process.
 	Claimant string `json:"claimant"`
 	// Defendant is who is being claimed in the process.
 	Defendant string `json:"defendant"`
 	// Vara is the court where the process is being processed.
 	Vara string `json:"vara"`
+	// Situation is the situation label of the process, empty when the page doesn't show one.
+	// Example: "Em andamento", "Extinto", "Suspenso"
+	Situation string `json:"situation"`
 	// URL is the URL of the process in the TJSP website.
 	// Example: https://esaj.tjsp.jus.br/cpopg/show.do?processo.codigo=1HZX5Q48A0000&processo.foro=53&paginaConsulta=17&cbPesquisa=NUMOAB&dadosConsulta.valorConsulta=103289&cdForo=-1
 	URL string `json:"url"`
 }
+
+// Movement is an entry of the movements (movimentações) of a process.
+type Movement struct {
+	// Date is the day of the movement, the eSAJ website doesn't show its time.
+	Date time.Time `json:"date"`
+	// Title example: "Certidão de Publicação Expedida"
+	Title string `json:"title"`
+	// Text is the description of the movement, it can be empty.
+	Text string `json:"text"`
+}
@@ -0,0 +1,243 @@
+// Package esaj session.go gather the session manager, responsible to keep the eSAJ cookies valid.
+package esaj
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/perebaj/esaj/metrics"
+)
+
+// SessionProvider is implemented by the flows that are able to log in the eSAJ website and return the
+// session cookies. Example: the headless browser flow (HeadlessProvider) or the HTTP only flow (CASProvider).
+type SessionProvider interface {
+	NewSession(ctx context.Context) ([]*http.Cookie, error)
+}
+
+// SessionManager owns the credentials of an eSAJ account and refreshes the session cookies through a
+// SessionProvider when they expire. It is safe for concurrent use across goroutines.
+type SessionManager struct {
+	// URL is the base URL of the eSAJ website, used to scope the session cookies.
+	URL string
+	// Store is optional. When set, the session of the Account is loaded from it before the first login,
+	// and saved after each login, so a valid session can be reused between runs.
+	Store *SessionStore
+	// Account identifies the session in the Store. Example: the eSAJ username.
+	Account string
+	// Proxies is optional. When set, each session is created through a proxy of the pool and all its requests
+	// are kept in that proxy, since the eSAJ website may refuse the cookies coming from another address.
+	Proxies *ProxyPool
+
+	provider SessionProvider
+	// lock is a semaphore that guards the fields below. A channel is used instead of a sync.Mutex because
+	// the login can take a while and the waiting goroutines must respect their context cancellation.
+	lock   chan struct{}
+	config Config
+	// version is incremented each time that the session is replaced, it's used to avoid that many goroutines
+	// that saw the same expired session trigger many logins.
+	version uint64
+}
+
+// NewSessionManager creates a new SessionManager. The first session is created lazily, in the first request.
+func NewSessionManager(provider SessionProvider) *SessionManager {
+	return &SessionManager{
+		URL:      ESAJURL,
+		provider: provider,
+		lock:     make(chan struct{}, 1),
+	}
+}
+
+// SetConfig replaces the current session by the cookies in the config, useful to reuse a session obtained
+// previously. The provider will be called only when this session expires.
+func (m *SessionManager) SetConfig(ctx context.Context, config Config) error {
+	if err := m.acquire(ctx); err != nil {
+		return err
+	}
+	defer m.release()
+
+	m.config = config
+	m.version++
+	return nil
+}
+
+// Current returns the current session and its version. If there is no session yet, a new one is created.
+func (m *SessionManager) Current(ctx context.Context) (Config, uint64, error) {
+	if err := m.acquire(ctx); err != nil {
+		return Config{}, 0, err
+	}
+	defer m.release()
+
+	if m.version == 0 {
+		m.loadStored()
+	}
+
+	if m.version == 0 {
+		if err := m.login(ctx); err != nil {
+			return Config{}, 0, err
+		}
+	}
+
+	return m.config, m.version, nil
+}
+
+// Refresh creates a new session if the session identified by version is still the current one.
+// When another goroutine already refreshed the session, the new session is returned without a new login.
+func (m *SessionManager) Refresh(ctx context.Context, version uint64) (Config, uint64, error) {
+	if err := m.acquire(ctx); err != nil {
+		return Config{}, 0, err
+	}
+	defer m.release()
+
+	if m.version == version {
+		if err := m.login(ctx); err != nil {
+			return Config{}, 0, err
+		}
+	}
+
+	return m.config, m.version, nil
+}
+
+// login must be called with the lock acquired.
+func (m *SessionManager) login(ctx context.Context) error {
+	var proxy string
+	if m.Proxies != nil {
+		var err error
+		proxy, err = m.Proxies.Pick()
+		if err != nil {
+			return fmt.Errorf("error picking a proxy to the new session: %w", err)
+		}
+		ctx = WithProxy(ctx, proxy)
+	}
+
+	slog.Info("creating a new esaj session", "version", m.version+1)
+	cookies, err := m.provider.NewSession(ctx)
+	if err != nil {
+		return fmt.Errorf("error creating a new session: %w", err)
+	}
+
+	jar, err := NewJar(m.URL)
+	if err != nil {
+		return err
+	}
+	jar.Proxy = proxy
+	jar.Add(cookies...)
+
+	m.config = jar.Config()
+	m.version++
+
+	if m.Store != nil {
+		if err := m.Store.Save(m.Account, jar); err != nil {
+			// the session is valid even if it can't be persisted.
+			slog.Warn("error saving esaj session", "error", err)
+		}
+	}
+	return nil
+}
+
+// loadStored loads the session of the account from the Store, must be called with the lock acquired.
+func (m *SessionManager) loadStored() {
+	if m.Store == nil {
+		return
+	}
+
+	jar, err := m.Store.Load(m.Account)
+	if errors.Is(err, ErrSessionNotFound) {
+		return
+	}
+	if err != nil {
+		slog.Warn("error loading esaj session, a new one will be created", "error", err)
+		return
+	}
+
+	slog.Info("reusing saved esaj session")
+	m.config = jar.Config()
+	m.version++
+}
+
+func (m *SessionManager) acquire(ctx context.Context) error {
+	select {
+	case m.lock <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *SessionManager) release() {
+	<-m.lock
+}
+
+// withSession runs fn with the cookies of the current session. When fn returns ErrSessionExpired, the
+// session is refreshed and fn is retried once. If the Client has an AccountPool, the session of one of its
+// accounts is used. If the Client has no SessionManager, the static Config is used.
+func (ec Client) withSession(ctx context.Context, fn func(config Config) error) error {
+	if ec.Accounts != nil {
+		return ec.withAccount(ctx, fn)
+	}
+
+	if ec.Session == nil {
+		return fn(ec.Config)
+	}
+
+	return withSessionManager(ctx, ec.Session, fn)
+}
+
+func withSessionManager(ctx context.Context, m *SessionManager, fn func(config Config) error) error {
+	config, version, err := m.Current(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(config)
+	if !errors.Is(err, ErrSessionExpired) {
+		return err
+	}
+
+	slog.Info("esaj session expired, refreshing it", "version", version)
+	metrics.SessionExpirations.Inc()
+	metrics.Retries.WithLabelValues("session_expired").Inc()
+	config, _, err = m.Refresh(ctx, version)
+	if err != nil {
+		return err
+	}
+
+	return fn(config)
+}
+
+// HeadlessProvider is a SessionProvider that uses a headless browser to log in the eSAJ website.
+// The browser uses the proxy of the context, set by WithProxy, when there is one. Chrome doesn't support the
+// proxies with credentials, see ChromeProxyServer.
+type HeadlessProvider struct {
+	Login Login
+	// Headless defines if the browser should be headless or not. For production, it must be true.
+	Headless bool
+	// ProcessID is a process that the account can access, it is used to reach the pasta digital cookies.
+	// Example: 1016358-63.2020.8.26.0053
+	ProcessID string
+}
+
+// NewSession logs in the eSAJ website using a headless browser and returns the session cookies.
+func (p HeadlessProvider) NewSession(ctx context.Context) ([]*http.Cookie, error) {
+	ctx = context.WithValue(ctx, ProcessIDContextKey, p.ProcessID)
+	cookies, err := getCookies(ctx, p.Login, p.Headless, p.ProcessID)
+	if err != nil {
+		return nil, err
+	}
+	return toHTTPCookies(cookies), nil
+}
+
+// CheckSession reports if the session of the Config is still accepted, asking the pasta digital URL of the
+// process. It returns ErrSessionExpired when the session is no longer valid. The session is never refreshed.
+// - processID example: 1016358-63.2020.8.26.0053
+func (ec Client) CheckSession(ctx context.Context, processID string) error {
+	processCode, err := ec.ProcessCodeByProcessID(ctx, processID)
+	if err != nil {
+		return fmt.Errorf("error getting process code: %w", err)
+	}
+
+	_, err = ec.fetchPastaDigitalURL(ctx, ec.Config, processCode)
+	return err
+}
@@ -0,0 +1,200 @@
+package esaj
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/perebaj/esaj/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider returns a new session each time that it is called, the value of the cookie is the call number.
+type fakeProvider struct {
+	calls atomic.Int32
+	delay time.Duration
+	err   error
+}
+
+func (p *fakeProvider) NewSession(_ context.Context) ([]*http.Cookie, error) {
+	n := p.calls.Add(1)
+	time.Sleep(p.delay)
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return []*http.Cookie{
+		{Name: "JSESSIONID", Value: fmt.Sprintf("session%d.cpopg1", n), Path: "/cpopg"},
+		{Name: "JSESSIONID", Value: fmt.Sprintf("session%d.pasta1", n), Path: "/pastadigital"},
+	}, nil
+}
+
+func Test_SessionManager_Current(t *testing.T) {
+	provider := &fakeProvider{}
+	m := NewSessionManager(provider)
+
+	config, version, err := m.Current(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), version)
+	assert.Equal(t, "JSESSIONID=session1.cpopg1;", config.CookieSession)
+	assert.Equal(t, "JSESSIONID=session1.pasta1;", config.CookiePDFSession)
+
+	// the session is reused while it is not refreshed
+	_, version, err = m.Current(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), version)
+	assert.Equal(t, int32(1), provider.calls.Load())
+}
+
+func Test_SessionManager_SetConfig(t *testing.T) {
+	provider := &fakeProvider{}
+	m := NewSessionManager(provider)
+
+	require.NoError(t, m.SetConfig(context.Background(), Config{CookieSession: "saved"}))
+
+	config, _, err := m.Current(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "saved", config.CookieSession)
+	assert.Equal(t, int32(0), provider.calls.Load())
+}
+
+func Test_SessionManager_Refresh_concurrent(t *testing.T) {
+	provider := &fakeProvider{delay: 10 * time.Millisecond}
+	m := NewSessionManager(provider)
+
+	_, version, err := m.Current(context.Background())
+	require.NoError(t, err)
+
+	// all goroutines saw the same expired session, only one login must happen.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			config, newVersion, err := m.Refresh(context.Background(), version)
+			assert.NoError(t, err)
+			assert.Equal(t, version+1, newVersion)
+			assert.Equal(t, "JSESSIONID=session2.cpopg1;", config.CookieSession)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), provider.calls.Load())
+}
+
+func Test_SessionManager_contextCanceled(t *testing.T) {
+	provider := &fakeProvider{delay: 100 * time.Millisecond}
+	m := NewSessionManager(provider)
+
+	go func() {
+		_, _, _ = m.Current(context.Background())
+	}()
+	// wait the first goroutine to acquire the lock
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, _, err := m.Current(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func Test_SessionManager_providerError(t *testing.T) {
+	m := NewSessionManager(&fakeProvider{err: errors.New("invalid credentials")})
+
+	_, _, err := m.Current(context.Background())
+	require.ErrorContains(t, err, "invalid credentials")
+}
+
+func Test_Client_GetPDF_refreshSession(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// only the second session is valid
+		if !strings.Contains(r.Header.Get("Cookie"), "session2") {
+			_, _ = w.Write([]byte("Sua sessão expirou"))
+			return
+		}
+		_, _ = w.Write([]byte("%PDF"))
+	}))
+	defer server.Close()
+
+	provider := &fakeProvider{}
+	c := New(Config{}, &http.Client{Timeout: 2 * time.Second})
+	c.URL = server.URL
+	c.Session = NewSessionManager(provider)
+	c.Session.URL = server.URL
+
+	// GetPDF saves the file in the tmp folder relative to the working directory.
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	defer func() {
+		_ = os.Chdir(wd)
+	}()
+	require.NoError(t, os.Mkdir("tmp", 0755))
+
+	expirations := testutil.ToFloat64(metrics.SessionExpirations)
+	downloaded := testutil.ToFloat64(metrics.DocumentsDownloaded)
+
+	err = c.GetPDF(context.Background(), "1029989-06.2022.8.26.0053", ChildrenData{Title: "doc"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), provider.calls.Load())
+	assert.Equal(t, expirations+1, testutil.ToFloat64(metrics.SessionExpirations))
+	assert.Equal(t, downloaded+1, testutil.ToFloat64(metrics.DocumentsDownloaded))
+}
+
+func Test_Client_pastaDigitalURL_expiredAfterRefresh(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("<body>Não foi possível validar o seu acesso</body>"))
+	}))
+	defer server.Close()
+
+	provider := &fakeProvider{}
+	c := New(Config{}, &http.Client{Timeout: 2 * time.Second})
+	c.URL = server.URL
+	c.Session = NewSessionManager(provider)
+	c.Session.URL = server.URL
+
+	_, err := c.pastaDigitalURL(context.Background(), "PROCESSCODE")
+	require.ErrorIs(t, err, ErrSessionExpired)
+	// the request is retried only once
+	assert.Equal(t, int32(2), provider.calls.Load())
+}
+
+func Test_Client_CheckSession(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cpopg/search.do":
+			_, _ = w.Write([]byte(`<table><tr><td><a class="linkMovVincProc" href="abrirDocumentoVinculadoMovimentacao.do?processo.codigo=CODE">doc</a></td></tr></table>`))
+		case "/cpopg/abrirPastaDigital.do":
+			if !strings.Contains(r.Header.Get("Cookie"), "valid") {
+				_, _ = w.Write([]byte("<body>Não foi possível validar o seu acesso</body>"))
+				return
+			}
+			_, _ = w.Write([]byte(`<body>https://esaj.tjsp.jus.br/pastadigital/abrirPastaProcessoDigital.do</body>`))
+		}
+	}))
+	defer server.Close()
+
+	c := New(Config{CookieSession: "JSESSIONID=valid"}, &http.Client{Timeout: 2 * time.Second})
+	c.URL = server.URL
+	require.NoError(t, c.CheckSession(context.Background(), "1029989-06.2022.8.26.0053"))
+
+	c.Config.CookieSession = "JSESSIONID=expired"
+	err := c.CheckSession(context.Background(), "1029989-06.2022.8.26.0053")
+	require.ErrorIs(t, err, ErrSessionExpired)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = c.CheckSession(ctx, "1029989-06.2022.8.26.0053")
+	require.ErrorIs(t, err, context.Canceled)
+}
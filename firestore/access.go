@@ -0,0 +1,121 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/perebaj/esaj/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// accessEventDoc is an access event in the access_events collection, whose document ID is the event ID. The
+// documents are only created, never updated or deleted.
+type accessEventDoc struct {
+	ID             string    `firestore:"id"`
+	UserID         string    `firestore:"user_id"`
+	OrganizationID string    `firestore:"organization_id"`
+	TraceID        string    `firestore:"trace_id"`
+	Action         string    `firestore:"action"`
+	Resource       string    `firestore:"resource"`
+	CreatedAt      time.Time `firestore:"created_at"`
+	SchemaVersion  int       `firestore:"schema_version"`
+}
+
+// SaveAccessEvents creates the access events in the firestore database. The events that already exist are
+// kept as they are.
+func (s *Storage) SaveAccessEvents(ctx context.Context, events []storage.AccessEvent) error {
+	collection := s.client.Collection("access_events")
+	bulkWriter := s.client.BulkWriter(ctx)
+	jobs := make(map[string]*firestore.BulkWriterJob, len(events))
+	for _, e := range events {
+		job, err := bulkWriter.Create(collection.Doc(e.ID), accessEventDoc{
+			ID:             e.ID,
+			UserID:         e.UserID,
+			OrganizationID: e.OrganizationID,
+			TraceID:        e.TraceID,
+			Action:         e.Action,
+			Resource:       e.Resource,
+			CreatedAt:      e.CreatedAt,
+			SchemaVersion:  accessEventSchemaVersion,
+		})
+		if err != nil {
+			bulkWriter.End()
+			return fmt.Errorf("error saving access event %s: %w", e.ID, err)
+		}
+		jobs[e.ID] = job
+	}
+
+	bulkWriter.End()
+
+	failures := make(map[string]error)
+	for id, job := range jobs {
+		if _, err := job.Results(); err != nil && status.Code(err) != codes.AlreadyExists {
+			failures[id] = err
+		}
+	}
+	if len(failures) > 0 {
+		return &storage.BatchError{Failures: failures}
+	}
+	return nil
+}
+
+// QueryAccessEvents returns a page of the access events that match the query. The queries with filters need
+// composite indexes of the filtered fields with created_at.
+func (s *Storage) QueryAccessEvents(ctx context.Context, q storage.AccessQuery) (storage.AccessPage, error) {
+	after, err := q.Normalize()
+	if err != nil {
+		return storage.AccessPage{}, err
+	}
+
+	query := s.client.Collection("access_events").Query
+	for _, filter := range []struct{ field, value string }{
+		{"organization_id", q.OrganizationID},
+		{"user_id", q.UserID},
+		{"resource", q.Resource},
+	} {
+		if filter.value != "" {
+			query = query.Where(filter.field, "==", filter.value)
+		}
+	}
+	if !q.Since.IsZero() {
+		query = query.Where("created_at", ">=", q.Since)
+	}
+	if !q.Until.IsZero() {
+		query = query.Where("created_at", "<", q.Until)
+	}
+	query = query.OrderBy("created_at", firestore.Asc).OrderBy(firestore.DocumentID, firestore.Asc)
+	if after != nil {
+		query = query.StartAfter(after.CreatedAt, after.ID)
+	}
+
+	docs, err := query.Limit(q.PageSize + 1).Documents(ctx).GetAll()
+	if err != nil {
+		return storage.AccessPage{}, fmt.Errorf("error querying access events: %w", err)
+	}
+
+	var page storage.AccessPage
+	for _, d := range docs {
+		var doc accessEventDoc
+		if err := d.DataTo(&doc); err != nil {
+			return storage.AccessPage{}, fmt.Errorf("error parsing access event %s: %w", d.Ref.ID, err)
+		}
+		page.Events = append(page.Events, storage.AccessEvent{
+			ID:             doc.ID,
+			UserID:         doc.UserID,
+			OrganizationID: doc.OrganizationID,
+			TraceID:        doc.TraceID,
+			Action:         doc.Action,
+			Resource:       doc.Resource,
+			CreatedAt:      doc.CreatedAt,
+		})
+	}
+
+	if len(page.Events) > q.PageSize {
+		page.Events = page.Events[:q.PageSize]
+		page.NextCursor = q.CursorOf(page.Events[q.PageSize-1]).String()
+	}
+	return page, nil
+}
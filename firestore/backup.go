@@ -0,0 +1,399 @@
+package firestore
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/storage"
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+// BackupCollections are the collections that can be exported and imported, with their subcollections.
+var BackupCollections = []string{"process_seeds", "process_basic_info", "users", "organizations"}
+
+// importBatchSize is the number of lines imported between the checkpoints of Import.
+const importBatchSize = 500
+
+// Record is a line of an export: a document, with its path and the times kept by Firestore. The top-level
+// document of a collection comes before the documents of its subcollections.
+type Record struct {
+	// Path is the path of the document from the root of the database. Example: process_basic_info/123/history/1
+	Path string `json:"path"`
+	// CreateTime and UpdateTime are only informative, since Firestore sets them when the document is imported.
+	CreateTime time.Time `json:"create_time"`
+	UpdateTime time.Time `json:"update_time"`
+	// Data is the document, with the values that JSON doesn't represent wrapped in an object of a single key:
+	// {"$int": "1"}, {"$time": "2024-08-01T10:00:00Z"}, {"$bytes": "base64"}, {"$geo": [lat, lng]},
+	// {"$ref": "path"} or {"$double": "NaN"}. The other numbers are doubles.
+	Data map[string]any `json:"data"`
+}
+
+// topLevel reports whether the record is a document of a collection, not of a subcollection.
+func (r Record) topLevel() bool {
+	return strings.Count(r.Path, "/") == 1
+}
+
+// ExportOptions filter the documents of an export.
+type ExportOptions struct {
+	// Collection is one of BackupCollections.
+	Collection string
+	// OAB exports only the seeds, the processes or the organizations of the OAB when not zero. The users are
+	// not tied to an OAB.
+	OAB esaj.OAB
+	// After resumes an export after the document with this ID, since the documents are exported in the order
+	// of their IDs.
+	After string
+}
+
+// ImportOptions filter the documents of an import.
+type ImportOptions struct {
+	// OAB imports only the seeds, the processes or the organizations of the OAB, with their subcollections, when
+	// not zero.
+	OAB esaj.OAB
+	// Skip is the number of lines already imported, from a previous checkpoint.
+	Skip int
+	// Checkpoint is called with the number of lines imported after each batch is saved, when not nil.
+	Checkpoint func(lines int) error
+}
+
+// Export writes the documents of the collection, with their subcollections, as NDJSON Records ordered by ID.
+// It returns the number of written records.
+func (s *Storage) Export(ctx context.Context, w io.Writer, opts ExportOptions) (int, error) {
+	query, err := s.backupQuery(opts.Collection, opts.OAB)
+	if err != nil {
+		return 0, err
+	}
+	query = query.OrderBy(firestore.DocumentID, firestore.Asc)
+	if opts.After != "" {
+		query = query.StartAfter(opts.After)
+	}
+
+	enc := json.NewEncoder(w)
+	written := 0
+	var export func(d *firestore.DocumentSnapshot) error
+	export = func(d *firestore.DocumentSnapshot) error {
+		data, err := encodeValue(d.Data())
+		if err != nil {
+			return fmt.Errorf("error encoding document %s: %w", d.Ref.Path, err)
+		}
+		err = enc.Encode(Record{
+			Path:       relativePath(d.Ref),
+			CreateTime: d.CreateTime,
+			UpdateTime: d.UpdateTime,
+			Data:       data.(map[string]any),
+		})
+		if err != nil {
+			return fmt.Errorf("error writing document %s: %w", d.Ref.Path, err)
+		}
+		written++
+
+		collections, err := d.Ref.Collections(ctx).GetAll()
+		if err != nil {
+			return fmt.Errorf("error getting subcollections of %s: %w", d.Ref.Path, err)
+		}
+		for _, c := range collections {
+			if err := eachDocument(ctx, c.OrderBy(firestore.DocumentID, firestore.Asc), export); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return written, eachDocument(ctx, query, export)
+}
+
+// ResumeExport returns the ID after which an interrupted export continues, and the size of the export up to
+// the records of the previous document. The last top-level document may miss some of its subcollections, so
+// it's exported again: the export must be truncated to the returned size.
+func ResumeExport(r io.Reader) (string, int64, error) {
+	var (
+		reader      = bufio.NewReader(r)
+		offset      int64
+		prevID      string
+		lastID      string
+		lastTopSize int64
+	)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// a line without its newline was interrupted, and is dropped with the last document
+			return prevID, lastTopSize, nil
+		}
+		if err != nil {
+			return "", 0, fmt.Errorf("error reading export: %w", err)
+		}
+
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return "", 0, fmt.Errorf("error parsing export at byte %d: %w", offset, err)
+		}
+		if rec.topLevel() {
+			prevID, lastID = lastID, rec.Path[strings.Index(rec.Path, "/")+1:]
+			lastTopSize = offset
+		}
+		offset += int64(len(line))
+	}
+}
+
+// Import saves the NDJSON Records of an export, replacing the documents with the same paths. The lines are saved
+// in batches, and the Checkpoint is called after each of them, so an interrupted import continues by skipping
+// the lines of the last checkpoint. It returns the number of read lines, including the skipped ones and the ones
+// filtered out.
+func (s *Storage) Import(ctx context.Context, r io.Reader, opts ImportOptions) (int, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var (
+		lines   int
+		include bool
+		pending = make(map[string]*firestore.BulkWriterJob)
+		bulk    = s.client.BulkWriter(ctx)
+	)
+	flush := func() error {
+		bulk.Flush()
+		failures := make(map[string]error)
+		for path, job := range pending {
+			if _, err := job.Results(); err != nil {
+				failures[path] = err
+			}
+		}
+		clear(pending)
+		if len(failures) > 0 {
+			return &storage.BatchError{Failures: failures}
+		}
+		if opts.Checkpoint != nil {
+			return opts.Checkpoint(lines)
+		}
+		return nil
+	}
+	defer bulk.End()
+
+	for {
+		var rec Record
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return lines, fmt.Errorf("error parsing line %d: %w", lines+1, err)
+		}
+		lines++
+
+		// the subcollections follow their top-level document, and are filtered with it
+		if rec.topLevel() {
+			include, err = s.backupIncludes(rec, opts.OAB)
+			if err != nil {
+				return lines, fmt.Errorf("error filtering line %d: %w", lines, err)
+			}
+		}
+		if lines <= opts.Skip || !include {
+			continue
+		}
+
+		data, err := s.decodeValue(rec.Data)
+		if err != nil {
+			return lines, fmt.Errorf("error decoding line %d: %w", lines, err)
+		}
+		job, err := bulk.Set(s.client.Doc(rec.Path), data)
+		if err != nil {
+			return lines, fmt.Errorf("error importing %s: %w", rec.Path, err)
+		}
+		pending[rec.Path] = job
+
+		if len(pending) >= importBatchSize {
+			if err := flush(); err != nil {
+				return lines, err
+			}
+		}
+	}
+	return lines, flush()
+}
+
+// backupQuery returns the query of the documents of a collection exported with the OAB filter.
+func (s *Storage) backupQuery(collection string, oab esaj.OAB) (firestore.Query, error) {
+	query := s.client.Collection(collection).Query
+	switch {
+	case !isBackupCollection(collection):
+		return firestore.Query{}, fmt.Errorf("collection %q can't be exported, use one of %s", collection,
+			strings.Join(BackupCollections, ", "))
+	case oab.IsZero():
+		return query, nil
+	case collection == "process_seeds":
+		return query.Where("oab", "in", oabValues(oab)), nil
+	case collection == "process_basic_info", collection == "organizations":
+		return query.Where("oabs", "array-contains-any", oabValues(oab)), nil
+	}
+	return firestore.Query{}, fmt.Errorf("collection %q is not filtered by OAB", collection)
+}
+
+// backupIncludes reports whether the top-level document of an import matches the OAB filter.
+func (s *Storage) backupIncludes(rec Record, oab esaj.OAB) (bool, error) {
+	collection := rec.Path[:strings.Index(rec.Path, "/")]
+	if !isBackupCollection(collection) {
+		return false, fmt.Errorf("collection %q can't be imported, use one of %s", collection,
+			strings.Join(BackupCollections, ", "))
+	}
+	switch {
+	case oab.IsZero():
+		return true, nil
+	case collection == "process_seeds":
+		v, _ := rec.Data["oab"].(string)
+		return slices.Contains(oabValues(oab), v), nil
+	case collection == "process_basic_info", collection == "organizations":
+		oabs, _ := rec.Data["oabs"].([]any)
+		for _, o := range oabs {
+			if v, _ := o.(string); slices.Contains(oabValues(oab), v) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("collection %q is not filtered by OAB", collection)
+}
+
+func isBackupCollection(collection string) bool {
+	for _, c := range BackupCollections {
+		if c == collection {
+			return true
+		}
+	}
+	return false
+}
+
+// relativePath returns the path of the document from the root of the database.
+func relativePath(ref *firestore.DocumentRef) string {
+	_, path, _ := strings.Cut(ref.Path, "/documents/")
+	return path
+}
+
+// encodeValue returns the JSON representation of a Firestore value, described in Record.Data.
+func encodeValue(v any) (any, error) {
+	switch v := v.(type) {
+	case nil, bool, string:
+		return v, nil
+	case int64:
+		return map[string]any{"$int": strconv.FormatInt(v, 10)}, nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return map[string]any{"$double": strconv.FormatFloat(v, 'g', -1, 64)}, nil
+		}
+		return v, nil
+	case time.Time:
+		return map[string]any{"$time": v.UTC().Format(time.RFC3339Nano)}, nil
+	case []byte:
+		return map[string]any{"$bytes": base64.StdEncoding.EncodeToString(v)}, nil
+	case *latlng.LatLng:
+		return map[string]any{"$geo": []float64{v.GetLatitude(), v.GetLongitude()}}, nil
+	case *firestore.DocumentRef:
+		return map[string]any{"$ref": relativePath(v)}, nil
+	case []any:
+		list := make([]any, 0, len(v))
+		for _, e := range v {
+			encoded, err := encodeValue(e)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, encoded)
+		}
+		return list, nil
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			encoded, err := encodeValue(e)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			m[k] = encoded
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unsupported value of type %T", v)
+}
+
+// decodeValue returns the Firestore value of a JSON representation returned by encodeValue, decoded with
+// json.Decoder.UseNumber.
+func (s *Storage) decodeValue(v any) (any, error) {
+	switch v := v.(type) {
+	case nil, bool, string:
+		return v, nil
+	case json.Number:
+		return v.Float64()
+	case []any:
+		list := make([]any, 0, len(v))
+		for _, e := range v {
+			decoded, err := s.decodeValue(e)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, decoded)
+		}
+		return list, nil
+	case map[string]any:
+		if len(v) == 1 {
+			if decoded, ok, err := s.decodeTyped(v); ok || err != nil {
+				return decoded, err
+			}
+		}
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			decoded, err := s.decodeValue(e)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			m[k] = decoded
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unsupported value of type %T", v)
+}
+
+// decodeTyped decodes the values wrapped by encodeValue, returning false when the map is not one of them.
+func (s *Storage) decodeTyped(v map[string]any) (any, bool, error) {
+	for tag, raw := range v {
+		str, isString := raw.(string)
+		switch {
+		case tag == "$int" && isString:
+			n, err := strconv.ParseInt(str, 10, 64)
+			return n, true, err
+		case tag == "$double" && isString:
+			f, err := strconv.ParseFloat(str, 64)
+			return f, true, err
+		case tag == "$time" && isString:
+			t, err := time.Parse(time.RFC3339Nano, str)
+			return t, true, err
+		case tag == "$bytes" && isString:
+			b, err := base64.StdEncoding.DecodeString(str)
+			return b, true, err
+		case tag == "$ref" && isString:
+			return s.client.Doc(str), true, nil
+		case tag == "$geo":
+			coords, _ := raw.([]any)
+			if len(coords) != 2 {
+				return nil, true, fmt.Errorf("invalid $geo %v", raw)
+			}
+			lat, latOK := coords[0].(json.Number)
+			lng, lngOK := coords[1].(json.Number)
+			if !latOK || !lngOK {
+				return nil, true, fmt.Errorf("invalid $geo %v", raw)
+			}
+			latitude, err := lat.Float64()
+			if err != nil {
+				return nil, true, err
+			}
+			longitude, err := lng.Float64()
+			return &latlng.LatLng{Latitude: latitude, Longitude: longitude}, true, err
+		}
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,92 @@
+//go:build integration
+
+package firestore_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	fs "cloud.google.com/go/firestore"
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/firestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_ExportImport(t *testing.T) {
+	ctx := context.TODO()
+	c, err := fs.NewClient(ctx, projectID)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cleanup(t, c)
+	})
+	cleanup(t, c)
+	s := firestore.NewStorage(c, projectID)
+
+	oab, other := esaj.MustParseOAB("123"), esaj.MustParseOAB("456")
+	for _, p := range []esaj.ProcessBasicInfo{
+		{ProcessID: "1", OAB: oab, Judge: "Fulano"},
+		{ProcessID: "2", OAB: other, Judge: "Beltrano"},
+	} {
+		require.NoError(t, s.SaveProcessBasicInfo(ctx, p))
+	}
+	_, err = s.SaveMovements(ctx, "1", []esaj.Movement{{Date: time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC), Title: "Conclusos"}})
+	require.NoError(t, err)
+
+	var export bytes.Buffer
+	written, err := s.Export(ctx, &export, firestore.ExportOptions{Collection: "process_basic_info"})
+	require.NoError(t, err)
+	// the processes, their snapshots and the movement
+	assert.Equal(t, 5, written)
+	assert.True(t, strings.HasPrefix(export.String(), `{"path":"process_basic_info/1",`))
+
+	var filtered bytes.Buffer
+	written, err = s.Export(ctx, &filtered, firestore.ExportOptions{Collection: "process_basic_info", OAB: other})
+	require.NoError(t, err)
+	assert.Equal(t, 2, written)
+
+	_, err = s.Export(ctx, &filtered, firestore.ExportOptions{Collection: "users", OAB: oab})
+	require.Error(t, err)
+	_, err = s.Export(ctx, &filtered, firestore.ExportOptions{Collection: "documents"})
+	require.Error(t, err)
+
+	// an interrupted export continues from the last process
+	after, size, err := firestore.ResumeExport(bytes.NewReader(export.Bytes()[:export.Len()-10]))
+	require.NoError(t, err)
+	assert.Equal(t, "1", after)
+	assert.Equal(t, int64(strings.Index(export.String(), `{"path":"process_basic_info/2",`)), size)
+
+	// importing the export restores the documents, with their timestamps
+	cleanup(t, c)
+	var checkpoints []int
+	lines, err := s.Import(ctx, bytes.NewReader(export.Bytes()), firestore.ImportOptions{
+		OAB: oab,
+		Checkpoint: func(lines int) error {
+			checkpoints = append(checkpoints, lines)
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 5, lines)
+	assert.Equal(t, []int{5}, checkpoints)
+
+	processes, err := s.ProcessBasicInfoByOAB(ctx, oab)
+	require.NoError(t, err)
+	require.Len(t, processes, 1)
+	assert.Equal(t, "Fulano", processes[0].Judge)
+	processes, err = s.ProcessBasicInfoByOAB(ctx, other)
+	require.NoError(t, err)
+	assert.Empty(t, processes)
+
+	movements, err := s.MovementsByOAB(ctx, oab, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, movements, 1)
+	assert.True(t, movements[0].Date.Equal(time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)))
+
+	history, err := s.ProcessHistory(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+}
@@ -5,15 +5,19 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/storage"
 	"github.com/perebaj/esaj/tracing"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+var _ storage.Storage = (*Storage)(nil)
+
 // Storage is a struct that holds the firestore client and the projectID and database name
 type Storage struct {
 	client    *firestore.Client
@@ -28,107 +32,197 @@ func NewStorage(client *firestore.Client, projectID string) *Storage {
 	}
 }
 
-// SaveProcessSeeds saves the process seeds in the firestore database
+// SaveProcessSeeds saves the process seeds in the firestore database, a document of each process and OAB
 func (s *Storage) SaveProcessSeeds(ctx context.Context, ps []esaj.ProcessSeed) error {
 	traceID := tracing.GetTraceIDFromContext(ctx)
 	collection := s.client.Collection("process_seeds")
 	bulkWriter := s.client.BulkWriter(ctx)
+	jobs := make(map[string]*firestore.BulkWriterJob, len(ps))
+	now := time.Now()
 	for _, seed := range ps {
-		docRef := collection.Doc(seed.ProcessID)
-		m := make(map[string]interface{})
-		m["process_id"] = seed.ProcessID
-		m["oab"] = seed.OAB
-		m["url"] = seed.URL
-		m["trace_id"] = traceID
-		_, err := bulkWriter.Set(docRef, m)
+		id := storage.SeedID(seed.ProcessID, seed.OAB)
+		docRef := collection.Doc(id)
+		doc := seedDoc{
+			ProcessID:     seed.ProcessID,
+			OAB:           seed.OAB.String(),
+			URL:           seed.URL,
+			TraceID:       traceID,
+			Status:        storage.SeedPending,
+			UpdatedAt:     now,
+			SchemaVersion: seedSchemaVersion,
+		}
+		job, err := bulkWriter.Set(docRef, doc)
 		if err != nil {
-			return err
+			bulkWriter.End()
+			return fmt.Errorf("error saving seed %s: %w", id, err)
 		}
+		jobs[id] = job
 	}
 
-	bulkWriter.Flush()
-	return nil
-}
+	bulkWriter.End()
 
-// ProcessSeed is the struct that represents the process seed in the firestore database
-type ProcessSeed struct {
-	ID        string
-	ProcessID string
-	OAB       string
-	URL       string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	// each document is written on its own, so some of them can fail while the others are saved.
+	failures := make(map[string]error)
+	for id, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			failures[id] = err
+		}
+	}
+	if len(failures) > 0 {
+		return &storage.BatchError{Failures: failures}
+	}
+	return nil
 }
 
 // GetSeedsByOAB returns all the process seeds given an OAB identifier
-func (s *Storage) GetSeedsByOAB(ctx context.Context, oab string) ([]ProcessSeed, error) {
+func (s *Storage) GetSeedsByOAB(ctx context.Context, oab esaj.OAB) ([]storage.ProcessSeed, error) {
 	collection := s.client.Collection("process_seeds")
-	iter := collection.Where("oab", "==", oab).Documents(ctx)
+	iter := collection.Where("oab", "in", oabValues(oab)).Documents(ctx)
 
 	doc, err := iter.GetAll()
 	if err != nil {
 		return nil, err
 	}
 
-	var seeds []ProcessSeed
+	var seeds []storage.ProcessSeed
 	for _, d := range doc {
-		seed := ProcessSeed{
-			ID:        d.Ref.ID,
-			ProcessID: d.Data()["process_id"].(string),
-			OAB:       d.Data()["oab"].(string),
-			URL:       d.Data()["url"].(string),
-			CreatedAt: d.CreateTime,
-			UpdatedAt: d.UpdateTime,
+		seed, err := seedFromDoc(d)
+		if err != nil {
+			skipSeed(ctx, d, err)
+			continue
 		}
-
 		seeds = append(seeds, seed)
 	}
 
 	return seeds, nil
 }
 
-// SaveProcessBasicInfo saves the process basic information in the firestore database
+// skipSeed logs a process_seeds document that can't be read, like a legacy seed with an OAB that doesn't parse.
+// It's skipped by the reads, so it doesn't fail the other seeds of the OAB.
+func skipSeed(ctx context.Context, d *firestore.DocumentSnapshot, err error) {
+	slog.Warn("skipping invalid seed", "traceID", tracing.GetTraceIDFromContext(ctx), "seed", d.Ref.ID, "error", err)
+}
+
+// seedFromDoc returns the seed of a process_seeds document.
+func seedFromDoc(d *firestore.DocumentSnapshot) (storage.ProcessSeed, error) {
+	var seed seedDoc
+	if err := d.DataTo(&seed); err != nil {
+		return storage.ProcessSeed{}, fmt.Errorf("error parsing seed %s: %w", d.Ref.ID, err)
+	}
+
+	seedOAB, err := esaj.ParseOAB(seed.OAB)
+	if err != nil {
+		return storage.ProcessSeed{}, fmt.Errorf("error parsing oab of seed %s: %w", d.Ref.ID, err)
+	}
+
+	// the seeds saved before the status was added, and not migrated yet, are pending
+	if seed.Status == "" {
+		seed.Status = storage.SeedPending
+	}
+	if seed.UpdatedAt.IsZero() {
+		seed.UpdatedAt = d.UpdateTime
+	}
+
+	return storage.ProcessSeed{
+		ID:        d.Ref.ID,
+		ProcessID: seed.ProcessID,
+		OAB:       seedOAB,
+		URL:       seed.URL,
+		Status:    seed.Status,
+		CreatedAt: d.CreateTime,
+		UpdatedAt: seed.UpdatedAt,
+		RemovedAt: seed.RemovedAt,
+	}, nil
+}
+
+// SaveProcessBasicInfo saves the process basic information in the firestore database. The process, its OABs,
+// its snapshot, its search document and the status of its seed are written in a transaction, so two seeds of the same process
+// ingested at the same time don't lose each other's OAB. A new OAB of the process is copied to its movements after it.
 func (s *Storage) SaveProcessBasicInfo(ctx context.Context, pBasicInfo esaj.ProcessBasicInfo) error {
 	traceID := tracing.GetTraceIDFromContext(ctx)
 	logger := slog.With("traceID", traceID)
 	logger.Info("saving process basic info", "process_id", pBasicInfo.ProcessID)
 
-	collection := s.client.Collection("process_basic_info")
-	docRef := collection.Doc(pBasicInfo.ProcessID)
+	docRef := s.client.Collection("process_basic_info").Doc(pBasicInfo.ProcessID)
+	seedRef := s.client.Collection("process_seeds").Doc(storage.SeedID(pBasicInfo.ProcessID, pBasicInfo.OAB))
+
+	var addedOAB bool
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		// all reads of a transaction must happen before its writes.
+		doc, err := tx.Get(docRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return fmt.Errorf("error getting document: %w", err)
+		}
+		seed, err := tx.Get(seedRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return fmt.Errorf("error getting seed: %w", err)
+		}
+		names, err := s.anonymizedNames(ctx, tx, pBasicInfo.Claimant, pBasicInfo.Defendant)
+		if err != nil {
+			return err
+		}
+		pBasicInfo, _ := storage.AnonymizeProcess(pBasicInfo, names)
+
+		var prev *esaj.ProcessBasicInfo
+		oabs := []string{}
+		if doc.Exists() {
+			var existing processInfoDoc
+			if err := doc.DataTo(&existing); err != nil {
+				return fmt.Errorf("error parsing document: %w", err)
+			}
+			p := existing.process()
+			prev = &p
+
+			// the document is saved with the current schema version, so the migrate command won't normalize
+			// the OABs saved by the previous versions
+			oabs = existing.canonicalOABs()
+		}
+		addedOAB = !slices.Contains(oabs, pBasicInfo.OAB.String())
+		if addedOAB {
+			oabs = append(oabs, pBasicInfo.OAB.String())
+		}
 
-	doc, err := docRef.Get(ctx)
-	if err != nil && status.Code(err) != codes.NotFound {
-		return fmt.Errorf("error getting document: %w", err)
+		now := time.Now()
+		if err := tx.Set(docRef, newProcessInfoDoc(pBasicInfo, oabs, traceID, now)); err != nil {
+			return fmt.Errorf("error saving document: %w", err)
+		}
+
+		searchRef := s.client.Collection("search_index").Doc(pBasicInfo.ProcessID)
+		if err := tx.Set(searchRef, searchDocOf(pBasicInfo, oabs)); err != nil {
+			return fmt.Errorf("error saving search document: %w", err)
+		}
+
+		if snapshot, ok := storage.NewProcessSnapshot(prev, pBasicInfo, now, traceID); ok {
+			historyRef := docRef.Collection("history").Doc(snapshot.ID)
+			if err := tx.Set(historyRef, newSnapshotDoc(snapshot)); err != nil {
+				return fmt.Errorf("error saving snapshot: %w", err)
+			}
+		}
+
+		if seed.Exists() {
+			err := tx.Update(seedRef, []firestore.Update{
+				{Path: "status", Value: storage.SeedIngested},
+				{Path: "ingested_at", Value: now},
+			})
+			if err != nil {
+				return fmt.Errorf("error updating seed: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error saving process %s: %w", pBasicInfo.ProcessID, err)
 	}
-	m := make(map[string]interface{})
-	m["process_id"] = pBasicInfo.ProcessID
-	m["foro_code"] = pBasicInfo.ProcessForo
-	m["foro_name"] = pBasicInfo.ForoName
-	m["process_code"] = pBasicInfo.ProcessCode
-	m["judge"] = pBasicInfo.Judge
-	m["class"] = pBasicInfo.Class
-	m["claimant"] = pBasicInfo.Claimant
-	m["defendant"] = pBasicInfo.Defendant
-	m["vara"] = pBasicInfo.Vara
-	m["trace_id"] = traceID
-	m["url"] = pBasicInfo.URL
-
-	if status.Code(err) == codes.NotFound {
-		m["oabs"] = firestore.ArrayUnion(pBasicInfo.OAB)
-	} else {
-		existingOABs := doc.Data()["oabs"].([]interface{})
-		existingOABs = append(existingOABs, pBasicInfo.OAB)
-		m["oabs"] = firestore.ArrayUnion(existingOABs...)
+	if addedOAB {
+		return s.addMovementsOAB(ctx, pBasicInfo.ProcessID, pBasicInfo.OAB)
 	}
-	_, err = docRef.Set(ctx, m)
-
-	return err
+	return nil
 }
 
 // ProcessBasicInfoByOAB returns all process that has the same OAB identifier
-func (s *Storage) ProcessBasicInfoByOAB(ctx context.Context, oab string) ([]esaj.ProcessBasicInfo, error) {
+func (s *Storage) ProcessBasicInfoByOAB(ctx context.Context, oab esaj.OAB) ([]esaj.ProcessBasicInfo, error) {
 	collection := s.client.Collection("process_basic_info")
-	iter := collection.Where("oabs", "array-contains", oab).Documents(ctx)
+	iter := collection.Where("oabs", "array-contains-any", oabValues(oab)).Documents(ctx)
 
 	doc, err := iter.GetAll()
 	if err != nil {
@@ -137,20 +231,14 @@ func (s *Storage) ProcessBasicInfoByOAB(ctx context.Context, oab string) ([]esaj
 
 	var processBasicInfo []esaj.ProcessBasicInfo
 	for _, d := range doc {
-		p := esaj.ProcessBasicInfo{
-			ProcessID:   d.Data()["process_id"].(string),
-			ProcessForo: d.Data()["foro_code"].(string),
-			ForoName:    d.Data()["foro_name"].(string),
-			ProcessCode: d.Data()["process_code"].(string),
-			Judge:       d.Data()["judge"].(string),
-			Class:       d.Data()["class"].(string),
-			Claimant:    d.Data()["claimant"].(string),
-			Defendant:   d.Data()["defendant"].(string),
-			Vara:        d.Data()["vara"].(string),
-			URL:         d.Data()["url"].(string),
+		var p processInfoDoc
+		if err := d.DataTo(&p); err != nil {
+			return nil, fmt.Errorf("error parsing process %s: %w", d.Ref.ID, err)
 		}
 
-		processBasicInfo = append(processBasicInfo, p)
+		info := p.process()
+		info.OAB = oab
+		processBasicInfo = append(processBasicInfo, info)
 	}
 
 	return processBasicInfo, nil
@@ -13,6 +13,7 @@ import (
 	fs "cloud.google.com/go/firestore"
 	"github.com/perebaj/esaj/esaj"
 	"github.com/perebaj/esaj/firestore"
+	esajstorage "github.com/perebaj/esaj/storage"
 	"github.com/perebaj/esaj/tracing"
 	"github.com/stretchr/testify/require"
 )
@@ -34,17 +35,17 @@ func TestStorage_SaveProcessSeeds(t *testing.T) {
 	ps := []esaj.ProcessSeed{
 		{
 			ProcessID: "123",
-			OAB:       "123",
+			OAB:       esaj.MustParseOAB("123"),
 			URL:       "http://example.com",
 		},
 		{
 			ProcessID: "456",
-			OAB:       "456",
+			OAB:       esaj.MustParseOAB("456"),
 			URL:       "http://example.com",
 		},
 		{
 			ProcessID: "789",
-			OAB:       "789",
+			OAB:       esaj.MustParseOAB("789"),
 			URL:       "http://example.com",
 		},
 	}
@@ -72,9 +73,11 @@ func TestStorage_SaveProcessSeeds(t *testing.T) {
 		doc.DataTo(&got)
 
 		require.Equal(t, ps[i].ProcessID, got["process_id"])
-		require.Equal(t, ps[i].OAB, got["oab"])
+		require.Equal(t, ps[i].OAB.String(), got["oab"])
 		require.Equal(t, ps[i].URL, got["url"])
 		require.Equal(t, "test-trace-id", got["trace_id"])
+		require.Equal(t, int64(3), got["schema_version"])
+		require.Equal(t, esajstorage.SeedID(ps[i].ProcessID, ps[i].OAB), doc.Ref.ID)
 	}
 
 	// update a document that already exists
@@ -98,17 +101,17 @@ func TestStorage_GetSeedsByOAB(t *testing.T) {
 	ps := []esaj.ProcessSeed{
 		{
 			ProcessID: "123",
-			OAB:       "123",
+			OAB:       esaj.MustParseOAB("123"),
 			URL:       "http://teste.com",
 		},
 		{
 			ProcessID: "456",
-			OAB:       "456",
+			OAB:       esaj.MustParseOAB("456"),
 			URL:       "http://example.com",
 		},
 		{
 			ProcessID: "789",
-			OAB:       "123",
+			OAB:       esaj.MustParseOAB("123"),
 			URL:       "http://teste1.com",
 		},
 	}
@@ -124,7 +127,7 @@ func TestStorage_GetSeedsByOAB(t *testing.T) {
 
 	require.NoError(t, err)
 
-	got, err := storage.GetSeedsByOAB(ctx, "123")
+	got, err := storage.GetSeedsByOAB(ctx, esaj.MustParseOAB("123"))
 	require.NoError(t, err)
 
 	require.Len(t, got, 2)
@@ -167,7 +170,7 @@ func TestStorage_SaveProcessBasicInfo(t *testing.T) {
 		Defendant:   "Defendant Test",
 		Vara:        "Vara Test",
 		URL:         "http://example.com",
-		OAB:         "OAB123",
+		OAB:         esaj.MustParseOAB("123"),
 	}
 
 	// Test initial save
@@ -208,7 +211,7 @@ func TestStorage_SaveProcessBasicInfo(t *testing.T) {
 	require.Len(t, got["oabs"], 1)
 
 	// Test update with new OAB
-	pBasicInfo.OAB = "OAB456"
+	pBasicInfo.OAB = esaj.MustParseOAB("456")
 	err = storage.SaveProcessBasicInfo(ctx, pBasicInfo)
 	require.NoError(t, err)
 
@@ -220,7 +223,7 @@ func TestStorage_SaveProcessBasicInfo(t *testing.T) {
 	require.Len(t, got["oabs"], 2)
 
 	// Test update with existing OAB (should not add duplicate)
-	pBasicInfo.OAB = "OAB123"
+	pBasicInfo.OAB = esaj.MustParseOAB("123")
 	err = storage.SaveProcessBasicInfo(ctx, pBasicInfo)
 	require.NoError(t, err)
 
@@ -236,17 +239,17 @@ func TestStorage_ProcessBasicInfoByOAB(t *testing.T) {
 	ps := []esaj.ProcessSeed{
 		{
 			ProcessID: "123",
-			OAB:       "123",
+			OAB:       esaj.MustParseOAB("123"),
 			URL:       "http://teste.com",
 		},
 		{
 			ProcessID: "456",
-			OAB:       "456",
+			OAB:       esaj.MustParseOAB("456"),
 			URL:       "http://example.com",
 		},
 		{
 			ProcessID: "789",
-			OAB:       "123",
+			OAB:       esaj.MustParseOAB("123"),
 			URL:       "http://teste1.com",
 		},
 	}
@@ -273,7 +276,7 @@ func TestStorage_ProcessBasicInfoByOAB(t *testing.T) {
 		Defendant:   "123",
 		Vara:        "http://teste.com",
 		URL:         "http://example.com",
-		OAB:         "123",
+		OAB:         esaj.MustParseOAB("123"),
 	}
 
 	err = storage.SaveProcessBasicInfo(ctx, pBasicInfo)
@@ -290,13 +293,13 @@ func TestStorage_ProcessBasicInfoByOAB(t *testing.T) {
 		Defendant:   "123",
 		Vara:        "http://teste.com",
 		URL:         "http://example.com",
-		OAB:         "123",
+		OAB:         esaj.MustParseOAB("123"),
 	}
 
 	err = storage.SaveProcessBasicInfo(ctx, pBasicInfo2)
 	require.NoError(t, err)
 
-	got, err := storage.ProcessBasicInfoByOAB(ctx, "123")
+	got, err := storage.ProcessBasicInfoByOAB(ctx, esaj.MustParseOAB("123"))
 	require.NoError(t, err)
 
 	require.Len(t, got, 2)
@@ -334,14 +337,24 @@ func cleanup(t *testing.T, c *fs.Client) {
 		if err != nil {
 			break
 		}
-		iter := collection.Documents(ctx)
-		for {
-			doc, err := iter.Next()
-			if err != nil {
-				break
-			}
-			_, err = doc.Ref.Delete(ctx)
-			require.NoError(t, err)
+		deleteCollection(t, collection)
+	}
+}
+
+// deleteCollection deletes the documents of the collection and of their subcollections
+func deleteCollection(t *testing.T, collection *fs.CollectionRef) {
+	ctx := context.TODO()
+	refs, err := collection.DocumentRefs(ctx).GetAll()
+	require.NoError(t, err)
+
+	for _, ref := range refs {
+		subcollections, err := ref.Collections(ctx).GetAll()
+		require.NoError(t, err)
+		for _, sub := range subcollections {
+			deleteCollection(t, sub)
 		}
+
+		_, err = ref.Delete(ctx)
+		require.NoError(t, err)
 	}
 }
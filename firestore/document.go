@@ -0,0 +1,85 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/tracing"
+)
+
+// document is the struct that represents the document of a process in the firestore database
+type document struct {
+	ID        string `firestore:"id"`
+	ProcessID string `firestore:"process_id"`
+	Title     string `firestore:"title"`
+	Pages     int    `firestore:"pages"`
+	Path      string `firestore:"path"`
+	Size      int64  `firestore:"size"`
+	SHA256    string `firestore:"sha256"`
+	TraceID   string `firestore:"trace_id"`
+	// SchemaVersion is the version of the document in the documents collection.
+	SchemaVersion int `firestore:"schema_version"`
+}
+
+// SaveDocument saves the document of a process in the firestore database
+func (s *Storage) SaveDocument(ctx context.Context, doc storage.Document) error {
+	collection := s.client.Collection("documents")
+	docRef := collection.Doc(documentID(doc.ProcessID, doc.ID))
+
+	_, err := docRef.Set(ctx, document{
+		ID:            doc.ID,
+		ProcessID:     doc.ProcessID,
+		Title:         doc.Title,
+		Pages:         doc.Pages,
+		Path:          doc.Path,
+		Size:          doc.Size,
+		SHA256:        doc.SHA256,
+		TraceID:       tracing.GetTraceIDFromContext(ctx),
+		SchemaVersion: documentSchemaVersion,
+	})
+	if err != nil {
+		return fmt.Errorf("error saving document %s of process %s: %w", doc.ID, doc.ProcessID, err)
+	}
+	return nil
+}
+
+// DocumentsByProcess returns all documents of a process
+func (s *Storage) DocumentsByProcess(ctx context.Context, processID string) ([]storage.Document, error) {
+	collection := s.client.Collection("documents")
+	docs, err := collection.Where("process_id", "==", processID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error getting documents of process %s: %w", processID, err)
+	}
+
+	var documents []storage.Document
+	for _, d := range docs {
+		var doc document
+		if err := d.DataTo(&doc); err != nil {
+			return nil, fmt.Errorf("error parsing document %s: %w", d.Ref.ID, err)
+		}
+
+		documents = append(documents, storage.Document{
+			ID:        doc.ID,
+			ProcessID: doc.ProcessID,
+			Title:     doc.Title,
+			Pages:     doc.Pages,
+			Path:      doc.Path,
+			Size:      doc.Size,
+			SHA256:    doc.SHA256,
+			CreatedAt: d.CreateTime,
+			UpdatedAt: d.UpdateTime,
+		})
+	}
+	// sorted here instead of in the query, to not require a composite index.
+	sort.Slice(documents, func(i, j int) bool {
+		return documents[i].ID < documents[j].ID
+	})
+	return documents, nil
+}
+
+// documentID is the firestore document ID of a document, unique across the processes.
+func documentID(processID, id string) string {
+	return processID + "_" + id
+}
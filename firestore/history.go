@@ -0,0 +1,142 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// processDoc is the process of a snapshot in the firestore database, with the same fields of the
+// process_basic_info documents.
+type processDoc struct {
+	ProcessID   string `firestore:"process_id"`
+	ProcessForo string `firestore:"foro_code"`
+	ForoName    string `firestore:"foro_name"`
+	ProcessCode string `firestore:"process_code"`
+	Judge       string `firestore:"judge"`
+	Class       string `firestore:"class"`
+	Subject     string `firestore:"subject"`
+	Claimant    string `firestore:"claimant"`
+	Defendant   string `firestore:"defendant"`
+	Vara        string `firestore:"vara"`
+	URL         string `firestore:"url"`
+	Situation   string `firestore:"situation"`
+}
+
+type fieldChange struct {
+	Field string `firestore:"field"`
+	From  string `firestore:"from"`
+	To    string `firestore:"to"`
+}
+
+// snapshotDoc is the snapshot of a process in the history subcollection of the process_basic_info documents.
+type snapshotDoc struct {
+	ID        string        `firestore:"id"`
+	ProcessID string        `firestore:"process_id"`
+	CreatedAt time.Time     `firestore:"created_at"`
+	TraceID   string        `firestore:"trace_id"`
+	Process   processDoc    `firestore:"process"`
+	Diff      []fieldChange `firestore:"diff"`
+	// SchemaVersion is the version of the snapshot document, not of the process in it.
+	SchemaVersion int `firestore:"schema_version"`
+}
+
+func newSnapshotDoc(s storage.ProcessSnapshot) snapshotDoc {
+	doc := snapshotDoc{
+		ID:        s.ID,
+		ProcessID: s.ProcessID,
+		CreatedAt: s.CreatedAt,
+		TraceID:   s.TraceID,
+		Process: processDoc{
+			ProcessID:   s.Process.ProcessID,
+			ProcessForo: s.Process.ProcessForo,
+			ForoName:    s.Process.ForoName,
+			ProcessCode: s.Process.ProcessCode,
+			Judge:       s.Process.Judge,
+			Class:       s.Process.Class,
+			Subject:     s.Process.Subject,
+			Claimant:    s.Process.Claimant,
+			Defendant:   s.Process.Defendant,
+			Vara:        s.Process.Vara,
+			URL:         s.Process.URL,
+			Situation:   s.Process.Situation,
+		},
+		Diff:          []fieldChange{},
+		SchemaVersion: snapshotSchemaVersion,
+	}
+	for _, c := range s.Diff {
+		doc.Diff = append(doc.Diff, fieldChange(c))
+	}
+	return doc
+}
+
+func (d snapshotDoc) snapshot() storage.ProcessSnapshot {
+	s := storage.ProcessSnapshot{
+		ID:        d.ID,
+		ProcessID: d.ProcessID,
+		CreatedAt: d.CreatedAt,
+		TraceID:   d.TraceID,
+		Process: esaj.ProcessBasicInfo{
+			ProcessID:   d.Process.ProcessID,
+			ProcessForo: d.Process.ProcessForo,
+			ForoName:    d.Process.ForoName,
+			ProcessCode: d.Process.ProcessCode,
+			Judge:       d.Process.Judge,
+			Class:       d.Process.Class,
+			Subject:     d.Process.Subject,
+			Claimant:    d.Process.Claimant,
+			Defendant:   d.Process.Defendant,
+			Vara:        d.Process.Vara,
+			URL:         d.Process.URL,
+			Situation:   d.Process.Situation,
+		},
+	}
+	for _, c := range d.Diff {
+		s.Diff = append(s.Diff, storage.FieldChange(c))
+	}
+	return s
+}
+
+// ProcessHistory returns the snapshots of a process, from the oldest to the newest
+func (s *Storage) ProcessHistory(ctx context.Context, processID string) ([]storage.ProcessSnapshot, error) {
+	collection := s.client.Collection("process_basic_info").Doc(processID).Collection("history")
+	// the IDs of the snapshots sort as their creation time, and the documents are returned ordered by ID.
+	docs, err := collection.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error getting history of process %s: %w", processID, err)
+	}
+
+	var snapshots []storage.ProcessSnapshot
+	for _, d := range docs {
+		var doc snapshotDoc
+		if err := d.DataTo(&doc); err != nil {
+			return nil, fmt.Errorf("error parsing snapshot %s: %w", d.Ref.ID, err)
+		}
+		snapshots = append(snapshots, doc.snapshot())
+	}
+	return snapshots, nil
+}
+
+// ProcessOABs returns the OABs that found a process
+func (s *Storage) ProcessOABs(ctx context.Context, processID string) ([]esaj.OAB, error) {
+	d, err := s.client.Collection("process_basic_info").Doc(processID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, fmt.Errorf("error getting the OABs of process %s: %w", processID, storage.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting process %s: %w", processID, err)
+	}
+
+	var doc processInfoDoc
+	if err := d.DataTo(&doc); err != nil {
+		return nil, fmt.Errorf("error parsing process %s: %w", processID, err)
+	}
+	oabs := parseOABs(doc.OABs)
+	storage.SortOABs(oabs)
+	return oabs, nil
+}
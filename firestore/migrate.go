@@ -0,0 +1,330 @@
+package firestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// migration changes the documents of a collection to a schema version.
+type migration struct {
+	Collection  string
+	Version     int
+	Description string
+	// Apply changes the fields of the document d in place, the fields removed from data are deleted from the
+	// document. It must accept the documents written by any previous version.
+	Apply func(d *firestore.DocumentSnapshot, data map[string]interface{}) error
+	// ID returns the ID of the migrated document, that is moved to it when it changes. It's optional, the
+	// document keeps its ID when it's nil.
+	ID func(data map[string]interface{}) (string, error)
+}
+
+// migrations are applied in order to the documents with a schema_version lower than their version, so running
+// them again only changes the documents written by old versions. The last version of each collection is its
+// schema version constant.
+var migrations = []migration{
+	{
+		Collection:  "process_seeds",
+		Version:     1,
+		Description: "normalize the oab and backfill the status",
+		Apply: func(_ *firestore.DocumentSnapshot, data map[string]interface{}) error {
+			oab, err := canonicalOAB(data["oab"])
+			if err != nil {
+				return err
+			}
+			data["oab"] = oab
+
+			if _, ok := data["status"].(string); !ok {
+				data["status"] = storage.SeedPending
+			}
+			return nil
+		},
+	},
+	{
+		Collection:  "process_basic_info",
+		Version:     1,
+		Description: "make the oabs an array of normalized oabs and backfill the missing fields",
+		Apply: func(_ *firestore.DocumentSnapshot, data map[string]interface{}) error {
+			var raw []interface{}
+			switch v := data["oabs"].(type) {
+			case []interface{}:
+				raw = v
+			case string:
+				raw = []interface{}{v}
+			case nil:
+			default:
+				return fmt.Errorf("invalid oabs %v", v)
+			}
+
+			oabs := []interface{}{}
+			seen := make(map[string]bool)
+			for _, o := range raw {
+				oab, err := canonicalOAB(o)
+				if err != nil {
+					return err
+				}
+				if !seen[oab] {
+					seen[oab] = true
+					oabs = append(oabs, oab)
+				}
+			}
+			data["oabs"] = oabs
+
+			for _, field := range []string{"process_id", "foro_code", "foro_name", "process_code", "judge", "class",
+				"claimant", "defendant", "vara", "url", "trace_id"} {
+				if _, ok := data[field].(string); !ok {
+					data[field] = ""
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Collection:  "process_seeds",
+		Version:     2,
+		Description: "backfill the update time, used to sort the seeds",
+		Apply:       backfillUpdatedAt,
+	},
+	{
+		Collection:  "process_basic_info",
+		Version:     2,
+		Description: "backfill the update time, used to sort the processes, the situation and the subject",
+		Apply: func(d *firestore.DocumentSnapshot, data map[string]interface{}) error {
+			for _, field := range []string{"situation", "subject"} {
+				if _, ok := data[field].(string); !ok {
+					data[field] = ""
+				}
+			}
+			return backfillUpdatedAt(d, data)
+		},
+	},
+	{
+		Collection:  "users",
+		Version:     1,
+		Description: "convert the dates to RFC3339 strings and backfill the email addresses",
+		Apply: func(_ *firestore.DocumentSnapshot, data map[string]interface{}) error {
+			for _, field := range []string{"created_at", "updated_at", "deleted_at"} {
+				switch v := data[field].(type) {
+				case time.Time:
+					data[field] = v.UTC().Format(time.RFC3339)
+				case int64:
+					// the clerk dates are unix timestamps in milliseconds
+					data[field] = time.UnixMilli(v).UTC().Format(time.RFC3339)
+				case nil:
+					if field != "deleted_at" {
+						data[field] = ""
+					} else {
+						delete(data, field)
+					}
+				}
+			}
+
+			if _, ok := data["email_addresses"].([]interface{}); !ok {
+				data["email_addresses"] = []interface{}{}
+			}
+			return nil
+		},
+	},
+	{
+		Collection:  "process_seeds",
+		Version:     3,
+		Description: "key the seeds by process and OAB, so the seeds of a process found by many OABs are kept",
+		Apply: func(d *firestore.DocumentSnapshot, data map[string]interface{}) error {
+			// the seeds were keyed by their process
+			if _, ok := data["process_id"].(string); !ok {
+				data["process_id"] = d.Ref.ID
+			}
+			return nil
+		},
+		ID: func(data map[string]interface{}) (string, error) {
+			processID, _ := data["process_id"].(string)
+			raw, _ := data["oab"].(string)
+			oab, err := esaj.ParseOAB(raw)
+			if err != nil {
+				return "", err
+			}
+			return storage.SeedID(processID, oab), nil
+		},
+	},
+	{
+		Collection:  "anonymized_parties",
+		Version:     1,
+		Description: "remove the anonymized names, only their hashes are kept",
+		Apply: func(_ *firestore.DocumentSnapshot, data map[string]interface{}) error {
+			delete(data, "name")
+			return nil
+		},
+	},
+}
+
+// backfillUpdatedAt sets the updated_at field with the last update time of the document, when it's missing.
+func backfillUpdatedAt(d *firestore.DocumentSnapshot, data map[string]interface{}) error {
+	if _, ok := data["updated_at"].(time.Time); !ok {
+		data["updated_at"] = d.UpdateTime
+	}
+	return nil
+}
+
+// migratedCollections are the collections that have migrations, in the order they are migrated.
+var migratedCollections = []string{"process_seeds", "process_basic_info", "users", "anonymized_parties"}
+
+// MigrationResult is the result of the migrations of a collection.
+type MigrationResult struct {
+	Collection string
+	// Scanned is the number of documents read.
+	Scanned int
+	// Migrated is the number of documents changed, or that would be changed in a dry run.
+	Migrated int
+}
+
+// Migrate applies the migrations to the documents of the process_seeds, process_basic_info, users and
+// anonymized_parties collections. In a dry run the documents are migrated in memory, but not written.
+// A document that fails doesn't stop the others, the failures are returned in a *storage.BatchError by
+// document path. A document changed while it was migrated fails too, and is migrated by the next run. The
+// documents whose ID changes, like the seeds keyed by their process only, are moved to the new ID.
+func (s *Storage) Migrate(ctx context.Context, dryRun bool) ([]MigrationResult, error) {
+	failures := make(map[string]error)
+	var results []MigrationResult
+	for _, collection := range migratedCollections {
+		result, err := s.migrateCollection(ctx, collection, dryRun, failures)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+
+	if len(failures) > 0 {
+		return results, &storage.BatchError{Failures: failures}
+	}
+	return results, nil
+}
+
+func (s *Storage) migrateCollection(ctx context.Context, collection string, dryRun bool, failures map[string]error) (MigrationResult, error) {
+	result := MigrationResult{Collection: collection}
+
+	iter := s.client.Collection(collection).Documents(ctx)
+	defer iter.Stop()
+	for {
+		d, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("error reading collection %s: %w", collection, err)
+		}
+		result.Scanned++
+
+		changed, err := s.migrateDocument(ctx, d, dryRun)
+		if err != nil {
+			failures[collection+"/"+d.Ref.ID] = err
+			continue
+		}
+		if changed {
+			result.Migrated++
+		}
+	}
+	return result, nil
+}
+
+// migrateDocument applies the migrations newer than the document version. It returns false when the document
+// is already in the last version.
+func (s *Storage) migrateDocument(ctx context.Context, d *firestore.DocumentSnapshot, dryRun bool) (bool, error) {
+	data := d.Data()
+	version := schemaVersionOf(data)
+
+	var applied bool
+	id := d.Ref.ID
+	for _, m := range migrations {
+		if m.Collection != d.Ref.Parent.ID || m.Version <= version {
+			continue
+		}
+		if err := m.Apply(d, data); err != nil {
+			return false, fmt.Errorf("error applying migration %d: %w", m.Version, err)
+		}
+		if m.ID != nil {
+			var err error
+			if id, err = m.ID(data); err != nil {
+				return false, fmt.Errorf("error applying migration %d: %w", m.Version, err)
+			}
+		}
+		data["schema_version"] = m.Version
+		applied = true
+	}
+	if !applied || dryRun {
+		return applied, nil
+	}
+	if id != d.Ref.ID {
+		return true, s.moveDocument(ctx, d, id, data)
+	}
+
+	var updates []firestore.Update
+	for field, value := range data {
+		updates = append(updates, firestore.Update{FieldPath: firestore.FieldPath{field}, Value: value})
+	}
+	for field := range d.Data() {
+		if _, ok := data[field]; !ok {
+			updates = append(updates, firestore.Update{FieldPath: firestore.FieldPath{field}, Value: firestore.Delete})
+		}
+	}
+
+	if _, err := d.Ref.Update(ctx, updates, firestore.LastUpdateTime(d.UpdateTime)); err != nil {
+		return false, fmt.Errorf("error saving document: %w", err)
+	}
+	return true, nil
+}
+
+// moveDocument replaces the document by the migrated data with the new ID, in a transaction. A document with
+// the new ID was written by the current version, so it's kept and only the old one is deleted.
+func (s *Storage) moveDocument(ctx context.Context, d *firestore.DocumentSnapshot, id string, data map[string]interface{}) error {
+	ref := d.Ref.Parent.Doc(id)
+	err := s.client.RunTransaction(ctx, func(_ context.Context, tx *firestore.Transaction) error {
+		existing, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return fmt.Errorf("error getting document %s: %w", id, err)
+		}
+		if !existing.Exists() {
+			if err := tx.Create(ref, data); err != nil {
+				return fmt.Errorf("error creating document %s: %w", id, err)
+			}
+		}
+		return tx.Delete(d.Ref, firestore.LastUpdateTime(d.UpdateTime))
+	})
+	if err != nil {
+		return fmt.Errorf("error moving document to %s: %w", id, err)
+	}
+	return nil
+}
+
+// schemaVersionOf returns the schema_version of a document, 0 for the documents written before it.
+func schemaVersionOf(data map[string]interface{}) int {
+	v, _ := data["schema_version"].(int64)
+	return int(v)
+}
+
+// canonicalOAB returns the canonical format of an OAB saved by any version, like "103289", "103289SP" or
+// "103289/SP".
+func canonicalOAB(v interface{}) (string, error) {
+	var raw string
+	switch v := v.(type) {
+	case string:
+		raw = v
+	case int64:
+		raw = fmt.Sprint(v)
+	default:
+		return "", fmt.Errorf("invalid oab %v", v)
+	}
+
+	oab, err := esaj.ParseOAB(raw)
+	if err != nil {
+		return "", err
+	}
+	return oab.String(), nil
+}
@@ -0,0 +1,213 @@
+//go:build integration
+
+package firestore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	fs "cloud.google.com/go/firestore"
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/firestore"
+	esajstorage "github.com/perebaj/esaj/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStorage_Migrate(t *testing.T) {
+	ctx := context.TODO()
+	c, err := fs.NewClient(ctx, projectID)
+	require.NoError(t, err)
+	cleanup(t, c)
+	defer cleanup(t, c)
+
+	// documents as written by the first versions of the collector
+	_, err = c.Collection("process_seeds").Doc("123").Set(ctx, map[string]interface{}{
+		"process_id": "123",
+		"oab":        "103289",
+		"url":        "http://example.com",
+		"trace_id":   "trace-id",
+	})
+	require.NoError(t, err)
+	_, err = c.Collection("process_basic_info").Doc("123").Set(ctx, map[string]interface{}{
+		"process_id": "123",
+		"judge":      "Judge",
+		"oabs":       []interface{}{"103289", "103289/SP", "SP 200.000"},
+	})
+	require.NoError(t, err)
+	_, err = c.Collection("users").Doc("user_1").Set(ctx, map[string]interface{}{
+		"id":         "user_1",
+		"created_at": int64(1654012591514),
+		"updated_at": "2022-05-31T15:56:31Z",
+		"deleted_at": nil,
+	})
+	require.NoError(t, err)
+	_, err = c.Collection("anonymized_parties").Doc(esajstorage.SubjectHash("José da Silva")).Set(ctx, map[string]interface{}{
+		"name":       "José da Silva",
+		"created_at": time.Now(),
+	})
+	require.NoError(t, err)
+
+	storage := firestore.NewStorage(c, projectID)
+
+	// the documents written by the current version are not migrated
+	require.NoError(t, storage.SaveProcessSeeds(ctx, []esaj.ProcessSeed{
+		{ProcessID: "456", OAB: esaj.MustParseOAB("456"), URL: "http://example.com"},
+	}))
+
+	want := []firestore.MigrationResult{
+		{Collection: "process_seeds", Scanned: 2, Migrated: 1},
+		{Collection: "process_basic_info", Scanned: 1, Migrated: 1},
+		{Collection: "users", Scanned: 1, Migrated: 1},
+		{Collection: "anonymized_parties", Scanned: 1, Migrated: 1},
+	}
+
+	results, err := storage.Migrate(ctx, true)
+	require.NoError(t, err)
+	assert.Equal(t, want, results)
+
+	// a dry run doesn't change the documents
+	seed, err := c.Collection("process_seeds").Doc("123").Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "103289", seed.Data()["oab"])
+
+	results, err = storage.Migrate(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, want, results)
+
+	seeds, err := storage.GetSeedsByOAB(ctx, esaj.MustParseOAB("103289"))
+	require.NoError(t, err)
+	require.Len(t, seeds, 1)
+	assert.Equal(t, esajstorage.SeedPending, seeds[0].Status)
+
+	// the seed is keyed by its process and OAB
+	assert.Equal(t, esajstorage.SeedID("123", esaj.MustParseOAB("103289")), seeds[0].ID)
+	_, err = c.Collection("process_seeds").Doc("123").Get(ctx)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	seed, err = c.Collection("process_seeds").Doc(seeds[0].ID).Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), seed.Data()["schema_version"])
+	assert.Equal(t, "http://example.com", seed.Data()["url"])
+	assert.NotNil(t, seed.Data()["updated_at"])
+
+	processes, err := storage.ProcessBasicInfoByOAB(ctx, esaj.MustParseOAB("200000/SP"))
+	require.NoError(t, err)
+	require.Len(t, processes, 1)
+	assert.Equal(t, "Judge", processes[0].Judge)
+
+	process, err := c.Collection("process_basic_info").Doc("123").Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"103289/SP", "200000/SP"}, process.Data()["oabs"])
+
+	user, err := storage.GetUser(ctx, "user_1")
+	require.NoError(t, err)
+	assert.Equal(t, "2022-05-31T15:56:31Z", user.CreatedAt)
+	assert.Empty(t, user.DeletedAt)
+
+	// the anonymized name is removed, its hash still anonymizes the processes
+	party, err := c.Collection("anonymized_parties").Doc(esajstorage.SubjectHash("José da Silva")).Get(ctx)
+	require.NoError(t, err)
+	assert.NotContains(t, party.Data(), "name")
+	require.NoError(t, storage.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{
+		ProcessID: "789", OAB: esaj.MustParseOAB("103289"), Claimant: "Jose da Silva",
+	}))
+	processes, err = storage.ProcessBasicInfoByOAB(ctx, esaj.MustParseOAB("103289"))
+	require.NoError(t, err)
+	require.Len(t, processes, 2)
+	for _, p := range processes {
+		if p.ProcessID == "789" {
+			assert.Equal(t, esajstorage.Anonymized, p.Claimant)
+		}
+	}
+
+	// running it again changes nothing
+	results, err = storage.Migrate(ctx, false)
+	require.NoError(t, err)
+	for _, r := range results {
+		assert.Zero(t, r.Migrated, r.Collection)
+	}
+}
+
+func TestStorage_MigrateFailures(t *testing.T) {
+	ctx := context.TODO()
+	c, err := fs.NewClient(ctx, projectID)
+	require.NoError(t, err)
+	cleanup(t, c)
+	defer cleanup(t, c)
+
+	_, err = c.Collection("process_seeds").Doc("123").Set(ctx, map[string]interface{}{"oab": "invalid"})
+	require.NoError(t, err)
+	_, err = c.Collection("process_seeds").Doc("456").Set(ctx, map[string]interface{}{"oab": "456"})
+	require.NoError(t, err)
+
+	results, err := firestore.NewStorage(c, projectID).Migrate(ctx, false)
+	var batchErr *esajstorage.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Contains(t, batchErr.Failures, "process_seeds/123")
+	assert.Len(t, batchErr.Failures, 1)
+
+	// the other documents are migrated
+	require.Len(t, results, 3)
+	assert.Equal(t, 1, results[0].Migrated)
+}
+
+func TestStorage_legacyOAB(t *testing.T) {
+	ctx := context.TODO()
+	c, err := fs.NewClient(ctx, projectID)
+	require.NoError(t, err)
+	cleanup(t, c)
+	defer cleanup(t, c)
+
+	// the bare number saved before the OAB type is found before the migration
+	_, err = c.Collection("process_seeds").Doc("123").Set(ctx, map[string]interface{}{
+		"process_id": "123",
+		"oab":        "103289",
+		"url":        "http://example.com",
+	})
+	require.NoError(t, err)
+	// and so is the format of the eSAJ search
+	_, err = c.Collection("process_seeds").Doc("456").Set(ctx, map[string]interface{}{
+		"process_id": "456",
+		"oab":        "103289SP",
+		"url":        "http://example.com",
+	})
+	require.NoError(t, err)
+	// a seed that can't be read is skipped, without failing the others
+	_, err = c.Collection("process_seeds").Doc("789").Set(ctx, map[string]interface{}{
+		"process_id": "789",
+		"oab":        "103289",
+		"updated_at": "yesterday",
+	})
+	require.NoError(t, err)
+	_, err = c.Collection("process_basic_info").Doc("123").Set(ctx, map[string]interface{}{
+		"process_id": "123",
+		"oabs":       []interface{}{"103289"},
+	})
+	require.NoError(t, err)
+
+	s := firestore.NewStorage(c, projectID)
+	oab := esaj.MustParseOAB("103289/SP")
+	seeds, err := s.GetSeedsByOAB(ctx, oab)
+	require.NoError(t, err)
+	require.Len(t, seeds, 2)
+	assert.Equal(t, oab, seeds[0].OAB)
+	assert.Equal(t, oab, seeds[1].OAB)
+
+	page, err := s.QuerySeeds(ctx, esajstorage.SeedQuery{OAB: oab, PageSize: 3})
+	require.NoError(t, err)
+	require.Len(t, page.Seeds, 2)
+	assert.Empty(t, page.NextCursor)
+
+	processes, err := s.ProcessBasicInfoByOAB(ctx, oab)
+	require.NoError(t, err)
+	require.Len(t, processes, 1)
+
+	// saving the process again normalizes its OABs, without duplicating them
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{ProcessID: "123", OAB: oab}))
+	doc, err := c.Collection("process_basic_info").Doc("123").Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"103289/SP"}, doc.Data()["oabs"])
+}
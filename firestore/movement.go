@@ -0,0 +1,280 @@
+package firestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/tracing"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// movementsPageSize is the number of movements read by each query of MovementsByOAB and UnreadMovements.
+const movementsPageSize = 300
+
+// movementsBatchSize is the number of movements created by each transaction of SaveMovements, below the 500
+// writes of a transaction.
+const movementsBatchSize = 400
+
+// movementDoc is the movement of a process in the movements subcollection of the process_basic_info documents
+type movementDoc struct {
+	ID        string    `firestore:"id"`
+	ProcessID string    `firestore:"process_id"`
+	Date      time.Time `firestore:"date"`
+	Title     string    `firestore:"title"`
+	Text      string    `firestore:"text"`
+	CreatedAt time.Time `firestore:"created_at"`
+	TraceID   string    `firestore:"trace_id"`
+	// OABs are the OABs of the process, in their canonical format, so the movements of an OAB are queried
+	// across the movements collection group.
+	OABs []string `firestore:"oabs"`
+	// SchemaVersion is the version of the movement document.
+	SchemaVersion int `firestore:"schema_version"`
+}
+
+func newMovementDoc(m storage.Movement, oabs []string) movementDoc {
+	return movementDoc{
+		ID:            m.ID,
+		ProcessID:     m.ProcessID,
+		Date:          m.Date,
+		Title:         m.Title,
+		Text:          m.Text,
+		CreatedAt:     m.CreatedAt,
+		TraceID:       m.TraceID,
+		OABs:          oabs,
+		SchemaVersion: movementSchemaVersion,
+	}
+}
+
+func (d movementDoc) movement() storage.Movement {
+	return storage.Movement{
+		ID:        d.ID,
+		ProcessID: d.ProcessID,
+		Date:      d.Date,
+		Title:     d.Title,
+		Text:      d.Text,
+		CreatedAt: d.CreatedAt,
+		TraceID:   d.TraceID,
+	}
+}
+
+func (s *Storage) movements(processID string) *firestore.CollectionRef {
+	return s.client.Collection("process_basic_info").Doc(processID).Collection("movements")
+}
+
+// readMovement is the document that marks a movement as read by the user, in the read_movements subcollection
+// of the users documents.
+func (s *Storage) readMovement(userID, processID, movementID string) *firestore.DocumentRef {
+	return s.client.Collection("users").Doc(userID).Collection("read_movements").Doc(processID + "_" + movementID)
+}
+
+// SaveMovements saves the movements of a process that were not saved yet in the firestore database
+func (s *Storage) SaveMovements(ctx context.Context, processID string, ms []esaj.Movement) ([]storage.Movement, error) {
+	movements := storage.NewMovements(processID, ms, time.Now(), tracing.GetTraceIDFromContext(ctx))
+	texts := make([]string, 0, 2*len(movements))
+	for _, m := range movements {
+		texts = append(texts, m.Title, m.Text)
+	}
+	names, err := s.anonymizedNames(ctx, nil, texts...)
+	if err != nil {
+		return nil, err
+	}
+	for i, m := range movements {
+		movements[i], _ = storage.AnonymizeMovement(m, names)
+	}
+
+	var created []storage.Movement
+	for start := 0; start < len(movements); start += movementsBatchSize {
+		batch, err := s.createMovements(ctx, processID, movements[start:min(start+movementsBatchSize, len(movements))])
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, batch...)
+	}
+	return created, nil
+}
+
+// createMovements creates the movements that were not saved yet, with the OABs of their process. The process is
+// read in the same transaction, so an OAB added to it by SaveProcessBasicInfo at the same time is either read
+// here or copied to the movements after it.
+func (s *Storage) createMovements(ctx context.Context, processID string, movements []storage.Movement) ([]storage.Movement, error) {
+	processRef := s.client.Collection("process_basic_info").Doc(processID)
+	refs := make([]*firestore.DocumentRef, 0, len(movements))
+	for _, m := range movements {
+		refs = append(refs, s.movements(processID).Doc(m.ID))
+	}
+
+	var created []storage.Movement
+	err := s.client.RunTransaction(ctx, func(_ context.Context, tx *firestore.Transaction) error {
+		created = nil
+		process, err := tx.Get(processRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return fmt.Errorf("error getting process: %w", err)
+		}
+		oabs := []string{}
+		if process.Exists() {
+			var doc processInfoDoc
+			if err := process.DataTo(&doc); err != nil {
+				return fmt.Errorf("error parsing process: %w", err)
+			}
+			oabs = doc.canonicalOABs()
+		}
+
+		docs, err := tx.GetAll(refs)
+		if err != nil {
+			return fmt.Errorf("error getting movements: %w", err)
+		}
+		for i, d := range docs {
+			if d.Exists() {
+				continue
+			}
+			if err := tx.Create(refs[i], newMovementDoc(movements[i], oabs)); err != nil {
+				return fmt.Errorf("error saving movement %s: %w", movements[i].ID, err)
+			}
+			created = append(created, movements[i])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error saving the movements of process %s: %w", processID, err)
+	}
+	return created, nil
+}
+
+// addMovementsOAB adds an OAB to the movements of a process, after it was added to the process.
+func (s *Storage) addMovementsOAB(ctx context.Context, processID string, oab esaj.OAB) error {
+	refs, err := s.movements(processID).DocumentRefs(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("error getting the movements of process %s: %w", processID, err)
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+
+	bulkWriter := s.client.BulkWriter(ctx)
+	jobs := make([]*firestore.BulkWriterJob, 0, len(refs))
+	for _, ref := range refs {
+		job, err := bulkWriter.Update(ref, []firestore.Update{{Path: "oabs", Value: firestore.ArrayUnion(oab.String())}})
+		if err != nil {
+			bulkWriter.End()
+			return fmt.Errorf("error adding oab %s to the movements of process %s: %w", oab, processID, err)
+		}
+		jobs = append(jobs, job)
+	}
+	bulkWriter.End()
+
+	var errs []error
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("error adding oab %s to the movements of process %s: %w", oab, processID, err)
+	}
+	return nil
+}
+
+// MovementsByOAB returns the movements of the processes of an OAB saved since a time
+func (s *Storage) MovementsByOAB(ctx context.Context, oab esaj.OAB, since time.Time) ([]storage.Movement, error) {
+	var movements []storage.Movement
+	err := s.eachMovementsPage(ctx, oab, since, func(page []storage.Movement) error {
+		movements = append(movements, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	storage.SortMovements(movements)
+	return movements, nil
+}
+
+// MarkMovementsRead marks the movements of a process as read by a user
+func (s *Storage) MarkMovementsRead(ctx context.Context, userID, processID string, movementIDs []string) error {
+	now := time.Now()
+	for _, id := range movementIDs {
+		_, err := s.readMovement(userID, processID, id).Set(ctx, map[string]interface{}{
+			"process_id":  processID,
+			"movement_id": id,
+			"read_at":     now,
+		})
+		if err != nil {
+			return fmt.Errorf("error marking movement %s of process %s as read: %w", id, processID, err)
+		}
+	}
+	return nil
+}
+
+// UnreadMovements returns the movements of the processes of an OAB that were not read by a user. The read marks
+// of each page of movements are read at once.
+func (s *Storage) UnreadMovements(ctx context.Context, userID string, oab esaj.OAB) ([]storage.Movement, error) {
+	var unread []storage.Movement
+	err := s.eachMovementsPage(ctx, oab, time.Time{}, func(page []storage.Movement) error {
+		refs := make([]*firestore.DocumentRef, 0, len(page))
+		for _, m := range page {
+			refs = append(refs, s.readMovement(userID, m.ProcessID, m.ID))
+		}
+		reads, err := s.client.GetAll(ctx, refs)
+		if err != nil {
+			return fmt.Errorf("error getting the movements read by user %s: %w", userID, err)
+		}
+		for i, read := range reads {
+			if !read.Exists() {
+				unread = append(unread, page[i])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	storage.SortMovements(unread)
+	return unread, nil
+}
+
+// eachMovementsPage calls fn with each page of the movements of the processes of an OAB saved since a time, in
+// the order they were saved. The movements are queried across the movements collection group by their OABs,
+// which needs a composite index of oabs and created_at with the collection group scope.
+func (s *Storage) eachMovementsPage(ctx context.Context, oab esaj.OAB, since time.Time, fn func(page []storage.Movement) error) error {
+	query := s.client.CollectionGroup("movements").
+		Where("oabs", "array-contains", oab.String()).
+		Where("created_at", ">=", since).
+		OrderBy("created_at", firestore.Asc).
+		Limit(movementsPageSize)
+
+	var last *firestore.DocumentSnapshot
+	for {
+		q := query
+		if last != nil {
+			q = q.StartAfter(last)
+		}
+		docs, err := q.Documents(ctx).GetAll()
+		if err != nil {
+			return fmt.Errorf("error getting the movements of oab %s: %w", oab, err)
+		}
+		if len(docs) == 0 {
+			return nil
+		}
+
+		page := make([]storage.Movement, 0, len(docs))
+		for _, d := range docs {
+			var doc movementDoc
+			if err := d.DataTo(&doc); err != nil {
+				return fmt.Errorf("error parsing movement %s: %w", d.Ref.Path, err)
+			}
+			page = append(page, doc.movement())
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		if len(docs) < movementsPageSize {
+			return nil
+		}
+		last = docs[len(docs)-1]
+	}
+}
@@ -0,0 +1,33 @@
+package firestore
+
+import (
+	"slices"
+
+	"github.com/perebaj/esaj/esaj"
+)
+
+// oabValues returns the values an OAB may be saved with, matched by every query by OAB with "in" or
+// "array-contains-any": its canonical format, used since the OAB type, and the spellings saved by the versions
+// before it, that are found until the migrate command normalizes them:
+//   - the number and the UF without the slash, like "123456SP", "123456 SP" or "123456-SP";
+//   - for the registrations of the DefaultUF, the number alone, like "123456" or "OAB123456".
+//
+// Other legacy spellings, like the numbers with dots or saved as integers, are only found after the migration.
+func oabValues(oab esaj.OAB) []string {
+	values := []string{oab.String()}
+	add := func(v string) {
+		if !slices.Contains(values, v) {
+			values = append(values, v)
+		}
+	}
+
+	add(oab.ESAJQuery())
+	add(oab.Number + oab.Suffix + " " + oab.UF)
+	add(oab.Number + oab.Suffix + "-" + oab.UF)
+	if oab.UF == esaj.DefaultUF {
+		add(oab.Number + oab.Suffix)
+		add("OAB" + oab.Number + oab.Suffix)
+		add("OAB " + oab.Number + oab.Suffix)
+	}
+	return values
+}
@@ -0,0 +1,345 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/perebaj/esaj/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// organizationDoc is an organization in the organizations collection, whose members and annotations are in the
+// members and annotations subcollections of its document.
+type organizationDoc struct {
+	ID   string `firestore:"id"`
+	Name string `firestore:"name"`
+	// OABs are the OABs owned by the organization, in their canonical format.
+	OABs          []string  `firestore:"oabs"`
+	CreatedAt     time.Time `firestore:"created_at"`
+	UpdatedAt     time.Time `firestore:"updated_at"`
+	SchemaVersion int       `firestore:"schema_version"`
+}
+
+func (d organizationDoc) organization() storage.Organization {
+	oabs := parseOABs(d.OABs)
+	storage.SortOABs(oabs)
+	return storage.Organization{
+		ID:        d.ID,
+		Name:      d.Name,
+		OABs:      oabs,
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+	}
+}
+
+// memberDoc is a member in the members subcollection of an organization, whose document ID is the user ID.
+// The memberships of a user are queried by user_id across the members collection group.
+type memberDoc struct {
+	OrganizationID string    `firestore:"organization_id"`
+	UserID         string    `firestore:"user_id"`
+	Role           string    `firestore:"role"`
+	CreatedAt      time.Time `firestore:"created_at"`
+	SchemaVersion  int       `firestore:"schema_version"`
+}
+
+func (d memberDoc) member() storage.Member {
+	return storage.Member{
+		OrganizationID: d.OrganizationID,
+		UserID:         d.UserID,
+		Role:           d.Role,
+		CreatedAt:      d.CreatedAt,
+	}
+}
+
+// annotationDoc is an annotation in the annotations subcollection of an organization
+type annotationDoc struct {
+	ID             string    `firestore:"id"`
+	OrganizationID string    `firestore:"organization_id"`
+	ProcessID      string    `firestore:"process_id"`
+	AuthorID       string    `firestore:"author_id"`
+	Text           string    `firestore:"text"`
+	CreatedAt      time.Time `firestore:"created_at"`
+	UpdatedAt      time.Time `firestore:"updated_at"`
+	SchemaVersion  int       `firestore:"schema_version"`
+}
+
+func (d annotationDoc) annotation() storage.Annotation {
+	return storage.Annotation{
+		ID:             d.ID,
+		OrganizationID: d.OrganizationID,
+		ProcessID:      d.ProcessID,
+		AuthorID:       d.AuthorID,
+		Text:           d.Text,
+		CreatedAt:      d.CreatedAt,
+		UpdatedAt:      d.UpdatedAt,
+	}
+}
+
+func (s *Storage) organizationRef(id string) *firestore.DocumentRef {
+	return s.client.Collection("organizations").Doc(id)
+}
+
+// SaveOrganization saves an organization in the organizations collection, keeping its creation time
+func (s *Storage) SaveOrganization(ctx context.Context, o storage.Organization) error {
+	ref := s.organizationRef(o.ID)
+	oabs := make([]string, 0, len(o.OABs))
+	for _, oab := range o.OABs {
+		oabs = append(oabs, oab.String())
+	}
+
+	err := s.client.RunTransaction(ctx, func(_ context.Context, tx *firestore.Transaction) error {
+		now := time.Now()
+		doc := organizationDoc{
+			ID:            o.ID,
+			Name:          o.Name,
+			OABs:          oabs,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+			SchemaVersion: organizationSchemaVersion,
+		}
+
+		existing, err := tx.Get(ref)
+		switch {
+		case status.Code(err) == codes.NotFound:
+		case err != nil:
+			return fmt.Errorf("error getting organization: %w", err)
+		default:
+			var saved organizationDoc
+			if err := existing.DataTo(&saved); err != nil {
+				return fmt.Errorf("error parsing organization: %w", err)
+			}
+			doc.CreatedAt = saved.CreatedAt
+		}
+		return tx.Set(ref, doc)
+	})
+	if err != nil {
+		return fmt.Errorf("error saving organization %s: %w", o.ID, err)
+	}
+	return nil
+}
+
+// GetOrganization returns an organization of the organizations collection
+func (s *Storage) GetOrganization(ctx context.Context, id string) (storage.Organization, error) {
+	d, err := s.organizationRef(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return storage.Organization{}, fmt.Errorf("error getting organization %s: %w", id, storage.ErrNotFound)
+	}
+	if err != nil {
+		return storage.Organization{}, fmt.Errorf("error getting organization %s: %w", id, err)
+	}
+
+	var doc organizationDoc
+	if err := d.DataTo(&doc); err != nil {
+		return storage.Organization{}, fmt.Errorf("error parsing organization %s: %w", id, err)
+	}
+	return doc.organization(), nil
+}
+
+// SaveMember saves a member in the members subcollection of its organization, keeping its creation time
+func (s *Storage) SaveMember(ctx context.Context, m storage.Member) error {
+	orgRef := s.organizationRef(m.OrganizationID)
+	ref := orgRef.Collection("members").Doc(m.UserID)
+
+	err := s.client.RunTransaction(ctx, func(_ context.Context, tx *firestore.Transaction) error {
+		if _, err := tx.Get(orgRef); err != nil {
+			if status.Code(err) == codes.NotFound {
+				return fmt.Errorf("organization %s: %w", m.OrganizationID, storage.ErrNotFound)
+			}
+			return fmt.Errorf("error getting organization: %w", err)
+		}
+
+		doc := memberDoc{
+			OrganizationID: m.OrganizationID,
+			UserID:         m.UserID,
+			Role:           m.Role,
+			CreatedAt:      time.Now(),
+			SchemaVersion:  memberSchemaVersion,
+		}
+		existing, err := tx.Get(ref)
+		switch {
+		case status.Code(err) == codes.NotFound:
+		case err != nil:
+			return fmt.Errorf("error getting member: %w", err)
+		default:
+			var saved memberDoc
+			if err := existing.DataTo(&saved); err != nil {
+				return fmt.Errorf("error parsing member: %w", err)
+			}
+			doc.CreatedAt = saved.CreatedAt
+		}
+		return tx.Set(ref, doc)
+	})
+	if err != nil {
+		return fmt.Errorf("error saving member %s of organization %s: %w", m.UserID, m.OrganizationID, err)
+	}
+	return nil
+}
+
+// GetMember returns a member of an organization
+func (s *Storage) GetMember(ctx context.Context, organizationID, userID string) (storage.Member, error) {
+	d, err := s.organizationRef(organizationID).Collection("members").Doc(userID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return storage.Member{}, fmt.Errorf("error getting member %s of organization %s: %w", userID,
+			organizationID, storage.ErrNotFound)
+	}
+	if err != nil {
+		return storage.Member{}, fmt.Errorf("error getting member %s of organization %s: %w", userID,
+			organizationID, err)
+	}
+
+	var doc memberDoc
+	if err := d.DataTo(&doc); err != nil {
+		return storage.Member{}, fmt.Errorf("error parsing member %s: %w", d.Ref.Path, err)
+	}
+	return doc.member(), nil
+}
+
+// RemoveMember removes a member from the members subcollection of its organization
+func (s *Storage) RemoveMember(ctx context.Context, organizationID, userID string) error {
+	_, err := s.organizationRef(organizationID).Collection("members").Doc(userID).Delete(ctx, firestore.Exists)
+	if status.Code(err) == codes.NotFound {
+		return fmt.Errorf("error removing member %s of organization %s: %w", userID, organizationID,
+			storage.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("error removing member %s of organization %s: %w", userID, organizationID, err)
+	}
+	return nil
+}
+
+// Members returns the members of an organization, ordered by the document ID that is the user ID
+func (s *Storage) Members(ctx context.Context, organizationID string) ([]storage.Member, error) {
+	members, err := s.queryMembers(ctx, s.organizationRef(organizationID).Collection("members").Query)
+	if err != nil {
+		return nil, fmt.Errorf("error getting members of organization %s: %w", organizationID, err)
+	}
+	return members, nil
+}
+
+// UserMemberships returns the memberships of a user, from the members collection group. The query requires
+// the single field index of user_id with the collection group scope.
+func (s *Storage) UserMemberships(ctx context.Context, userID string) ([]storage.Member, error) {
+	members, err := s.queryMembers(ctx, s.client.CollectionGroup("members").Where("user_id", "==", userID))
+	if err != nil {
+		return nil, fmt.Errorf("error getting memberships of user %s: %w", userID, err)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].OrganizationID < members[j].OrganizationID
+	})
+	return members, nil
+}
+
+func (s *Storage) queryMembers(ctx context.Context, q firestore.Query) ([]storage.Member, error) {
+	var members []storage.Member
+	err := eachDocument(ctx, q, func(d *firestore.DocumentSnapshot) error {
+		var doc memberDoc
+		if err := d.DataTo(&doc); err != nil {
+			return fmt.Errorf("error parsing member %s: %w", d.Ref.Path, err)
+		}
+		members = append(members, doc.member())
+		return nil
+	})
+	return members, err
+}
+
+// SaveAnnotation saves an annotation in the annotations subcollection of its organization, keeping its
+// creation time
+func (s *Storage) SaveAnnotation(ctx context.Context, a storage.Annotation) error {
+	orgRef := s.organizationRef(a.OrganizationID)
+	ref := orgRef.Collection("annotations").Doc(a.ID)
+
+	err := s.client.RunTransaction(ctx, func(_ context.Context, tx *firestore.Transaction) error {
+		if _, err := tx.Get(orgRef); err != nil {
+			if status.Code(err) == codes.NotFound {
+				return fmt.Errorf("organization %s: %w", a.OrganizationID, storage.ErrNotFound)
+			}
+			return fmt.Errorf("error getting organization: %w", err)
+		}
+
+		now := time.Now()
+		doc := annotationDoc{
+			ID:             a.ID,
+			OrganizationID: a.OrganizationID,
+			ProcessID:      a.ProcessID,
+			AuthorID:       a.AuthorID,
+			Text:           a.Text,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+			SchemaVersion:  annotationSchemaVersion,
+		}
+		existing, err := tx.Get(ref)
+		switch {
+		case status.Code(err) == codes.NotFound:
+		case err != nil:
+			return fmt.Errorf("error getting annotation: %w", err)
+		default:
+			var saved annotationDoc
+			if err := existing.DataTo(&saved); err != nil {
+				return fmt.Errorf("error parsing annotation: %w", err)
+			}
+			doc.CreatedAt = saved.CreatedAt
+		}
+		return tx.Set(ref, doc)
+	})
+	if err != nil {
+		return fmt.Errorf("error saving annotation %s of organization %s: %w", a.ID, a.OrganizationID, err)
+	}
+	return nil
+}
+
+// GetAnnotation returns an annotation of an organization
+func (s *Storage) GetAnnotation(ctx context.Context, organizationID, id string) (storage.Annotation, error) {
+	d, err := s.organizationRef(organizationID).Collection("annotations").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return storage.Annotation{}, fmt.Errorf("error getting annotation %s of organization %s: %w", id,
+			organizationID, storage.ErrNotFound)
+	}
+	if err != nil {
+		return storage.Annotation{}, fmt.Errorf("error getting annotation %s of organization %s: %w", id,
+			organizationID, err)
+	}
+
+	var doc annotationDoc
+	if err := d.DataTo(&doc); err != nil {
+		return storage.Annotation{}, fmt.Errorf("error parsing annotation %s: %w", d.Ref.Path, err)
+	}
+	return doc.annotation(), nil
+}
+
+// DeleteAnnotation removes an annotation from the annotations subcollection of its organization
+func (s *Storage) DeleteAnnotation(ctx context.Context, organizationID, id string) error {
+	_, err := s.organizationRef(organizationID).Collection("annotations").Doc(id).Delete(ctx, firestore.Exists)
+	if status.Code(err) == codes.NotFound {
+		return fmt.Errorf("error deleting annotation %s of organization %s: %w", id, organizationID,
+			storage.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("error deleting annotation %s of organization %s: %w", id, organizationID, err)
+	}
+	return nil
+}
+
+// Annotations returns the annotations of an organization on a process. They are sorted after the query, so it
+// doesn't require a composite index.
+func (s *Storage) Annotations(ctx context.Context, organizationID, processID string) ([]storage.Annotation, error) {
+	q := s.organizationRef(organizationID).Collection("annotations").Where("process_id", "==", processID)
+
+	var annotations []storage.Annotation
+	err := eachDocument(ctx, q, func(d *firestore.DocumentSnapshot) error {
+		var doc annotationDoc
+		if err := d.DataTo(&doc); err != nil {
+			return fmt.Errorf("error parsing annotation %s: %w", d.Ref.Path, err)
+		}
+		annotations = append(annotations, doc.annotation())
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting annotations of process %s: %w", processID, err)
+	}
+	storage.SortAnnotations(annotations)
+	return annotations, nil
+}
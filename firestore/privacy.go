@@ -0,0 +1,358 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/tracing"
+)
+
+// anonymizedPartyDoc is a name anonymized by AnonymizeParty, in the anonymized_parties collection whose
+// document ID is the storage.SubjectHash of the name. The name itself is not kept.
+type anonymizedPartyDoc struct {
+	CreatedAt     time.Time `firestore:"created_at"`
+	SchemaVersion int       `firestore:"schema_version"`
+}
+
+// anonymizedNamesBatch is the number of anonymized_parties documents read by request.
+const anonymizedNamesBatch = 300
+
+// privacyAuditDoc is an audit record in the privacy_audit collection
+type privacyAuditDoc struct {
+	ID            string    `firestore:"id"`
+	Operation     string    `firestore:"operation"`
+	Subject       string    `firestore:"subject"`
+	Actor         string    `firestore:"actor"`
+	Records       []string  `firestore:"records"`
+	CreatedAt     time.Time `firestore:"created_at"`
+	TraceID       string    `firestore:"trace_id"`
+	SchemaVersion int       `firestore:"schema_version"`
+}
+
+// anonymizedNames returns the names of the texts anonymized by AnonymizeParty, reading the documents of the
+// hashes of their storage.NameCandidates. The documents are read in the transaction when it's not nil, so only
+// the names of the texts take part in it, not the whole collection.
+func (s *Storage) anonymizedNames(ctx context.Context, tx *firestore.Transaction, texts ...string) ([]string, error) {
+	candidates := storage.NameCandidates(texts...)
+	refs := make([]*firestore.DocumentRef, 0, len(candidates))
+	for hash := range candidates {
+		refs = append(refs, s.client.Collection("anonymized_parties").Doc(hash))
+	}
+
+	var names []string
+	for len(refs) > 0 {
+		batch := refs[:min(len(refs), anonymizedNamesBatch)]
+		refs = refs[len(batch):]
+
+		var (
+			docs []*firestore.DocumentSnapshot
+			err  error
+		)
+		if tx != nil {
+			docs, err = tx.GetAll(batch)
+		} else {
+			docs, err = s.client.GetAll(ctx, batch)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error getting anonymized names: %w", err)
+		}
+		for _, d := range docs {
+			if d.Exists() {
+				names = append(names, candidates[d.Ref.ID])
+			}
+		}
+	}
+	storage.SortNames(names)
+	return names, nil
+}
+
+// ExportUser returns the user, the movements it read, its memberships and the annotations it wrote
+func (s *Storage) ExportUser(ctx context.Context, userID string) (storage.UserExport, error) {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return storage.UserExport{}, err
+	}
+	if user.ID == "" {
+		return storage.UserExport{}, fmt.Errorf("error exporting user %s: %w", userID, storage.ErrNotFound)
+	}
+
+	docs, err := s.client.Collection("users").Doc(userID).Collection("read_movements").Documents(ctx).GetAll()
+	if err != nil {
+		return storage.UserExport{}, fmt.Errorf("error getting the movements read by user %s: %w", userID, err)
+	}
+
+	export := storage.UserExport{
+		User:          user,
+		MovementReads: []storage.MovementRead{},
+		Memberships:   []storage.Member{},
+		Annotations:   []storage.Annotation{},
+	}
+	for _, d := range docs {
+		var read struct {
+			ProcessID  string    `firestore:"process_id"`
+			MovementID string    `firestore:"movement_id"`
+			ReadAt     time.Time `firestore:"read_at"`
+		}
+		if err := d.DataTo(&read); err != nil {
+			return storage.UserExport{}, fmt.Errorf("error parsing movement read %s: %w", d.Ref.ID, err)
+		}
+		export.MovementReads = append(export.MovementReads, storage.MovementRead(read))
+	}
+
+	memberships, err := s.UserMemberships(ctx, userID)
+	if err != nil {
+		return storage.UserExport{}, err
+	}
+	export.Memberships = append(export.Memberships, memberships...)
+
+	err = eachDocument(ctx, s.authoredAnnotations(userID), func(d *firestore.DocumentSnapshot) error {
+		var doc annotationDoc
+		if err := d.DataTo(&doc); err != nil {
+			return fmt.Errorf("error parsing annotation %s: %w", d.Ref.Path, err)
+		}
+		export.Annotations = append(export.Annotations, doc.annotation())
+		return nil
+	})
+	if err != nil {
+		return storage.UserExport{}, fmt.Errorf("error getting the annotations of user %s: %w", userID, err)
+	}
+	storage.SortUserExport(export)
+	return export, nil
+}
+
+// authoredAnnotations queries the annotations written by the user, across the annotations collection group.
+func (s *Storage) authoredAnnotations(userID string) firestore.Query {
+	return s.client.CollectionGroup("annotations").Where("author_id", "==", userID)
+}
+
+// PurgeUsers removes the users deleted before a time, with the movements they read and their memberships, and
+// removes them from the annotations they wrote. A *storage.BatchError is returned when some documents were not
+// changed, keyed by their path, and their users are not returned.
+func (s *Storage) PurgeUsers(ctx context.Context, deletedBefore time.Time) ([]string, error) {
+	// the deletion times are RFC3339 strings, compared after parsing them since their time zones can differ
+	users, err := s.client.Collection("users").Where("deleted_at", ">", "").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error getting deleted users: %w", err)
+	}
+
+	bulkWriter := s.client.BulkWriter(ctx)
+	jobs := make(map[string]map[string]*firestore.BulkWriterJob)
+	for _, d := range users {
+		var user userDoc
+		if err := d.DataTo(&user); err != nil {
+			bulkWriter.End()
+			return nil, fmt.Errorf("error parsing user %s: %w", d.Ref.ID, err)
+		}
+		deletedAt, err := time.Parse(time.RFC3339, user.DeletedAt)
+		if err != nil {
+			bulkWriter.End()
+			return nil, fmt.Errorf("error parsing deletion time of user %s: %w", d.Ref.ID, err)
+		}
+		if !deletedAt.Before(deletedBefore) {
+			continue
+		}
+
+		reads, err := d.Ref.Collection("read_movements").DocumentRefs(ctx).GetAll()
+		if err != nil {
+			bulkWriter.End()
+			return nil, fmt.Errorf("error getting the movements read by user %s: %w", d.Ref.ID, err)
+		}
+		memberships, err := s.client.CollectionGroup("members").Where("user_id", "==", d.Ref.ID).Documents(ctx).GetAll()
+		if err != nil {
+			bulkWriter.End()
+			return nil, fmt.Errorf("error getting the memberships of user %s: %w", d.Ref.ID, err)
+		}
+		for _, m := range memberships {
+			reads = append(reads, m.Ref)
+		}
+		annotations, err := s.authoredAnnotations(d.Ref.ID).Documents(ctx).GetAll()
+		if err != nil {
+			bulkWriter.End()
+			return nil, fmt.Errorf("error getting the annotations of user %s: %w", d.Ref.ID, err)
+		}
+
+		userJobs := make(map[string]*firestore.BulkWriterJob)
+		for _, ref := range append(reads, d.Ref) {
+			job, err := bulkWriter.Delete(ref)
+			if err != nil {
+				bulkWriter.End()
+				return nil, fmt.Errorf("error purging user %s: %w", d.Ref.ID, err)
+			}
+			userJobs[ref.Path] = job
+		}
+		// the annotations belong to their organizations, only their author is removed
+		for _, a := range annotations {
+			job, err := bulkWriter.Update(a.Ref, []firestore.Update{{Path: "author_id", Value: ""}})
+			if err != nil {
+				bulkWriter.End()
+				return nil, fmt.Errorf("error purging user %s: %w", d.Ref.ID, err)
+			}
+			userJobs[a.Ref.Path] = job
+		}
+		jobs[d.Ref.ID] = userJobs
+	}
+	bulkWriter.End()
+
+	var purged []string
+	failures := make(map[string]error)
+	for userID, userJobs := range jobs {
+		ok := true
+		for path, job := range userJobs {
+			if _, err := job.Results(); err != nil {
+				failures[path] = err
+				ok = false
+			}
+		}
+		if ok {
+			purged = append(purged, userID)
+		}
+	}
+	sort.Strings(purged)
+	if len(failures) > 0 {
+		return purged, &storage.BatchError{Failures: failures}
+	}
+	return purged, nil
+}
+
+// AnonymizeParty replaces a name in the processes saved in the firestore database and in the ones saved later.
+// The processes, their history and their movements are updated by a bulk writer, a *storage.BatchError is
+// returned when some of them were not updated, keyed by their path. Running it again updates them.
+func (s *Storage) AnonymizeParty(ctx context.Context, name string) ([]string, error) {
+	names := []string{name}
+	_, err := s.client.Collection("anonymized_parties").Doc(storage.SubjectHash(name)).
+		Set(ctx, anonymizedPartyDoc{CreatedAt: time.Now(), SchemaVersion: anonymizedPartySchemaVersion})
+	if err != nil {
+		return nil, fmt.Errorf("error saving anonymized name: %w", err)
+	}
+
+	bulkWriter := s.client.BulkWriter(ctx)
+	jobs := make(map[string]*firestore.BulkWriterJob)
+	// changed maps the path of each changed document to its process
+	changed := make(map[string]string)
+	set := func(ref *firestore.DocumentRef, processID string, data interface{}) error {
+		job, err := bulkWriter.Set(ref, data)
+		if err != nil {
+			return fmt.Errorf("error anonymizing %s: %w", ref.Path, err)
+		}
+		jobs[ref.Path] = job
+		changed[ref.Path] = processID
+		return nil
+	}
+
+	err = eachDocument(ctx, s.client.Collection("process_basic_info").Query, func(d *firestore.DocumentSnapshot) error {
+		var doc processInfoDoc
+		if err := d.DataTo(&doc); err != nil {
+			return fmt.Errorf("error parsing process %s: %w", d.Ref.ID, err)
+		}
+		p, ok := storage.AnonymizeProcess(doc.process(), names)
+		if !ok {
+			return nil
+		}
+		doc.Claimant, doc.Defendant = p.Claimant, p.Defendant
+		if err := set(d.Ref, d.Ref.ID, doc); err != nil {
+			return err
+		}
+		p.ProcessID = d.Ref.ID
+		return set(s.client.Collection("search_index").Doc(d.Ref.ID), d.Ref.ID, searchDocOf(p, doc.OABs))
+	})
+	if err == nil {
+		err = eachDocument(ctx, s.client.CollectionGroup("history").Query, func(d *firestore.DocumentSnapshot) error {
+			var doc snapshotDoc
+			if err := d.DataTo(&doc); err != nil {
+				return fmt.Errorf("error parsing snapshot %s: %w", d.Ref.Path, err)
+			}
+			if snapshot, ok := storage.AnonymizeSnapshot(doc.snapshot(), names); ok {
+				return set(d.Ref, snapshot.ProcessID, newSnapshotDoc(snapshot))
+			}
+			return nil
+		})
+	}
+	if err == nil {
+		err = eachDocument(ctx, s.client.CollectionGroup("movements").Query, func(d *firestore.DocumentSnapshot) error {
+			var doc movementDoc
+			if err := d.DataTo(&doc); err != nil {
+				return fmt.Errorf("error parsing movement %s: %w", d.Ref.Path, err)
+			}
+			if m, ok := storage.AnonymizeMovement(doc.movement(), names); ok {
+				return set(d.Ref, m.ProcessID, newMovementDoc(m, doc.OABs))
+			}
+			return nil
+		})
+	}
+	bulkWriter.End()
+	if err != nil {
+		return nil, err
+	}
+
+	processes := make(map[string]bool)
+	failures := make(map[string]error)
+	for path, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			failures[path] = err
+		}
+		processes[changed[path]] = true
+	}
+	ids := make([]string, 0, len(processes))
+	for id := range processes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if len(failures) > 0 {
+		return ids, &storage.BatchError{Failures: failures}
+	}
+	return ids, nil
+}
+
+// SavePrivacyAudit saves an audit record in the firestore database
+func (s *Storage) SavePrivacyAudit(ctx context.Context, a storage.PrivacyAudit) error {
+	_, err := s.client.Collection("privacy_audit").Doc(a.ID).Set(ctx, privacyAuditDoc{
+		ID:            a.ID,
+		Operation:     a.Operation,
+		Subject:       a.Subject,
+		Actor:         a.Actor,
+		Records:       a.Records,
+		CreatedAt:     a.CreatedAt,
+		TraceID:       tracing.GetTraceIDFromContext(ctx),
+		SchemaVersion: privacyAuditSchemaVersion,
+	})
+	if err != nil {
+		return fmt.Errorf("error saving audit %s: %w", a.ID, err)
+	}
+	return nil
+}
+
+// PrivacyAudits returns the audit records of a subject, or all of them. They are sorted after being read, so
+// the query doesn't need a composite index.
+func (s *Storage) PrivacyAudits(ctx context.Context, subject string) ([]storage.PrivacyAudit, error) {
+	query := s.client.Collection("privacy_audit").Query
+	if subject != "" {
+		query = query.Where("subject", "==", subject)
+	}
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error getting audits: %w", err)
+	}
+
+	var audits []storage.PrivacyAudit
+	for _, d := range docs {
+		var doc privacyAuditDoc
+		if err := d.DataTo(&doc); err != nil {
+			return nil, fmt.Errorf("error parsing audit %s: %w", d.Ref.ID, err)
+		}
+		audits = append(audits, storage.PrivacyAudit{
+			ID:        doc.ID,
+			Operation: doc.Operation,
+			Subject:   doc.Subject,
+			Actor:     doc.Actor,
+			Records:   doc.Records,
+			CreatedAt: doc.CreatedAt,
+			TraceID:   doc.TraceID,
+		})
+	}
+	storage.SortPrivacyAudits(audits)
+	return audits, nil
+}
@@ -0,0 +1,143 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/perebaj/esaj/storage"
+)
+
+// paginate orders the query by the field and by the document ID, that is the process ID, and starts it after
+// the cursor. One more document than the page size is read, to know if there is a next page.
+// The queries with filters and orders need composite indexes, firestore returns the link to create them in the
+// error of the first query.
+func paginate(q firestore.Query, field string, after *storage.Cursor, desc bool, size int) firestore.Query {
+	dir := firestore.Asc
+	if desc {
+		dir = firestore.Desc
+	}
+
+	var values []interface{}
+	if field != "" {
+		q = q.OrderBy(field, dir)
+		if after != nil && after.Order == storage.OrderUpdatedAt {
+			values = append(values, after.UpdatedAt)
+		} else if after != nil {
+			values = append(values, after.Value)
+		}
+	}
+
+	q = q.OrderBy(firestore.DocumentID, dir)
+	if after != nil {
+		q = q.StartAfter(append(values, after.ProcessID)...)
+	}
+	return q.Limit(size + 1)
+}
+
+// QuerySeeds returns a page of the seeds of an OAB
+func (s *Storage) QuerySeeds(ctx context.Context, q storage.SeedQuery) (storage.SeedPage, error) {
+	after, err := q.Normalize()
+	if err != nil {
+		return storage.SeedPage{}, err
+	}
+
+	// the seeds are ordered by their document ID, of the process and the OAB, the order of their process IDs in
+	// the seeds of an OAB
+	if after != nil {
+		c := *after
+		c.ProcessID = storage.SeedID(after.ProcessID, q.OAB)
+		after = &c
+	}
+	query := s.client.Collection("process_seeds").Where("oab", "in", oabValues(q.OAB))
+	if q.Status != "" {
+		query = query.Where("status", "==", q.Status)
+	}
+	field := ""
+	if q.OrderBy == storage.OrderUpdatedAt {
+		field = "updated_at"
+	}
+
+	docs, err := paginate(query, field, after, q.Desc, q.PageSize).Documents(ctx).GetAll()
+	if err != nil {
+		return storage.SeedPage{}, fmt.Errorf("error querying seeds of oab %s: %w", q.OAB, err)
+	}
+
+	more := len(docs) > q.PageSize
+	if more {
+		docs = docs[:q.PageSize]
+	}
+
+	var page storage.SeedPage
+	for _, d := range docs {
+		seed, err := seedFromDoc(d)
+		if err != nil {
+			skipSeed(ctx, d, err)
+			continue
+		}
+		page.Seeds = append(page.Seeds, seed)
+	}
+
+	// the cursor points to the last document read, even when it's an invalid seed that was skipped
+	if more {
+		last := docs[len(docs)-1]
+		processID, ok := last.Data()["process_id"].(string)
+		if !ok {
+			processID = last.Ref.ID
+		}
+		updatedAt, _ := last.Data()["updated_at"].(time.Time)
+		page.NextCursor = q.CursorOf(storage.ProcessSeed{ProcessID: processID, UpdatedAt: updatedAt}).String()
+	}
+	return page, nil
+}
+
+// QueryProcesses returns a page of the processes of an OAB that match the filters of the query
+func (s *Storage) QueryProcesses(ctx context.Context, q storage.ProcessQuery) (storage.ProcessPage, error) {
+	after, err := q.Normalize()
+	if err != nil {
+		return storage.ProcessPage{}, err
+	}
+
+	query := s.client.Collection("process_basic_info").Where("oabs", "array-contains-any", oabValues(q.OAB))
+	for _, filter := range []struct{ field, value string }{
+		{"foro_code", q.Foro},
+		{"class", q.Class},
+		{"situation", q.Situation},
+	} {
+		if filter.value != "" {
+			query = query.Where(filter.field, "==", filter.value)
+		}
+	}
+	field := map[storage.Order]string{
+		storage.OrderUpdatedAt: "updated_at",
+		storage.OrderClass:     "class",
+		storage.OrderForo:      "foro_code",
+	}[q.OrderBy]
+
+	docs, err := paginate(query, field, after, q.Desc, q.PageSize).Documents(ctx).GetAll()
+	if err != nil {
+		return storage.ProcessPage{}, fmt.Errorf("error querying processes of oab %s: %w", q.OAB, err)
+	}
+
+	var (
+		page storage.ProcessPage
+		last processInfoDoc
+	)
+	for i, d := range docs {
+		if i == q.PageSize {
+			page.NextCursor = q.CursorOf(last.process(), last.UpdatedAt).String()
+			break
+		}
+
+		var doc processInfoDoc
+		if err := d.DataTo(&doc); err != nil {
+			return storage.ProcessPage{}, fmt.Errorf("error parsing process %s: %w", d.Ref.ID, err)
+		}
+		last = doc
+		p := doc.process()
+		p.OAB = q.OAB
+		page.Processes = append(page.Processes, p)
+	}
+	return page, nil
+}
@@ -0,0 +1,131 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/tracing"
+)
+
+// ReconcileSeeds marks the seeds of an OAB that were not found as removed, and takes the OAB out of the
+// processes that were not found. The seeds are updated by a bulk writer and each process by its own
+// transaction, a *storage.BatchError is returned when some of them were not updated, keyed by the ID of the
+// seed or of the process. Running it again updates them.
+func (s *Storage) ReconcileSeeds(ctx context.Context, oab esaj.OAB, found []esaj.ProcessSeed) ([]string, error) {
+	traceID := tracing.GetTraceIDFromContext(ctx)
+	isFound := make(map[string]bool, len(found))
+	for _, seed := range found {
+		isFound[seed.ProcessID] = true
+	}
+
+	seeds, err := s.client.Collection("process_seeds").Where("oab", "in", oabValues(oab)).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error getting seeds of oab %s: %w", oab, err)
+	}
+	processes, err := s.client.Collection("process_basic_info").Where("oabs", "array-contains-any", oabValues(oab)).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error getting processes of oab %s: %w", oab, err)
+	}
+
+	now := time.Now()
+	bulkWriter := s.client.BulkWriter(ctx)
+	jobs := make(map[string]*firestore.BulkWriterJob)
+	// processOf maps the ID of each removed seed to its process
+	processOf := make(map[string]string)
+	for _, d := range seeds {
+		seed, err := seedFromDoc(d)
+		if err != nil {
+			skipSeed(ctx, d, err)
+			continue
+		}
+		if !seed.RemovedAt.IsZero() || isFound[seed.ProcessID] {
+			continue
+		}
+		job, err := bulkWriter.Update(d.Ref, []firestore.Update{
+			{Path: "removed_at", Value: now},
+			{Path: "updated_at", Value: now},
+		})
+		if err != nil {
+			bulkWriter.End()
+			return nil, fmt.Errorf("error removing seed %s: %w", d.Ref.ID, err)
+		}
+		jobs[d.Ref.ID] = job
+		processOf[d.Ref.ID] = seed.ProcessID
+	}
+	bulkWriter.End()
+
+	removed := make(map[string]bool)
+	failures := make(map[string]error)
+	for id, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			failures[id] = err
+			continue
+		}
+		removed[processOf[id]] = true
+	}
+
+	for _, d := range processes {
+		if isFound[d.Ref.ID] {
+			continue
+		}
+		if err := s.removeProcessOAB(ctx, d.Ref, oab, now, traceID); err != nil {
+			failures[d.Ref.ID] = err
+			continue
+		}
+		removed[d.Ref.ID] = true
+	}
+
+	ids := make([]string, 0, len(removed))
+	for id := range removed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if len(failures) > 0 {
+		return ids, &storage.BatchError{Failures: failures}
+	}
+	return ids, nil
+}
+
+// removeProcessOAB takes the OAB out of the process, adding the change to its history and indexing it again.
+// It's a transaction, so an OAB added by a concurrent SaveProcessBasicInfo is not lost.
+func (s *Storage) removeProcessOAB(ctx context.Context, ref *firestore.DocumentRef, oab esaj.OAB, now time.Time,
+	traceID string) error {
+	return s.client.RunTransaction(ctx, func(_ context.Context, tx *firestore.Transaction) error {
+		d, err := tx.Get(ref)
+		if err != nil {
+			return fmt.Errorf("error getting process %s: %w", ref.ID, err)
+		}
+		var doc processInfoDoc
+		if err := d.DataTo(&doc); err != nil {
+			return fmt.Errorf("error parsing process %s: %w", ref.ID, err)
+		}
+		values := oabValues(oab)
+		oabs := slices.DeleteFunc(slices.Clone(doc.OABs), func(o string) bool {
+			return slices.Contains(values, o)
+		})
+		if len(oabs) == len(doc.OABs) {
+			return nil
+		}
+
+		if err := tx.Update(ref, []firestore.Update{{Path: "oabs", Value: oabs}}); err != nil {
+			return fmt.Errorf("error removing oab of process %s: %w", ref.ID, err)
+		}
+		p := doc.process()
+		p.ProcessID = ref.ID
+		if err := tx.Set(s.client.Collection("search_index").Doc(ref.ID), searchDocOf(p, oabs)); err != nil {
+			return fmt.Errorf("error saving search document of process %s: %w", ref.ID, err)
+		}
+		snapshot := storage.NewOABRemovedSnapshot(p, oab, now, traceID)
+		if err := tx.Set(ref.Collection("history").Doc(snapshot.ID), newSnapshotDoc(snapshot)); err != nil {
+			return fmt.Errorf("error saving snapshot of process %s: %w", ref.ID, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,162 @@
+package firestore
+
+import (
+	"slices"
+	"time"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/storage"
+)
+
+// The schema versions of the documents written by the storage. A document with a lower version, or without the
+// schema_version field, is changed to the current version by the migrations of its collection.
+const (
+	seedSchemaVersion     = 3
+	processSchemaVersion  = 2
+	userSchemaVersion     = 1
+	snapshotSchemaVersion = 1
+	movementSchemaVersion = 1
+	documentSchemaVersion = 1
+	searchSchemaVersion   = 1
+
+	privacyAuditSchemaVersion    = 1
+	anonymizedPartySchemaVersion = 1
+	organizationSchemaVersion    = 1
+	memberSchemaVersion          = 1
+	annotationSchemaVersion      = 1
+	accessEventSchemaVersion     = 1
+)
+
+// seedDoc is the struct that represents the process seed in the process_seeds collection
+type seedDoc struct {
+	ProcessID     string    `firestore:"process_id"`
+	OAB           string    `firestore:"oab"`
+	URL           string    `firestore:"url"`
+	TraceID       string    `firestore:"trace_id"`
+	Status        string    `firestore:"status"`
+	IngestedAt    time.Time `firestore:"ingested_at,omitempty"`
+	UpdatedAt     time.Time `firestore:"updated_at"`
+	RemovedAt     time.Time `firestore:"removed_at,omitempty"`
+	SchemaVersion int       `firestore:"schema_version"`
+}
+
+// processInfoDoc is the struct that represents the process in the process_basic_info collection
+type processInfoDoc struct {
+	ProcessID   string `firestore:"process_id"`
+	ProcessForo string `firestore:"foro_code"`
+	ForoName    string `firestore:"foro_name"`
+	ProcessCode string `firestore:"process_code"`
+	Judge       string `firestore:"judge"`
+	Class       string `firestore:"class"`
+	Subject     string `firestore:"subject"`
+	Claimant    string `firestore:"claimant"`
+	Defendant   string `firestore:"defendant"`
+	Vara        string `firestore:"vara"`
+	URL         string `firestore:"url"`
+	Situation   string `firestore:"situation"`
+	// OABs are the OABs that found the process, in their canonical format.
+	OABs          []string  `firestore:"oabs"`
+	TraceID       string    `firestore:"trace_id"`
+	UpdatedAt     time.Time `firestore:"updated_at"`
+	SchemaVersion int       `firestore:"schema_version"`
+}
+
+func newProcessInfoDoc(p esaj.ProcessBasicInfo, oabs []string, traceID string, updatedAt time.Time) processInfoDoc {
+	return processInfoDoc{
+		ProcessID:     p.ProcessID,
+		ProcessForo:   p.ProcessForo,
+		ForoName:      p.ForoName,
+		ProcessCode:   p.ProcessCode,
+		Judge:         p.Judge,
+		Class:         p.Class,
+		Subject:       p.Subject,
+		Claimant:      p.Claimant,
+		Defendant:     p.Defendant,
+		Vara:          p.Vara,
+		URL:           p.URL,
+		Situation:     p.Situation,
+		OABs:          oabs,
+		TraceID:       traceID,
+		UpdatedAt:     updatedAt,
+		SchemaVersion: processSchemaVersion,
+	}
+}
+
+// canonicalOABs returns the OABs of the process in their canonical format, without the repeated ones. The OABs
+// saved by the previous versions, not migrated yet, are normalized.
+func (d processInfoDoc) canonicalOABs() []string {
+	oabs := []string{}
+	for _, o := range d.OABs {
+		if canonical, err := canonicalOAB(o); err == nil {
+			o = canonical
+		}
+		if !slices.Contains(oabs, o) {
+			oabs = append(oabs, o)
+		}
+	}
+	return oabs
+}
+
+// process returns the process without its OAB, since a process can be found by many OABs.
+func (d processInfoDoc) process() esaj.ProcessBasicInfo {
+	return esaj.ProcessBasicInfo{
+		ProcessID:   d.ProcessID,
+		ProcessForo: d.ProcessForo,
+		ForoName:    d.ForoName,
+		ProcessCode: d.ProcessCode,
+		Judge:       d.Judge,
+		Class:       d.Class,
+		Subject:     d.Subject,
+		Claimant:    d.Claimant,
+		Defendant:   d.Defendant,
+		Vara:        d.Vara,
+		URL:         d.URL,
+		Situation:   d.Situation,
+	}
+}
+
+// userDoc is the struct that represents the user in the users collection
+type userDoc struct {
+	ID             string `firestore:"id"`
+	FirstName      string `firestore:"first_name"`
+	LastName       string `firestore:"last_name"`
+	EmailAddresses []any  `firestore:"email_addresses"`
+	ImageURL       string `firestore:"image_url"`
+	Birthday       string `firestore:"birthday"`
+	CreatedAt      string `firestore:"created_at"`
+	UpdatedAt      string `firestore:"updated_at"`
+	DeletedAt      string `firestore:"deleted_at,omitempty"`
+	TraceID        string `firestore:"trace_id"`
+	SchemaVersion  int    `firestore:"schema_version"`
+}
+
+func newUserDoc(u storage.User) userDoc {
+	return userDoc{
+		ID:             u.ID,
+		FirstName:      u.FirstName,
+		LastName:       u.LastName,
+		EmailAddresses: u.EmailAddresses,
+		ImageURL:       u.ImageURL,
+		Birthday:       u.Birthday,
+		CreatedAt:      u.CreatedAt,
+		UpdatedAt:      u.UpdatedAt,
+		DeletedAt:      u.DeletedAt,
+		TraceID:        u.TraceID,
+		SchemaVersion:  userSchemaVersion,
+	}
+}
+
+func (d userDoc) user() storage.User {
+	return storage.User{
+		ID:             d.ID,
+		FirstName:      d.FirstName,
+		LastName:       d.LastName,
+		EmailAddresses: d.EmailAddresses,
+		ImageURL:       d.ImageURL,
+		Birthday:       d.Birthday,
+		CreatedAt:      d.CreatedAt,
+		UpdatedAt:      d.UpdatedAt,
+		DeletedAt:      d.DeletedAt,
+		TraceID:        d.TraceID,
+	}
+}
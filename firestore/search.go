@@ -0,0 +1,212 @@
+package firestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/firestore"
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/search"
+	"github.com/perebaj/esaj/storage"
+	"google.golang.org/api/iterator"
+)
+
+// searchDoc is the struct that represents the search document of a process in the search_index collection,
+// whose document ID is the process ID.
+type searchDoc struct {
+	ProcessID string `firestore:"process_id"`
+	// OABs are the canonical OABs of the process, the searches filter them with array-contains-any.
+	OABs          []string            `firestore:"oabs"`
+	Terms         map[string][]string `firestore:"terms"`
+	SchemaVersion int                 `firestore:"schema_version"`
+}
+
+func newSearchDoc(doc search.Document) searchDoc {
+	d := searchDoc{
+		ProcessID:     doc.ProcessID,
+		OABs:          make([]string, 0, len(doc.OABs)),
+		Terms:         make(map[string][]string, len(doc.Terms)),
+		SchemaVersion: searchSchemaVersion,
+	}
+	for _, oab := range doc.OABs {
+		d.OABs = append(d.OABs, oab.String())
+	}
+	for term, fields := range doc.Terms {
+		for _, f := range fields {
+			d.Terms[term] = append(d.Terms[term], string(f))
+		}
+	}
+	return d
+}
+
+func (d searchDoc) document() search.Document {
+	doc := search.Document{
+		ProcessID: d.ProcessID,
+		OABs:      parseOABs(d.OABs),
+		Terms:     make(map[string][]search.Field, len(d.Terms)),
+	}
+	for term, fields := range d.Terms {
+		for _, f := range fields {
+			doc.Terms[term] = append(doc.Terms[term], search.Field(f))
+		}
+	}
+	return doc
+}
+
+// searchDocOf returns the search document of a process saved with the OABs.
+func searchDocOf(p esaj.ProcessBasicInfo, oabs []string) searchDoc {
+	return newSearchDoc(search.NewDocument(p, parseOABs(oabs)))
+}
+
+// parseOABs parses the canonical OABs saved in the documents. The invalid ones, only written by versions
+// older than the migrations, are skipped.
+func parseOABs(raw []string) []esaj.OAB {
+	oabs := make([]esaj.OAB, 0, len(raw))
+	for _, r := range raw {
+		if oab, err := esaj.ParseOAB(r); err == nil {
+			oabs = append(oabs, oab)
+		}
+	}
+	return oabs
+}
+
+// SearchProcesses returns the processes of the OABs of a query that match its text, the best ranked first.
+// The search documents of the OABs are read and ranked by the search package, since Firestore has no
+// full-text search.
+func (s *Storage) SearchProcesses(ctx context.Context, q search.Query) ([]search.Result, error) {
+	terms, err := q.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	oabs := make([]string, 0, len(q.OABs))
+	for _, oab := range q.OABs {
+		oabs = append(oabs, oab.String())
+	}
+	snapshots, err := s.client.Collection("search_index").Where("oabs", "array-contains-any", oabs).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error querying search index: %w", err)
+	}
+
+	docs := make(map[string]search.Document, len(snapshots))
+	ranked := make([]search.Document, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		var d searchDoc
+		if err := snapshot.DataTo(&d); err != nil {
+			return nil, fmt.Errorf("error parsing search document %s: %w", snapshot.Ref.ID, err)
+		}
+		doc := d.document()
+		docs[doc.ProcessID] = doc
+		ranked = append(ranked, doc)
+	}
+
+	results := search.Rank(ranked, terms, q.Limit)
+	if len(results) == 0 {
+		return results, nil
+	}
+
+	refs := make([]*firestore.DocumentRef, 0, len(results))
+	for _, r := range results {
+		refs = append(refs, s.client.Collection("process_basic_info").Doc(r.Process.ProcessID))
+	}
+	processes, err := s.client.GetAll(ctx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("error getting searched processes: %w", err)
+	}
+
+	// GetAll returns the documents in the order of the refs
+	for i, d := range processes {
+		var p processInfoDoc
+		if d.Exists() {
+			if err := d.DataTo(&p); err != nil {
+				return nil, fmt.Errorf("error parsing process %s: %w", d.Ref.ID, err)
+			}
+		}
+		info := p.process()
+		info.ProcessID = results[i].Process.ProcessID
+		info.OAB = q.ScopeOAB(docs[info.ProcessID])
+		results[i].Process = info
+	}
+	return results, nil
+}
+
+// RebuildSearchIndex writes the search document of each process in the process_basic_info collection, and
+// deletes the search documents of the processes that don't exist anymore. A *storage.BatchError is returned
+// when some documents were not written, keyed by process ID.
+func (s *Storage) RebuildSearchIndex(ctx context.Context) (int, error) {
+	bulkWriter := s.client.BulkWriter(ctx)
+	// the jobs of the indexed processes and of the deleted search documents, by process ID
+	jobs := make(map[string]*firestore.BulkWriterJob)
+	deletes := make(map[string]*firestore.BulkWriterJob)
+
+	err := eachDocument(ctx, s.client.Collection("process_basic_info").Query, func(d *firestore.DocumentSnapshot) error {
+		var p processInfoDoc
+		if err := d.DataTo(&p); err != nil {
+			return fmt.Errorf("error parsing process %s: %w", d.Ref.ID, err)
+		}
+		info := p.process()
+		info.ProcessID = d.Ref.ID
+		job, err := bulkWriter.Set(s.client.Collection("search_index").Doc(d.Ref.ID), searchDocOf(info, p.OABs))
+		if err != nil {
+			return fmt.Errorf("error indexing process %s: %w", d.Ref.ID, err)
+		}
+		jobs[d.Ref.ID] = job
+		return nil
+	})
+	if err == nil {
+		err = eachDocument(ctx, s.client.Collection("search_index").Query, func(d *firestore.DocumentSnapshot) error {
+			if _, ok := jobs[d.Ref.ID]; ok {
+				return nil
+			}
+			job, err := bulkWriter.Delete(d.Ref)
+			if err != nil {
+				return fmt.Errorf("error deleting search document %s: %w", d.Ref.ID, err)
+			}
+			deletes[d.Ref.ID] = job
+			return nil
+		})
+	}
+	bulkWriter.End()
+	if err != nil {
+		return 0, err
+	}
+
+	var indexed int
+	failures := make(map[string]error)
+	for processID, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			failures[processID] = err
+		} else {
+			indexed++
+		}
+	}
+	for processID, job := range deletes {
+		if _, err := job.Results(); err != nil {
+			failures[processID] = err
+		}
+	}
+	if len(failures) > 0 {
+		return indexed, &storage.BatchError{Failures: failures}
+	}
+	return indexed, nil
+}
+
+// eachDocument calls fn with each document of the query, stopping at the first error.
+func eachDocument(ctx context.Context, q firestore.Query, fn func(d *firestore.DocumentSnapshot) error) error {
+	iter := q.Documents(ctx)
+	defer iter.Stop()
+	for {
+		d, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading documents: %w", err)
+		}
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+}
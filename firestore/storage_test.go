@@ -0,0 +1,28 @@
+//go:build integration
+
+package firestore_test
+
+import (
+	"context"
+	"testing"
+
+	fs "cloud.google.com/go/firestore"
+	"github.com/perebaj/esaj/firestore"
+	esajstorage "github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) esajstorage.Storage {
+		c, err := fs.NewClient(context.TODO(), projectID)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			cleanup(t, c)
+		})
+		// the emulator is shared by all tests, so it must start empty
+		cleanup(t, c)
+
+		return firestore.NewStorage(c, projectID)
+	})
+}
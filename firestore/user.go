@@ -8,6 +8,7 @@ import (
 
 	"cloud.google.com/go/firestore"
 	"github.com/perebaj/esaj/clerk"
+	"github.com/perebaj/esaj/storage"
 	"github.com/perebaj/esaj/tracing"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -18,20 +19,8 @@ func (s *Storage) SaveUser(ctx context.Context, event clerk.WebHookEvent) error
 	traceID := tracing.GetTraceIDFromContext(ctx)
 	collection := s.client.Collection("users")
 	docRef := collection.Doc(event.Data.ID)
-	m := make(map[string]interface{})
 
-	m["id"] = event.Data.ID
-	m["first_name"] = event.Data.FirstName
-	m["last_name"] = event.Data.LastName
-	m["email_addresses"] = event.Data.EmailAddresses
-	m["image_url"] = event.Data.ImageURL
-	m["birthday"] = event.Data.Birthday
-	// Date is received in unix timestamp in milliseconds and must be converted to RFC3339
-	m["created_at"] = time.Unix(0, event.Data.CreatedAt*int64(time.Millisecond)).Format(time.RFC3339)
-	m["updated_at"] = time.Unix(0, event.Data.UpdatedAt*int64(time.Millisecond)).Format(time.RFC3339)
-	m["trace_id"] = traceID
-
-	_, err := docRef.Set(ctx, m)
+	_, err := docRef.Set(ctx, newUserDoc(storage.NewUser(event, traceID)))
 
 	return err
 }
@@ -51,27 +40,16 @@ func (s *Storage) DeleteUser(ctx context.Context, event clerk.WebHookEvent) erro
 			Value: time.Now().Format(time.RFC3339),
 		},
 	})
+	if status.Code(err) == codes.NotFound {
+		return fmt.Errorf("error deleting user %s: %w", event.Data.ID, storage.ErrNotFound)
+	}
 
 	return err
 }
 
-// User is the struct that represents the user in the firestore database
-type User struct {
-	ID             string `firestore:"id"`
-	FirstName      string `firestore:"first_name"`
-	LastName       string `firestore:"last_name"`
-	EmailAddresses []any  `firestore:"email_addresses"`
-	ImageURL       string `firestore:"image_url"`
-	Birthday       string `firestore:"birthday"`
-	CreatedAt      string `firestore:"created_at"`
-	UpdatedAt      string `firestore:"updated_at"`
-	DeletedAt      string `firestore:"deleted_at"`
-	TraceID        string `firestore:"trace_id"`
-}
-
 // GetUser get a user from the firestore database
 // If the user does not exist, it will return an empty user and a nil error.
-func (s *Storage) GetUser(ctx context.Context, userID string) (User, error) {
+func (s *Storage) GetUser(ctx context.Context, userID string) (storage.User, error) {
 	traceID := tracing.GetTraceIDFromContext(ctx)
 	slog.Info(fmt.Sprintf("getting user %s", userID), "traceID", traceID, "user_id", userID)
 	collection := s.client.Collection("users")
@@ -79,18 +57,18 @@ func (s *Storage) GetUser(ctx context.Context, userID string) (User, error) {
 
 	doc, err := docRef.Get(ctx)
 	if status.Code(err) == codes.NotFound {
-		return User{}, nil
+		return storage.User{}, nil
 	}
 
 	if err != nil {
-		return User{}, fmt.Errorf("error getting user %s: %w", userID, err)
+		return storage.User{}, fmt.Errorf("error getting user %s: %w", userID, err)
 	}
 
-	var user User
-	err = doc.DataTo(&user)
+	var u userDoc
+	err = doc.DataTo(&u)
 	if err != nil {
-		return User{}, fmt.Errorf("error parsing user data: %w", err)
+		return storage.User{}, fmt.Errorf("error parsing user data: %w", err)
 	}
 
-	return user, nil
+	return u.user(), nil
 }
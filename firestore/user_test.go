@@ -9,6 +9,7 @@ import (
 	fs "cloud.google.com/go/firestore"
 	"github.com/perebaj/esaj/clerk"
 	"github.com/perebaj/esaj/firestore"
+	esajstorage "github.com/perebaj/esaj/storage"
 	"github.com/perebaj/esaj/tracing"
 	"github.com/stretchr/testify/require"
 )
@@ -186,5 +187,5 @@ func TestStorage_GetUser(t *testing.T) {
 	user, err = storage.GetUser(ctx, "non-exitent")
 	require.NoError(t, err)
 
-	require.Equal(t, firestore.User{}, user)
+	require.Equal(t, esajstorage.User{}, user)
 }
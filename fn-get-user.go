@@ -41,7 +41,7 @@ func init() {
 	storage := firestore.NewStorage(fsClient, projectID)
 	slog.Info("storage initialized")
 
-	handler := api.NewUserHandler(storage)
+	handler := api.NewUserHandler(storage, os.Getenv("ESAJ_CLERK_WEBHOOK_SECRET"), os.Getenv("ESAJ_ADMIN_TOKEN"))
 	// GET /?user_id=123456
 	// Expected response: 200 OK with the user data
 	// If the user does not exist, it will return a 404 status code
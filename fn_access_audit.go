@@ -0,0 +1,81 @@
+// The endpoints of the access log of the process data: a page of the events, and the export of all of them. The
+// admins of the platform read all the events with the ESAJ_ADMIN_TOKEN as a bearer token, and the owners and the
+// admins of an organization read the events of their organization, identified by the gateway.
+
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	fs "cloud.google.com/go/firestore"
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/perebaj/esaj/api"
+	"github.com/perebaj/esaj/audit"
+	"github.com/perebaj/esaj/firestore"
+	"github.com/perebaj/esaj/logger"
+	"github.com/perebaj/esaj/storage"
+)
+
+var (
+	recorderOnce sync.Once
+	recorder     *audit.Recorder
+)
+
+// accessRecorder returns the recorder of the accesses to process data, shared by the functions since all of them
+// are initialized in each instance. The instances are stopped with a SIGTERM, that writes the buffered events
+// before exiting.
+func accessRecorder(s storage.AuditRepository) *audit.Recorder {
+	recorderOnce.Do(func() {
+		recorder = audit.NewRecorder(s, audit.DefaultBuffer)
+		go func() {
+			sig := make(chan os.Signal, 1)
+			signal.Notify(sig, syscall.SIGTERM)
+			<-sig
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := recorder.Close(ctx); err != nil {
+				slog.Error("error writing the buffered access events", "error", err)
+			}
+			os.Exit(0)
+		}()
+	})
+	return recorder
+}
+
+func init() {
+	logger, err := logger.NewLoggerSlog(logger.ConfigLogger{
+		Level:  logger.LevelInfo,
+		Format: logger.FormatGCP,
+	})
+
+	if err != nil {
+		slog.Error("error initializing logger", "error", err)
+		os.Exit(1)
+	}
+
+	slog.SetDefault(logger)
+
+	projectID := "blup-432616"
+	databaseName := "blup-db"
+	fsClient, err := fs.NewClientWithDatabase(context.Background(), projectID, databaseName)
+	if err != nil {
+		slog.Error("error initializing firestore client", "error", err)
+		os.Exit(1)
+	}
+
+	storage := firestore.NewStorage(fsClient, projectID)
+	slog.Info("storage initialized")
+
+	handler := api.NewAuditHandler(storage, os.Getenv("ESAJ_ADMIN_TOKEN"))
+	// GET /?resource=oab:123456/SP&since=2024-08-01T00:00:00Z&page_size=100
+	functions.HTTP("fn-access-events", handler.AccessEventsHandler)
+	// GET /?since=2024-08-01T00:00:00Z&until=2024-09-01T00:00:00Z, one JSON event per line
+	functions.HTTP("fn-access-events-export", handler.AccessExportHandler)
+}
@@ -38,6 +38,6 @@ func init() {
 	storage := firestore.NewStorage(fsClient, projectID)
 	slog.Info("storage initialized")
 
-	handler := api.NewUserHandler(storage)
+	handler := api.NewUserHandler(storage, os.Getenv("ESAJ_CLERK_WEBHOOK_SECRET"), os.Getenv("ESAJ_ADMIN_TOKEN"))
 	functions.HTTP("fn-clerk-webhook", handler.ClerkWebHookHandler)
 }
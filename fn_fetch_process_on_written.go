@@ -17,6 +17,8 @@ import (
 	"github.com/perebaj/esaj/esaj"
 	"github.com/perebaj/esaj/firestore"
 	"github.com/perebaj/esaj/logger"
+	"github.com/perebaj/esaj/metrics"
+	esajstorage "github.com/perebaj/esaj/storage"
 	"github.com/perebaj/esaj/tracing"
 	"google.golang.org/protobuf/proto"
 )
@@ -45,6 +47,12 @@ func Parser(_ context.Context, event event.Event) error {
 		return fmt.Errorf("error unmarshalling data. Data received: %v. error: %w", data.Value, err)
 	}
 
+	// a deleted seed, like the ones moved to the key of their process and OAB by the migrate command
+	if data.GetValue() == nil {
+		slog.Info("seed deleted, skipping", "seed", data.GetOldValue().GetName())
+		return nil
+	}
+
 	doc := data.GetValue().GetFields()
 
 	processID := doc["process_id"].GetStringValue()
@@ -56,11 +64,29 @@ func Parser(_ context.Context, event event.Event) error {
 
 	logger := slog.With("trace_id", traceID)
 
+	// saving the process marks its seed as ingested, which triggers this function again.
+	if doc["status"].GetStringValue() == esajstorage.SeedIngested {
+		logger.Info("seed already ingested, skipping", "process_id", processID)
+		return nil
+	}
+
+	// a seed that is not found by the search of its OAB anymore is marked as removed, which also triggers it.
+	if doc["removed_at"].GetTimestampValue() != nil {
+		logger.Info("seed removed, skipping", "process_id", processID)
+		return nil
+	}
+
 	ctx := context.Background()
 	ctx = tracing.SetTraceIDInContext(ctx, traceID)
 
 	u := doc["url"].GetStringValue()
 
+	parsedOAB, err := esaj.ParseOAB(oab)
+	if err != nil {
+		logger.Error("error parsing oab", "error", err, "oab", oab)
+		return fmt.Errorf("error parsing oab. error: %w", err)
+	}
+
 	projectID := "blup-432616"
 	databaseName := "blup-db"
 
@@ -73,15 +99,26 @@ func Parser(_ context.Context, event event.Event) error {
 
 	// This request doesn't require cookies to access information
 	esajClient := esaj.New(esaj.Config{}, &http.Client{
-		Timeout: 90 * time.Second,
+		Timeout:   90 * time.Second,
+		Transport: metrics.Transport(nil),
 	})
 
-	pBasicInfo, err := esajClient.FetchBasicProcessInfo(ctx, u, processID)
+	pBasicInfo, movements, err := esajClient.FetchProcess(ctx, u, processID)
 	if err != nil {
 		logger.Error("error fetching basic process info", "error", err)
 		return fmt.Errorf("error fetching basic process info. error: %w", err)
 	}
 
+	// the movements are saved before the process, that marks the seed as ingested, so a failure leaves the seed
+	// pending. The OAB of the seed is copied to the movements when the process is saved.
+	created, err := storage.SaveMovements(ctx, processID, movements)
+	if err != nil {
+		logger.Error("error saving movements", "error", err)
+		return fmt.Errorf("error saving movements. error: %w", err)
+	}
+	logger.Info("movements saved", "process_id", processID, "movements", len(movements), "created", len(created))
+
+	pBasicInfo.OAB = parsedOAB
 	err = storage.SaveProcessBasicInfo(ctx, *pBasicInfo)
 	if err != nil {
 		logger.Error("error saving basic process info", "error", err)
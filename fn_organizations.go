@@ -0,0 +1,56 @@
+// The endpoints of the organizations (law firms): their creation and OABs, that require the ESAJ_ADMIN_TOKEN as a
+// bearer token, and the memberships, members and private annotations of the caller, identified by the gateway.
+
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	fs "cloud.google.com/go/firestore"
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/perebaj/esaj/api"
+	"github.com/perebaj/esaj/firestore"
+	"github.com/perebaj/esaj/logger"
+)
+
+func init() {
+	logger, err := logger.NewLoggerSlog(logger.ConfigLogger{
+		Level:  logger.LevelInfo,
+		Format: logger.FormatGCP,
+	})
+
+	if err != nil {
+		slog.Error("error initializing logger", "error", err)
+		os.Exit(1)
+	}
+
+	slog.SetDefault(logger)
+
+	projectID := "blup-432616"
+	databaseName := "blup-db"
+	fsClient, err := fs.NewClientWithDatabase(context.Background(), projectID, databaseName)
+	if err != nil {
+		slog.Error("error initializing firestore client", "error", err)
+		os.Exit(1)
+	}
+
+	storage := firestore.NewStorage(fsClient, projectID)
+	slog.Info("storage initialized")
+
+	// An empty token rejects the admin requests, so fn-organizations is closed when it's not configured
+	handler := api.NewOrganizationHandler(storage, os.Getenv("ESAJ_ADMIN_TOKEN"), accessRecorder(storage))
+	// POST / {"name": "Silva Advogados", "oabs": ["123456/SP"], "owner_id": "user_123"}
+	// PUT /?id=abc {"name": "Silva Advogados", "oabs": ["123456/SP", "654321/RJ"]}
+	functions.HTTP("fn-organizations", handler.OrganizationsHandler)
+	// GET /
+	functions.HTTP("fn-memberships", handler.MembershipsHandler)
+	// GET /
+	functions.HTTP("fn-organization", handler.CurrentOrganizationHandler)
+	// PUT / {"user_id": "user_456", "role": "admin"} and DELETE /?user_id=user_456
+	functions.HTTP("fn-organization-members", handler.MembersHandler)
+	// GET /?process_id=123, POST / {"process_id": "123", "text": "..."}, PUT / {"id": "abc", "text": "..."} and
+	// DELETE /?id=abc
+	functions.HTTP("fn-annotations", handler.AnnotationsHandler)
+}
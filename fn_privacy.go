@@ -0,0 +1,54 @@
+// The admin endpoints of the LGPD operations: the export of a user, the purge of the deleted users, the
+// anonymization of a party and the audit of these operations. They require the ESAJ_ADMIN_TOKEN as a bearer token.
+
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	fs "cloud.google.com/go/firestore"
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/perebaj/esaj/api"
+	"github.com/perebaj/esaj/firestore"
+	"github.com/perebaj/esaj/lgpd"
+	"github.com/perebaj/esaj/logger"
+)
+
+func init() {
+	logger, err := logger.NewLoggerSlog(logger.ConfigLogger{
+		Level:  logger.LevelInfo,
+		Format: logger.FormatGCP,
+	})
+
+	if err != nil {
+		slog.Error("error initializing logger", "error", err)
+		os.Exit(1)
+	}
+
+	slog.SetDefault(logger)
+
+	projectID := "blup-432616"
+	databaseName := "blup-db"
+	fsClient, err := fs.NewClientWithDatabase(context.Background(), projectID, databaseName)
+	if err != nil {
+		slog.Error("error initializing firestore client", "error", err)
+		os.Exit(1)
+	}
+
+	storage := firestore.NewStorage(fsClient, projectID)
+	slog.Info("storage initialized")
+
+	// An empty token rejects all requests, so the endpoints are closed when it's not configured
+	handler := api.NewPrivacyHandler(lgpd.NewService(storage), os.Getenv("ESAJ_ADMIN_TOKEN"),
+		accessRecorder(storage))
+	// GET /?user_id=123&actor=dpo@example.com
+	functions.HTTP("fn-privacy-export", handler.ExportUserHandler)
+	// POST /?grace_period=720h&actor=dpo@example.com
+	functions.HTTP("fn-privacy-purge", handler.PurgeUsersHandler)
+	// POST / {"name": "José da Silva", "actor": "dpo@example.com"}
+	functions.HTTP("fn-privacy-anonymize", handler.AnonymizePartyHandler)
+	// GET /?subject=123
+	functions.HTTP("fn-privacy-audit", handler.PrivacyAuditHandler)
+}
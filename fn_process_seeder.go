@@ -16,6 +16,7 @@ import (
 	"github.com/perebaj/esaj/firestore"
 
 	"github.com/perebaj/esaj/logger"
+	"github.com/perebaj/esaj/metrics"
 )
 
 func init() {
@@ -45,10 +46,11 @@ func init() {
 		CookieSession:    "",
 		CookiePDFSession: "",
 	}, &http.Client{
-		Timeout: 90 * time.Second,
+		Timeout:   90 * time.Second,
+		Transport: metrics.Transport(nil),
 	})
 
-	handler := api.NewHandler(storage, esajClient)
+	handler := api.NewHandler(storage, esajClient, accessRecorder(storage))
 	// POST /oab-seeder?oab=123456
 	// first argument is the entry-point, second is the handler function
 	functions.HTTP("fn-process-seeder", handler.OabSeederHandler)
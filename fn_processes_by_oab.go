@@ -41,6 +41,6 @@ func init() {
 
 	// This endpoint is not using the esaj client, so we don't need to load it here
 	// POST /processes-by-oab?oab=123456
-	handler := api.NewHandler(storage, nil)
+	handler := api.NewHandler(storage, nil, accessRecorder(storage))
 	functions.HTTP("fn-processes-by-oab", handler.ProcessesByOABHandler)
 }
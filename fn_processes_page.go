@@ -0,0 +1,47 @@
+// An API endpoint that returns a page of the processes of an OAB, with filters and ordering
+
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	fs "cloud.google.com/go/firestore"
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/perebaj/esaj/api"
+	"github.com/perebaj/esaj/firestore"
+	"github.com/perebaj/esaj/logger"
+)
+
+func init() {
+	logger, err := logger.NewLoggerSlog(logger.ConfigLogger{
+		Level:  logger.LevelInfo,
+		Format: logger.FormatJSON,
+	})
+
+	if err != nil {
+		slog.Error("error initializing logger", "error", err)
+		os.Exit(1)
+	}
+
+	slog.SetDefault(logger)
+
+	projectID := "blup-432616"
+	databaseName := "blup-db"
+	fsClient, err := fs.NewClientWithDatabase(context.Background(), projectID, databaseName)
+
+	if err != nil {
+		slog.Error("error initializing firestore client", "error", err)
+		os.Exit(1)
+	}
+
+	storage := firestore.NewStorage(fsClient, projectID)
+	slog.Info("storage initialized")
+
+	// This endpoint is not using the esaj client, so we don't need to load it here
+	// GET /processes-page?oab=123456&order_by=updated_at&desc=true&page_size=20
+	// Expected response: 200 OK with {"processes": [...], "next_cursor": "..."}, next_cursor is omitted in the last page
+	handler := api.NewHandler(storage, nil, accessRecorder(storage))
+	functions.HTTP("fn-processes-page", handler.ProcessesPageHandler)
+}
@@ -0,0 +1,135 @@
+// Package lgpd gather the operations on personal data required by the LGPD: the export of the data tied to a
+// user, the purge of the deleted users and the anonymization of the parties of the processes. Each operation is
+// recorded in the privacy audit, without the personal data itself.
+package lgpd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/tracing"
+)
+
+// DefaultGracePeriod is how long a deleted user is kept before being purged.
+const DefaultGracePeriod = 30 * 24 * time.Hour
+
+// minNameLetters is the minimum number of letters of an anonymized name, so a short name doesn't replace the
+// words of every process.
+const minNameLetters = 3
+
+// ErrInvalidRequest is returned when the arguments of an operation are invalid.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// Service runs the operations on personal data and records them in the privacy audit.
+type Service struct {
+	storage storage.PrivacyRepository
+	now     func() time.Time
+}
+
+// NewService creates a new Service
+func NewService(storage storage.PrivacyRepository) Service {
+	return Service{
+		storage: storage,
+		now:     time.Now,
+	}
+}
+
+// Export returns the data tied to the user. storage.ErrNotFound is returned when the user doesn't exist.
+func (s Service) Export(ctx context.Context, actor, userID string) (storage.UserExport, error) {
+	if actor == "" || userID == "" {
+		return storage.UserExport{}, fmt.Errorf("%w: actor and user_id are required", ErrInvalidRequest)
+	}
+
+	export, err := s.storage.ExportUser(ctx, userID)
+	if err != nil {
+		return storage.UserExport{}, err
+	}
+	return export, s.audit(ctx, storage.PrivacyExport, userID, actor, nil)
+}
+
+// Purge removes the users deleted more than the grace period ago, and returns their IDs. Each purged user is
+// recorded in the audit, even when the purge fails later.
+func (s Service) Purge(ctx context.Context, actor string, grace time.Duration) ([]string, error) {
+	if actor == "" {
+		return nil, fmt.Errorf("%w: actor is required", ErrInvalidRequest)
+	}
+	if grace < 0 {
+		return nil, fmt.Errorf("%w: negative grace period %s", ErrInvalidRequest, grace)
+	}
+
+	purged, purgeErr := s.storage.PurgeUsers(ctx, s.now().Add(-grace))
+	for _, id := range purged {
+		if err := s.audit(ctx, storage.PrivacyPurge, id, actor, nil); err != nil {
+			return purged, errors.Join(purgeErr, err)
+		}
+	}
+	return purged, purgeErr
+}
+
+// Anonymize replaces the name in the parties of the saved processes and of the ones saved later, and returns
+// the IDs of the changed processes. The audit keeps the storage.SubjectHash of the name, not the name.
+func (s Service) Anonymize(ctx context.Context, actor, name string) ([]string, error) {
+	if actor == "" {
+		return nil, fmt.Errorf("%w: actor is required", ErrInvalidRequest)
+	}
+	// the names are found as whole words, the punctuation around them is not part of the name
+	name = strings.TrimFunc(strings.Join(strings.Fields(name), " "), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	letters := 0
+	for _, r := range name {
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	if letters < minNameLetters {
+		return nil, fmt.Errorf("%w: the name must have at least %d letters", ErrInvalidRequest, minNameLetters)
+	}
+	if words := storage.NameWords(name); words > storage.MaxNameWords {
+		return nil, fmt.Errorf("%w: the name must have at most %d words", ErrInvalidRequest, storage.MaxNameWords)
+	}
+
+	changed, err := s.storage.AnonymizeParty(ctx, name)
+	if auditErr := s.audit(ctx, storage.PrivacyAnonymize, storage.SubjectHash(name), actor, changed); auditErr != nil {
+		return changed, errors.Join(err, auditErr)
+	}
+	return changed, err
+}
+
+// Audits returns the audit records of a subject, a user ID or an anonymized name, or all of them when it's
+// empty.
+func (s Service) Audits(ctx context.Context, subject string) ([]storage.PrivacyAudit, error) {
+	return s.storage.PrivacyAudits(ctx, subject)
+}
+
+func (s Service) audit(ctx context.Context, operation, subject, actor string, records []string) error {
+	id, err := storage.NewID()
+	if err != nil {
+		return err
+	}
+
+	a := storage.PrivacyAudit{
+		ID:        id,
+		Operation: operation,
+		Subject:   subject,
+		Actor:     actor,
+		Records:   records,
+		CreatedAt: s.now(),
+		TraceID:   tracing.GetTraceIDFromContext(ctx),
+	}
+	if a.Records == nil {
+		a.Records = []string{}
+	}
+	if err := s.storage.SavePrivacyAudit(ctx, a); err != nil {
+		return fmt.Errorf("error saving the audit of %s %s: %w", operation, subject, err)
+	}
+	slog.Info("privacy operation", "traceID", a.TraceID, "audit_id", id, "operation", operation, "actor", actor,
+		"records", len(records))
+	return nil
+}
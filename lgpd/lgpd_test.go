@@ -0,0 +1,97 @@
+package lgpd_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/perebaj/esaj/clerk"
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/lgpd"
+	"github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/storage/memory"
+	"github.com/perebaj/esaj/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService(t *testing.T) {
+	ctx := tracing.SetTraceIDInContext(context.Background(), "test-trace-id")
+	s := memory.NewStorage()
+	svc := lgpd.NewService(s)
+
+	event := clerk.WebHookEvent{Data: clerk.Data{ID: "123", FirstName: "John"}}
+	require.NoError(t, s.SaveUser(ctx, event))
+
+	export, err := svc.Export(ctx, "admin", "123")
+	require.NoError(t, err)
+	assert.Equal(t, "John", export.User.FirstName)
+
+	_, err = svc.Export(ctx, "admin", "456")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	// the user deleted now is kept by the grace period
+	require.NoError(t, s.DeleteUser(ctx, event))
+	purged, err := svc.Purge(ctx, "admin", lgpd.DefaultGracePeriod)
+	require.NoError(t, err)
+	assert.Empty(t, purged)
+
+	purged, err = svc.Purge(ctx, "admin", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"123"}, purged)
+
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{
+		ProcessID: "1", OAB: esaj.MustParseOAB("123"), Claimant: "José da Silva",
+	}))
+	changed, err := svc.Anonymize(ctx, "dpo", " José  da Silva. ")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, changed)
+
+	audits, err := svc.Audits(ctx, "123")
+	require.NoError(t, err)
+	require.Len(t, audits, 2)
+	ops := []string{audits[0].Operation, audits[1].Operation}
+	assert.ElementsMatch(t, []string{storage.PrivacyExport, storage.PrivacyPurge}, ops)
+
+	// the audit of the anonymization doesn't keep the name
+	audits, err = svc.Audits(ctx, storage.SubjectHash("jose da silva"))
+	require.NoError(t, err)
+	require.Len(t, audits, 1)
+	assert.Equal(t, storage.PrivacyAnonymize, audits[0].Operation)
+	assert.Equal(t, "dpo", audits[0].Actor)
+	assert.Equal(t, []string{"1"}, audits[0].Records)
+	assert.Equal(t, "test-trace-id", audits[0].TraceID)
+	assert.Len(t, audits[0].ID, 32)
+	assert.WithinDuration(t, time.Now(), audits[0].CreatedAt, time.Minute)
+
+	// the failed export is not audited
+	audits, err = svc.Audits(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, audits, 3)
+}
+
+func TestService_invalidRequest(t *testing.T) {
+	ctx := context.Background()
+	svc := lgpd.NewService(memory.NewStorage())
+
+	_, err := svc.Export(ctx, "", "123")
+	assert.ErrorIs(t, err, lgpd.ErrInvalidRequest)
+	_, err = svc.Export(ctx, "admin", "")
+	assert.ErrorIs(t, err, lgpd.ErrInvalidRequest)
+
+	_, err = svc.Purge(ctx, "admin", -time.Hour)
+	assert.ErrorIs(t, err, lgpd.ErrInvalidRequest)
+	_, err = svc.Purge(ctx, "", time.Hour)
+	assert.ErrorIs(t, err, lgpd.ErrInvalidRequest)
+
+	for _, name := range []string{"", "  ", "Jo", "1234 5", "-- Jo --", "a b c d e f g h i j k"} {
+		_, err = svc.Anonymize(ctx, "admin", name)
+		assert.ErrorIs(t, err, lgpd.ErrInvalidRequest, name)
+	}
+	_, err = svc.Anonymize(ctx, "", "José da Silva")
+	assert.ErrorIs(t, err, lgpd.ErrInvalidRequest)
+
+	audits, err := svc.Audits(ctx, "")
+	require.NoError(t, err)
+	assert.Empty(t, audits)
+}
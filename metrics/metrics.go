@@ -0,0 +1,208 @@
+// Package metrics gather the Prometheus metrics of the eSAJ client and of the collector pipeline.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "esaj"
+
+// Registry holds all metrics of the collector. A custom registry is used instead of the default one, so only
+// the metrics of this package and the runtime ones are exposed.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	// HTTPRequests counts the requests to the eSAJ website by endpoint and status. The status is the HTTP
+	// status code, or "error" when the request failed without a response.
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Requests to the eSAJ website by endpoint and status.",
+	}, []string{"endpoint", "status"})
+
+	// HTTPRequestDuration is the latency of the requests to the eSAJ website by endpoint.
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of the requests to the eSAJ website by endpoint.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"endpoint"})
+
+	// Retries counts the operations retried by reason. Example: session_expired, account_rotation.
+	Retries = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retries_total",
+		Help:      "Operations retried by reason.",
+	}, []string{"reason"})
+
+	// SessionExpirations counts the sessions that expired and were refreshed.
+	SessionExpirations = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "session_expirations_total",
+		Help:      "Sessions that expired while in use.",
+	})
+
+	// SeedsDiscovered counts the processes found by the OAB search.
+	SeedsDiscovered = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "seeds_discovered_total",
+		Help:      "Processes found by the OAB search.",
+	})
+
+	// ProcessesFetched counts the processes whose basic information was fetched.
+	ProcessesFetched = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "processes_fetched_total",
+		Help:      "Processes whose basic information was fetched.",
+	})
+
+	// ParseFailures counts the pages that could not be parsed by reason.
+	ParseFailures = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "parse_failures_total",
+		Help:      "Pages of the eSAJ website that could not be parsed by reason.",
+	}, []string{"reason"})
+
+	// DocumentsDownloaded counts the PDF documents downloaded.
+	DocumentsDownloaded = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "documents_downloaded_total",
+		Help:      "PDF documents downloaded.",
+	})
+
+	// AuditEvents counts the access events by result: saved, dropped when the buffer of the recorder was full,
+	// or failed when they could not be written.
+	AuditEvents = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "audit_events_total",
+		Help:      "Access events to process data by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+// Handler returns the handler of the /metrics endpoint.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Transport returns a http.RoundTripper that records the requests in HTTPRequests and HTTPRequestDuration.
+// If next is nil, http.DefaultTransport is used.
+func Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{next: next}
+}
+
+type transport struct {
+	next http.RoundTripper
+}
+
+// Unwrap returns the round tripper whose requests are recorded.
+func (t *transport) Unwrap() http.RoundTripper {
+	return t.next
+}
+
+// Rewrap returns a transport that records the requests of next. It's used to change the inner transport, like
+// adding the client certificate of the eSAJ login.
+func (t *transport) Rewrap(next http.RoundTripper) http.RoundTripper {
+	return Transport(next)
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := Endpoint(req.URL.Path)
+	start := time.Now()
+
+	resp, err := t.next.RoundTrip(req)
+
+	HTTPRequestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	HTTPRequests.WithLabelValues(endpoint, status).Inc()
+
+	return resp, err
+}
+
+// Endpoint returns the label of a request path. The eSAJ paths are kept as they are, since they don't have
+// ids, but the path is limited to its first two segments to avoid a label for each unknown URL.
+// Example: /cpopg/search.do
+func Endpoint(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > 2 {
+		segments = segments[:2]
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// ParseFailure records a page that could not be parsed.
+func ParseFailure(reason string) {
+	ParseFailures.WithLabelValues(reason).Inc()
+}
+
+// Summary writes the collector metrics with a value, in a human readable table. Used at the end of the CLI
+// commands. The histograms are summarized by their count and average.
+func Summary(w io.Writer) error {
+	families, err := Registry.Gather()
+	if err != nil {
+		return fmt.Errorf("error gathering metrics: %w", err)
+	}
+
+	var lines []string
+	for _, f := range families {
+		if !strings.HasPrefix(f.GetName(), namespace+"_") {
+			continue
+		}
+
+		for _, m := range f.GetMetric() {
+			var labels []string
+			for _, l := range m.GetLabel() {
+				labels = append(labels, l.GetName()+"="+l.GetValue())
+			}
+			name := f.GetName()
+			if len(labels) > 0 {
+				name += "{" + strings.Join(labels, ",") + "}"
+			}
+
+			switch {
+			case m.GetCounter() != nil:
+				if v := m.GetCounter().GetValue(); v > 0 {
+					lines = append(lines, fmt.Sprintf("%s\t%g", name, v))
+				}
+			case m.GetHistogram() != nil:
+				h := m.GetHistogram()
+				if h.GetSampleCount() > 0 {
+					avg := h.GetSampleSum() / float64(h.GetSampleCount())
+					lines = append(lines, fmt.Sprintf("%s\tcount=%d avg=%.3fs", name, h.GetSampleCount(), avg))
+				}
+			}
+		}
+	}
+	sort.Strings(lines)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, l := range lines {
+		if _, err := fmt.Fprintln(tw, l); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpoint(t *testing.T) {
+	tests := map[string]string{
+		"/cpopg/search.do":          "/cpopg/search.do",
+		"/pastadigital/getPDF.do":   "/pastadigital/getPDF.do",
+		"/sajcas/login/certificado": "/sajcas/login",
+		"/":                         "/",
+		"":                          "/",
+		"/pastadigital/abrirPastaProcessoDigital.do/x": "/pastadigital/abrirPastaProcessoDigital.do",
+	}
+
+	for path, want := range tests {
+		assert.Equal(t, want, Endpoint(path), path)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cpopg/missing.do" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: Transport(nil)}
+
+	before := testutil.ToFloat64(HTTPRequests.WithLabelValues("/cpopg/search.do", "200"))
+	beforeMissing := testutil.ToFloat64(HTTPRequests.WithLabelValues("/cpopg/missing.do", "404"))
+	beforeError := testutil.ToFloat64(HTTPRequests.WithLabelValues("/cpopg/search.do", "error"))
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL + "/cpopg/search.do?processo.codigo=1")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	}
+	resp, err := client.Get(server.URL + "/cpopg/missing.do")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	_, err = client.Get("http://127.0.0.1:1/cpopg/search.do")
+	require.Error(t, err)
+
+	assert.Equal(t, before+2, testutil.ToFloat64(HTTPRequests.WithLabelValues("/cpopg/search.do", "200")))
+	assert.Equal(t, beforeMissing+1, testutil.ToFloat64(HTTPRequests.WithLabelValues("/cpopg/missing.do", "404")))
+	assert.Equal(t, beforeError+1, testutil.ToFloat64(HTTPRequests.WithLabelValues("/cpopg/search.do", "error")))
+}
+
+func TestHandler(t *testing.T) {
+	SeedsDiscovered.Add(3)
+	ParseFailure("parties")
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "esaj_seeds_discovered_total")
+	assert.Contains(t, string(body), `esaj_parse_failures_total{reason="parties"}`)
+	assert.Contains(t, string(body), "go_goroutines")
+}
+
+func TestSummary(t *testing.T) {
+	DocumentsDownloaded.Inc()
+	HTTPRequestDuration.WithLabelValues("/pastadigital/getPDF.do").Observe(0.5)
+
+	var buf bytes.Buffer
+	require.NoError(t, Summary(&buf))
+
+	out := buf.String()
+	assert.Contains(t, out, "esaj_documents_downloaded_total")
+	assert.Contains(t, out, `esaj_http_request_duration_seconds{endpoint=/pastadigital/getPDF.do}`)
+	// the runtime metrics are not part of the summary
+	assert.NotContains(t, out, "go_goroutines")
+}
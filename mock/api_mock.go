@@ -14,6 +14,8 @@ import (
 	reflect "reflect"
 
 	esaj "github.com/perebaj/esaj/esaj"
+	search "github.com/perebaj/esaj/search"
+	storage "github.com/perebaj/esaj/storage"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -40,8 +42,53 @@ func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
 	return m.recorder
 }
 
+// GetMember mocks base method.
+func (m *MockStorage) GetMember(ctx context.Context, organizationID, userID string) (storage.Member, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMember", ctx, organizationID, userID)
+	ret0, _ := ret[0].(storage.Member)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMember indicates an expected call of GetMember.
+func (mr *MockStorageMockRecorder) GetMember(ctx, organizationID, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMember", reflect.TypeOf((*MockStorage)(nil).GetMember), ctx, organizationID, userID)
+}
+
+// GetOrganization mocks base method.
+func (m *MockStorage) GetOrganization(ctx context.Context, id string) (storage.Organization, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrganization", ctx, id)
+	ret0, _ := ret[0].(storage.Organization)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrganization indicates an expected call of GetOrganization.
+func (mr *MockStorageMockRecorder) GetOrganization(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrganization", reflect.TypeOf((*MockStorage)(nil).GetOrganization), ctx, id)
+}
+
+// GetSeedsByOAB mocks base method.
+func (m *MockStorage) GetSeedsByOAB(ctx context.Context, oab esaj.OAB) ([]storage.ProcessSeed, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSeedsByOAB", ctx, oab)
+	ret0, _ := ret[0].([]storage.ProcessSeed)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSeedsByOAB indicates an expected call of GetSeedsByOAB.
+func (mr *MockStorageMockRecorder) GetSeedsByOAB(ctx, oab any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSeedsByOAB", reflect.TypeOf((*MockStorage)(nil).GetSeedsByOAB), ctx, oab)
+}
+
 // ProcessBasicInfoByOAB mocks base method.
-func (m *MockStorage) ProcessBasicInfoByOAB(ctx context.Context, oab string) ([]esaj.ProcessBasicInfo, error) {
+func (m *MockStorage) ProcessBasicInfoByOAB(ctx context.Context, oab esaj.OAB) ([]esaj.ProcessBasicInfo, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "ProcessBasicInfoByOAB", ctx, oab)
 	ret0, _ := ret[0].([]esaj.ProcessBasicInfo)
@@ -55,6 +102,81 @@ func (mr *MockStorageMockRecorder) ProcessBasicInfoByOAB(ctx, oab any) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessBasicInfoByOAB", reflect.TypeOf((*MockStorage)(nil).ProcessBasicInfoByOAB), ctx, oab)
 }
 
+// ProcessHistory mocks base method.
+func (m *MockStorage) ProcessHistory(ctx context.Context, processID string) ([]storage.ProcessSnapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ProcessHistory", ctx, processID)
+	ret0, _ := ret[0].([]storage.ProcessSnapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ProcessHistory indicates an expected call of ProcessHistory.
+func (mr *MockStorageMockRecorder) ProcessHistory(ctx, processID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessHistory", reflect.TypeOf((*MockStorage)(nil).ProcessHistory), ctx, processID)
+}
+
+// ProcessOABs mocks base method.
+func (m *MockStorage) ProcessOABs(ctx context.Context, processID string) ([]esaj.OAB, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ProcessOABs", ctx, processID)
+	ret0, _ := ret[0].([]esaj.OAB)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ProcessOABs indicates an expected call of ProcessOABs.
+func (mr *MockStorageMockRecorder) ProcessOABs(ctx, processID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessOABs", reflect.TypeOf((*MockStorage)(nil).ProcessOABs), ctx, processID)
+}
+
+// QueryProcesses mocks base method.
+func (m *MockStorage) QueryProcesses(ctx context.Context, q storage.ProcessQuery) (storage.ProcessPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueryProcesses", ctx, q)
+	ret0, _ := ret[0].(storage.ProcessPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryProcesses indicates an expected call of QueryProcesses.
+func (mr *MockStorageMockRecorder) QueryProcesses(ctx, q any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryProcesses", reflect.TypeOf((*MockStorage)(nil).QueryProcesses), ctx, q)
+}
+
+// QuerySeeds mocks base method.
+func (m *MockStorage) QuerySeeds(ctx context.Context, q storage.SeedQuery) (storage.SeedPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QuerySeeds", ctx, q)
+	ret0, _ := ret[0].(storage.SeedPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QuerySeeds indicates an expected call of QuerySeeds.
+func (mr *MockStorageMockRecorder) QuerySeeds(ctx, q any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QuerySeeds", reflect.TypeOf((*MockStorage)(nil).QuerySeeds), ctx, q)
+}
+
+// ReconcileSeeds mocks base method.
+func (m *MockStorage) ReconcileSeeds(ctx context.Context, oab esaj.OAB, found []esaj.ProcessSeed) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReconcileSeeds", ctx, oab, found)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReconcileSeeds indicates an expected call of ReconcileSeeds.
+func (mr *MockStorageMockRecorder) ReconcileSeeds(ctx, oab, found any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReconcileSeeds", reflect.TypeOf((*MockStorage)(nil).ReconcileSeeds), ctx, oab, found)
+}
+
 // SaveProcessSeeds mocks base method.
 func (m *MockStorage) SaveProcessSeeds(ctx context.Context, ps []esaj.ProcessSeed) error {
 	m.ctrl.T.Helper()
@@ -69,6 +191,21 @@ func (mr *MockStorageMockRecorder) SaveProcessSeeds(ctx, ps any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveProcessSeeds", reflect.TypeOf((*MockStorage)(nil).SaveProcessSeeds), ctx, ps)
 }
 
+// SearchProcesses mocks base method.
+func (m *MockStorage) SearchProcesses(ctx context.Context, q search.Query) ([]search.Result, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchProcesses", ctx, q)
+	ret0, _ := ret[0].([]search.Result)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchProcesses indicates an expected call of SearchProcesses.
+func (mr *MockStorageMockRecorder) SearchProcesses(ctx, q any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchProcesses", reflect.TypeOf((*MockStorage)(nil).SearchProcesses), ctx, q)
+}
+
 // MockesajClient is a mock of esajClient interface.
 type MockesajClient struct {
 	ctrl     *gomock.Controller
@@ -93,7 +230,7 @@ func (m *MockesajClient) EXPECT() *MockesajClientMockRecorder {
 }
 
 // SearchByOAB mocks base method.
-func (m *MockesajClient) SearchByOAB(ctx context.Context, oab string) ([]esaj.ProcessSeed, error) {
+func (m *MockesajClient) SearchByOAB(ctx context.Context, oab esaj.OAB) ([]esaj.ProcessSeed, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "SearchByOAB", ctx, oab)
 	ret0, _ := ret[0].([]esaj.ProcessSeed)
@@ -106,3 +243,18 @@ func (mr *MockesajClientMockRecorder) SearchByOAB(ctx, oab any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchByOAB", reflect.TypeOf((*MockesajClient)(nil).SearchByOAB), ctx, oab)
 }
+
+// SearchByOABInForo mocks base method.
+func (m *MockesajClient) SearchByOABInForo(ctx context.Context, oab esaj.OAB, foroCode string) ([]esaj.ProcessSeed, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchByOABInForo", ctx, oab, foroCode)
+	ret0, _ := ret[0].([]esaj.ProcessSeed)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchByOABInForo indicates an expected call of SearchByOABInForo.
+func (mr *MockesajClientMockRecorder) SearchByOABInForo(ctx, oab, foroCode any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchByOABInForo", reflect.TypeOf((*MockesajClient)(nil).SearchByOABInForo), ctx, oab, foroCode)
+}
@@ -0,0 +1,137 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: audit.go
+//
+// Generated by this command:
+//
+//	mockgen -source audit.go -destination ../mock/audit_mock.go -package mock
+//
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	esaj "github.com/perebaj/esaj/esaj"
+	storage "github.com/perebaj/esaj/storage"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockAuditor is a mock of Auditor interface.
+type MockAuditor struct {
+	ctrl     *gomock.Controller
+	recorder *MockAuditorMockRecorder
+}
+
+// MockAuditorMockRecorder is the mock recorder for MockAuditor.
+type MockAuditorMockRecorder struct {
+	mock *MockAuditor
+}
+
+// NewMockAuditor creates a new mock instance.
+func NewMockAuditor(ctrl *gomock.Controller) *MockAuditor {
+	mock := &MockAuditor{ctrl: ctrl}
+	mock.recorder = &MockAuditorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAuditor) EXPECT() *MockAuditorMockRecorder {
+	return m.recorder
+}
+
+// Record mocks base method.
+func (m *MockAuditor) Record(ctx context.Context, e storage.AccessEvent) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Record", ctx, e)
+}
+
+// Record indicates an expected call of Record.
+func (mr *MockAuditorMockRecorder) Record(ctx, e any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Record", reflect.TypeOf((*MockAuditor)(nil).Record), ctx, e)
+}
+
+// MockAuditStorage is a mock of AuditStorage interface.
+type MockAuditStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockAuditStorageMockRecorder
+}
+
+// MockAuditStorageMockRecorder is the mock recorder for MockAuditStorage.
+type MockAuditStorageMockRecorder struct {
+	mock *MockAuditStorage
+}
+
+// NewMockAuditStorage creates a new mock instance.
+func NewMockAuditStorage(ctrl *gomock.Controller) *MockAuditStorage {
+	mock := &MockAuditStorage{ctrl: ctrl}
+	mock.recorder = &MockAuditStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAuditStorage) EXPECT() *MockAuditStorageMockRecorder {
+	return m.recorder
+}
+
+// GetMember mocks base method.
+func (m *MockAuditStorage) GetMember(ctx context.Context, organizationID, userID string) (storage.Member, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMember", ctx, organizationID, userID)
+	ret0, _ := ret[0].(storage.Member)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMember indicates an expected call of GetMember.
+func (mr *MockAuditStorageMockRecorder) GetMember(ctx, organizationID, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMember", reflect.TypeOf((*MockAuditStorage)(nil).GetMember), ctx, organizationID, userID)
+}
+
+// GetOrganization mocks base method.
+func (m *MockAuditStorage) GetOrganization(ctx context.Context, id string) (storage.Organization, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrganization", ctx, id)
+	ret0, _ := ret[0].(storage.Organization)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrganization indicates an expected call of GetOrganization.
+func (mr *MockAuditStorageMockRecorder) GetOrganization(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrganization", reflect.TypeOf((*MockAuditStorage)(nil).GetOrganization), ctx, id)
+}
+
+// ProcessOABs mocks base method.
+func (m *MockAuditStorage) ProcessOABs(ctx context.Context, processID string) ([]esaj.OAB, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ProcessOABs", ctx, processID)
+	ret0, _ := ret[0].([]esaj.OAB)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ProcessOABs indicates an expected call of ProcessOABs.
+func (mr *MockAuditStorageMockRecorder) ProcessOABs(ctx, processID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessOABs", reflect.TypeOf((*MockAuditStorage)(nil).ProcessOABs), ctx, processID)
+}
+
+// QueryAccessEvents mocks base method.
+func (m *MockAuditStorage) QueryAccessEvents(ctx context.Context, q storage.AccessQuery) (storage.AccessPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueryAccessEvents", ctx, q)
+	ret0, _ := ret[0].(storage.AccessPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryAccessEvents indicates an expected call of QueryAccessEvents.
+func (mr *MockAuditStorageMockRecorder) QueryAccessEvents(ctx, q any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryAccessEvents", reflect.TypeOf((*MockAuditStorage)(nil).QueryAccessEvents), ctx, q)
+}
@@ -0,0 +1,217 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: organization.go
+//
+// Generated by this command:
+//
+//	mockgen -source organization.go -destination ../mock/organization_mock.go -package mock
+//
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	esaj "github.com/perebaj/esaj/esaj"
+	storage "github.com/perebaj/esaj/storage"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockOrganizationStorage is a mock of OrganizationStorage interface.
+type MockOrganizationStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockOrganizationStorageMockRecorder
+}
+
+// MockOrganizationStorageMockRecorder is the mock recorder for MockOrganizationStorage.
+type MockOrganizationStorageMockRecorder struct {
+	mock *MockOrganizationStorage
+}
+
+// NewMockOrganizationStorage creates a new mock instance.
+func NewMockOrganizationStorage(ctrl *gomock.Controller) *MockOrganizationStorage {
+	mock := &MockOrganizationStorage{ctrl: ctrl}
+	mock.recorder = &MockOrganizationStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockOrganizationStorage) EXPECT() *MockOrganizationStorageMockRecorder {
+	return m.recorder
+}
+
+// Annotations mocks base method.
+func (m *MockOrganizationStorage) Annotations(ctx context.Context, organizationID, processID string) ([]storage.Annotation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Annotations", ctx, organizationID, processID)
+	ret0, _ := ret[0].([]storage.Annotation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Annotations indicates an expected call of Annotations.
+func (mr *MockOrganizationStorageMockRecorder) Annotations(ctx, organizationID, processID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Annotations", reflect.TypeOf((*MockOrganizationStorage)(nil).Annotations), ctx, organizationID, processID)
+}
+
+// DeleteAnnotation mocks base method.
+func (m *MockOrganizationStorage) DeleteAnnotation(ctx context.Context, organizationID, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteAnnotation", ctx, organizationID, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAnnotation indicates an expected call of DeleteAnnotation.
+func (mr *MockOrganizationStorageMockRecorder) DeleteAnnotation(ctx, organizationID, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAnnotation", reflect.TypeOf((*MockOrganizationStorage)(nil).DeleteAnnotation), ctx, organizationID, id)
+}
+
+// GetAnnotation mocks base method.
+func (m *MockOrganizationStorage) GetAnnotation(ctx context.Context, organizationID, id string) (storage.Annotation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAnnotation", ctx, organizationID, id)
+	ret0, _ := ret[0].(storage.Annotation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAnnotation indicates an expected call of GetAnnotation.
+func (mr *MockOrganizationStorageMockRecorder) GetAnnotation(ctx, organizationID, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAnnotation", reflect.TypeOf((*MockOrganizationStorage)(nil).GetAnnotation), ctx, organizationID, id)
+}
+
+// GetMember mocks base method.
+func (m *MockOrganizationStorage) GetMember(ctx context.Context, organizationID, userID string) (storage.Member, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMember", ctx, organizationID, userID)
+	ret0, _ := ret[0].(storage.Member)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMember indicates an expected call of GetMember.
+func (mr *MockOrganizationStorageMockRecorder) GetMember(ctx, organizationID, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMember", reflect.TypeOf((*MockOrganizationStorage)(nil).GetMember), ctx, organizationID, userID)
+}
+
+// GetOrganization mocks base method.
+func (m *MockOrganizationStorage) GetOrganization(ctx context.Context, id string) (storage.Organization, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrganization", ctx, id)
+	ret0, _ := ret[0].(storage.Organization)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrganization indicates an expected call of GetOrganization.
+func (mr *MockOrganizationStorageMockRecorder) GetOrganization(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrganization", reflect.TypeOf((*MockOrganizationStorage)(nil).GetOrganization), ctx, id)
+}
+
+// Members mocks base method.
+func (m *MockOrganizationStorage) Members(ctx context.Context, organizationID string) ([]storage.Member, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Members", ctx, organizationID)
+	ret0, _ := ret[0].([]storage.Member)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Members indicates an expected call of Members.
+func (mr *MockOrganizationStorageMockRecorder) Members(ctx, organizationID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Members", reflect.TypeOf((*MockOrganizationStorage)(nil).Members), ctx, organizationID)
+}
+
+// ProcessOABs mocks base method.
+func (m *MockOrganizationStorage) ProcessOABs(ctx context.Context, processID string) ([]esaj.OAB, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ProcessOABs", ctx, processID)
+	ret0, _ := ret[0].([]esaj.OAB)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ProcessOABs indicates an expected call of ProcessOABs.
+func (mr *MockOrganizationStorageMockRecorder) ProcessOABs(ctx, processID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessOABs", reflect.TypeOf((*MockOrganizationStorage)(nil).ProcessOABs), ctx, processID)
+}
+
+// RemoveMember mocks base method.
+func (m *MockOrganizationStorage) RemoveMember(ctx context.Context, organizationID, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveMember", ctx, organizationID, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveMember indicates an expected call of RemoveMember.
+func (mr *MockOrganizationStorageMockRecorder) RemoveMember(ctx, organizationID, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveMember", reflect.TypeOf((*MockOrganizationStorage)(nil).RemoveMember), ctx, organizationID, userID)
+}
+
+// SaveAnnotation mocks base method.
+func (m *MockOrganizationStorage) SaveAnnotation(ctx context.Context, a storage.Annotation) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveAnnotation", ctx, a)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveAnnotation indicates an expected call of SaveAnnotation.
+func (mr *MockOrganizationStorageMockRecorder) SaveAnnotation(ctx, a any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveAnnotation", reflect.TypeOf((*MockOrganizationStorage)(nil).SaveAnnotation), ctx, a)
+}
+
+// SaveMember mocks base method.
+func (m_2 *MockOrganizationStorage) SaveMember(ctx context.Context, m storage.Member) error {
+	m_2.ctrl.T.Helper()
+	ret := m_2.ctrl.Call(m_2, "SaveMember", ctx, m)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveMember indicates an expected call of SaveMember.
+func (mr *MockOrganizationStorageMockRecorder) SaveMember(ctx, m any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveMember", reflect.TypeOf((*MockOrganizationStorage)(nil).SaveMember), ctx, m)
+}
+
+// SaveOrganization mocks base method.
+func (m *MockOrganizationStorage) SaveOrganization(ctx context.Context, o storage.Organization) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveOrganization", ctx, o)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveOrganization indicates an expected call of SaveOrganization.
+func (mr *MockOrganizationStorageMockRecorder) SaveOrganization(ctx, o any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveOrganization", reflect.TypeOf((*MockOrganizationStorage)(nil).SaveOrganization), ctx, o)
+}
+
+// UserMemberships mocks base method.
+func (m *MockOrganizationStorage) UserMemberships(ctx context.Context, userID string) ([]storage.Member, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UserMemberships", ctx, userID)
+	ret0, _ := ret[0].([]storage.Member)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UserMemberships indicates an expected call of UserMemberships.
+func (mr *MockOrganizationStorageMockRecorder) UserMemberships(ctx, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserMemberships", reflect.TypeOf((*MockOrganizationStorage)(nil).UserMemberships), ctx, userID)
+}
@@ -0,0 +1,102 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: privacy.go
+//
+// Generated by this command:
+//
+//	mockgen -source privacy.go -destination ../mock/privacy_mock.go -package mock
+//
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	storage "github.com/perebaj/esaj/storage"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockPrivacyService is a mock of PrivacyService interface.
+type MockPrivacyService struct {
+	ctrl     *gomock.Controller
+	recorder *MockPrivacyServiceMockRecorder
+}
+
+// MockPrivacyServiceMockRecorder is the mock recorder for MockPrivacyService.
+type MockPrivacyServiceMockRecorder struct {
+	mock *MockPrivacyService
+}
+
+// NewMockPrivacyService creates a new mock instance.
+func NewMockPrivacyService(ctrl *gomock.Controller) *MockPrivacyService {
+	mock := &MockPrivacyService{ctrl: ctrl}
+	mock.recorder = &MockPrivacyServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPrivacyService) EXPECT() *MockPrivacyServiceMockRecorder {
+	return m.recorder
+}
+
+// Anonymize mocks base method.
+func (m *MockPrivacyService) Anonymize(ctx context.Context, actor, name string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Anonymize", ctx, actor, name)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Anonymize indicates an expected call of Anonymize.
+func (mr *MockPrivacyServiceMockRecorder) Anonymize(ctx, actor, name any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Anonymize", reflect.TypeOf((*MockPrivacyService)(nil).Anonymize), ctx, actor, name)
+}
+
+// Audits mocks base method.
+func (m *MockPrivacyService) Audits(ctx context.Context, subject string) ([]storage.PrivacyAudit, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Audits", ctx, subject)
+	ret0, _ := ret[0].([]storage.PrivacyAudit)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Audits indicates an expected call of Audits.
+func (mr *MockPrivacyServiceMockRecorder) Audits(ctx, subject any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Audits", reflect.TypeOf((*MockPrivacyService)(nil).Audits), ctx, subject)
+}
+
+// Export mocks base method.
+func (m *MockPrivacyService) Export(ctx context.Context, actor, userID string) (storage.UserExport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Export", ctx, actor, userID)
+	ret0, _ := ret[0].(storage.UserExport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Export indicates an expected call of Export.
+func (mr *MockPrivacyServiceMockRecorder) Export(ctx, actor, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Export", reflect.TypeOf((*MockPrivacyService)(nil).Export), ctx, actor, userID)
+}
+
+// Purge mocks base method.
+func (m *MockPrivacyService) Purge(ctx context.Context, actor string, grace time.Duration) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Purge", ctx, actor, grace)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Purge indicates an expected call of Purge.
+func (mr *MockPrivacyServiceMockRecorder) Purge(ctx, actor, grace any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*MockPrivacyService)(nil).Purge), ctx, actor, grace)
+}
@@ -14,7 +14,7 @@ import (
 	reflect "reflect"
 
 	clerk "github.com/perebaj/esaj/clerk"
-	firestore "github.com/perebaj/esaj/firestore"
+	storage "github.com/perebaj/esaj/storage"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -56,10 +56,10 @@ func (mr *MockUserStorageMockRecorder) DeleteUser(ctx, user any) *gomock.Call {
 }
 
 // GetUser mocks base method.
-func (m *MockUserStorage) GetUser(ctx context.Context, userID string) (firestore.User, error) {
+func (m *MockUserStorage) GetUser(ctx context.Context, userID string) (storage.User, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetUser", ctx, userID)
-	ret0, _ := ret[0].(firestore.User)
+	ret0, _ := ret[0].(storage.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -0,0 +1,247 @@
+// Package search gather the full-text search of the processes. The text fields of a process are indexed as a
+// Document, whose terms are accent-insensitive Portuguese words, and the documents that match a Query are
+// ranked by Rank. The storage backends keep the documents and use this package to build and rank them, so the
+// results are the same in all of them.
+package search
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/perebaj/esaj/esaj"
+)
+
+// The limits of a query.
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+	// MaxOABs is the maximum number of OABs of a query, the limit of the array-contains-any filter of Firestore.
+	MaxOABs = 30
+	// minPrefix is the minimum length of a query term that matches the terms that start with it.
+	minPrefix = 3
+)
+
+var (
+	// ErrInvalidQuery is returned when a query has no terms, no OABs or an invalid limit.
+	ErrInvalidQuery = errors.New("invalid search query")
+)
+
+// Field is a text field of a process that is indexed.
+type Field string
+
+// The indexed fields of a process.
+const (
+	FieldParty   Field = "party"
+	FieldLawyer  Field = "lawyer"
+	FieldClass   Field = "class"
+	FieldSubject Field = "subject"
+	FieldJudge   Field = "judge"
+	FieldVara    Field = "vara"
+)
+
+// weights rank the matches of each field, a party or lawyer name is what identifies a process the most.
+var weights = map[Field]float64{
+	FieldParty:   3,
+	FieldLawyer:  2.5,
+	FieldClass:   2,
+	FieldSubject: 2,
+	FieldJudge:   1.5,
+	FieldVara:    1,
+}
+
+// Document is the indexed form of a process.
+type Document struct {
+	ProcessID string `json:"process_id"`
+	// OABs are the OABs that found the process, only the queries of them can find it.
+	OABs []esaj.OAB `json:"oabs"`
+	// Terms maps each term to the fields where it appears.
+	Terms map[string][]Field `json:"terms"`
+}
+
+// NewDocument indexes the process, found by the OABs. The claimant and the defendant are split in the name of
+// the party and of its lawyers.
+func NewDocument(p esaj.ProcessBasicInfo, oabs []esaj.OAB) Document {
+	doc := Document{
+		ProcessID: p.ProcessID,
+		OABs:      slices.Clone(oabs),
+		Terms:     make(map[string][]Field),
+	}
+	add := func(field Field, text string) {
+		for _, term := range Tokenize(text) {
+			if !slices.Contains(doc.Terms[term], field) {
+				doc.Terms[term] = append(doc.Terms[term], field)
+			}
+		}
+	}
+
+	for _, text := range []string{p.Claimant, p.Defendant} {
+		party, lawyers := splitParty(text)
+		add(FieldParty, party)
+		for _, lawyer := range lawyers {
+			add(FieldLawyer, lawyer)
+		}
+	}
+	add(FieldClass, p.Class)
+	add(FieldSubject, p.Subject)
+	add(FieldJudge, p.Judge)
+	add(FieldVara, p.Vara)
+	return doc
+}
+
+// Query is a full-text search of processes.
+type Query struct {
+	// Text is matched against the indexed fields, all of its terms must be found. A term with 3 or more letters
+	// also matches the terms that start with it, so "execu" finds "Execução Fiscal".
+	Text string
+	// OABs scope the search to their processes. A tenant is scoped by the OABs of its lawyers.
+	OABs []esaj.OAB
+	// Limit is the maximum number of results, DefaultLimit when zero.
+	Limit int
+}
+
+// Normalize sets the defaults of the query and validates it. It returns the terms of the text.
+func (q *Query) Normalize() ([]string, error) {
+	terms := Tokenize(q.Text)
+	switch {
+	case len(terms) == 0:
+		return nil, fmt.Errorf("%w: the text has no searchable terms", ErrInvalidQuery)
+	case len(q.OABs) == 0:
+		return nil, fmt.Errorf("%w: at least one oab is required", ErrInvalidQuery)
+	case len(q.OABs) > MaxOABs:
+		return nil, fmt.Errorf("%w: at most %d oabs are allowed", ErrInvalidQuery, MaxOABs)
+	case q.Limit == 0:
+		q.Limit = DefaultLimit
+	case q.Limit < 0 || q.Limit > MaxLimit:
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, MaxLimit)
+	}
+	return terms, nil
+}
+
+// InScope reports whether the document was found by one of the OABs of the query.
+func (q Query) InScope(doc Document) bool {
+	for _, oab := range doc.OABs {
+		if slices.Contains(q.OABs, oab) {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopeOAB returns the first OAB of the query that found the document, it's the OAB of the result.
+func (q Query) ScopeOAB(doc Document) esaj.OAB {
+	for _, oab := range q.OABs {
+		if slices.Contains(doc.OABs, oab) {
+			return oab
+		}
+	}
+	return esaj.OAB{}
+}
+
+// Result is a process found by a query.
+type Result struct {
+	Process esaj.ProcessBasicInfo `json:"process"`
+	Score   float64               `json:"score"`
+	// Fields are the fields where the terms of the query were found, sorted.
+	Fields []Field `json:"fields"`
+}
+
+// Rank returns the results of the documents that have all the terms, the best first, at most limit of them.
+// Only the ProcessID of the result processes is set, the backends fill the rest.
+//
+// Each term scores the weight of the best field where it's found, halved when it only matches as a prefix,
+// times its inverse document frequency among the documents, so the rare terms count more. The results with
+// the same score are sorted by process ID.
+func Rank(docs []Document, terms []string, limit int) []Result {
+	type match struct {
+		doc    Document
+		fields map[string][]Field
+		exact  map[string]bool
+	}
+
+	df := make(map[string]int)
+	var matches []match
+	for _, doc := range docs {
+		m := match{doc: doc, fields: make(map[string][]Field), exact: make(map[string]bool)}
+		for _, term := range terms {
+			fields, exact := lookup(doc, term)
+			if len(fields) == 0 {
+				break
+			}
+			m.fields[term], m.exact[term] = fields, exact
+			df[term]++
+		}
+		if len(m.fields) == len(terms) {
+			matches = append(matches, m)
+		}
+	}
+
+	results := make([]Result, 0, len(matches))
+	for _, m := range matches {
+		var (
+			score float64
+			seen  = make(map[Field]bool)
+		)
+		for _, term := range terms {
+			best := 0.0
+			for _, f := range m.fields[term] {
+				best = math.Max(best, weights[f])
+				seen[f] = true
+			}
+			if !m.exact[term] {
+				best /= 2
+			}
+			idf := math.Log(1 + float64(len(docs))/float64(df[term]))
+			score += best * idf
+		}
+
+		fields := make([]Field, 0, len(seen))
+		for f := range seen {
+			fields = append(fields, f)
+		}
+		slices.Sort(fields)
+		results = append(results, Result{
+			Process: esaj.ProcessBasicInfo{ProcessID: m.doc.ProcessID},
+			Score:   math.Round(score*1000) / 1000,
+			Fields:  fields,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Process.ProcessID < results[j].Process.ProcessID
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// lookup returns the fields where the term is found in the document, and whether it was found as a whole
+// term. When the term is not found as a whole, the fields of the terms that start with it are returned.
+func lookup(doc Document, term string) ([]Field, bool) {
+	if fields, ok := doc.Terms[term]; ok {
+		return fields, true
+	}
+	if len(term) < minPrefix {
+		return nil, false
+	}
+
+	var fields []Field
+	for t, fs := range doc.Terms {
+		if !strings.HasPrefix(t, term) {
+			continue
+		}
+		for _, f := range fs {
+			if !slices.Contains(fields, f) {
+				fields = append(fields, f)
+			}
+		}
+	}
+	return fields, false
+}
@@ -0,0 +1,99 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDocument(t *testing.T) {
+	oab := esaj.MustParseOAB("123")
+	doc := NewDocument(esaj.ProcessBasicInfo{
+		ProcessID: "1",
+		Class:     "Execução Fiscal",
+		Subject:   "Dívida Ativa",
+		Claimant:  "Fazenda Pública Advogado: Ana Fazenda",
+		Defendant: "José Lima",
+		Judge:     "Paulo Lima",
+		Vara:      "Vara das Execuções Fiscais",
+	}, []esaj.OAB{oab})
+
+	assert.Equal(t, "1", doc.ProcessID)
+	assert.Equal(t, []esaj.OAB{oab}, doc.OABs)
+	assert.Equal(t, map[string][]Field{
+		"fazenda":   {FieldParty, FieldLawyer},
+		"publica":   {FieldParty},
+		"ana":       {FieldLawyer},
+		"jose":      {FieldParty},
+		"lima":      {FieldParty, FieldJudge},
+		"execucao":  {FieldClass},
+		"fiscal":    {FieldClass},
+		"divida":    {FieldSubject},
+		"ativa":     {FieldSubject},
+		"paulo":     {FieldJudge},
+		"vara":      {FieldVara},
+		"execucoes": {FieldVara},
+		"fiscais":   {FieldVara},
+	}, doc.Terms)
+}
+
+func TestQuery_Normalize(t *testing.T) {
+	oabs := []esaj.OAB{esaj.MustParseOAB("123")}
+
+	q := Query{Text: "Execução da Fazenda", OABs: oabs}
+	terms, err := q.Normalize()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"execucao", "fazenda"}, terms)
+	assert.Equal(t, DefaultLimit, q.Limit)
+
+	for _, q := range []Query{
+		{Text: "", OABs: oabs},
+		{Text: "de", OABs: oabs},
+		{Text: "fazenda"},
+		{Text: "fazenda", OABs: make([]esaj.OAB, MaxOABs+1)},
+		{Text: "fazenda", OABs: oabs, Limit: -1},
+		{Text: "fazenda", OABs: oabs, Limit: MaxLimit + 1},
+	} {
+		_, err := q.Normalize()
+		assert.ErrorIs(t, err, ErrInvalidQuery, q)
+	}
+}
+
+func TestRank(t *testing.T) {
+	docs := []Document{
+		{ProcessID: "1", Terms: map[string][]Field{"lima": {FieldJudge}, "execucao": {FieldClass}}},
+		{ProcessID: "2", Terms: map[string][]Field{"lima": {FieldParty}, "execucao": {FieldClass}}},
+		{ProcessID: "3", Terms: map[string][]Field{"limao": {FieldParty}, "execucao": {FieldClass}}},
+		{ProcessID: "4", Terms: map[string][]Field{"lima": {FieldParty}}},
+		{ProcessID: "5", Terms: map[string][]Field{"lima": {FieldParty}, "execucao": {FieldClass}}},
+	}
+
+	ids := func(results []Result) []string {
+		var ids []string
+		for _, r := range results {
+			ids = append(ids, r.Process.ProcessID)
+		}
+		return ids
+	}
+
+	// the party ranks above the judge, and the exact terms above the prefixes; the ties by process ID
+	results := Rank(docs, []string{"lima", "execucao"}, 10)
+	assert.Equal(t, []string{"2", "5", "1", "3"}, ids(results))
+	assert.Equal(t, []Field{FieldClass, FieldParty}, results[0].Fields)
+	assert.Equal(t, results[0].Score, results[1].Score)
+	assert.Greater(t, results[1].Score, results[2].Score)
+
+	// "limao" of "3" only matches "lima" as a prefix, scoring as the judge of "1"
+	assert.Equal(t, []string{"2", "4", "5", "1", "3"}, ids(Rank(docs, []string{"lima"}, 10)))
+	assert.Equal(t, []string{"2", "3", "4", "5", "1"}, ids(Rank(docs, []string{"lim"}, 10)))
+	assert.Equal(t, []string{"2", "3"}, ids(Rank(docs, []string{"lim"}, 2)))
+	// the short terms only match as a whole
+	assert.Empty(t, Rank(docs, []string{"li"}, 10))
+
+	// the rare terms count more
+	rare := Rank(docs, []string{"limao"}, 10)
+	common := Rank(docs, []string{"execucao"}, 10)
+	assert.Greater(t, rare[0].Score, common[0].Score)
+}
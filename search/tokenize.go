@@ -0,0 +1,66 @@
+package search
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// stopwords are the Portuguese words that are too common to find a process, they are dropped from the
+// indexed text and from the queries. They are compared after Normalize, so they have no accents.
+var stopwords = map[string]bool{
+	"a": true, "o": true, "as": true, "os": true, "e": true, "ou": true, "um": true, "uma": true,
+	"de": true, "da": true, "do": true, "das": true, "dos": true, "em": true, "na": true, "no": true,
+	"nas": true, "nos": true, "ao": true, "aos": true, "para": true, "por": true, "pela": true,
+	"pelo": true, "com": true, "sem": true, "que": true, "se": true,
+}
+
+// lawyerLabel separates the lawyers from the party in the text of the parties. Example:
+// "Maria da Silva Advogado: João Souza Advogada: Ana Lima"
+var lawyerLabel = regexp.MustCompile(`(?i)\badvogad[oa]s?\s*:`)
+
+// Normalize lowercases the text and removes its accents, so "Execução" and "execucao" are the same text.
+func Normalize(text string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	normalized, _, err := transform.String(t, text)
+	if err != nil {
+		normalized = text
+	}
+	return strings.ToLower(normalized)
+}
+
+// Tokenize returns the terms of the text: its normalized words, without the stopwords, the single letters
+// and the repeated terms, in the order they appear.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(Normalize(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var terms []string
+	seen := make(map[string]bool)
+	for _, w := range words {
+		if stopwords[w] || seen[w] || (len(w) == 1 && !unicode.IsDigit(rune(w[0]))) {
+			continue
+		}
+		seen[w] = true
+		terms = append(terms, w)
+	}
+	return terms
+}
+
+// splitParty splits the text of a party, as scraped from the process page, in the name of the party and the
+// names of its lawyers.
+func splitParty(text string) (string, []string) {
+	parts := lawyerLabel.Split(text, -1)
+	var lawyers []string
+	for _, lawyer := range parts[1:] {
+		if lawyer = strings.TrimSpace(lawyer); lawyer != "" {
+			lawyers = append(lawyers, lawyer)
+		}
+	}
+	return strings.TrimSpace(parts[0]), lawyers
+}
@@ -0,0 +1,52 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "execucao fiscal", Normalize("Execução Fiscal"))
+	assert.Equal(t, "sao joao", Normalize("SÃO JOÃO"))
+	assert.Equal(t, "indenizacao por dano moral", Normalize("Indenização por Dano Moral"))
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Execução Fiscal", []string{"execucao", "fiscal"}},
+		{"Município de São Paulo", []string{"municipio", "sao", "paulo"}},
+		{"Banco Exemplo S.A.", []string{"banco", "exemplo"}},
+		{"2ª Vara Cível - Foro Central", []string{"2ª", "vara", "civel", "foro", "central"}},
+		{"João e Maria, João", []string{"joao", "maria"}},
+		{"1016358-63.2020", []string{"1016358", "63", "2020"}},
+		{"de da do", nil},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Tokenize(tt.text), tt.text)
+	}
+}
+
+func TestSplitParty(t *testing.T) {
+	tests := []struct {
+		text        string
+		wantParty   string
+		wantLawyers []string
+	}{
+		{"Maria da Silva", "Maria da Silva", nil},
+		{"Maria da Silva Advogado: João Souza", "Maria da Silva", []string{"João Souza"}},
+		{"Banco S.A. Advogada: Ana Lima  Advogado: Rui Costa", "Banco S.A.", []string{"Ana Lima", "Rui Costa"}},
+		{"Banco S.A. ADVOGADOS: Lima e Costa", "Banco S.A.", []string{"Lima e Costa"}},
+	}
+
+	for _, tt := range tests {
+		party, lawyers := splitParty(tt.text)
+		assert.Equal(t, tt.wantParty, party, tt.text)
+		assert.Equal(t, tt.wantLawyers, lawyers, tt.text)
+	}
+}
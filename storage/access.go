@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/perebaj/esaj/esaj"
+)
+
+// The actions recorded in the access audit.
+const (
+	AccessRead  = "read"
+	AccessWrite = "write"
+)
+
+// AccessEvent records a read or a write of process data, through the API or the CLI. The events are kept in an
+// append-only log, that is never changed.
+type AccessEvent struct {
+	ID string `json:"id"`
+	// UserID is the clerk user ID of the caller, or "cli:" and the system user for the commands.
+	UserID string `json:"user_id"`
+	// OrganizationID is the organization the caller acts for, empty for the admins of the platform.
+	OrganizationID string `json:"organization_id"`
+	TraceID        string `json:"trace_id"`
+	// Action is AccessRead or AccessWrite.
+	Action string `json:"action"`
+	// Resource is the accessed data, like the processes of an OAB (see OABResource), a process (see
+	// ProcessResource) or a collection (see CollectionResource).
+	Resource  string    `json:"resource"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OABResource is the resource of the processes of an OAB. Example: "oab:123456/SP"
+func OABResource(oab esaj.OAB) string {
+	return "oab:" + oab.String()
+}
+
+// ProcessResource is the resource of a process and of its history, movements and annotations.
+// Example: "process:1001234-56.2024.8.26.0053"
+func ProcessResource(processID string) string {
+	return "process:" + processID
+}
+
+// CollectionResource is the resource of a whole collection, read or written by the commands.
+// Example: "collection:process_basic_info"
+func CollectionResource(collection string) string {
+	return "collection:" + collection
+}
+
+// SortAccessEvents sorts the events by creation time and ID, the order returned by the AuditRepository.
+func SortAccessEvents(events []AccessEvent) {
+	sort.Slice(events, func(i, j int) bool {
+		return accessBefore(events[i].CreatedAt, events[i].ID, events[j].CreatedAt, events[j].ID)
+	})
+}
+
+func accessBefore(createdAt time.Time, id string, otherCreatedAt time.Time, otherID string) bool {
+	if !createdAt.Equal(otherCreatedAt) {
+		return createdAt.Before(otherCreatedAt)
+	}
+	return id < otherID
+}
+
+// AccessCursor is the position of the last event of a page, sent to the clients as an opaque string.
+type AccessCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        string    `json:"id"`
+}
+
+// String encodes the cursor as an URL safe string.
+func (c AccessCursor) String() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// After reports whether the event comes after the cursor, in the order of the AuditRepository.
+func (c AccessCursor) After(e AccessEvent) bool {
+	return accessBefore(c.CreatedAt, c.ID, e.CreatedAt, e.ID)
+}
+
+// AccessQuery is a paginated query of the access events.
+type AccessQuery struct {
+	// OrganizationID, UserID and Resource filter the events when not empty.
+	OrganizationID string
+	UserID         string
+	Resource       string
+	// Since and Until filter the events created in [Since, Until) when not zero.
+	Since time.Time
+	Until time.Time
+	// PageSize is DefaultPageSize when zero.
+	PageSize int
+	// Cursor is the NextCursor of the previous page, empty for the first one.
+	Cursor string
+}
+
+// Normalize sets the defaults of the query and validates it. It returns the parsed cursor, nil in the
+// first page.
+func (q *AccessQuery) Normalize() (*AccessCursor, error) {
+	switch {
+	case q.PageSize == 0:
+		q.PageSize = DefaultPageSize
+	case q.PageSize < 0 || q.PageSize > MaxPageSize:
+		return nil, fmt.Errorf("%w: page size must be between 1 and %d", ErrInvalidQuery, MaxPageSize)
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Since.Before(q.Until) {
+		return nil, fmt.Errorf("%w: since must be before until", ErrInvalidQuery)
+	}
+
+	if q.Cursor == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	var c AccessCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	return &c, nil
+}
+
+// Match reports whether the event passes the filters of the query. The cursor is not checked.
+func (q AccessQuery) Match(e AccessEvent) bool {
+	return (q.OrganizationID == "" || e.OrganizationID == q.OrganizationID) &&
+		(q.UserID == "" || e.UserID == q.UserID) &&
+		(q.Resource == "" || e.Resource == q.Resource) &&
+		(q.Since.IsZero() || !e.CreatedAt.Before(q.Since)) &&
+		(q.Until.IsZero() || e.CreatedAt.Before(q.Until))
+}
+
+// CursorOf returns the cursor that points to the event.
+func (q AccessQuery) CursorOf(e AccessEvent) AccessCursor {
+	return AccessCursor{CreatedAt: e.CreatedAt, ID: e.ID}
+}
+
+// AccessPage is a page of the access events.
+type AccessPage struct {
+	Events []AccessEvent `json:"events"`
+	// NextCursor is the cursor of the next page, empty in the last one.
+	NextCursor string `json:"next_cursor"`
+}
+
+// AuditRepository keeps the append-only log of the accesses to process data, written by the audit package.
+type AuditRepository interface {
+	// SaveAccessEvents appends the events to the log. The saved events are never changed, an event whose ID
+	// was already saved is ignored, so the writes can be retried.
+	SaveAccessEvents(ctx context.Context, events []AccessEvent) error
+	// QueryAccessEvents returns a page of the events that match the query, ordered by creation time and ID.
+	// ErrInvalidQuery is returned when the query is not valid.
+	QueryAccessEvents(ctx context.Context, q AccessQuery) (AccessPage, error)
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/perebaj/esaj/esaj"
+)
+
+// ProcessSnapshot is the process as it was in one of its scrapes. A snapshot is saved only when the scrape
+// differs from the previous one, so the history of a process shows when each field changed.
+type ProcessSnapshot struct {
+	// ID identifies the snapshot in the history of the process, the IDs grow with the time of the snapshots.
+	ID        string    `json:"id"`
+	ProcessID string    `json:"process_id"`
+	CreatedAt time.Time `json:"created_at"`
+	TraceID   string    `json:"trace_id"`
+	// Process is the scraped process. Its OAB is not part of the snapshot, since it's only the OAB that was
+	// used to find the process.
+	Process esaj.ProcessBasicInfo `json:"process"`
+	// Diff is the fields that changed since the previous snapshot, empty in the first one.
+	Diff []FieldChange `json:"diff"`
+}
+
+// FieldChange is a field of the process that changed between two snapshots. The field is named as in the JSON
+// of esaj.ProcessBasicInfo. Example: {Field: "judge", From: "Fulano", To: "Beltrano"}
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// OABRemoved is the field of the change added to the history when the process stops being found by the
+// search of an OAB. From is the removed OAB and To is empty. See NewOABRemovedSnapshot.
+const OABRemoved = "oab"
+
+// processFields are the fields of the process compared by DiffProcess.
+var processFields = []struct {
+	name  string
+	value func(p esaj.ProcessBasicInfo) string
+}{
+	{"process_foro", func(p esaj.ProcessBasicInfo) string { return p.ProcessForo }},
+	{"foro_name", func(p esaj.ProcessBasicInfo) string { return p.ForoName }},
+	{"process_code", func(p esaj.ProcessBasicInfo) string { return p.ProcessCode }},
+	{"judge", func(p esaj.ProcessBasicInfo) string { return p.Judge }},
+	{"class", func(p esaj.ProcessBasicInfo) string { return p.Class }},
+	{"subject", func(p esaj.ProcessBasicInfo) string { return p.Subject }},
+	{"claimant", func(p esaj.ProcessBasicInfo) string { return p.Claimant }},
+	{"defendant", func(p esaj.ProcessBasicInfo) string { return p.Defendant }},
+	{"vara", func(p esaj.ProcessBasicInfo) string { return p.Vara }},
+	{"situation", func(p esaj.ProcessBasicInfo) string { return p.Situation }},
+	{"url", func(p esaj.ProcessBasicInfo) string { return p.URL }},
+}
+
+// DiffProcess returns the fields that changed from prev to next, in the order of esaj.ProcessBasicInfo.
+// The OAB is not compared.
+func DiffProcess(prev, next esaj.ProcessBasicInfo) []FieldChange {
+	var diff []FieldChange
+	for _, f := range processFields {
+		from, to := f.value(prev), f.value(next)
+		if from != to {
+			diff = append(diff, FieldChange{Field: f.name, From: from, To: to})
+		}
+	}
+	return diff
+}
+
+// NewProcessSnapshot returns the snapshot of the scraped process, or false when it must not be saved because
+// nothing changed since the previous snapshot. prev is nil when the process has no previous snapshot.
+func NewProcessSnapshot(prev *esaj.ProcessBasicInfo, next esaj.ProcessBasicInfo, createdAt time.Time, traceID string) (ProcessSnapshot, bool) {
+	next.OAB = esaj.OAB{}
+	snapshot := ProcessSnapshot{
+		ID:        SnapshotID(createdAt),
+		ProcessID: next.ProcessID,
+		CreatedAt: createdAt,
+		TraceID:   traceID,
+		Process:   next,
+	}
+
+	if prev == nil {
+		return snapshot, true
+	}
+
+	snapshot.Diff = DiffProcess(*prev, next)
+	return snapshot, len(snapshot.Diff) > 0
+}
+
+// NewOABRemovedSnapshot returns the snapshot of a process that stopped being found by the search of the OAB.
+// The process is the saved one, since it was not scraped again.
+func NewOABRemovedSnapshot(p esaj.ProcessBasicInfo, oab esaj.OAB, createdAt time.Time, traceID string) ProcessSnapshot {
+	p.OAB = esaj.OAB{}
+	return ProcessSnapshot{
+		ID:        SnapshotID(createdAt),
+		ProcessID: p.ProcessID,
+		CreatedAt: createdAt,
+		TraceID:   traceID,
+		Process:   p,
+		Diff:      []FieldChange{{Field: OABRemoved, From: oab.String()}},
+	}
+}
+
+// SnapshotID returns the ID of a snapshot created at the time, that sorts in the same order as the time.
+// Example: 2024-08-01T10:00:00.000000000Z
+func SnapshotID(createdAt time.Time) string {
+	return createdAt.UTC().Format("2006-01-02T15:04:05.000000000Z")
+}
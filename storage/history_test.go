@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffProcess(t *testing.T) {
+	prev := esaj.ProcessBasicInfo{OAB: esaj.MustParseOAB("123"), ProcessID: "1", Judge: "Fulano", Claimant: "A"}
+	next := esaj.ProcessBasicInfo{OAB: esaj.MustParseOAB("456"), ProcessID: "1", Judge: "Beltrano", Claimant: "A", Defendant: "B"}
+
+	assert.Equal(t, []FieldChange{
+		{Field: "judge", From: "Fulano", To: "Beltrano"},
+		{Field: "defendant", From: "", To: "B"},
+	}, DiffProcess(prev, next))
+	assert.Empty(t, DiffProcess(prev, prev))
+}
+
+func TestNewProcessSnapshot(t *testing.T) {
+	now := time.Date(2024, 8, 1, 10, 0, 0, 5, time.FixedZone("BRT", -3*60*60))
+	p := esaj.ProcessBasicInfo{OAB: esaj.MustParseOAB("123"), ProcessID: "1", Judge: "Fulano"}
+
+	snapshot, ok := NewProcessSnapshot(nil, p, now, "trace")
+	assert.True(t, ok)
+	assert.Equal(t, "2024-08-01T13:00:00.000000005Z", snapshot.ID)
+	assert.Equal(t, "1", snapshot.ProcessID)
+	assert.Equal(t, "trace", snapshot.TraceID)
+	assert.True(t, snapshot.Process.OAB.IsZero())
+	assert.Empty(t, snapshot.Diff)
+
+	_, ok = NewProcessSnapshot(&p, p, now, "trace")
+	assert.False(t, ok)
+
+	next := p
+	next.Judge = "Beltrano"
+	snapshot, ok = NewProcessSnapshot(&p, next, now, "trace")
+	assert.True(t, ok)
+	assert.Equal(t, []FieldChange{{Field: "judge", From: "Fulano", To: "Beltrano"}}, snapshot.Diff)
+}
+
+func TestNewOABRemovedSnapshot(t *testing.T) {
+	now := time.Date(2024, 8, 1, 10, 0, 0, 0, time.UTC)
+	p := esaj.ProcessBasicInfo{OAB: esaj.MustParseOAB("123"), ProcessID: "1", Judge: "Fulano"}
+
+	snapshot := NewOABRemovedSnapshot(p, esaj.MustParseOAB("123"), now, "trace")
+	assert.Equal(t, "2024-08-01T10:00:00.000000000Z", snapshot.ID)
+	assert.Equal(t, "1", snapshot.ProcessID)
+	assert.Equal(t, "Fulano", snapshot.Process.Judge)
+	assert.True(t, snapshot.Process.OAB.IsZero())
+	assert.Equal(t, []FieldChange{{Field: OABRemoved, From: esaj.MustParseOAB("123").String()}}, snapshot.Diff)
+}
@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/perebaj/esaj/storage"
+)
+
+// SaveAccessEvents saves the access events in memory
+func (s *Storage) SaveAccessEvents(_ context.Context, events []storage.AccessEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range events {
+		if _, ok := s.accesses[e.ID]; !ok {
+			s.accesses[e.ID] = e
+		}
+	}
+	return nil
+}
+
+// QueryAccessEvents returns a page of the access events saved in memory
+func (s *Storage) QueryAccessEvents(_ context.Context, q storage.AccessQuery) (storage.AccessPage, error) {
+	after, err := q.Normalize()
+	if err != nil {
+		return storage.AccessPage{}, err
+	}
+
+	s.mu.RLock()
+	var events []storage.AccessEvent
+	for _, e := range s.accesses {
+		if q.Match(e) && (after == nil || after.After(e)) {
+			events = append(events, e)
+		}
+	}
+	s.mu.RUnlock()
+
+	storage.SortAccessEvents(events)
+	var page storage.AccessPage
+	if len(events) > q.PageSize {
+		events = events[:q.PageSize]
+		page.NextCursor = q.CursorOf(events[q.PageSize-1]).String()
+	}
+	page.Events = events
+	return page, nil
+}
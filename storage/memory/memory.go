@@ -0,0 +1,512 @@
+// Package memory gather the storage implementation that keeps the data in memory. It has the same behavior of
+// the other backends and is meant for tests and short runs of the collector, since the data is lost when the
+// process exits.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/perebaj/esaj/clerk"
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/search"
+	"github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/tracing"
+)
+
+var _ storage.Storage = (*Storage)(nil)
+
+type process struct {
+	info      esaj.ProcessBasicInfo
+	oabs      []esaj.OAB
+	history   []storage.ProcessSnapshot
+	updatedAt time.Time
+}
+
+// key identifies the records that are unique by process, like the documents and the movements.
+type key struct {
+	processID string
+	id        string
+}
+
+// Storage is the storage that keeps the data in memory. The zero value is not usable, use NewStorage.
+// Storage is safe for concurrent use across goroutines.
+type Storage struct {
+	mu        sync.RWMutex
+	seeds     map[string]storage.ProcessSeed
+	processes map[string]process
+	users     map[string]storage.User
+	documents map[key]storage.Document
+	movements map[string]map[string]storage.Movement
+	// reads has the movements read by each user, and when.
+	reads map[string]map[key]time.Time
+	// index has the search document of each process.
+	index map[string]search.Document
+	// anonymized has the storage.SubjectHash of the names anonymized by AnonymizeParty.
+	anonymized map[string]bool
+	audits     []storage.PrivacyAudit
+	orgs       map[string]storage.Organization
+	// members has the members of each organization, by user ID.
+	members map[string]map[string]storage.Member
+	// annotations has the annotations of each organization, by ID.
+	annotations map[string]map[string]storage.Annotation
+	// accesses has the access events by ID.
+	accesses map[string]storage.AccessEvent
+	now      func() time.Time
+}
+
+// NewStorage creates an empty Storage.
+func NewStorage() *Storage {
+	return &Storage{
+		seeds:       make(map[string]storage.ProcessSeed),
+		processes:   make(map[string]process),
+		users:       make(map[string]storage.User),
+		documents:   make(map[key]storage.Document),
+		movements:   make(map[string]map[string]storage.Movement),
+		reads:       make(map[string]map[key]time.Time),
+		index:       make(map[string]search.Document),
+		anonymized:  make(map[string]bool),
+		orgs:        make(map[string]storage.Organization),
+		members:     make(map[string]map[string]storage.Member),
+		annotations: make(map[string]map[string]storage.Annotation),
+		accesses:    make(map[string]storage.AccessEvent),
+		now:         time.Now,
+	}
+}
+
+// SaveProcessSeeds saves the process seeds in memory
+func (s *Storage) SaveProcessSeeds(_ context.Context, ps []esaj.ProcessSeed) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for _, seed := range ps {
+		id := storage.SeedID(seed.ProcessID, seed.OAB)
+		createdAt := now
+		if existing, ok := s.seeds[id]; ok {
+			createdAt = existing.CreatedAt
+		}
+
+		s.seeds[id] = storage.ProcessSeed{
+			ID:        id,
+			ProcessID: seed.ProcessID,
+			OAB:       seed.OAB,
+			URL:       seed.URL,
+			Status:    storage.SeedPending,
+			CreatedAt: createdAt,
+			UpdatedAt: now,
+		}
+	}
+	return nil
+}
+
+// GetSeedsByOAB returns all the process seeds given an OAB identifier
+func (s *Storage) GetSeedsByOAB(_ context.Context, oab esaj.OAB) ([]storage.ProcessSeed, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var seeds []storage.ProcessSeed
+	for _, seed := range s.seeds {
+		if seed.OAB == oab {
+			seeds = append(seeds, seed)
+		}
+	}
+
+	sort.Slice(seeds, func(i, j int) bool {
+		return seeds[i].ProcessID < seeds[j].ProcessID
+	})
+	return seeds, nil
+}
+
+// QuerySeeds returns a page of the seeds of an OAB
+func (s *Storage) QuerySeeds(_ context.Context, q storage.SeedQuery) (storage.SeedPage, error) {
+	after, err := q.Normalize()
+	if err != nil {
+		return storage.SeedPage{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var seeds []storage.ProcessSeed
+	for _, seed := range s.seeds {
+		if seed.OAB == q.OAB && (q.Status == "" || seed.Status == q.Status) {
+			seeds = append(seeds, seed)
+		}
+	}
+
+	var page storage.SeedPage
+	page.Seeds, page.NextCursor = paginate(seeds, q.CursorOf, after, q.PageSize)
+	return page, nil
+}
+
+// ReconcileSeeds marks the seeds of an OAB that were not found as removed, and takes the OAB out of the
+// processes that were not found
+func (s *Storage) ReconcileSeeds(ctx context.Context, oab esaj.OAB, found []esaj.ProcessSeed) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	isFound := make(map[string]bool, len(found))
+	for _, seed := range found {
+		isFound[seed.ProcessID] = true
+	}
+
+	now := s.now()
+	removed := make(map[string]bool)
+	for id, seed := range s.seeds {
+		if seed.OAB == oab && seed.RemovedAt.IsZero() && !isFound[seed.ProcessID] {
+			seed.RemovedAt, seed.UpdatedAt = now, now
+			s.seeds[id] = seed
+			removed[seed.ProcessID] = true
+		}
+	}
+
+	for id, p := range s.processes {
+		i := slices.Index(p.oabs, oab)
+		if i < 0 || isFound[id] {
+			continue
+		}
+		// a new slice, so the slices returned before are not changed
+		p.oabs = slices.Delete(slices.Clone(p.oabs), i, i+1)
+		snapshot := storage.NewOABRemovedSnapshot(p.info, oab, now, tracing.GetTraceIDFromContext(ctx))
+		p.history = append(slices.Clip(p.history), snapshot)
+		s.processes[id] = p
+		s.index[id] = search.NewDocument(p.info, p.oabs)
+		removed[id] = true
+	}
+
+	ids := make([]string, 0, len(removed))
+	for id := range removed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// SaveProcessBasicInfo saves the process basic information in memory
+func (s *Storage) SaveProcessBasicInfo(ctx context.Context, pBasicInfo esaj.ProcessBasicInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pBasicInfo, _ = storage.AnonymizeProcess(pBasicInfo, s.anonymizedNames(pBasicInfo.Claimant, pBasicInfo.Defendant))
+	p, ok := s.processes[pBasicInfo.ProcessID]
+	var prev *esaj.ProcessBasicInfo
+	if ok {
+		prev = &p.info
+	}
+	now := s.now()
+	if snapshot, changed := storage.NewProcessSnapshot(prev, pBasicInfo, now, tracing.GetTraceIDFromContext(ctx)); changed {
+		p.history = append(slices.Clip(p.history), snapshot)
+	}
+
+	p.info = pBasicInfo
+	p.updatedAt = now
+	if !slices.Contains(p.oabs, pBasicInfo.OAB) {
+		// a new slice, so the slices returned before are not changed
+		p.oabs = append(slices.Clip(p.oabs), pBasicInfo.OAB)
+	}
+	s.processes[pBasicInfo.ProcessID] = p
+	s.index[pBasicInfo.ProcessID] = search.NewDocument(p.info, p.oabs)
+
+	seedID := storage.SeedID(pBasicInfo.ProcessID, pBasicInfo.OAB)
+	if seed, ok := s.seeds[seedID]; ok {
+		seed.Status = storage.SeedIngested
+		s.seeds[seedID] = seed
+	}
+	return nil
+}
+
+// ProcessBasicInfoByOAB returns all process that has the same OAB identifier
+func (s *Storage) ProcessBasicInfoByOAB(_ context.Context, oab esaj.OAB) ([]esaj.ProcessBasicInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var processBasicInfo []esaj.ProcessBasicInfo
+	for _, p := range s.processes {
+		if slices.Contains(p.oabs, oab) {
+			info := p.info
+			info.OAB = oab
+			processBasicInfo = append(processBasicInfo, info)
+		}
+	}
+
+	sort.Slice(processBasicInfo, func(i, j int) bool {
+		return processBasicInfo[i].ProcessID < processBasicInfo[j].ProcessID
+	})
+	return processBasicInfo, nil
+}
+
+// QueryProcesses returns a page of the processes of an OAB that match the filters of the query
+func (s *Storage) QueryProcesses(_ context.Context, q storage.ProcessQuery) (storage.ProcessPage, error) {
+	after, err := q.Normalize()
+	if err != nil {
+		return storage.ProcessPage{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var processes []process
+	for _, p := range s.processes {
+		if slices.Contains(p.oabs, q.OAB) && q.Match(p.info) {
+			processes = append(processes, p)
+		}
+	}
+
+	matched, next := paginate(processes, func(p process) storage.Cursor {
+		return q.CursorOf(p.info, p.updatedAt)
+	}, after, q.PageSize)
+
+	page := storage.ProcessPage{NextCursor: next}
+	for _, p := range matched {
+		info := p.info
+		info.OAB = q.OAB
+		page.Processes = append(page.Processes, info)
+	}
+	return page, nil
+}
+
+// paginate sorts the items by their cursors and returns the page that starts after the cursor after, and the
+// cursor of the next page.
+func paginate[T any](items []T, cursorOf func(T) storage.Cursor, after *storage.Cursor, size int) ([]T, string) {
+	sort.Slice(items, func(i, j int) bool {
+		return cursorOf(items[i]).Less(cursorOf(items[j]))
+	})
+
+	start := 0
+	if after != nil {
+		start = sort.Search(len(items), func(i int) bool {
+			return after.Less(cursorOf(items[i]))
+		})
+	}
+
+	items = items[start:]
+	if len(items) <= size {
+		return items, ""
+	}
+	return items[:size], cursorOf(items[size-1]).String()
+}
+
+// SearchProcesses returns the processes of the OABs of a query that match its text, the best ranked first
+func (s *Storage) SearchProcesses(_ context.Context, q search.Query) ([]search.Result, error) {
+	terms, err := q.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var docs []search.Document
+	for _, doc := range s.index {
+		if q.InScope(doc) {
+			docs = append(docs, doc)
+		}
+	}
+
+	results := search.Rank(docs, terms, q.Limit)
+	for i, r := range results {
+		info := s.processes[r.Process.ProcessID].info
+		info.OAB = q.ScopeOAB(s.index[info.ProcessID])
+		results[i].Process = info
+	}
+	return results, nil
+}
+
+// RebuildSearchIndex indexes again all the processes saved in memory
+func (s *Storage) RebuildSearchIndex(_ context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.index = make(map[string]search.Document, len(s.processes))
+	for id, p := range s.processes {
+		s.index[id] = search.NewDocument(p.info, p.oabs)
+	}
+	return len(s.index), nil
+}
+
+// ProcessHistory returns the snapshots of a process, from the oldest to the newest
+func (s *Storage) ProcessHistory(_ context.Context, processID string) ([]storage.ProcessSnapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var snapshots []storage.ProcessSnapshot
+	for _, snapshot := range s.processes[processID].history {
+		snapshot.Diff = slices.Clone(snapshot.Diff)
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+// ProcessOABs returns the OABs that found a process
+func (s *Storage) ProcessOABs(_ context.Context, processID string) ([]esaj.OAB, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.processes[processID]
+	if !ok {
+		return nil, fmt.Errorf("error getting the OABs of process %s: %w", processID, storage.ErrNotFound)
+	}
+	oabs := slices.Clone(p.oabs)
+	storage.SortOABs(oabs)
+	return oabs, nil
+}
+
+// SaveUser receive a generic clerk webhook event and save the user in memory
+func (s *Storage) SaveUser(ctx context.Context, event clerk.WebHookEvent) error {
+	user := storage.NewUser(event, tracing.GetTraceIDFromContext(ctx))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[user.ID] = user
+	return nil
+}
+
+// DeleteUser receive a generic clerk webhook event and delete the user in memory
+// This delete is a soft delete, the user is kept, but its DeletedAt is set with the current time
+func (s *Storage) DeleteUser(_ context.Context, event clerk.WebHookEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[event.Data.ID]
+	if !ok {
+		return fmt.Errorf("error deleting user %s: %w", event.Data.ID, storage.ErrNotFound)
+	}
+
+	user.DeletedAt = s.now().Format(time.RFC3339)
+	s.users[event.Data.ID] = user
+	return nil
+}
+
+// GetUser get a user from memory
+// If the user does not exist, it will return an empty user and a nil error.
+func (s *Storage) GetUser(_ context.Context, userID string) (storage.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user := s.users[userID]
+	user.EmailAddresses = slices.Clone(user.EmailAddresses)
+	return user, nil
+}
+
+// SaveDocument saves the document of a process in memory
+func (s *Storage) SaveDocument(_ context.Context, doc storage.Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := key{processID: doc.ProcessID, id: doc.ID}
+	now := s.now()
+
+	doc.CreatedAt = now
+	if existing, ok := s.documents[key]; ok {
+		doc.CreatedAt = existing.CreatedAt
+	}
+	doc.UpdatedAt = now
+	s.documents[key] = doc
+	return nil
+}
+
+// DocumentsByProcess returns all documents of a process
+func (s *Storage) DocumentsByProcess(_ context.Context, processID string) ([]storage.Document, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var documents []storage.Document
+	for key, doc := range s.documents {
+		if key.processID == processID {
+			documents = append(documents, doc)
+		}
+	}
+
+	sort.Slice(documents, func(i, j int) bool {
+		return documents[i].ID < documents[j].ID
+	})
+	return documents, nil
+}
+
+// SaveMovements saves the movements of a process that were not saved yet in memory
+func (s *Storage) SaveMovements(ctx context.Context, processID string, ms []esaj.Movement) ([]storage.Movement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved, ok := s.movements[processID]
+	if !ok {
+		saved = make(map[string]storage.Movement)
+		s.movements[processID] = saved
+	}
+
+	var created []storage.Movement
+	for _, m := range storage.NewMovements(processID, ms, s.now(), tracing.GetTraceIDFromContext(ctx)) {
+		if _, ok := saved[m.ID]; ok {
+			continue
+		}
+		m, _ = storage.AnonymizeMovement(m, s.anonymizedNames(m.Title, m.Text))
+		saved[m.ID] = m
+		created = append(created, m)
+	}
+	return created, nil
+}
+
+// MovementsByOAB returns the movements of the processes of an OAB saved since a time
+func (s *Storage) MovementsByOAB(_ context.Context, oab esaj.OAB, since time.Time) ([]storage.Movement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.movementsOf(oab, func(m storage.Movement) bool {
+		return !m.CreatedAt.Before(since)
+	}), nil
+}
+
+// MarkMovementsRead marks the movements of a process as read by a user
+func (s *Storage) MarkMovementsRead(_ context.Context, userID, processID string, movementIDs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reads, ok := s.reads[userID]
+	if !ok {
+		reads = make(map[key]time.Time)
+		s.reads[userID] = reads
+	}
+	now := s.now()
+	for _, id := range movementIDs {
+		if _, ok := reads[key{processID: processID, id: id}]; !ok {
+			reads[key{processID: processID, id: id}] = now
+		}
+	}
+	return nil
+}
+
+// UnreadMovements returns the movements of the processes of an OAB that were not read by a user
+func (s *Storage) UnreadMovements(_ context.Context, userID string, oab esaj.OAB) ([]storage.Movement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.movementsOf(oab, func(m storage.Movement) bool {
+		_, read := s.reads[userID][key{processID: m.ProcessID, id: m.ID}]
+		return !read
+	}), nil
+}
+
+// movementsOf returns the movements of the processes of the OAB that match the filter. It must be called with
+// the lock held.
+func (s *Storage) movementsOf(oab esaj.OAB, filter func(m storage.Movement) bool) []storage.Movement {
+	var movements []storage.Movement
+	for processID, p := range s.processes {
+		if !slices.Contains(p.oabs, oab) {
+			continue
+		}
+		for _, m := range s.movements[processID] {
+			if filter(m) {
+				movements = append(movements, m)
+			}
+		}
+	}
+
+	storage.SortMovements(movements)
+	return movements
+}
@@ -0,0 +1,60 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/perebaj/esaj/clerk"
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(_ *testing.T) storage.Storage {
+		return NewStorage()
+	})
+}
+
+func TestStorage_concurrent(t *testing.T) {
+	s := NewStorage()
+	ctx := context.Background()
+	oab := esaj.MustParseOAB("123")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			processID := fmt.Sprintf("%03d", i%5)
+
+			assert.NoError(t, s.SaveProcessSeeds(ctx, []esaj.ProcessSeed{{ProcessID: processID, OAB: oab}}))
+			assert.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{
+				ProcessID: processID,
+				OAB:       esaj.MustParseOAB(fmt.Sprintf("%d", 100+i)),
+			}))
+			assert.NoError(t, s.SaveUser(ctx, clerk.WebHookEvent{Data: clerk.Data{ID: processID}}))
+			_, err := s.ProcessBasicInfoByOAB(ctx, oab)
+			assert.NoError(t, err)
+			_, err = s.GetUser(ctx, processID)
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	seeds, err := s.GetSeedsByOAB(ctx, oab)
+	require.NoError(t, err)
+	assert.Len(t, seeds, 5)
+
+	// each process has the OABs of its 4 saves
+	for i := 0; i < 20; i++ {
+		got, err := s.ProcessBasicInfoByOAB(ctx, esaj.MustParseOAB(fmt.Sprintf("%d", 100+i)))
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, fmt.Sprintf("%03d", i%5), got[0].ProcessID)
+	}
+}
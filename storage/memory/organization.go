@@ -0,0 +1,185 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/perebaj/esaj/storage"
+)
+
+// SaveOrganization saves an organization in memory
+func (s *Storage) SaveOrganization(_ context.Context, o storage.Organization) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	o.CreatedAt = now
+	if existing, ok := s.orgs[o.ID]; ok {
+		o.CreatedAt = existing.CreatedAt
+	}
+	o.UpdatedAt = now
+	o.OABs = slices.Clone(o.OABs)
+	storage.SortOABs(o.OABs)
+	s.orgs[o.ID] = o
+	return nil
+}
+
+// GetOrganization returns an organization saved in memory
+func (s *Storage) GetOrganization(_ context.Context, id string) (storage.Organization, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	o, ok := s.orgs[id]
+	if !ok {
+		return storage.Organization{}, fmt.Errorf("error getting organization %s: %w", id, storage.ErrNotFound)
+	}
+	o.OABs = slices.Clone(o.OABs)
+	return o, nil
+}
+
+// SaveMember saves a member of an organization in memory
+func (s *Storage) SaveMember(_ context.Context, m storage.Member) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.orgs[m.OrganizationID]; !ok {
+		return fmt.Errorf("error saving member of organization %s: %w", m.OrganizationID, storage.ErrNotFound)
+	}
+	members, ok := s.members[m.OrganizationID]
+	if !ok {
+		members = make(map[string]storage.Member)
+		s.members[m.OrganizationID] = members
+	}
+
+	m.CreatedAt = s.now()
+	if existing, ok := members[m.UserID]; ok {
+		m.CreatedAt = existing.CreatedAt
+	}
+	members[m.UserID] = m
+	return nil
+}
+
+// GetMember returns a member of an organization
+func (s *Storage) GetMember(_ context.Context, organizationID, userID string) (storage.Member, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	m, ok := s.members[organizationID][userID]
+	if !ok {
+		return storage.Member{}, fmt.Errorf("error getting member %s of organization %s: %w", userID,
+			organizationID, storage.ErrNotFound)
+	}
+	return m, nil
+}
+
+// RemoveMember removes a member of an organization from memory
+func (s *Storage) RemoveMember(_ context.Context, organizationID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.members[organizationID][userID]; !ok {
+		return fmt.Errorf("error removing member %s of organization %s: %w", userID, organizationID,
+			storage.ErrNotFound)
+	}
+	delete(s.members[organizationID], userID)
+	return nil
+}
+
+// Members returns the members of an organization
+func (s *Storage) Members(_ context.Context, organizationID string) ([]storage.Member, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var members []storage.Member
+	for _, m := range s.members[organizationID] {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].UserID < members[j].UserID
+	})
+	return members, nil
+}
+
+// UserMemberships returns the memberships of a user
+func (s *Storage) UserMemberships(_ context.Context, userID string) ([]storage.Member, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var memberships []storage.Member
+	for _, members := range s.members {
+		if m, ok := members[userID]; ok {
+			memberships = append(memberships, m)
+		}
+	}
+	sort.Slice(memberships, func(i, j int) bool {
+		return memberships[i].OrganizationID < memberships[j].OrganizationID
+	})
+	return memberships, nil
+}
+
+// SaveAnnotation saves an annotation of an organization in memory
+func (s *Storage) SaveAnnotation(_ context.Context, a storage.Annotation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.orgs[a.OrganizationID]; !ok {
+		return fmt.Errorf("error saving annotation of organization %s: %w", a.OrganizationID, storage.ErrNotFound)
+	}
+	annotations, ok := s.annotations[a.OrganizationID]
+	if !ok {
+		annotations = make(map[string]storage.Annotation)
+		s.annotations[a.OrganizationID] = annotations
+	}
+
+	now := s.now()
+	a.CreatedAt = now
+	if existing, ok := annotations[a.ID]; ok {
+		a.CreatedAt = existing.CreatedAt
+	}
+	a.UpdatedAt = now
+	annotations[a.ID] = a
+	return nil
+}
+
+// GetAnnotation returns an annotation of an organization
+func (s *Storage) GetAnnotation(_ context.Context, organizationID, id string) (storage.Annotation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.annotations[organizationID][id]
+	if !ok {
+		return storage.Annotation{}, fmt.Errorf("error getting annotation %s of organization %s: %w", id,
+			organizationID, storage.ErrNotFound)
+	}
+	return a, nil
+}
+
+// DeleteAnnotation removes an annotation of an organization from memory
+func (s *Storage) DeleteAnnotation(_ context.Context, organizationID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.annotations[organizationID][id]; !ok {
+		return fmt.Errorf("error deleting annotation %s of organization %s: %w", id, organizationID,
+			storage.ErrNotFound)
+	}
+	delete(s.annotations[organizationID], id)
+	return nil
+}
+
+// Annotations returns the annotations of an organization on a process
+func (s *Storage) Annotations(_ context.Context, organizationID, processID string) ([]storage.Annotation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var annotations []storage.Annotation
+	for _, a := range s.annotations[organizationID] {
+		if a.ProcessID == processID {
+			annotations = append(annotations, a)
+		}
+	}
+	storage.SortAnnotations(annotations)
+	return annotations, nil
+}
@@ -0,0 +1,168 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/perebaj/esaj/search"
+	"github.com/perebaj/esaj/storage"
+)
+
+// anonymizedNames returns the names of the texts anonymized by AnonymizeParty. It must be called with the lock
+// acquired.
+func (s *Storage) anonymizedNames(texts ...string) []string {
+	var names []string
+	for hash, name := range storage.NameCandidates(texts...) {
+		if s.anonymized[hash] {
+			names = append(names, name)
+		}
+	}
+	storage.SortNames(names)
+	return names
+}
+
+// ExportUser returns the user and the movements it read
+func (s *Storage) ExportUser(_ context.Context, userID string) (storage.UserExport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return storage.UserExport{}, fmt.Errorf("error exporting user %s: %w", userID, storage.ErrNotFound)
+	}
+	user.EmailAddresses = slices.Clone(user.EmailAddresses)
+
+	export := storage.UserExport{
+		User:          user,
+		MovementReads: []storage.MovementRead{},
+		Memberships:   []storage.Member{},
+		Annotations:   []storage.Annotation{},
+	}
+	for k, readAt := range s.reads[userID] {
+		export.MovementReads = append(export.MovementReads, storage.MovementRead{
+			ProcessID:  k.processID,
+			MovementID: k.id,
+			ReadAt:     readAt,
+		})
+	}
+	for _, members := range s.members {
+		if m, ok := members[userID]; ok {
+			export.Memberships = append(export.Memberships, m)
+		}
+	}
+	for _, annotations := range s.annotations {
+		for _, a := range annotations {
+			if a.AuthorID == userID {
+				export.Annotations = append(export.Annotations, a)
+			}
+		}
+	}
+	storage.SortUserExport(export)
+	return export, nil
+}
+
+// PurgeUsers removes the users deleted before a time, with the movements they read and their memberships, and
+// removes them from the annotations they wrote
+func (s *Storage) PurgeUsers(_ context.Context, deletedBefore time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged []string
+	for id, user := range s.users {
+		if user.DeletedAt == "" {
+			continue
+		}
+		deletedAt, err := time.Parse(time.RFC3339, user.DeletedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing deletion time of user %s: %w", id, err)
+		}
+		if deletedAt.Before(deletedBefore) {
+			purged = append(purged, id)
+		}
+	}
+
+	for _, id := range purged {
+		delete(s.users, id)
+		delete(s.reads, id)
+		for _, members := range s.members {
+			delete(members, id)
+		}
+		for _, annotations := range s.annotations {
+			for annotationID, a := range annotations {
+				if a.AuthorID == id {
+					a.AuthorID = ""
+					annotations[annotationID] = a
+				}
+			}
+		}
+	}
+	sort.Strings(purged)
+	return purged, nil
+}
+
+// AnonymizeParty replaces a name in the processes saved in memory and in the ones saved later
+func (s *Storage) AnonymizeParty(_ context.Context, name string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.anonymized[storage.SubjectHash(name)] = true
+	names := []string{name}
+
+	var changed []string
+	for id, p := range s.processes {
+		var processChanged bool
+		p.info, processChanged = storage.AnonymizeProcess(p.info, names)
+
+		history := make([]storage.ProcessSnapshot, 0, len(p.history))
+		for _, snapshot := range p.history {
+			snapshot, snapshotChanged := storage.AnonymizeSnapshot(snapshot, names)
+			processChanged = processChanged || snapshotChanged
+			history = append(history, snapshot)
+		}
+		p.history = history
+
+		for movementID, m := range s.movements[id] {
+			if m, ok := storage.AnonymizeMovement(m, names); ok {
+				s.movements[id][movementID] = m
+				processChanged = true
+			}
+		}
+
+		if processChanged {
+			s.processes[id] = p
+			s.index[id] = search.NewDocument(p.info, p.oabs)
+			changed = append(changed, id)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// SavePrivacyAudit saves an audit record in memory
+func (s *Storage) SavePrivacyAudit(_ context.Context, a storage.PrivacyAudit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a.Records = slices.Clone(a.Records)
+	s.audits = append(s.audits, a)
+	return nil
+}
+
+// PrivacyAudits returns the audit records of a subject, or all of them
+func (s *Storage) PrivacyAudits(_ context.Context, subject string) ([]storage.PrivacyAudit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var audits []storage.PrivacyAudit
+	for _, a := range s.audits {
+		if subject == "" || a.Subject == subject {
+			a.Records = slices.Clone(a.Records)
+			audits = append(audits, a)
+		}
+	}
+	storage.SortPrivacyAudits(audits)
+	return audits, nil
+}
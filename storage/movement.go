@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/perebaj/esaj/esaj"
+)
+
+// Movement is a movement of a process saved in the storage.
+type Movement struct {
+	// ID is the MovementID of the movement, unique in the process.
+	ID        string    `json:"id"`
+	ProcessID string    `json:"process_id"`
+	Date      time.Time `json:"date"`
+	Title     string    `json:"title"`
+	Text      string    `json:"text"`
+	// CreatedAt is when the movement was saved for the first time, in the scrape that found it.
+	CreatedAt time.Time `json:"created_at"`
+	TraceID   string    `json:"trace_id"`
+}
+
+// MovementID returns the ID of a movement, a hash of its date, title and text. The same movement has the same
+// ID in all scrapes, so saving it again doesn't duplicate it. The spaces of the title and text are normalized,
+// since the eSAJ website is not consistent with them.
+func MovementID(m esaj.Movement) string {
+	h := sha256.New()
+	for _, part := range []string{m.Date.Format(time.DateOnly), strings.Join(strings.Fields(m.Title), " "),
+		strings.Join(strings.Fields(m.Text), " ")} {
+		h.Write([]byte(part))
+		// separates the parts, so moving text between the title and the text changes the hash
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// NewMovements returns the movements of the process with their IDs. The duplicated movements are removed.
+func NewMovements(processID string, ms []esaj.Movement, createdAt time.Time, traceID string) []Movement {
+	seen := make(map[string]bool)
+	var movements []Movement
+	for _, m := range ms {
+		id := MovementID(m)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		movements = append(movements, Movement{
+			ID:        id,
+			ProcessID: processID,
+			Date:      m.Date,
+			Title:     m.Title,
+			Text:      m.Text,
+			CreatedAt: createdAt,
+			TraceID:   traceID,
+		})
+	}
+	return movements
+}
+
+// SortMovements sorts the movements by date, process ID and ID, the order returned by the MovementRepository.
+func SortMovements(movements []Movement) {
+	sort.Slice(movements, func(i, j int) bool {
+		a, b := movements[i], movements[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.ProcessID != b.ProcessID {
+			return a.ProcessID < b.ProcessID
+		}
+		return a.ID < b.ID
+	})
+}
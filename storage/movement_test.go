@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMovementID(t *testing.T) {
+	date := time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)
+	m := esaj.Movement{Date: date, Title: "Certidão de Publicação Expedida", Text: "Relação: 0123/2024"}
+
+	id := MovementID(m)
+	assert.Len(t, id, 32)
+	// the ID must not change between releases, otherwise the saved movements are duplicated
+	assert.Equal(t, "50fabb2b8bfad3f1f5f6931991770e05", id)
+
+	// the spaces and the time of the date don't change the ID
+	assert.Equal(t, id, MovementID(esaj.Movement{Date: date.Add(time.Hour), Title: " Certidão de  Publicação Expedida", Text: "Relação:\n0123/2024"}))
+
+	for _, other := range []esaj.Movement{
+		{Date: date.AddDate(0, 0, 1), Title: m.Title, Text: m.Text},
+		{Date: date, Title: "Certidão", Text: m.Text},
+		{Date: date, Title: m.Title},
+		// the text moved to the title
+		{Date: date, Title: m.Title + " Relação: 0123/2024"},
+	} {
+		assert.NotEqual(t, id, MovementID(other))
+	}
+}
+
+func TestNewMovements(t *testing.T) {
+	now := time.Now()
+	m := esaj.Movement{Date: now, Title: "Conclusos"}
+
+	movements := NewMovements("1", []esaj.Movement{m, m, {Date: now, Title: "Juntada"}}, now, "trace")
+	assert.Len(t, movements, 2)
+	assert.Equal(t, MovementID(m), movements[0].ID)
+	assert.Equal(t, "1", movements[0].ProcessID)
+	assert.Equal(t, "trace", movements[0].TraceID)
+	assert.Equal(t, now, movements[0].CreatedAt)
+}
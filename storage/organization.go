@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/search"
+)
+
+// MaxOrganizationOABs is the maximum number of OABs of an organization, so all of them are searched by one query.
+const MaxOrganizationOABs = search.MaxOABs
+
+// The roles of the members of an organization. The owners and the admins manage the organization, its OABs
+// and its members, while only the owners manage the other owners.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// Organization is a law firm. It owns a set of OABs, whose processes are seen by its members. An OAB may be
+// owned by many organizations, like the ones that share it through co-counsel.
+type Organization struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	OABs      []esaj.OAB `json:"oabs"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// HasOAB reports whether the OAB is owned by the organization.
+func (o Organization) HasOAB(oab esaj.OAB) bool {
+	return slices.Contains(o.OABs, oab)
+}
+
+// HasAnyOAB reports whether any of the OABs is owned by the organization. It's used to check if a process,
+// that may be found by many OABs, is seen by the organization.
+func (o Organization) HasAnyOAB(oabs []esaj.OAB) bool {
+	return slices.ContainsFunc(oabs, o.HasOAB)
+}
+
+// Member is a user of an organization, identified by its clerk user ID.
+type Member struct {
+	OrganizationID string `json:"organization_id"`
+	UserID         string `json:"user_id"`
+	// Role is RoleOwner, RoleAdmin or RoleMember.
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CanManage reports whether the member manages the organization, being an owner or an admin.
+func (m Member) CanManage() bool {
+	return m.Role == RoleOwner || m.Role == RoleAdmin
+}
+
+// ValidRole reports whether the role is one of the member roles.
+func ValidRole(role string) bool {
+	return role == RoleOwner || role == RoleAdmin || role == RoleMember
+}
+
+// Annotation is a private note of an organization on a process. It's only seen by the members of the
+// organization, even when the process is also seen by other organizations. Its AuthorID is empty after the author was
+// purged, the annotation is kept by the organization.
+type Annotation struct {
+	ID             string    `json:"id"`
+	OrganizationID string    `json:"organization_id"`
+	ProcessID      string    `json:"process_id"`
+	AuthorID       string    `json:"author_id"`
+	Text           string    `json:"text"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// OrganizationRepository saves the organizations, their members and their annotations. The annotations are
+// always read through the organization that wrote them.
+type OrganizationRepository interface {
+	// SaveOrganization creates or replaces the organization, identified by its ID, keeping its creation time.
+	SaveOrganization(ctx context.Context, o Organization) error
+	// GetOrganization returns the organization, with its OABs sorted. ErrNotFound is returned when it doesn't
+	// exist.
+	GetOrganization(ctx context.Context, id string) (Organization, error)
+	// SaveMember creates or replaces the member of the organization, keeping its creation time. ErrNotFound is
+	// returned when the organization doesn't exist.
+	SaveMember(ctx context.Context, m Member) error
+	// GetMember returns the member of the organization. ErrNotFound is returned when the user is not a member.
+	GetMember(ctx context.Context, organizationID, userID string) (Member, error)
+	// RemoveMember removes the user from the organization. ErrNotFound is returned when the user is not a
+	// member.
+	RemoveMember(ctx context.Context, organizationID, userID string) error
+	// Members returns the members of the organization, ordered by user ID.
+	Members(ctx context.Context, organizationID string) ([]Member, error)
+	// UserMemberships returns the memberships of the user, ordered by organization ID.
+	UserMemberships(ctx context.Context, userID string) ([]Member, error)
+	// SaveAnnotation creates or replaces the annotation, identified by its organization ID and ID, keeping its
+	// creation time. ErrNotFound is returned when the organization doesn't exist.
+	SaveAnnotation(ctx context.Context, a Annotation) error
+	// GetAnnotation returns the annotation of the organization. ErrNotFound is returned when it doesn't exist.
+	GetAnnotation(ctx context.Context, organizationID, id string) (Annotation, error)
+	// DeleteAnnotation removes the annotation of the organization. ErrNotFound is returned when it doesn't
+	// exist.
+	DeleteAnnotation(ctx context.Context, organizationID, id string) error
+	// Annotations returns the annotations of the organization on the process, ordered by creation time and ID.
+	Annotations(ctx context.Context, organizationID, processID string) ([]Annotation, error)
+}
+
+// SortOABs sorts the OABs by their string form, the order of the OABs of an organization.
+func SortOABs(oabs []esaj.OAB) {
+	sort.Slice(oabs, func(i, j int) bool {
+		return oabs[i].String() < oabs[j].String()
+	})
+}
+
+// SortAnnotations sorts the annotations by creation time and ID, the order returned by the
+// OrganizationRepository.
+func SortAnnotations(annotations []Annotation) {
+	sort.Slice(annotations, func(i, j int) bool {
+		if !annotations[i].CreatedAt.Equal(annotations[j].CreatedAt) {
+			return annotations[i].CreatedAt.Before(annotations[j].CreatedAt)
+		}
+		return annotations[i].ID < annotations[j].ID
+	})
+}
+
+// NewID returns a random ID for the records that have no natural one, like the organizations, the annotations
+// and the audit records.
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
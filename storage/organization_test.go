@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrganization_HasAnyOAB(t *testing.T) {
+	org := Organization{OABs: []esaj.OAB{esaj.MustParseOAB("123"), esaj.MustParseOAB("456/RJ")}}
+
+	assert.True(t, org.HasOAB(esaj.MustParseOAB("123/SP")))
+	assert.False(t, org.HasOAB(esaj.MustParseOAB("456")))
+	assert.True(t, org.HasAnyOAB([]esaj.OAB{esaj.MustParseOAB("789"), esaj.MustParseOAB("456/RJ")}))
+	assert.False(t, org.HasAnyOAB([]esaj.OAB{esaj.MustParseOAB("789")}))
+	assert.False(t, org.HasAnyOAB(nil))
+}
+
+func TestMember_CanManage(t *testing.T) {
+	assert.True(t, Member{Role: RoleOwner}.CanManage())
+	assert.True(t, Member{Role: RoleAdmin}.CanManage())
+	assert.False(t, Member{Role: RoleMember}.CanManage())
+	assert.False(t, ValidRole("boss"))
+}
+
+func TestNewID(t *testing.T) {
+	a, err := NewID()
+	require.NoError(t, err)
+	b, err := NewID()
+	require.NoError(t, err)
+	assert.Len(t, a, 32)
+	assert.NotEqual(t, a, b)
+}
@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/search"
+)
+
+// Anonymized replaces the names of the anonymized parties in the processes.
+const Anonymized = "[ANONIMIZADO]"
+
+// MaxNameWords is the maximum number of words of an anonymized name. The anonymized names are not kept, only
+// their SubjectHash, so the saved texts are matched by the hashes of their sequences of up to MaxNameWords words.
+const MaxNameWords = 10
+
+// The operations recorded in the privacy audit.
+const (
+	PrivacyExport    = "export"
+	PrivacyPurge     = "purge"
+	PrivacyAnonymize = "anonymize"
+)
+
+// MovementRead is a movement read by a user.
+type MovementRead struct {
+	ProcessID  string    `json:"process_id"`
+	MovementID string    `json:"movement_id"`
+	ReadAt     time.Time `json:"read_at"`
+}
+
+// UserExport is all the data tied to a user, as returned to the data subject.
+type UserExport struct {
+	User User `json:"user"`
+	// MovementReads are the movements read by the user, ordered by process ID and movement ID.
+	MovementReads []MovementRead `json:"movement_reads"`
+	// Memberships are the organizations of the user, ordered by organization ID.
+	Memberships []Member `json:"memberships"`
+	// Annotations are the annotations written by the user, ordered by organization ID, creation time and ID.
+	Annotations []Annotation `json:"annotations"`
+}
+
+// SortUserExport sorts the records of the export in the order of the UserExport fields.
+func SortUserExport(e UserExport) {
+	sort.Slice(e.MovementReads, func(i, j int) bool {
+		a, b := e.MovementReads[i], e.MovementReads[j]
+		if a.ProcessID != b.ProcessID {
+			return a.ProcessID < b.ProcessID
+		}
+		return a.MovementID < b.MovementID
+	})
+	sort.Slice(e.Memberships, func(i, j int) bool {
+		return e.Memberships[i].OrganizationID < e.Memberships[j].OrganizationID
+	})
+	SortAnnotations(e.Annotations)
+	sort.SliceStable(e.Annotations, func(i, j int) bool {
+		return e.Annotations[i].OrganizationID < e.Annotations[j].OrganizationID
+	})
+}
+
+// PrivacyAudit records an operation on personal data. It doesn't keep the personal data itself.
+type PrivacyAudit struct {
+	ID string `json:"id"`
+	// Operation is PrivacyExport, PrivacyPurge or PrivacyAnonymize.
+	Operation string `json:"operation"`
+	// Subject identifies the data subject: the user ID, or the SubjectHash of an anonymized name.
+	Subject string `json:"subject"`
+	// Actor is who requested the operation.
+	Actor string `json:"actor"`
+	// Records are the IDs of the changed records, like the processes of an anonymization.
+	Records   []string  `json:"records"`
+	CreatedAt time.Time `json:"created_at"`
+	TraceID   string    `json:"trace_id"`
+}
+
+// SortPrivacyAudits sorts the audit records by creation time and ID, the order returned by the
+// PrivacyRepository.
+func SortPrivacyAudits(audits []PrivacyAudit) {
+	sort.Slice(audits, func(i, j int) bool {
+		if !audits[i].CreatedAt.Equal(audits[j].CreatedAt) {
+			return audits[i].CreatedAt.Before(audits[j].CreatedAt)
+		}
+		return audits[i].ID < audits[j].ID
+	})
+}
+
+// SubjectHash identifies an anonymized name without keeping it. Names that differ only in case, accents or
+// spaces have the same hash.
+func SubjectHash(name string) string {
+	h := sha256.Sum256([]byte(strings.Join(strings.Fields(search.Normalize(name)), " ")))
+	return hex.EncodeToString(h[:])[:32]
+}
+
+// NameWords returns the number of words of the name, the sequences of letters and digits.
+func NameWords(name string) int {
+	folded, _, _ := fold(name)
+	return len(wordSpans(folded))
+}
+
+// NameCandidates returns the names that AnonymizeText could find in the texts, keyed by their SubjectHash: the
+// sequences of up to MaxNameWords whole words. The names anonymized in the texts are the candidates whose hash
+// was anonymized, so only the hashes of the anonymized names are kept.
+func NameCandidates(texts ...string) map[string]string {
+	candidates := make(map[string]string)
+	for _, text := range texts {
+		folded, _, _ := fold(text)
+		spans := wordSpans(folded)
+		for i := range spans {
+			for j := i; j < len(spans) && j-i < MaxNameWords; j++ {
+				name := string(folded[spans[i][0]:spans[j][1]])
+				candidates[SubjectHash(name)] = name
+			}
+		}
+	}
+	return candidates
+}
+
+// SortNames sorts the names found by NameCandidates longest first, so the anonymized names are replaced before
+// the shorter ones inside them, whatever the order they were found.
+func SortNames(names []string) {
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+}
+
+// wordSpans returns the start and the end of each word of the folded runes.
+func wordSpans(folded []rune) [][2]int {
+	var spans [][2]int
+	for i := 0; i < len(folded); i++ {
+		if !isWord(folded[i]) {
+			continue
+		}
+		start := i
+		for i < len(folded) && isWord(folded[i]) {
+			i++
+		}
+		spans = append(spans, [2]int{start, i})
+	}
+	return spans
+}
+
+// AnonymizeText replaces the names in the text by Anonymized. The names are matched as whole words, ignoring
+// case, accents and the number of spaces between the words.
+func AnonymizeText(text string, names []string) (string, bool) {
+	changed := false
+	for _, name := range names {
+		want := []rune(strings.Join(strings.Fields(search.Normalize(name)), " "))
+		if len(want) == 0 {
+			continue
+		}
+
+		folded, starts, ends := fold(text)
+		var b strings.Builder
+		last := 0
+		for i := 0; i+len(want) <= len(folded); i++ {
+			end := i + len(want)
+			if !slices.Equal(folded[i:end], want) || (i > 0 && isWord(folded[i-1])) ||
+				(end < len(folded) && isWord(folded[end])) {
+				continue
+			}
+			b.WriteString(text[last:starts[i]])
+			b.WriteString(Anonymized)
+			last = ends[end-1]
+			i = end - 1
+		}
+		if last == 0 {
+			continue
+		}
+		b.WriteString(text[last:])
+		text, changed = b.String(), true
+	}
+	return text, changed
+}
+
+// fold returns the normalized runes of the text, with its spaces collapsed, and the byte offsets in the text
+// where each of them starts and ends.
+func fold(text string) ([]rune, []int, []int) {
+	var (
+		folded       []rune
+		starts, ends []int
+	)
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		next := i + size
+		if unicode.IsSpace(r) {
+			if len(folded) > 0 && folded[len(folded)-1] == ' ' {
+				ends[len(ends)-1] = next
+				i = next
+				continue
+			}
+			r = ' '
+		}
+		for _, f := range search.Normalize(string(r)) {
+			folded = append(folded, f)
+			starts = append(starts, i)
+			ends = append(ends, next)
+		}
+		i = next
+	}
+	return folded, starts, ends
+}
+
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// AnonymizeProcess replaces the names in the parties of the process, the claimant and the defendant with
+// their lawyers.
+func AnonymizeProcess(p esaj.ProcessBasicInfo, names []string) (esaj.ProcessBasicInfo, bool) {
+	var claimant, defendant bool
+	p.Claimant, claimant = AnonymizeText(p.Claimant, names)
+	p.Defendant, defendant = AnonymizeText(p.Defendant, names)
+	return p, claimant || defendant
+}
+
+// AnonymizeSnapshot replaces the names in the parties of the snapshot and of its diff.
+func AnonymizeSnapshot(s ProcessSnapshot, names []string) (ProcessSnapshot, bool) {
+	var changed bool
+	s.Process, changed = AnonymizeProcess(s.Process, names)
+
+	s.Diff = slices.Clone(s.Diff)
+	for i, c := range s.Diff {
+		if c.Field != "claimant" && c.Field != "defendant" {
+			continue
+		}
+		var from, to bool
+		s.Diff[i].From, from = AnonymizeText(c.From, names)
+		s.Diff[i].To, to = AnonymizeText(c.To, names)
+		changed = changed || from || to
+	}
+	return s, changed
+}
+
+// AnonymizeMovement replaces the names in the title and the text of the movement. Its ID is kept, so the
+// original movement is not saved again by the next scrape.
+func AnonymizeMovement(m Movement, names []string) (Movement, bool) {
+	var title, text bool
+	m.Title, title = AnonymizeText(m.Title, names)
+	m.Text, text = AnonymizeText(m.Text, names)
+	return m, title || text
+}
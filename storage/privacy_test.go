@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnonymizeText(t *testing.T) {
+	names := []string{"José da Silva"}
+	tests := []struct {
+		text    string
+		want    string
+		changed bool
+	}{
+		{"José da Silva", Anonymized, true},
+		{"JOSE DA SILVA Advogado: Ana Lima", Anonymized + " Advogado: Ana Lima", true},
+		{"Citação de josé  da\nsilva.", "Citação de " + Anonymized + ".", true},
+		{"José da Silva e José da Silva", Anonymized + " e " + Anonymized, true},
+		// only whole words
+		{"José da Silveira", "José da Silveira", false},
+		{"Maria José da Silva", "Maria " + Anonymized, true},
+		{"AntonioJosé da Silva", "AntonioJosé da Silva", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, changed := AnonymizeText(tt.text, names)
+		assert.Equal(t, tt.want, got, tt.text)
+		assert.Equal(t, tt.changed, changed, tt.text)
+	}
+
+	got, changed := AnonymizeText("Ana Lima x Rui Costa", []string{"ana lima", "  ", "RUI COSTA"})
+	assert.True(t, changed)
+	assert.Equal(t, Anonymized+" x "+Anonymized, got)
+}
+
+func TestAnonymizeSnapshot(t *testing.T) {
+	s := ProcessSnapshot{
+		Process: esaj.ProcessBasicInfo{Claimant: "Ana Lima", Class: "Ana Lima"},
+		Diff: []FieldChange{
+			{Field: "claimant", From: "Ana  Lima", To: "Ana Lima Advogado: Rui Costa"},
+			{Field: "class", From: "Ana Lima", To: "Outra"},
+		},
+	}
+
+	got, changed := AnonymizeSnapshot(s, []string{"Ana Lima"})
+	assert.True(t, changed)
+	assert.Equal(t, Anonymized, got.Process.Claimant)
+	assert.Equal(t, "Ana Lima", got.Process.Class)
+	assert.Equal(t, Anonymized, got.Diff[0].From)
+	assert.Equal(t, Anonymized+" Advogado: Rui Costa", got.Diff[0].To)
+	assert.Equal(t, "Ana Lima", got.Diff[1].From)
+	// the snapshot is not changed
+	assert.Equal(t, "Ana  Lima", s.Diff[0].From)
+}
+
+func TestNameCandidates(t *testing.T) {
+	candidates := NameCandidates("Maria José da Silva, Advogado: Ana Lima", "Citação de  JOSÉ DA\nSILVA.")
+
+	// the names found by AnonymizeText are candidates, whatever their case, accents or spaces
+	for _, name := range []string{"José da Silva", "Maria José da Silva", "Ana Lima", "Silva, Advogado", "citação"} {
+		assert.Contains(t, candidates, SubjectHash(name), name)
+	}
+	for _, name := range []string{"José da Silv", "Silva,", "Lima Citação"} {
+		assert.NotContains(t, candidates, SubjectHash(name), name)
+	}
+	assert.Equal(t, "jose da silva", candidates[SubjectHash("José da Silva")])
+
+	long := "a b c d e f g h i j k"
+	assert.Contains(t, NameCandidates(long), SubjectHash("a b c d e f g h i j"))
+	assert.NotContains(t, NameCandidates(long), SubjectHash(long))
+	assert.Equal(t, 11, NameWords(long))
+	assert.Equal(t, 3, NameWords(" D'Ávila  Souza "))
+}
+
+func TestSubjectHash(t *testing.T) {
+	h := SubjectHash("José da Silva")
+	assert.Len(t, h, 32)
+	assert.Equal(t, h, SubjectHash("  jose DA  silva "))
+	assert.NotEqual(t, h, SubjectHash("José da Silveira"))
+}
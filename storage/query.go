@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/perebaj/esaj/esaj"
+)
+
+// The page sizes of the paginated queries.
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+var (
+	// ErrInvalidQuery is returned when a query has an invalid order, page size or cursor.
+	ErrInvalidQuery = errors.New("invalid query")
+)
+
+// Order is the field that sorts the results of a paginated query. The results with the same value are sorted
+// by process ID, so the order is stable across the pages.
+type Order string
+
+// The orders of the paginated queries. The seeds can only be sorted by OrderProcessID and OrderUpdatedAt.
+const (
+	OrderProcessID Order = "process_id"
+	OrderUpdatedAt Order = "updated_at"
+	OrderClass     Order = "class"
+	OrderForo      Order = "foro"
+)
+
+// Cursor is the position of the last result of a page. The clients receive it as an opaque string, that
+// returns the next page when sent back with the same query.
+type Cursor struct {
+	Order Order `json:"o"`
+	Desc  bool  `json:"d,omitempty"`
+	// Value is the value of the order field in the last result, when the order is by class or foro.
+	Value string `json:"v,omitempty"`
+	// UpdatedAt is the update time of the last result, when the order is by update time.
+	UpdatedAt time.Time `json:"u"`
+	ProcessID string    `json:"id"`
+}
+
+// String encodes the cursor as an URL safe string.
+func (c Cursor) String() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseCursor decodes a cursor returned by Cursor.String.
+func ParseCursor(s string) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ProcessID == "" {
+		return Cursor{}, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	return c, nil
+}
+
+// Less reports whether the position of c comes before the position of o, in the order of c.
+func (c Cursor) Less(o Cursor) bool {
+	if c.Desc {
+		return ascending(o, c)
+	}
+	return ascending(c, o)
+}
+
+// ascending reports whether a comes before b in the ascending order.
+func ascending(a, b Cursor) bool {
+	switch {
+	case a.Order == OrderUpdatedAt && !a.UpdatedAt.Equal(b.UpdatedAt):
+		return a.UpdatedAt.Before(b.UpdatedAt)
+	case a.Value != b.Value:
+		return a.Value < b.Value
+	}
+	return a.ProcessID < b.ProcessID
+}
+
+// normalizePage sets the default page size and parses the cursor, that must be of the same order of the query.
+func normalizePage(order Order, desc bool, pageSize *int, cursor string) (*Cursor, error) {
+	switch {
+	case *pageSize == 0:
+		*pageSize = DefaultPageSize
+	case *pageSize < 0 || *pageSize > MaxPageSize:
+		return nil, fmt.Errorf("%w: page size must be between 1 and %d", ErrInvalidQuery, MaxPageSize)
+	}
+
+	if cursor == "" {
+		return nil, nil
+	}
+	c, err := ParseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if c.Order != order || c.Desc != desc {
+		return nil, fmt.Errorf("%w: cursor of another order", ErrInvalidQuery)
+	}
+	return &c, nil
+}
+
+// SeedQuery is a paginated query of the seeds of an OAB.
+type SeedQuery struct {
+	OAB esaj.OAB
+	// Status filters the seeds by status when not empty.
+	Status string
+	// OrderBy is OrderProcessID, the default, or OrderUpdatedAt.
+	OrderBy Order
+	Desc    bool
+	// PageSize is DefaultPageSize when zero.
+	PageSize int
+	// Cursor is the NextCursor of the previous page, empty for the first one.
+	Cursor string
+}
+
+// Normalize sets the defaults of the query and validates it. It returns the parsed cursor, nil in the
+// first page.
+func (q *SeedQuery) Normalize() (*Cursor, error) {
+	if q.OrderBy == "" {
+		q.OrderBy = OrderProcessID
+	}
+	if q.OrderBy != OrderProcessID && q.OrderBy != OrderUpdatedAt {
+		return nil, fmt.Errorf("%w: seeds can't be ordered by %q", ErrInvalidQuery, q.OrderBy)
+	}
+	if q.Status != "" && q.Status != SeedPending && q.Status != SeedIngested {
+		return nil, fmt.Errorf("%w: unknown seed status %q", ErrInvalidQuery, q.Status)
+	}
+	return normalizePage(q.OrderBy, q.Desc, &q.PageSize, q.Cursor)
+}
+
+// CursorOf returns the cursor that points to the seed.
+func (q SeedQuery) CursorOf(seed ProcessSeed) Cursor {
+	c := Cursor{Order: q.OrderBy, Desc: q.Desc, ProcessID: seed.ProcessID}
+	if q.OrderBy == OrderUpdatedAt {
+		c.UpdatedAt = seed.UpdatedAt
+	}
+	return c
+}
+
+// SeedPage is a page of the seeds of an OAB.
+type SeedPage struct {
+	Seeds []ProcessSeed
+	// NextCursor is the cursor of the next page, empty in the last one.
+	NextCursor string
+}
+
+// ProcessQuery is a paginated query of the processes of an OAB.
+type ProcessQuery struct {
+	OAB esaj.OAB
+	// Foro filters the processes by foro code when not empty. Example: "0053"
+	Foro string
+	// Class filters the processes by class when not empty. Example: "Procedimento Comum Cível"
+	Class string
+	// Situation filters the processes by situation when not empty. Example: "Em andamento"
+	Situation string
+	// OrderBy is OrderProcessID when empty.
+	OrderBy Order
+	Desc    bool
+	// PageSize is DefaultPageSize when zero.
+	PageSize int
+	// Cursor is the NextCursor of the previous page, empty for the first one.
+	Cursor string
+}
+
+// Normalize sets the defaults of the query and validates it. It returns the parsed cursor, nil in the
+// first page.
+func (q *ProcessQuery) Normalize() (*Cursor, error) {
+	if q.OrderBy == "" {
+		q.OrderBy = OrderProcessID
+	}
+	switch q.OrderBy {
+	case OrderProcessID, OrderUpdatedAt, OrderClass, OrderForo:
+	default:
+		return nil, fmt.Errorf("%w: processes can't be ordered by %q", ErrInvalidQuery, q.OrderBy)
+	}
+	return normalizePage(q.OrderBy, q.Desc, &q.PageSize, q.Cursor)
+}
+
+// Match reports whether the process passes the filters of the query. The OAB is not checked.
+func (q ProcessQuery) Match(p esaj.ProcessBasicInfo) bool {
+	return (q.Foro == "" || p.ProcessForo == q.Foro) &&
+		(q.Class == "" || p.Class == q.Class) &&
+		(q.Situation == "" || p.Situation == q.Situation)
+}
+
+// CursorOf returns the cursor that points to the process, updated at updatedAt.
+func (q ProcessQuery) CursorOf(p esaj.ProcessBasicInfo, updatedAt time.Time) Cursor {
+	c := Cursor{Order: q.OrderBy, Desc: q.Desc, ProcessID: p.ProcessID}
+	switch q.OrderBy {
+	case OrderUpdatedAt:
+		c.UpdatedAt = updatedAt
+	case OrderClass:
+		c.Value = p.Class
+	case OrderForo:
+		c.Value = p.ProcessForo
+	}
+	return c
+}
+
+// ProcessPage is a page of the processes of an OAB.
+type ProcessPage struct {
+	Processes []esaj.ProcessBasicInfo
+	// NextCursor is the cursor of the next page, empty in the last one.
+	NextCursor string
+}
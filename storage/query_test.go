@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursor(t *testing.T) {
+	c := Cursor{
+		Order:     OrderUpdatedAt,
+		Desc:      true,
+		UpdatedAt: time.Date(2024, 8, 1, 10, 0, 0, 123456789, time.UTC),
+		ProcessID: "1007573-30.2024.8.26.0229",
+	}
+
+	got, err := ParseCursor(c.String())
+	require.NoError(t, err)
+	assert.Equal(t, c.Order, got.Order)
+	assert.True(t, c.UpdatedAt.Equal(got.UpdatedAt))
+	assert.Equal(t, c.ProcessID, got.ProcessID)
+
+	for _, s := range []string{"", "invalid", "e30"} {
+		_, err := ParseCursor(s)
+		assert.ErrorIs(t, err, ErrInvalidQuery, s)
+	}
+}
+
+func TestCursor_Less(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 8, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		a, b Cursor
+		want bool
+	}{
+		{"by id", Cursor{ProcessID: "1"}, Cursor{ProcessID: "2"}, true},
+		{"same position", Cursor{ProcessID: "1"}, Cursor{ProcessID: "1"}, false},
+		{"by value", Cursor{Order: OrderClass, Value: "A", ProcessID: "2"}, Cursor{Order: OrderClass, Value: "B", ProcessID: "1"}, true},
+		{"by id in the same value", Cursor{Order: OrderClass, Value: "A", ProcessID: "2"}, Cursor{Order: OrderClass, Value: "A", ProcessID: "1"}, false},
+		{"by time", Cursor{Order: OrderUpdatedAt, UpdatedAt: day(2), ProcessID: "1"}, Cursor{Order: OrderUpdatedAt, UpdatedAt: day(1), ProcessID: "2"}, false},
+		{"desc", Cursor{Desc: true, ProcessID: "2"}, Cursor{Desc: true, ProcessID: "1"}, true},
+		{"desc same position", Cursor{Desc: true, ProcessID: "1"}, Cursor{Desc: true, ProcessID: "1"}, false},
+		{"desc by time", Cursor{Order: OrderUpdatedAt, Desc: true, UpdatedAt: day(2), ProcessID: "1"}, Cursor{Order: OrderUpdatedAt, Desc: true, UpdatedAt: day(1), ProcessID: "2"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.a.Less(tt.b))
+		})
+	}
+}
+
+func TestProcessQuery_Normalize(t *testing.T) {
+	q := ProcessQuery{}
+	after, err := q.Normalize()
+	require.NoError(t, err)
+	assert.Nil(t, after)
+	assert.Equal(t, OrderProcessID, q.OrderBy)
+	assert.Equal(t, DefaultPageSize, q.PageSize)
+
+	q = ProcessQuery{OrderBy: OrderClass, PageSize: 10}
+	q.Cursor = q.CursorOf(esaj.ProcessBasicInfo{ProcessID: "1", Class: "Execução Fiscal"}, time.Time{}).String()
+	after, err = q.Normalize()
+	require.NoError(t, err)
+	assert.Equal(t, "Execução Fiscal", after.Value)
+	assert.Equal(t, 10, q.PageSize)
+
+	for _, q := range []ProcessQuery{
+		{PageSize: -1},
+		{PageSize: MaxPageSize + 1},
+		{OrderBy: "judge"},
+		{OrderBy: OrderForo, Cursor: q.Cursor},
+		{OrderBy: OrderClass, Desc: true, Cursor: q.Cursor},
+	} {
+		_, err := q.Normalize()
+		assert.ErrorIs(t, err, ErrInvalidQuery)
+	}
+}
+
+func TestSeedQuery_Normalize(t *testing.T) {
+	q := SeedQuery{}
+	_, err := q.Normalize()
+	require.NoError(t, err)
+	assert.Equal(t, OrderProcessID, q.OrderBy)
+	assert.Equal(t, DefaultPageSize, q.PageSize)
+
+	for _, q := range []SeedQuery{
+		{OrderBy: OrderForo},
+		{Status: "done"},
+		{PageSize: MaxPageSize + 1},
+	} {
+		_, err := q.Normalize()
+		assert.ErrorIs(t, err, ErrInvalidQuery)
+	}
+}
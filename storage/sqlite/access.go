@@ -0,0 +1,95 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/perebaj/esaj/storage"
+)
+
+// SaveAccessEvents saves the access events in the sqlite database
+func (s *Storage) SaveAccessEvents(ctx context.Context, events []storage.AccessEvent) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		for _, e := range events {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO access_events (id, user_id, organization_id, trace_id, action, resource, created_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT (id) DO NOTHING`,
+				e.ID, e.UserID, e.OrganizationID, e.TraceID, e.Action, e.Resource, e.CreatedAt.UnixNano())
+			if err != nil {
+				return fmt.Errorf("error saving access event %s: %w", e.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// QueryAccessEvents returns a page of the access events that match the query
+func (s *Storage) QueryAccessEvents(ctx context.Context, q storage.AccessQuery) (storage.AccessPage, error) {
+	after, err := q.Normalize()
+	if err != nil {
+		return storage.AccessPage{}, err
+	}
+
+	var (
+		where []string
+		args  []any
+	)
+	for _, filter := range []struct{ column, value string }{
+		{"organization_id", q.OrganizationID},
+		{"user_id", q.UserID},
+		{"resource", q.Resource},
+	} {
+		if filter.value != "" {
+			where = append(where, filter.column+" = ?")
+			args = append(args, filter.value)
+		}
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, q.Since.UnixNano())
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, q.Until.UnixNano())
+	}
+	if after != nil {
+		where = append(where, "(created_at, id) > (?, ?)")
+		args = append(args, after.CreatedAt.UnixNano(), after.ID)
+	}
+
+	query := `SELECT id, user_id, organization_id, trace_id, action, resource, created_at FROM access_events`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY created_at, id LIMIT ?`
+	args = append(args, q.PageSize+1)
+
+	var page storage.AccessPage
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		return eachRow(ctx, tx, query, func(rows *sql.Rows) error {
+			var (
+				e         storage.AccessEvent
+				createdAt int64
+			)
+			if err := rows.Scan(&e.ID, &e.UserID, &e.OrganizationID, &e.TraceID, &e.Action, &e.Resource, &createdAt); err != nil {
+				return fmt.Errorf("error scanning access event: %w", err)
+			}
+			e.CreatedAt = time.Unix(0, createdAt)
+			page.Events = append(page.Events, e)
+			return nil
+		}, args...)
+	})
+	if err != nil {
+		return storage.AccessPage{}, err
+	}
+
+	if len(page.Events) > q.PageSize {
+		page.Events = page.Events[:q.PageSize]
+		page.NextCursor = q.CursorOf(page.Events[q.PageSize-1]).String()
+	}
+	return page, nil
+}
@@ -0,0 +1,242 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/storage"
+)
+
+// organizationExists returns storage.ErrNotFound when the organization doesn't exist.
+func organizationExists(ctx context.Context, tx *sql.Tx, id string) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) > 0 FROM organizations WHERE id = ?`, id).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("error getting organization %s: %w", id, err)
+	}
+	if !exists {
+		return fmt.Errorf("organization %s: %w", id, storage.ErrNotFound)
+	}
+	return nil
+}
+
+// SaveOrganization saves an organization, replacing its OABs, in the sqlite database
+func (s *Storage) SaveOrganization(ctx context.Context, o storage.Organization) error {
+	now := s.now().UnixNano()
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO organizations (id, name, created_at, updated_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET name = excluded.name, updated_at = excluded.updated_at`,
+			o.ID, o.Name, now, now)
+		if err != nil {
+			return fmt.Errorf("error saving organization %s: %w", o.ID, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM organization_oabs WHERE organization_id = ?`, o.ID); err != nil {
+			return fmt.Errorf("error removing the OABs of organization %s: %w", o.ID, err)
+		}
+		for _, oab := range o.OABs {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO organization_oabs (organization_id, oab) VALUES (?, ?) ON CONFLICT DO NOTHING`,
+				o.ID, oab.String())
+			if err != nil {
+				return fmt.Errorf("error saving OAB %s of organization %s: %w", oab, o.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// GetOrganization returns an organization saved in the sqlite database
+func (s *Storage) GetOrganization(ctx context.Context, id string) (storage.Organization, error) {
+	var o storage.Organization
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var createdAt, updatedAt int64
+		err := tx.QueryRowContext(ctx, `SELECT id, name, created_at, updated_at FROM organizations WHERE id = ?`, id).
+			Scan(&o.ID, &o.Name, &createdAt, &updatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("error getting organization %s: %w", id, storage.ErrNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("error getting organization %s: %w", id, err)
+		}
+		o.CreatedAt = time.Unix(0, createdAt)
+		o.UpdatedAt = time.Unix(0, updatedAt)
+
+		return eachRow(ctx, tx, `SELECT oab FROM organization_oabs WHERE organization_id = ? ORDER BY oab`,
+			func(rows *sql.Rows) error {
+				var raw string
+				if err := rows.Scan(&raw); err != nil {
+					return fmt.Errorf("error scanning oab of organization %s: %w", id, err)
+				}
+				oab, err := esaj.ParseOAB(raw)
+				if err != nil {
+					return fmt.Errorf("error parsing oab of organization %s: %w", id, err)
+				}
+				o.OABs = append(o.OABs, oab)
+				return nil
+			}, id)
+	})
+	if err != nil {
+		return storage.Organization{}, err
+	}
+	return o, nil
+}
+
+// SaveMember saves a member of an organization in the sqlite database
+func (s *Storage) SaveMember(ctx context.Context, m storage.Member) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := organizationExists(ctx, tx, m.OrganizationID); err != nil {
+			return fmt.Errorf("error saving member %s: %w", m.UserID, err)
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO organization_members (organization_id, user_id, role, created_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (organization_id, user_id) DO UPDATE SET role = excluded.role`,
+			m.OrganizationID, m.UserID, m.Role, s.now().UnixNano())
+		if err != nil {
+			return fmt.Errorf("error saving member %s of organization %s: %w", m.UserID, m.OrganizationID, err)
+		}
+		return nil
+	})
+}
+
+// GetMember returns a member of an organization
+func (s *Storage) GetMember(ctx context.Context, organizationID, userID string) (storage.Member, error) {
+	members, err := s.queryMembers(ctx, `WHERE organization_id = ? AND user_id = ?`, organizationID, userID)
+	if err != nil {
+		return storage.Member{}, err
+	}
+	if len(members) == 0 {
+		return storage.Member{}, fmt.Errorf("error getting member %s of organization %s: %w", userID,
+			organizationID, storage.ErrNotFound)
+	}
+	return members[0], nil
+}
+
+// RemoveMember removes a member of an organization from the sqlite database
+func (s *Storage) RemoveMember(ctx context.Context, organizationID, userID string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM organization_members WHERE organization_id = ? AND user_id = ?`,
+		organizationID, userID)
+	if err != nil {
+		return fmt.Errorf("error removing member %s of organization %s: %w", userID, organizationID, err)
+	}
+	return notFoundIfNone(res, fmt.Sprintf("error removing member %s of organization %s", userID, organizationID))
+}
+
+// Members returns the members of an organization
+func (s *Storage) Members(ctx context.Context, organizationID string) ([]storage.Member, error) {
+	return s.queryMembers(ctx, `WHERE organization_id = ? ORDER BY user_id`, organizationID)
+}
+
+// UserMemberships returns the memberships of a user
+func (s *Storage) UserMemberships(ctx context.Context, userID string) ([]storage.Member, error) {
+	return s.queryMembers(ctx, `WHERE user_id = ? ORDER BY organization_id`, userID)
+}
+
+func (s *Storage) queryMembers(ctx context.Context, where string, args ...any) ([]storage.Member, error) {
+	var members []storage.Member
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		return eachRow(ctx, tx, `SELECT organization_id, user_id, role, created_at FROM organization_members `+where,
+			func(rows *sql.Rows) error {
+				var (
+					m         storage.Member
+					createdAt int64
+				)
+				if err := rows.Scan(&m.OrganizationID, &m.UserID, &m.Role, &createdAt); err != nil {
+					return fmt.Errorf("error scanning member: %w", err)
+				}
+				m.CreatedAt = time.Unix(0, createdAt)
+				members = append(members, m)
+				return nil
+			}, args...)
+	})
+	return members, err
+}
+
+// SaveAnnotation saves an annotation of an organization in the sqlite database
+func (s *Storage) SaveAnnotation(ctx context.Context, a storage.Annotation) error {
+	now := s.now().UnixNano()
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := organizationExists(ctx, tx, a.OrganizationID); err != nil {
+			return fmt.Errorf("error saving annotation %s: %w", a.ID, err)
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO annotations (organization_id, id, process_id, author_id, text, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (organization_id, id) DO UPDATE SET
+				process_id = excluded.process_id, author_id = excluded.author_id, text = excluded.text,
+				updated_at = excluded.updated_at`,
+			a.OrganizationID, a.ID, a.ProcessID, a.AuthorID, a.Text, now, now)
+		if err != nil {
+			return fmt.Errorf("error saving annotation %s of organization %s: %w", a.ID, a.OrganizationID, err)
+		}
+		return nil
+	})
+}
+
+// GetAnnotation returns an annotation of an organization
+func (s *Storage) GetAnnotation(ctx context.Context, organizationID, id string) (storage.Annotation, error) {
+	annotations, err := s.queryAnnotations(ctx, `WHERE organization_id = ? AND id = ?`, organizationID, id)
+	if err != nil {
+		return storage.Annotation{}, err
+	}
+	if len(annotations) == 0 {
+		return storage.Annotation{}, fmt.Errorf("error getting annotation %s of organization %s: %w", id,
+			organizationID, storage.ErrNotFound)
+	}
+	return annotations[0], nil
+}
+
+// DeleteAnnotation removes an annotation of an organization from the sqlite database
+func (s *Storage) DeleteAnnotation(ctx context.Context, organizationID, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM annotations WHERE organization_id = ? AND id = ?`, organizationID, id)
+	if err != nil {
+		return fmt.Errorf("error deleting annotation %s of organization %s: %w", id, organizationID, err)
+	}
+	return notFoundIfNone(res, fmt.Sprintf("error deleting annotation %s of organization %s", id, organizationID))
+}
+
+// Annotations returns the annotations of an organization on a process
+func (s *Storage) Annotations(ctx context.Context, organizationID, processID string) ([]storage.Annotation, error) {
+	return s.queryAnnotations(ctx, `WHERE organization_id = ? AND process_id = ? ORDER BY created_at, id`,
+		organizationID, processID)
+}
+
+func (s *Storage) queryAnnotations(ctx context.Context, where string, args ...any) ([]storage.Annotation, error) {
+	var annotations []storage.Annotation
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		return eachRow(ctx, tx, `
+			SELECT organization_id, id, process_id, author_id, text, created_at, updated_at FROM annotations `+where,
+			func(rows *sql.Rows) error {
+				var (
+					a                    storage.Annotation
+					createdAt, updatedAt int64
+				)
+				err := rows.Scan(&a.OrganizationID, &a.ID, &a.ProcessID, &a.AuthorID, &a.Text, &createdAt, &updatedAt)
+				if err != nil {
+					return fmt.Errorf("error scanning annotation: %w", err)
+				}
+				a.CreatedAt = time.Unix(0, createdAt)
+				a.UpdatedAt = time.Unix(0, updatedAt)
+				annotations = append(annotations, a)
+				return nil
+			}, args...)
+	})
+	return annotations, err
+}
+
+// notFoundIfNone returns storage.ErrNotFound, wrapped in the message, when the statement changed no rows.
+func notFoundIfNone(res sql.Result, msg string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", msg, storage.ErrNotFound)
+	}
+	return nil
+}
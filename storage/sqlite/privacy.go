@@ -0,0 +1,331 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/storage"
+)
+
+// anonymizedNamesBatch is the number of hashes looked up by query, below the limit of parameters of SQLite.
+const anonymizedNamesBatch = 500
+
+// anonymizedNames returns the names of the texts anonymized by AnonymizeParty, looking up the hashes of their
+// storage.NameCandidates.
+func anonymizedNames(ctx context.Context, tx *sql.Tx, texts ...string) ([]string, error) {
+	candidates := storage.NameCandidates(texts...)
+	hashes := make([]any, 0, len(candidates))
+	for hash := range candidates {
+		hashes = append(hashes, hash)
+	}
+
+	var names []string
+	for len(hashes) > 0 {
+		batch := hashes[:min(len(hashes), anonymizedNamesBatch)]
+		hashes = hashes[len(batch):]
+
+		err := eachRow(ctx, tx, `SELECT hash FROM anonymized_parties WHERE hash IN (?`+
+			strings.Repeat(", ?", len(batch)-1)+`)`, func(rows *sql.Rows) error {
+			var hash string
+			if err := rows.Scan(&hash); err != nil {
+				return fmt.Errorf("error scanning anonymized name: %w", err)
+			}
+			names = append(names, candidates[hash])
+			return nil
+		}, batch...)
+		if err != nil {
+			return nil, fmt.Errorf("error getting anonymized names: %w", err)
+		}
+	}
+	storage.SortNames(names)
+	return names, nil
+}
+
+// ExportUser returns the user, the movements it read, its memberships and the annotations it wrote
+func (s *Storage) ExportUser(ctx context.Context, userID string) (storage.UserExport, error) {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return storage.UserExport{}, err
+	}
+	if user.ID == "" {
+		return storage.UserExport{}, fmt.Errorf("error exporting user %s: %w", userID, storage.ErrNotFound)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT process_id, movement_id, read_at FROM movement_reads
+		WHERE user_id = ? ORDER BY process_id, movement_id`, userID)
+	if err != nil {
+		return storage.UserExport{}, fmt.Errorf("error getting the movements read by user %s: %w", userID, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	export := storage.UserExport{User: user, MovementReads: []storage.MovementRead{}}
+	for rows.Next() {
+		var (
+			read   storage.MovementRead
+			readAt int64
+		)
+		if err := rows.Scan(&read.ProcessID, &read.MovementID, &readAt); err != nil {
+			return storage.UserExport{}, fmt.Errorf("error scanning movement read: %w", err)
+		}
+		read.ReadAt = time.Unix(0, readAt)
+		export.MovementReads = append(export.MovementReads, read)
+	}
+	if err := rows.Err(); err != nil {
+		return storage.UserExport{}, fmt.Errorf("error reading movements read: %w", err)
+	}
+
+	if export.Memberships, err = s.UserMemberships(ctx, userID); err != nil {
+		return storage.UserExport{}, err
+	}
+	if export.Memberships == nil {
+		export.Memberships = []storage.Member{}
+	}
+	export.Annotations, err = s.queryAnnotations(ctx, `WHERE author_id = ? ORDER BY organization_id, created_at, id`, userID)
+	if err != nil {
+		return storage.UserExport{}, fmt.Errorf("error getting the annotations of user %s: %w", userID, err)
+	}
+	if export.Annotations == nil {
+		export.Annotations = []storage.Annotation{}
+	}
+	return export, nil
+}
+
+// PurgeUsers removes the users deleted before a time, with the movements they read and their memberships, and
+// removes them from the annotations they wrote
+func (s *Storage) PurgeUsers(ctx context.Context, deletedBefore time.Time) ([]string, error) {
+	var purged []string
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT id, deleted_at FROM users WHERE deleted_at != '' ORDER BY id`)
+		if err != nil {
+			return fmt.Errorf("error getting deleted users: %w", err)
+		}
+		for rows.Next() {
+			var id, rawDeletedAt string
+			if err := rows.Scan(&id, &rawDeletedAt); err != nil {
+				_ = rows.Close()
+				return fmt.Errorf("error scanning deleted user: %w", err)
+			}
+			deletedAt, err := time.Parse(time.RFC3339, rawDeletedAt)
+			if err != nil {
+				_ = rows.Close()
+				return fmt.Errorf("error parsing deletion time of user %s: %w", id, err)
+			}
+			if deletedAt.Before(deletedBefore) {
+				purged = append(purged, id)
+			}
+		}
+		_ = rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error reading deleted users: %w", err)
+		}
+
+		for _, id := range purged {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM movement_reads WHERE user_id = ?`, id); err != nil {
+				return fmt.Errorf("error purging the movements read by user %s: %w", id, err)
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM organization_members WHERE user_id = ?`, id); err != nil {
+				return fmt.Errorf("error purging the memberships of user %s: %w", id, err)
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE annotations SET author_id = '' WHERE author_id = ?`, id); err != nil {
+				return fmt.Errorf("error purging the author of the annotations of user %s: %w", id, err)
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, id); err != nil {
+				return fmt.Errorf("error purging user %s: %w", id, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return purged, nil
+}
+
+// AnonymizeParty replaces a name in the processes saved in the sqlite database and in the ones saved later
+func (s *Storage) AnonymizeParty(ctx context.Context, name string) ([]string, error) {
+	names := []string{name}
+	changed := make(map[string]bool)
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO anonymized_parties (hash, created_at) VALUES (?, ?)
+			ON CONFLICT (hash) DO NOTHING`, storage.SubjectHash(name), s.now().UnixNano())
+		if err != nil {
+			return fmt.Errorf("error saving anonymized name: %w", err)
+		}
+
+		// the rows are read before being updated, since the transaction has a single connection
+		var processes []esaj.ProcessBasicInfo
+		err = eachRow(ctx, tx, `SELECT `+processColumns+` FROM process_basic_info p`, func(rows *sql.Rows) error {
+			var p esaj.ProcessBasicInfo
+			if err := scanProcess(rows, &p); err != nil {
+				return fmt.Errorf("error scanning process: %w", err)
+			}
+			if p, ok := storage.AnonymizeProcess(p, names); ok {
+				processes = append(processes, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, p := range processes {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE process_basic_info SET claimant = ?, defendant = ? WHERE process_id = ?`,
+				p.Claimant, p.Defendant, p.ProcessID)
+			if err != nil {
+				return fmt.Errorf("error anonymizing process %s: %w", p.ProcessID, err)
+			}
+			changed[p.ProcessID] = true
+		}
+
+		var snapshots []storage.ProcessSnapshot
+		err = eachRow(ctx, tx, `SELECT process_id, id, process, diff FROM process_history`, func(rows *sql.Rows) error {
+			var (
+				snapshot      storage.ProcessSnapshot
+				process, diff string
+			)
+			if err := rows.Scan(&snapshot.ProcessID, &snapshot.ID, &process, &diff); err != nil {
+				return fmt.Errorf("error scanning snapshot: %w", err)
+			}
+			if err := json.Unmarshal([]byte(process), &snapshot.Process); err != nil {
+				return fmt.Errorf("error parsing snapshot %s: %w", snapshot.ID, err)
+			}
+			if err := json.Unmarshal([]byte(diff), &snapshot.Diff); err != nil {
+				return fmt.Errorf("error parsing diff of snapshot %s: %w", snapshot.ID, err)
+			}
+			if snapshot, ok := storage.AnonymizeSnapshot(snapshot, names); ok {
+				snapshots = append(snapshots, snapshot)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, snapshot := range snapshots {
+			process, err := json.Marshal(snapshot.Process)
+			if err != nil {
+				return fmt.Errorf("error encoding snapshot: %w", err)
+			}
+			diff, err := json.Marshal(snapshot.Diff)
+			if err != nil {
+				return fmt.Errorf("error encoding snapshot diff: %w", err)
+			}
+			_, err = tx.ExecContext(ctx, `
+				UPDATE process_history SET process = ?, diff = ? WHERE process_id = ? AND id = ?`,
+				string(process), string(diff), snapshot.ProcessID, snapshot.ID)
+			if err != nil {
+				return fmt.Errorf("error anonymizing snapshot %s of process %s: %w", snapshot.ID,
+					snapshot.ProcessID, err)
+			}
+			changed[snapshot.ProcessID] = true
+		}
+
+		var movements []storage.Movement
+		err = eachRow(ctx, tx, `SELECT process_id, id, title, text FROM movements`, func(rows *sql.Rows) error {
+			var m storage.Movement
+			if err := rows.Scan(&m.ProcessID, &m.ID, &m.Title, &m.Text); err != nil {
+				return fmt.Errorf("error scanning movement: %w", err)
+			}
+			if m, ok := storage.AnonymizeMovement(m, names); ok {
+				movements = append(movements, m)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, m := range movements {
+			_, err := tx.ExecContext(ctx, `UPDATE movements SET title = ?, text = ? WHERE process_id = ? AND id = ?`,
+				m.Title, m.Text, m.ProcessID, m.ID)
+			if err != nil {
+				return fmt.Errorf("error anonymizing movement %s of process %s: %w", m.ID, m.ProcessID, err)
+			}
+			changed[m.ProcessID] = true
+		}
+
+		for _, p := range processes {
+			if err := indexProcess(ctx, tx, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for id := range changed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// SavePrivacyAudit saves an audit record in the sqlite database
+func (s *Storage) SavePrivacyAudit(ctx context.Context, a storage.PrivacyAudit) error {
+	records, err := json.Marshal(a.Records)
+	if err != nil {
+		return fmt.Errorf("error encoding audit records: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO privacy_audit (id, operation, subject, actor, records, created_at, trace_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		a.ID, a.Operation, a.Subject, a.Actor, string(records), a.CreatedAt.UnixNano(), a.TraceID)
+	if err != nil {
+		return fmt.Errorf("error saving audit %s: %w", a.ID, err)
+	}
+	return nil
+}
+
+// PrivacyAudits returns the audit records of a subject, or all of them
+func (s *Storage) PrivacyAudits(ctx context.Context, subject string) ([]storage.PrivacyAudit, error) {
+	var query strings.Builder
+	query.WriteString(`SELECT id, operation, subject, actor, records, created_at, trace_id FROM privacy_audit`)
+	var args []any
+	if subject != "" {
+		query.WriteString(` WHERE subject = ?`)
+		args = append(args, subject)
+	}
+	query.WriteString(` ORDER BY created_at, id`)
+
+	rows, err := s.db.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying audits: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var audits []storage.PrivacyAudit
+	for rows.Next() {
+		var (
+			a         storage.PrivacyAudit
+			records   string
+			createdAt int64
+		)
+		if err := rows.Scan(&a.ID, &a.Operation, &a.Subject, &a.Actor, &records, &createdAt, &a.TraceID); err != nil {
+			return nil, fmt.Errorf("error scanning audit: %w", err)
+		}
+		if err := json.Unmarshal([]byte(records), &a.Records); err != nil {
+			return nil, fmt.Errorf("error parsing records of audit %s: %w", a.ID, err)
+		}
+		a.CreatedAt = time.Unix(0, createdAt)
+		audits = append(audits, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading audits: %w", err)
+	}
+	return audits, nil
+}
@@ -0,0 +1,158 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/storage"
+)
+
+// keyset returns the condition that selects the rows after the cursor and the ORDER BY clause of a paginated
+// query. column is the column of the order, empty when the order is only by idColumn.
+func keyset(column, idColumn string, after *storage.Cursor, desc bool) (string, []any, string) {
+	op, dir := ">", "ASC"
+	if desc {
+		op, dir = "<", "DESC"
+	}
+
+	if column == "" {
+		orderBy := fmt.Sprintf("%s %s", idColumn, dir)
+		if after == nil {
+			return "", nil, orderBy
+		}
+		return fmt.Sprintf(" AND %s %s ?", idColumn, op), []any{after.ProcessID}, orderBy
+	}
+
+	orderBy := fmt.Sprintf("%s %s, %s %s", column, dir, idColumn, dir)
+	if after == nil {
+		return "", nil, orderBy
+	}
+
+	var value any = after.Value
+	if after.Order == storage.OrderUpdatedAt {
+		value = after.UpdatedAt.UnixNano()
+	}
+	cond := fmt.Sprintf(" AND (%s %s ? OR (%s = ? AND %s %s ?))", column, op, column, idColumn, op)
+	return cond, []any{value, value, after.ProcessID}, orderBy
+}
+
+// QuerySeeds returns a page of the seeds of an OAB
+func (s *Storage) QuerySeeds(ctx context.Context, q storage.SeedQuery) (storage.SeedPage, error) {
+	after, err := q.Normalize()
+	if err != nil {
+		return storage.SeedPage{}, err
+	}
+
+	var query strings.Builder
+	query.WriteString(`SELECT ` + seedColumns + ` FROM process_seeds WHERE oab = ?`)
+	args := []any{q.OAB.String()}
+	if q.Status != "" {
+		query.WriteString(` AND status = ?`)
+		args = append(args, q.Status)
+	}
+
+	column := ""
+	if q.OrderBy == storage.OrderUpdatedAt {
+		column = "updated_at"
+	}
+	cond, condArgs, orderBy := keyset(column, "process_id", after, q.Desc)
+	query.WriteString(cond + ` ORDER BY ` + orderBy + ` LIMIT ?`)
+	args = append(append(args, condArgs...), q.PageSize+1)
+
+	rows, err := s.db.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return storage.SeedPage{}, fmt.Errorf("error querying seeds: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var page storage.SeedPage
+	for rows.Next() {
+		seed, err := scanSeed(rows)
+		if err != nil {
+			return storage.SeedPage{}, err
+		}
+		page.Seeds = append(page.Seeds, seed)
+	}
+	if err := rows.Err(); err != nil {
+		return storage.SeedPage{}, fmt.Errorf("error reading seeds: %w", err)
+	}
+
+	// the query reads one more seed to know if there is a next page
+	if len(page.Seeds) > q.PageSize {
+		page.Seeds = page.Seeds[:q.PageSize]
+		page.NextCursor = q.CursorOf(page.Seeds[q.PageSize-1]).String()
+	}
+	return page, nil
+}
+
+// QueryProcesses returns a page of the processes of an OAB that match the filters of the query
+func (s *Storage) QueryProcesses(ctx context.Context, q storage.ProcessQuery) (storage.ProcessPage, error) {
+	after, err := q.Normalize()
+	if err != nil {
+		return storage.ProcessPage{}, err
+	}
+
+	var query strings.Builder
+	query.WriteString(`
+		SELECT ` + processColumns + `, p.updated_at
+		FROM process_basic_info p JOIN process_oabs o ON o.process_id = p.process_id
+		WHERE o.oab = ?`)
+	args := []any{q.OAB.String()}
+	for _, filter := range []struct{ column, value string }{
+		{"p.foro_code", q.Foro},
+		{"p.class", q.Class},
+		{"p.situation", q.Situation},
+	} {
+		if filter.value != "" {
+			query.WriteString(` AND ` + filter.column + ` = ?`)
+			args = append(args, filter.value)
+		}
+	}
+
+	column := map[storage.Order]string{
+		storage.OrderUpdatedAt: "p.updated_at",
+		storage.OrderClass:     "p.class",
+		storage.OrderForo:      "p.foro_code",
+	}[q.OrderBy]
+	cond, condArgs, orderBy := keyset(column, "p.process_id", after, q.Desc)
+	query.WriteString(cond + ` ORDER BY ` + orderBy + ` LIMIT ?`)
+	args = append(append(args, condArgs...), q.PageSize+1)
+
+	rows, err := s.db.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return storage.ProcessPage{}, fmt.Errorf("error querying processes: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var (
+		page       storage.ProcessPage
+		updatedAts []time.Time
+	)
+	for rows.Next() {
+		var updatedAt int64
+		p := esaj.ProcessBasicInfo{OAB: q.OAB}
+		if err := scanProcess(rows, &p, &updatedAt); err != nil {
+			return storage.ProcessPage{}, fmt.Errorf("error scanning process: %w", err)
+		}
+		page.Processes = append(page.Processes, p)
+		updatedAts = append(updatedAts, time.Unix(0, updatedAt))
+	}
+	if err := rows.Err(); err != nil {
+		return storage.ProcessPage{}, fmt.Errorf("error reading processes: %w", err)
+	}
+
+	// the query reads one more process to know if there is a next page
+	if len(page.Processes) > q.PageSize {
+		page.Processes = page.Processes[:q.PageSize]
+		last := q.PageSize - 1
+		page.NextCursor = q.CursorOf(page.Processes[last], updatedAts[last]).String()
+	}
+	return page, nil
+}
@@ -0,0 +1,178 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/search"
+)
+
+// indexProcess saves the search document of the process, found by the OABs saved in process_oabs.
+func indexProcess(ctx context.Context, tx *sql.Tx, p esaj.ProcessBasicInfo) error {
+	oabs, err := processOABs(ctx, tx, p.ProcessID)
+	if err != nil {
+		return err
+	}
+
+	doc, err := json.Marshal(search.NewDocument(p, oabs))
+	if err != nil {
+		return fmt.Errorf("error encoding search document of process %s: %w", p.ProcessID, err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO search_index (process_id, document) VALUES (?, ?)
+		ON CONFLICT (process_id) DO UPDATE SET document = excluded.document`, p.ProcessID, string(doc))
+	if err != nil {
+		return fmt.Errorf("error indexing process %s: %w", p.ProcessID, err)
+	}
+	return nil
+}
+
+// processOABs returns the OABs of the process, sorted.
+func processOABs(ctx context.Context, tx *sql.Tx, processID string) ([]esaj.OAB, error) {
+	var oabs []esaj.OAB
+	err := eachRow(ctx, tx, `SELECT oab FROM process_oabs WHERE process_id = ? ORDER BY oab`, func(rows *sql.Rows) error {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return fmt.Errorf("error scanning oab of process %s: %w", processID, err)
+		}
+		oab, err := esaj.ParseOAB(raw)
+		if err != nil {
+			return fmt.Errorf("error parsing oab of process %s: %w", processID, err)
+		}
+		oabs = append(oabs, oab)
+		return nil
+	}, processID)
+	return oabs, err
+}
+
+// placeholders returns n comma separated placeholders, for an IN clause.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// SearchProcesses returns the processes of the OABs of a query that match its text, the best ranked first
+func (s *Storage) SearchProcesses(ctx context.Context, q search.Query) ([]search.Result, error) {
+	terms, err := q.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]any, 0, len(q.OABs))
+	for _, oab := range q.OABs {
+		args = append(args, oab.String())
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT s.document FROM search_index s
+		WHERE s.process_id IN (SELECT process_id FROM process_oabs WHERE oab IN (`+placeholders(len(args))+`))`,
+		args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying search index: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var docs []search.Document
+	for rows.Next() {
+		var (
+			raw string
+			doc search.Document
+		)
+		if err := rows.Scan(&raw); err != nil {
+			return nil, fmt.Errorf("error scanning search document: %w", err)
+		}
+		if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+			return nil, fmt.Errorf("error parsing search document: %w", err)
+		}
+		docs = append(docs, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading search index: %w", err)
+	}
+
+	results := search.Rank(docs, terms, q.Limit)
+	if len(results) == 0 {
+		return results, nil
+	}
+
+	oabs := make(map[string]esaj.OAB, len(docs))
+	for _, doc := range docs {
+		oabs[doc.ProcessID] = q.ScopeOAB(doc)
+	}
+	ids := make([]any, 0, len(results))
+	for _, r := range results {
+		ids = append(ids, r.Process.ProcessID)
+	}
+	processes, err := s.db.QueryContext(ctx, `
+		SELECT `+processColumns+` FROM process_basic_info p WHERE p.process_id IN (`+placeholders(len(ids))+`)`,
+		ids...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying searched processes: %w", err)
+	}
+	defer func() {
+		_ = processes.Close()
+	}()
+
+	byID := make(map[string]esaj.ProcessBasicInfo, len(results))
+	for processes.Next() {
+		var p esaj.ProcessBasicInfo
+		if err := scanProcess(processes, &p); err != nil {
+			return nil, fmt.Errorf("error scanning process: %w", err)
+		}
+		p.OAB = oabs[p.ProcessID]
+		byID[p.ProcessID] = p
+	}
+	if err := processes.Err(); err != nil {
+		return nil, fmt.Errorf("error reading processes: %w", err)
+	}
+
+	for i, r := range results {
+		results[i].Process = byID[r.Process.ProcessID]
+	}
+	return results, nil
+}
+
+// RebuildSearchIndex indexes again all the processes saved in the sqlite database
+func (s *Storage) RebuildSearchIndex(ctx context.Context) (int, error) {
+	var indexed int
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM search_index`); err != nil {
+			return fmt.Errorf("error clearing search index: %w", err)
+		}
+
+		rows, err := tx.QueryContext(ctx, `SELECT `+processColumns+` FROM process_basic_info p ORDER BY p.process_id`)
+		if err != nil {
+			return fmt.Errorf("error querying processes: %w", err)
+		}
+		var processes []esaj.ProcessBasicInfo
+		for rows.Next() {
+			var p esaj.ProcessBasicInfo
+			if err := scanProcess(rows, &p); err != nil {
+				_ = rows.Close()
+				return fmt.Errorf("error scanning process: %w", err)
+			}
+			processes = append(processes, p)
+		}
+		_ = rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error reading processes: %w", err)
+		}
+
+		// the processes are read before indexing them, since the transaction has a single connection
+		for _, p := range processes {
+			if err := indexProcess(ctx, tx, p); err != nil {
+				return err
+			}
+		}
+		indexed = len(processes)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return indexed, nil
+}
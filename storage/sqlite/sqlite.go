@@ -0,0 +1,936 @@
+// Package sqlite gather the storage implementation backed by an embedded SQLite database. It uses a pure Go
+// driver, so it doesn't require cgo and can run the collector without a GCP project.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/perebaj/esaj/clerk"
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/tracing"
+
+	// registers the "sqlite" database/sql driver.
+	_ "modernc.org/sqlite"
+)
+
+var _ storage.Storage = (*Storage)(nil)
+
+// schema creates the tables of the storage. The dates are saved as unix timestamps in nanoseconds, except the
+// user ones that are RFC3339 strings, as received from the clerk webhooks.
+const schema = seedsTable + `
+
+CREATE TABLE IF NOT EXISTS process_basic_info (
+	process_id TEXT PRIMARY KEY,
+	foro_code TEXT NOT NULL,
+	foro_name TEXT NOT NULL,
+	process_code TEXT NOT NULL,
+	judge TEXT NOT NULL,
+	class TEXT NOT NULL,
+	claimant TEXT NOT NULL,
+	defendant TEXT NOT NULL,
+	vara TEXT NOT NULL,
+	url TEXT NOT NULL,
+	trace_id TEXT NOT NULL,
+	situation TEXT NOT NULL DEFAULT '',
+	updated_at INTEGER NOT NULL DEFAULT 0,
+	subject TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS process_oabs (
+	process_id TEXT NOT NULL REFERENCES process_basic_info (process_id) ON DELETE CASCADE,
+	oab TEXT NOT NULL,
+	PRIMARY KEY (process_id, oab)
+);
+CREATE INDEX IF NOT EXISTS process_oabs_oab ON process_oabs (oab);
+
+CREATE TABLE IF NOT EXISTS search_index (
+	process_id TEXT PRIMARY KEY REFERENCES process_basic_info (process_id) ON DELETE CASCADE,
+	document TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS process_history (
+	process_id TEXT NOT NULL REFERENCES process_basic_info (process_id) ON DELETE CASCADE,
+	id TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	trace_id TEXT NOT NULL,
+	process TEXT NOT NULL,
+	diff TEXT NOT NULL,
+	PRIMARY KEY (process_id, id)
+);
+
+CREATE TABLE IF NOT EXISTS movements (
+	process_id TEXT NOT NULL,
+	id TEXT NOT NULL,
+	date INTEGER NOT NULL,
+	title TEXT NOT NULL,
+	text TEXT NOT NULL,
+	trace_id TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (process_id, id)
+);
+
+CREATE TABLE IF NOT EXISTS movement_reads (
+	user_id TEXT NOT NULL,
+	process_id TEXT NOT NULL,
+	movement_id TEXT NOT NULL,
+	read_at INTEGER NOT NULL,
+	PRIMARY KEY (user_id, process_id, movement_id)
+);
+
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	first_name TEXT NOT NULL,
+	last_name TEXT NOT NULL,
+	email_addresses TEXT NOT NULL,
+	image_url TEXT NOT NULL,
+	birthday TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL,
+	deleted_at TEXT NOT NULL DEFAULT '',
+	trace_id TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS anonymized_parties (
+	hash TEXT PRIMARY KEY,
+	created_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS privacy_audit (
+	id TEXT PRIMARY KEY,
+	operation TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	actor TEXT NOT NULL,
+	records TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	trace_id TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS privacy_audit_subject ON privacy_audit (subject);
+
+CREATE TABLE IF NOT EXISTS organizations (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS organization_oabs (
+	organization_id TEXT NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+	oab TEXT NOT NULL,
+	PRIMARY KEY (organization_id, oab)
+);
+
+CREATE TABLE IF NOT EXISTS organization_members (
+	organization_id TEXT NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+	user_id TEXT NOT NULL,
+	role TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (organization_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS organization_members_user ON organization_members (user_id);
+
+CREATE TABLE IF NOT EXISTS annotations (
+	organization_id TEXT NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+	id TEXT NOT NULL,
+	process_id TEXT NOT NULL,
+	author_id TEXT NOT NULL,
+	text TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	PRIMARY KEY (organization_id, id)
+);
+CREATE INDEX IF NOT EXISTS annotations_process ON annotations (organization_id, process_id);
+CREATE INDEX IF NOT EXISTS annotations_author ON annotations (author_id);
+
+CREATE TABLE IF NOT EXISTS access_events (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	organization_id TEXT NOT NULL,
+	trace_id TEXT NOT NULL,
+	action TEXT NOT NULL,
+	resource TEXT NOT NULL,
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS access_events_created ON access_events (created_at, id);
+CREATE INDEX IF NOT EXISTS access_events_organization ON access_events (organization_id, created_at, id);
+
+CREATE TABLE IF NOT EXISTS documents (
+	process_id TEXT NOT NULL,
+	id TEXT NOT NULL,
+	title TEXT NOT NULL,
+	pages INTEGER NOT NULL,
+	path TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	sha256 TEXT NOT NULL,
+	trace_id TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	PRIMARY KEY (process_id, id)
+);
+`
+
+// seedsTable creates the process_seeds table, with a seed of each process and OAB.
+const seedsTable = `
+CREATE TABLE IF NOT EXISTS process_seeds (
+	process_id TEXT NOT NULL,
+	oab TEXT NOT NULL,
+	url TEXT NOT NULL,
+	trace_id TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	ingested_at INTEGER,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	removed_at INTEGER,
+	PRIMARY KEY (process_id, oab)
+);
+CREATE INDEX IF NOT EXISTS process_seeds_oab ON process_seeds (oab);
+`
+
+// addedColumns are the columns added to the tables after they were created. Open adds them to the databases
+// created by older versions.
+var addedColumns = []struct {
+	table, column, definition string
+}{
+	{"process_seeds", "status", "TEXT NOT NULL DEFAULT 'pending'"},
+	{"process_seeds", "ingested_at", "INTEGER"},
+	{"process_seeds", "removed_at", "INTEGER"},
+	{"process_basic_info", "situation", "TEXT NOT NULL DEFAULT ''"},
+	{"process_basic_info", "updated_at", "INTEGER NOT NULL DEFAULT 0"},
+	{"process_basic_info", "subject", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// droppedColumns are the columns removed from the tables, like the personal data that is no longer kept. Open
+// drops them from the databases created by older versions.
+var droppedColumns = []struct {
+	table, column string
+}{
+	{"anonymized_parties", "name"},
+}
+
+// Storage is the storage backed by a SQLite database.
+type Storage struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// Open opens the SQLite database in the path, creating it and its tables if they don't exist.
+// Use ":memory:" for a database that lives only while it's open.
+func Open(ctx context.Context, path string) (*Storage, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("error opening sqlite database: %w", err)
+	}
+	// SQLite has a single writer, and each connection to ":memory:" would be a different database.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("error creating sqlite schema: %w", err)
+	}
+	if err := addColumns(ctx, db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := dropColumns(ctx, db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := rekeySeeds(ctx, db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &Storage{db: db, now: time.Now}, nil
+}
+
+// addColumns adds the addedColumns missing in the tables.
+func addColumns(ctx context.Context, db *sql.DB) error {
+	for _, c := range addedColumns {
+		var exists bool
+		err := db.QueryRowContext(ctx, `SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE name = ?`, c.table, c.column).
+			Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("error checking column %s.%s: %w", c.table, c.column, err)
+		}
+		if exists {
+			continue
+		}
+
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, c.table, c.column, c.definition)); err != nil {
+			return fmt.Errorf("error adding column %s.%s: %w", c.table, c.column, err)
+		}
+	}
+	return nil
+}
+
+// dropColumns drops the droppedColumns still in the tables.
+func dropColumns(ctx context.Context, db *sql.DB) error {
+	for _, c := range droppedColumns {
+		var exists bool
+		err := db.QueryRowContext(ctx, `SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE name = ?`, c.table, c.column).
+			Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("error checking column %s.%s: %w", c.table, c.column, err)
+		}
+		if !exists {
+			continue
+		}
+
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s DROP COLUMN %s`, c.table, c.column)); err != nil {
+			return fmt.Errorf("error dropping column %s.%s: %w", c.table, c.column, err)
+		}
+	}
+	return nil
+}
+
+// rekeySeeds recreates the process_seeds table of the databases created by older versions, keyed by the process
+// only, with the key of the process and the OAB. The seeds are kept.
+func rekeySeeds(ctx context.Context, db *sql.DB) error {
+	var keys int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_table_info('process_seeds') WHERE pk > 0`).Scan(&keys)
+	if err != nil {
+		return fmt.Errorf("error checking the key of process_seeds: %w", err)
+	}
+	if keys > 1 {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	const columns = `process_id, oab, url, trace_id, status, ingested_at, created_at, updated_at, removed_at`
+	for _, stmt := range []string{
+		`DROP INDEX process_seeds_oab`,
+		`ALTER TABLE process_seeds RENAME TO process_seeds_old`,
+		seedsTable,
+		`INSERT INTO process_seeds (` + columns + `) SELECT ` + columns + ` FROM process_seeds_old`,
+		`DROP TABLE process_seeds_old`,
+	} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("error changing the key of process_seeds: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// Close closes the database.
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+// withTx runs fn in a transaction, committed when fn returns nil.
+func (s *Storage) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// eachRow calls fn with each row of the query, stopping at the first error.
+func eachRow(ctx context.Context, tx *sql.Tx, query string, fn func(rows *sql.Rows) error, args ...any) error {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("error querying %q: %w", query, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading %q: %w", query, err)
+	}
+	return nil
+}
+
+// SaveProcessSeeds saves the process seeds in the sqlite database
+func (s *Storage) SaveProcessSeeds(ctx context.Context, ps []esaj.ProcessSeed) error {
+	traceID := tracing.GetTraceIDFromContext(ctx)
+	now := s.now().UnixNano()
+
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		for _, seed := range ps {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO process_seeds (process_id, oab, url, trace_id, status, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT (process_id, oab) DO UPDATE SET
+					url = excluded.url, trace_id = excluded.trace_id, status = excluded.status,
+					updated_at = excluded.updated_at, removed_at = NULL`,
+				seed.ProcessID, seed.OAB.String(), seed.URL, traceID, storage.SeedPending, now, now)
+			if err != nil {
+				return fmt.Errorf("error saving seed %s: %w", seed.ProcessID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// GetSeedsByOAB returns all the process seeds given an OAB identifier
+func (s *Storage) GetSeedsByOAB(ctx context.Context, oab esaj.OAB) ([]storage.ProcessSeed, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+seedColumns+` FROM process_seeds WHERE oab = ? ORDER BY process_id`, oab.String())
+	if err != nil {
+		return nil, fmt.Errorf("error querying seeds: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var seeds []storage.ProcessSeed
+	for rows.Next() {
+		seed, err := scanSeed(rows)
+		if err != nil {
+			return nil, err
+		}
+		seeds = append(seeds, seed)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading seeds: %w", err)
+	}
+	return seeds, nil
+}
+
+// seedColumns are the columns of the process_seeds table read by scanSeed.
+const seedColumns = `process_id, oab, url, status, created_at, updated_at, removed_at`
+
+func scanSeed(rows *sql.Rows) (storage.ProcessSeed, error) {
+	var (
+		seed                 storage.ProcessSeed
+		rawOAB               string
+		createdAt, updatedAt int64
+		removedAt            sql.NullInt64
+	)
+	if err := rows.Scan(&seed.ProcessID, &rawOAB, &seed.URL, &seed.Status, &createdAt, &updatedAt, &removedAt); err != nil {
+		return storage.ProcessSeed{}, fmt.Errorf("error scanning seed: %w", err)
+	}
+
+	oab, err := esaj.ParseOAB(rawOAB)
+	if err != nil {
+		return storage.ProcessSeed{}, fmt.Errorf("error parsing oab of seed %s: %w", seed.ProcessID, err)
+	}
+	seed.ID = storage.SeedID(seed.ProcessID, oab)
+	seed.OAB = oab
+	seed.CreatedAt = time.Unix(0, createdAt)
+	seed.UpdatedAt = time.Unix(0, updatedAt)
+	if removedAt.Valid {
+		seed.RemovedAt = time.Unix(0, removedAt.Int64)
+	}
+	return seed, nil
+}
+
+// ReconcileSeeds marks the seeds of an OAB that were not found as removed, and takes the OAB out of the
+// processes that were not found
+func (s *Storage) ReconcileSeeds(ctx context.Context, oab esaj.OAB, found []esaj.ProcessSeed) ([]string, error) {
+	traceID := tracing.GetTraceIDFromContext(ctx)
+	isFound := make(map[string]bool, len(found))
+	for _, seed := range found {
+		isFound[seed.ProcessID] = true
+	}
+
+	now := s.now()
+	removed := make(map[string]bool)
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var seeds []string
+		err := eachRow(ctx, tx, `SELECT process_id FROM process_seeds WHERE oab = ? AND removed_at IS NULL`,
+			func(rows *sql.Rows) error {
+				var id string
+				if err := rows.Scan(&id); err != nil {
+					return fmt.Errorf("error scanning seed: %w", err)
+				}
+				if !isFound[id] {
+					seeds = append(seeds, id)
+				}
+				return nil
+			}, oab.String())
+		if err != nil {
+			return err
+		}
+		for _, id := range seeds {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE process_seeds SET removed_at = ?, updated_at = ? WHERE process_id = ? AND oab = ?`,
+				now.UnixNano(), now.UnixNano(), id, oab.String())
+			if err != nil {
+				return fmt.Errorf("error removing seed %s: %w", id, err)
+			}
+			removed[id] = true
+		}
+
+		var processes []esaj.ProcessBasicInfo
+		err = eachRow(ctx, tx, `
+			SELECT `+processColumns+` FROM process_basic_info p
+			JOIN process_oabs o ON o.process_id = p.process_id WHERE o.oab = ?`,
+			func(rows *sql.Rows) error {
+				var p esaj.ProcessBasicInfo
+				if err := scanProcess(rows, &p); err != nil {
+					return fmt.Errorf("error scanning process: %w", err)
+				}
+				if !isFound[p.ProcessID] {
+					processes = append(processes, p)
+				}
+				return nil
+			}, oab.String())
+		if err != nil {
+			return err
+		}
+		for _, p := range processes {
+			_, err := tx.ExecContext(ctx, `DELETE FROM process_oabs WHERE process_id = ? AND oab = ?`,
+				p.ProcessID, oab.String())
+			if err != nil {
+				return fmt.Errorf("error removing oab of process %s: %w", p.ProcessID, err)
+			}
+			if err := saveSnapshot(ctx, tx, storage.NewOABRemovedSnapshot(p, oab, now, traceID)); err != nil {
+				return err
+			}
+			if err := indexProcess(ctx, tx, p); err != nil {
+				return err
+			}
+			removed[p.ProcessID] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(removed))
+	for id := range removed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// SaveProcessBasicInfo saves the process basic information in the sqlite database
+func (s *Storage) SaveProcessBasicInfo(ctx context.Context, pBasicInfo esaj.ProcessBasicInfo) error {
+	traceID := tracing.GetTraceIDFromContext(ctx)
+	logger := slog.With("traceID", traceID)
+	logger.Info("saving process basic info", "process_id", pBasicInfo.ProcessID)
+
+	now := s.now()
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		names, err := anonymizedNames(ctx, tx, pBasicInfo.Claimant, pBasicInfo.Defendant)
+		if err != nil {
+			return err
+		}
+		pBasicInfo, _ = storage.AnonymizeProcess(pBasicInfo, names)
+
+		prev, err := processByID(ctx, tx, pBasicInfo.ProcessID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO process_basic_info
+				(process_id, foro_code, foro_name, process_code, judge, class, subject, claimant, defendant, vara, url,
+				situation, trace_id, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (process_id) DO UPDATE SET
+				foro_code = excluded.foro_code, foro_name = excluded.foro_name, process_code = excluded.process_code,
+				judge = excluded.judge, class = excluded.class, subject = excluded.subject, claimant = excluded.claimant,
+				defendant = excluded.defendant, vara = excluded.vara, url = excluded.url,
+				situation = excluded.situation, trace_id = excluded.trace_id, updated_at = excluded.updated_at`,
+			pBasicInfo.ProcessID, pBasicInfo.ProcessForo, pBasicInfo.ForoName, pBasicInfo.ProcessCode,
+			pBasicInfo.Judge, pBasicInfo.Class, pBasicInfo.Subject, pBasicInfo.Claimant, pBasicInfo.Defendant,
+			pBasicInfo.Vara, pBasicInfo.URL, pBasicInfo.Situation, traceID, now.UnixNano())
+		if err != nil {
+			return fmt.Errorf("error saving process %s: %w", pBasicInfo.ProcessID, err)
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT OR IGNORE INTO process_oabs (process_id, oab) VALUES (?, ?)`,
+			pBasicInfo.ProcessID, pBasicInfo.OAB.String())
+		if err != nil {
+			return fmt.Errorf("error saving oab of process %s: %w", pBasicInfo.ProcessID, err)
+		}
+		if err := indexProcess(ctx, tx, pBasicInfo); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE process_seeds SET status = ?, ingested_at = ? WHERE process_id = ? AND oab = ?`,
+			storage.SeedIngested, now.UnixNano(), pBasicInfo.ProcessID, pBasicInfo.OAB.String())
+		if err != nil {
+			return fmt.Errorf("error updating seed of process %s: %w", pBasicInfo.ProcessID, err)
+		}
+
+		snapshot, ok := storage.NewProcessSnapshot(prev, pBasicInfo, now, traceID)
+		if !ok {
+			return nil
+		}
+		return saveSnapshot(ctx, tx, snapshot)
+	})
+}
+
+// processColumns are the columns of the process_basic_info table, aliased as p, read by scanProcess.
+const processColumns = `p.process_id, p.foro_code, p.foro_name, p.process_code, p.judge, p.class, p.subject,
+	p.claimant, p.defendant, p.vara, p.url, p.situation`
+
+// scanProcess scans the processColumns, followed by the dest columns.
+func scanProcess(row interface{ Scan(dest ...any) error }, p *esaj.ProcessBasicInfo, dest ...any) error {
+	return row.Scan(append([]any{&p.ProcessID, &p.ProcessForo, &p.ForoName, &p.ProcessCode, &p.Judge, &p.Class,
+		&p.Subject, &p.Claimant, &p.Defendant, &p.Vara, &p.URL, &p.Situation}, dest...)...)
+}
+
+// processByID returns the saved process, or nil if it doesn't exist.
+func processByID(ctx context.Context, tx *sql.Tx, processID string) (*esaj.ProcessBasicInfo, error) {
+	var p esaj.ProcessBasicInfo
+	err := scanProcess(tx.QueryRowContext(ctx, `
+		SELECT `+processColumns+` FROM process_basic_info p WHERE p.process_id = ?`, processID), &p)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting process %s: %w", processID, err)
+	}
+	return &p, nil
+}
+
+func saveSnapshot(ctx context.Context, tx *sql.Tx, snapshot storage.ProcessSnapshot) error {
+	process, err := json.Marshal(snapshot.Process)
+	if err != nil {
+		return fmt.Errorf("error encoding snapshot: %w", err)
+	}
+	diff, err := json.Marshal(snapshot.Diff)
+	if err != nil {
+		return fmt.Errorf("error encoding snapshot diff: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO process_history (process_id, id, created_at, trace_id, process, diff) VALUES (?, ?, ?, ?, ?, ?)`,
+		snapshot.ProcessID, snapshot.ID, snapshot.CreatedAt.UnixNano(), snapshot.TraceID, string(process), string(diff))
+	if err != nil {
+		return fmt.Errorf("error saving snapshot of process %s: %w", snapshot.ProcessID, err)
+	}
+	return nil
+}
+
+// ProcessHistory returns the snapshots of a process, from the oldest to the newest
+func (s *Storage) ProcessHistory(ctx context.Context, processID string) ([]storage.ProcessSnapshot, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT process_id, id, created_at, trace_id, process, diff FROM process_history
+		WHERE process_id = ? ORDER BY id`, processID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting history of process %s: %w", processID, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var snapshots []storage.ProcessSnapshot
+	for rows.Next() {
+		var (
+			snapshot      storage.ProcessSnapshot
+			createdAt     int64
+			process, diff string
+		)
+		err := rows.Scan(&snapshot.ProcessID, &snapshot.ID, &createdAt, &snapshot.TraceID, &process, &diff)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning snapshot: %w", err)
+		}
+		if err := json.Unmarshal([]byte(process), &snapshot.Process); err != nil {
+			return nil, fmt.Errorf("error parsing snapshot %s: %w", snapshot.ID, err)
+		}
+		if err := json.Unmarshal([]byte(diff), &snapshot.Diff); err != nil {
+			return nil, fmt.Errorf("error parsing diff of snapshot %s: %w", snapshot.ID, err)
+		}
+		snapshot.CreatedAt = time.Unix(0, createdAt)
+		snapshots = append(snapshots, snapshot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading snapshots: %w", err)
+	}
+	return snapshots, nil
+}
+
+// ProcessOABs returns the OABs that found a process
+func (s *Storage) ProcessOABs(ctx context.Context, processID string) ([]esaj.OAB, error) {
+	var oabs []esaj.OAB
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		p, err := processByID(ctx, tx, processID)
+		if err != nil {
+			return err
+		}
+		if p == nil {
+			return fmt.Errorf("error getting the OABs of process %s: %w", processID, storage.ErrNotFound)
+		}
+		oabs, err = processOABs(ctx, tx, processID)
+		return err
+	})
+	return oabs, err
+}
+
+// ProcessBasicInfoByOAB returns all process that has the same OAB identifier
+func (s *Storage) ProcessBasicInfoByOAB(ctx context.Context, oab esaj.OAB) ([]esaj.ProcessBasicInfo, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+processColumns+`
+		FROM process_basic_info p JOIN process_oabs o ON o.process_id = p.process_id
+		WHERE o.oab = ? ORDER BY p.process_id`, oab.String())
+	if err != nil {
+		return nil, fmt.Errorf("error querying processes: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var processBasicInfo []esaj.ProcessBasicInfo
+	for rows.Next() {
+		p := esaj.ProcessBasicInfo{OAB: oab}
+		if err := scanProcess(rows, &p); err != nil {
+			return nil, fmt.Errorf("error scanning process: %w", err)
+		}
+		processBasicInfo = append(processBasicInfo, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading processes: %w", err)
+	}
+	return processBasicInfo, nil
+}
+
+// SaveUser receive a generic clerk webhook event and save the user in the sqlite database
+func (s *Storage) SaveUser(ctx context.Context, event clerk.WebHookEvent) error {
+	user := storage.NewUser(event, tracing.GetTraceIDFromContext(ctx))
+
+	emails, err := json.Marshal(user.EmailAddresses)
+	if err != nil {
+		return fmt.Errorf("error encoding email addresses: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO users (id, first_name, last_name, email_addresses, image_url, birthday, created_at, updated_at,
+			deleted_at, trace_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, '', ?)
+		ON CONFLICT (id) DO UPDATE SET
+			first_name = excluded.first_name, last_name = excluded.last_name,
+			email_addresses = excluded.email_addresses, image_url = excluded.image_url, birthday = excluded.birthday,
+			created_at = excluded.created_at, updated_at = excluded.updated_at, deleted_at = '',
+			trace_id = excluded.trace_id`,
+		user.ID, user.FirstName, user.LastName, string(emails), user.ImageURL, user.Birthday, user.CreatedAt,
+		user.UpdatedAt, user.TraceID)
+	if err != nil {
+		return fmt.Errorf("error saving user %s: %w", user.ID, err)
+	}
+	return nil
+}
+
+// DeleteUser receive a generic clerk webhook event and delete the user in the sqlite database
+// This delete is a soft delete, the user is not removed from the database, but its deleted_at is set
+// with the current time
+func (s *Storage) DeleteUser(ctx context.Context, event clerk.WebHookEvent) error {
+	traceID := tracing.GetTraceIDFromContext(ctx)
+	slog.Info(fmt.Sprintf("deleting user %s", event.Data.ID), "traceID", traceID, "user_id", event.Data.ID)
+
+	result, err := s.db.ExecContext(ctx, `UPDATE users SET deleted_at = ? WHERE id = ?`,
+		s.now().Format(time.RFC3339), event.Data.ID)
+	if err != nil {
+		return fmt.Errorf("error deleting user %s: %w", event.Data.ID, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error deleting user %s: %w", event.Data.ID, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("error deleting user %s: %w", event.Data.ID, storage.ErrNotFound)
+	}
+	return nil
+}
+
+// GetUser get a user from the sqlite database
+// If the user does not exist, it will return an empty user and a nil error.
+func (s *Storage) GetUser(ctx context.Context, userID string) (storage.User, error) {
+	var (
+		user   storage.User
+		emails string
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, first_name, last_name, email_addresses, image_url, birthday, created_at, updated_at, deleted_at,
+			trace_id
+		FROM users WHERE id = ?`, userID).
+		Scan(&user.ID, &user.FirstName, &user.LastName, &emails, &user.ImageURL, &user.Birthday, &user.CreatedAt,
+			&user.UpdatedAt, &user.DeletedAt, &user.TraceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.User{}, nil
+	}
+	if err != nil {
+		return storage.User{}, fmt.Errorf("error getting user %s: %w", userID, err)
+	}
+
+	if err := json.Unmarshal([]byte(emails), &user.EmailAddresses); err != nil {
+		return storage.User{}, fmt.Errorf("error parsing user data: %w", err)
+	}
+	return user, nil
+}
+
+// SaveDocument saves the document of a process in the sqlite database
+func (s *Storage) SaveDocument(ctx context.Context, doc storage.Document) error {
+	now := s.now().UnixNano()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO documents (process_id, id, title, pages, path, size, sha256, trace_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (process_id, id) DO UPDATE SET
+			title = excluded.title, pages = excluded.pages, path = excluded.path, size = excluded.size,
+			sha256 = excluded.sha256, trace_id = excluded.trace_id, updated_at = excluded.updated_at`,
+		doc.ProcessID, doc.ID, doc.Title, doc.Pages, doc.Path, doc.Size, doc.SHA256,
+		tracing.GetTraceIDFromContext(ctx), now, now)
+	if err != nil {
+		return fmt.Errorf("error saving document %s of process %s: %w", doc.ID, doc.ProcessID, err)
+	}
+	return nil
+}
+
+// DocumentsByProcess returns all documents of a process
+func (s *Storage) DocumentsByProcess(ctx context.Context, processID string) ([]storage.Document, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT process_id, id, title, pages, path, size, sha256, created_at, updated_at FROM documents
+		WHERE process_id = ? ORDER BY id`, processID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting documents of process %s: %w", processID, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var documents []storage.Document
+	for rows.Next() {
+		var (
+			doc                  storage.Document
+			createdAt, updatedAt int64
+		)
+		err := rows.Scan(&doc.ProcessID, &doc.ID, &doc.Title, &doc.Pages, &doc.Path, &doc.Size, &doc.SHA256,
+			&createdAt, &updatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning document: %w", err)
+		}
+		doc.CreatedAt = time.Unix(0, createdAt)
+		doc.UpdatedAt = time.Unix(0, updatedAt)
+		documents = append(documents, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading documents: %w", err)
+	}
+	return documents, nil
+}
+
+// SaveMovements saves the movements of a process that were not saved yet in the sqlite database
+func (s *Storage) SaveMovements(ctx context.Context, processID string, ms []esaj.Movement) ([]storage.Movement, error) {
+	var created []storage.Movement
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		for _, m := range storage.NewMovements(processID, ms, s.now(), tracing.GetTraceIDFromContext(ctx)) {
+			names, err := anonymizedNames(ctx, tx, m.Title, m.Text)
+			if err != nil {
+				return err
+			}
+			m, _ = storage.AnonymizeMovement(m, names)
+			result, err := tx.ExecContext(ctx, `
+				INSERT INTO movements (process_id, id, date, title, text, trace_id, created_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT (process_id, id) DO NOTHING`,
+				m.ProcessID, m.ID, m.Date.UnixNano(), m.Title, m.Text, m.TraceID, m.CreatedAt.UnixNano())
+			if err != nil {
+				return fmt.Errorf("error saving movement %s of process %s: %w", m.ID, processID, err)
+			}
+
+			n, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("error saving movement %s of process %s: %w", m.ID, processID, err)
+			}
+			if n > 0 {
+				created = append(created, m)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// MovementsByOAB returns the movements of the processes of an OAB saved since a time
+func (s *Storage) MovementsByOAB(ctx context.Context, oab esaj.OAB, since time.Time) ([]storage.Movement, error) {
+	return s.queryMovements(ctx, `
+		SELECT m.process_id, m.id, m.date, m.title, m.text, m.trace_id, m.created_at
+		FROM movements m JOIN process_oabs o ON o.process_id = m.process_id
+		WHERE o.oab = ? AND m.created_at >= ?
+		ORDER BY m.date, m.process_id, m.id`, oab.String(), since.UnixNano())
+}
+
+// MarkMovementsRead marks the movements of a process as read by a user
+func (s *Storage) MarkMovementsRead(ctx context.Context, userID, processID string, movementIDs []string) error {
+	now := s.now().UnixNano()
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		for _, id := range movementIDs {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO movement_reads (user_id, process_id, movement_id, read_at) VALUES (?, ?, ?, ?)
+				ON CONFLICT (user_id, process_id, movement_id) DO NOTHING`,
+				userID, processID, id, now)
+			if err != nil {
+				return fmt.Errorf("error marking movement %s of process %s as read: %w", id, processID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// UnreadMovements returns the movements of the processes of an OAB that were not read by a user
+func (s *Storage) UnreadMovements(ctx context.Context, userID string, oab esaj.OAB) ([]storage.Movement, error) {
+	return s.queryMovements(ctx, `
+		SELECT m.process_id, m.id, m.date, m.title, m.text, m.trace_id, m.created_at
+		FROM movements m JOIN process_oabs o ON o.process_id = m.process_id
+		LEFT JOIN movement_reads r ON r.user_id = ? AND r.process_id = m.process_id AND r.movement_id = m.id
+		WHERE o.oab = ? AND r.movement_id IS NULL
+		ORDER BY m.date, m.process_id, m.id`, userID, oab.String())
+}
+
+func (s *Storage) queryMovements(ctx context.Context, query string, args ...any) ([]storage.Movement, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying movements: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var movements []storage.Movement
+	for rows.Next() {
+		var (
+			m               storage.Movement
+			date, createdAt int64
+		)
+		if err := rows.Scan(&m.ProcessID, &m.ID, &date, &m.Title, &m.Text, &m.TraceID, &createdAt); err != nil {
+			return nil, fmt.Errorf("error scanning movement: %w", err)
+		}
+		m.Date = time.Unix(0, date)
+		m.CreatedAt = time.Unix(0, createdAt)
+		movements = append(movements, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading movements: %w", err)
+	}
+	return movements, nil
+}
@@ -0,0 +1,198 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStorage(t *testing.T) *Storage {
+	s, err := Open(context.Background(), ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	return s
+}
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return newStorage(t)
+	})
+}
+
+func TestStorage_seedTimes(t *testing.T) {
+	s := newStorage(t)
+	ctx := context.Background()
+
+	created := time.Date(2024, 8, 1, 10, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return created }
+	seed := esaj.ProcessSeed{ProcessID: "123", OAB: esaj.MustParseOAB("123"), URL: "http://example.com"}
+	require.NoError(t, s.SaveProcessSeeds(ctx, []esaj.ProcessSeed{seed}))
+
+	s.now = func() time.Time { return created.Add(time.Hour) }
+	require.NoError(t, s.SaveProcessSeeds(ctx, []esaj.ProcessSeed{seed}))
+
+	seeds, err := s.GetSeedsByOAB(ctx, seed.OAB)
+	require.NoError(t, err)
+	require.Len(t, seeds, 1)
+	assert.True(t, seeds[0].CreatedAt.Equal(created))
+	assert.True(t, seeds[0].UpdatedAt.Equal(created.Add(time.Hour)))
+}
+
+func TestStorage_processOABs(t *testing.T) {
+	s := newStorage(t)
+	ctx := context.Background()
+
+	p := esaj.ProcessBasicInfo{ProcessID: "123", OAB: esaj.MustParseOAB("123")}
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, p))
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, p))
+	p.OAB = esaj.MustParseOAB("456")
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, p))
+
+	var oabs int
+	require.NoError(t, s.db.QueryRow(`SELECT count(*) FROM process_oabs`).Scan(&oabs))
+	assert.Equal(t, 2, oabs)
+}
+
+func TestOpen_file(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "esaj.db")
+	ctx := context.Background()
+
+	s, err := Open(ctx, path)
+	require.NoError(t, err)
+	require.NoError(t, s.SaveProcessSeeds(ctx, []esaj.ProcessSeed{{ProcessID: "123", OAB: esaj.MustParseOAB("123"), URL: "http://example.com"}}))
+	require.NoError(t, s.Close())
+
+	// the data and the schema survive reopening the database
+	s, err = Open(ctx, path)
+	require.NoError(t, err)
+	defer func() {
+		_ = s.Close()
+	}()
+
+	seeds, err := s.GetSeedsByOAB(ctx, esaj.MustParseOAB("123"))
+	require.NoError(t, err)
+	require.Len(t, seeds, 1)
+}
+
+func TestOpen_addedColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "esaj.db")
+	ctx := context.Background()
+
+	// the tables as created by the first version of the storage
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE process_seeds (
+			process_id TEXT PRIMARY KEY, oab TEXT NOT NULL, url TEXT NOT NULL, trace_id TEXT NOT NULL,
+			created_at INTEGER NOT NULL, updated_at INTEGER NOT NULL
+		);
+		CREATE TABLE process_basic_info (
+			process_id TEXT PRIMARY KEY, foro_code TEXT NOT NULL, foro_name TEXT NOT NULL, process_code TEXT NOT NULL,
+			judge TEXT NOT NULL, class TEXT NOT NULL, claimant TEXT NOT NULL, defendant TEXT NOT NULL,
+			vara TEXT NOT NULL, url TEXT NOT NULL, trace_id TEXT NOT NULL
+		);
+		INSERT INTO process_seeds VALUES ('123', '123/SP', 'http://example.com', '', 1, 1);`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	s, err := Open(ctx, path)
+	require.NoError(t, err)
+	defer func() {
+		_ = s.Close()
+	}()
+
+	seeds, err := s.GetSeedsByOAB(ctx, esaj.MustParseOAB("123"))
+	require.NoError(t, err)
+	require.Len(t, seeds, 1)
+	assert.Equal(t, storage.SeedPending, seeds[0].Status)
+
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{ProcessID: "123", OAB: esaj.MustParseOAB("123"), Situation: "Extinto"}))
+	page, err := s.QueryProcesses(ctx, storage.ProcessQuery{OAB: esaj.MustParseOAB("123"), Situation: "Extinto"})
+	require.NoError(t, err)
+	assert.Len(t, page.Processes, 1)
+}
+
+func TestOpen_droppedColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "esaj.db")
+	ctx := context.Background()
+
+	// the anonymized names were kept by the previous versions
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE anonymized_parties (hash TEXT PRIMARY KEY, name TEXT NOT NULL, created_at INTEGER NOT NULL);
+		INSERT INTO anonymized_parties VALUES (?, 'José da Silva', 1);`, storage.SubjectHash("José da Silva"))
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	s, err := Open(ctx, path)
+	require.NoError(t, err)
+	defer func() {
+		_ = s.Close()
+	}()
+
+	var columns int
+	require.NoError(t, s.db.QueryRow(`SELECT count(*) FROM pragma_table_info('anonymized_parties') WHERE name = 'name'`).Scan(&columns))
+	assert.Zero(t, columns)
+
+	// the hash is still anonymized
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{ProcessID: "123", OAB: esaj.MustParseOAB("123"), Claimant: "Jose da Silva"}))
+	processes, err := s.ProcessBasicInfoByOAB(ctx, esaj.MustParseOAB("123"))
+	require.NoError(t, err)
+	require.Len(t, processes, 1)
+	assert.Equal(t, storage.Anonymized, processes[0].Claimant)
+}
+
+func TestOpen_rekeySeeds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "esaj.db")
+	ctx := context.Background()
+
+	// the seeds were keyed by their process by the previous versions
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE process_seeds (process_id TEXT PRIMARY KEY, oab TEXT NOT NULL, url TEXT NOT NULL,
+			trace_id TEXT NOT NULL, created_at INTEGER NOT NULL, updated_at INTEGER NOT NULL);
+		CREATE INDEX process_seeds_oab ON process_seeds (oab);
+		INSERT INTO process_seeds VALUES ('1', '123/SP', 'http://example.com/1', 'trace', 1, 2);`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	s, err := Open(ctx, path)
+	require.NoError(t, err)
+	defer func() {
+		_ = s.Close()
+	}()
+
+	// the seed is kept, and the process gets a seed of another OAB
+	require.NoError(t, s.SaveProcessSeeds(ctx, []esaj.ProcessSeed{{ProcessID: "1", OAB: esaj.MustParseOAB("456")}}))
+	seeds, err := s.GetSeedsByOAB(ctx, esaj.MustParseOAB("123"))
+	require.NoError(t, err)
+	require.Len(t, seeds, 1)
+	assert.Equal(t, storage.SeedID("1", esaj.MustParseOAB("123")), seeds[0].ID)
+	assert.Equal(t, "http://example.com/1", seeds[0].URL)
+	assert.Equal(t, storage.SeedPending, seeds[0].Status)
+	assert.Equal(t, time.Unix(0, 1), seeds[0].CreatedAt)
+
+	seeds, err = s.GetSeedsByOAB(ctx, esaj.MustParseOAB("456"))
+	require.NoError(t, err)
+	assert.Len(t, seeds, 1)
+
+	// opening it again doesn't change it
+	require.NoError(t, s.Close())
+	s, err = Open(ctx, path)
+	require.NoError(t, err)
+	seeds, err = s.GetSeedsByOAB(ctx, esaj.MustParseOAB("123"))
+	require.NoError(t, err)
+	assert.Len(t, seeds, 1)
+}
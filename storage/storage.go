@@ -0,0 +1,256 @@
+// Package storage gather the repository interfaces used by the collector and the API, independent of the
+// database that implements them. The implementations are in the firestore and storage/sqlite packages.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/perebaj/esaj/clerk"
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/search"
+)
+
+var (
+	// ErrNotFound is an error that occurs when the record to be updated doesn't exist.
+	ErrNotFound = errors.New("not found")
+)
+
+const (
+	// SeedPending is the status of a seed whose process was not ingested yet. Saving a seed again makes it
+	// pending, so its process is fetched again.
+	SeedPending = "pending"
+	// SeedIngested is the status of a seed whose process was saved by SaveProcessBasicInfo.
+	SeedIngested = "ingested"
+)
+
+// BatchError is returned when some records of a batch were not saved, while the others were.
+type BatchError struct {
+	// Failures maps the ID of each record that was not saved to its error.
+	Failures map[string]error
+}
+
+// Error implements the error interface.
+func (e *BatchError) Error() string {
+	ids := make([]string, 0, len(e.Failures))
+	for id := range e.Failures {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	msgs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		msgs = append(msgs, id+": "+e.Failures[id].Error())
+	}
+	return fmt.Sprintf("error saving %d records: %s", len(ids), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors of the records, so errors.Is and errors.As check all of them.
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, err := range e.Failures {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// ProcessSeed is a process seed saved in the storage.
+type ProcessSeed struct {
+	// ID is the identifier of the seed in the storage, of its process and OAB. See SeedID.
+	ID        string   `json:"id"`
+	ProcessID string   `json:"process_id"`
+	OAB       esaj.OAB `json:"oab"`
+	URL       string   `json:"url"`
+	// Status is SeedPending or SeedIngested.
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// RemovedAt is when the process stopped being found by the search of the OAB, zero while it's found. See
+	// SeedRepository.ReconcileSeeds.
+	RemovedAt time.Time `json:"removed_at"`
+}
+
+// SeedID returns the ID of the seed of a process found by an OAB. A process found by many OABs has a seed of
+// each one. Example: "1016358-63.2020.8.26.0053_103289SP"
+func SeedID(processID string, oab esaj.OAB) string {
+	return processID + "_" + oab.ESAJQuery()
+}
+
+// User is a user saved in the storage. The dates are in the RFC3339 format and DeletedAt is empty while the
+// user is not deleted.
+type User struct {
+	ID             string
+	FirstName      string
+	LastName       string
+	EmailAddresses []any
+	ImageURL       string
+	Birthday       string
+	CreatedAt      string
+	UpdatedAt      string
+	DeletedAt      string
+	TraceID        string
+}
+
+// Document is a PDF document of a process downloaded from the pasta digital.
+type Document struct {
+	// ID identifies the document in the process. Example: the cdDocumento of the pasta digital.
+	ID        string
+	ProcessID string
+	// Title example: "Certidão de Publicação"
+	Title string
+	Pages int
+	// Path is where the PDF was saved. Example: tmp/1016358-63.2020.8.26.0053_Certidão de Publicação.pdf
+	Path string
+	Size int64
+	// SHA256 is the hex encoded hash of the PDF.
+	SHA256    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// SeedRepository saves the process seeds found by the OAB search.
+type SeedRepository interface {
+	// SaveProcessSeeds creates or replaces the seeds, identified by their process ID and OAB, as pending and
+	// not removed. A *BatchError is returned when only some of them were saved, keyed by their SeedID.
+	SaveProcessSeeds(ctx context.Context, ps []esaj.ProcessSeed) error
+	// GetSeedsByOAB returns the seeds of the OAB, ordered by process ID, including the removed ones.
+	GetSeedsByOAB(ctx context.Context, oab esaj.OAB) ([]ProcessSeed, error)
+	// QuerySeeds returns a page of the seeds of the OAB. ErrInvalidQuery is returned when the query is not
+	// valid, see SeedQuery.Normalize.
+	QuerySeeds(ctx context.Context, q SeedQuery) (SeedPage, error)
+	// ReconcileSeeds compares a complete search of the OAB with the saved data, found being all the seeds it
+	// returned. The seeds of the OAB that were not found are marked as removed, and the OAB is taken out of
+	// the processes that were not found, that get a snapshot with the OABRemoved change in their history and
+	// are indexed again. It returns the IDs of these seeds and processes, sorted. A removed seed is not
+	// reconciled again, and saving it again clears its removal.
+	ReconcileSeeds(ctx context.Context, oab esaj.OAB, found []esaj.ProcessSeed) ([]string, error)
+}
+
+// ProcessRepository saves the basic information of the processes.
+type ProcessRepository interface {
+	// SaveProcessBasicInfo creates or replaces the process, identified by its process ID. The OAB is added to
+	// the OABs of the process, so a process shared by many lawyers is found by all of them. When the process
+	// is new or differs from the saved one, a snapshot is added to its history (see NewProcessSnapshot).
+	// The seed of the process and the OAB, if any, becomes SeedIngested, and the process is indexed for the search (see
+	// SearchRepository). All of it is saved atomically. The names anonymized by AnonymizeParty are replaced in
+	// the parties before saving.
+	SaveProcessBasicInfo(ctx context.Context, pBasicInfo esaj.ProcessBasicInfo) error
+	// ProcessBasicInfoByOAB returns the processes of the OAB, ordered by process ID. The OAB of the returned
+	// processes is the given one.
+	ProcessBasicInfoByOAB(ctx context.Context, oab esaj.OAB) ([]esaj.ProcessBasicInfo, error)
+	// QueryProcesses returns a page of the processes of the OAB that match the filters of the query. The OAB
+	// of the returned processes is the queried one. ErrInvalidQuery is returned when the query is not valid,
+	// see ProcessQuery.Normalize.
+	QueryProcesses(ctx context.Context, q ProcessQuery) (ProcessPage, error)
+	// ProcessHistory returns the snapshots of the process, from the oldest to the newest.
+	ProcessHistory(ctx context.Context, processID string) ([]ProcessSnapshot, error)
+	// ProcessOABs returns the OABs that found the process, sorted. ErrNotFound is returned when the process
+	// doesn't exist.
+	ProcessOABs(ctx context.Context, processID string) ([]esaj.OAB, error)
+}
+
+// UserRepository saves the users received from the clerk webhooks.
+type UserRepository interface {
+	// SaveUser creates or replaces the user, clearing its deletion.
+	SaveUser(ctx context.Context, event clerk.WebHookEvent) error
+	// DeleteUser is a soft delete, the DeletedAt of the user is set to the current time. ErrNotFound is
+	// returned when the user doesn't exist.
+	DeleteUser(ctx context.Context, event clerk.WebHookEvent) error
+	// GetUser returns an empty user and a nil error when the user doesn't exist.
+	GetUser(ctx context.Context, userID string) (User, error)
+}
+
+// DocumentRepository saves the documents downloaded from the processes.
+type DocumentRepository interface {
+	// SaveDocument creates or replaces the document, identified by its process ID and ID.
+	SaveDocument(ctx context.Context, doc Document) error
+	// DocumentsByProcess returns the documents of the process, ordered by ID.
+	DocumentsByProcess(ctx context.Context, processID string) ([]Document, error)
+}
+
+// MovementRepository saves the movements of the processes and which of them were read by each user.
+type MovementRepository interface {
+	// SaveMovements saves the movements of the process that were not saved yet, and returns them. The saved
+	// ones are kept as they are, so saving the movements of a re-scrape is idempotent. The names anonymized by
+	// AnonymizeParty are replaced in the new movements, keeping their IDs.
+	SaveMovements(ctx context.Context, processID string, ms []esaj.Movement) ([]Movement, error)
+	// MovementsByOAB returns the movements of the processes of the OAB that were saved since the time.
+	// The movements are ordered by date, process ID and ID.
+	MovementsByOAB(ctx context.Context, oab esaj.OAB, since time.Time) ([]Movement, error)
+	// MarkMovementsRead marks the movements of the process as read by the user.
+	MarkMovementsRead(ctx context.Context, userID, processID string, movementIDs []string) error
+	// UnreadMovements returns the movements of the processes of the OAB that were not read by the user.
+	// The movements are ordered by date, process ID and ID.
+	UnreadMovements(ctx context.Context, userID string, oab esaj.OAB) ([]Movement, error)
+}
+
+// SearchRepository keeps the search index of the processes, whose documents are built and ranked by the
+// search package.
+type SearchRepository interface {
+	// SearchProcesses returns the processes of the OABs of the query that have all the terms of its text, the
+	// best ranked first (see search.Rank). The OAB of the returned processes is the first OAB of the query
+	// that found them. search.ErrInvalidQuery is returned when the query is not valid.
+	SearchProcesses(ctx context.Context, q search.Query) ([]search.Result, error)
+	// RebuildSearchIndex replaces the search index by one built from the saved processes, and returns how
+	// many processes were indexed.
+	RebuildSearchIndex(ctx context.Context) (int, error)
+}
+
+// PrivacyRepository gather the operations on personal data required by the LGPD. They are run by the lgpd
+// package, that records each of them in the privacy audit.
+type PrivacyRepository interface {
+	// ExportUser returns the data tied to the user. ErrNotFound is returned when the user doesn't exist.
+	ExportUser(ctx context.Context, userID string) (UserExport, error)
+	// PurgeUsers removes the users deleted before the time, with the movements they read and their
+	// memberships, and returns their IDs, sorted. The annotations they wrote are kept by their organizations,
+	// without their author.
+	PurgeUsers(ctx context.Context, deletedBefore time.Time) ([]string, error)
+	// AnonymizeParty replaces the name by Anonymized in the parties of the processes, in their history and in
+	// their movements, and indexes the changed processes again. Only the SubjectHash of the name is kept, and
+	// the processes and movements saved later are anonymized when the hash of one of their NameCandidates
+	// matches it. It returns the IDs of the changed processes, sorted.
+	AnonymizeParty(ctx context.Context, name string) ([]string, error)
+	// SavePrivacyAudit saves the audit record of an operation.
+	SavePrivacyAudit(ctx context.Context, a PrivacyAudit) error
+	// PrivacyAudits returns the audit records of the subject, or all of them when it's empty, ordered by
+	// creation time and ID.
+	PrivacyAudits(ctx context.Context, subject string) ([]PrivacyAudit, error)
+}
+
+// Storage gather all repositories, it's implemented by each storage backend.
+type Storage interface {
+	SeedRepository
+	ProcessRepository
+	UserRepository
+	DocumentRepository
+	MovementRepository
+	SearchRepository
+	PrivacyRepository
+	OrganizationRepository
+	AuditRepository
+}
+
+// NewUser returns the user of a clerk webhook event. The dates of the event are unix timestamps in
+// milliseconds, and are converted to RFC3339.
+func NewUser(event clerk.WebHookEvent, traceID string) User {
+	emails := make([]any, 0, len(event.Data.EmailAddresses))
+	for _, e := range event.Data.EmailAddresses {
+		emails = append(emails, e)
+	}
+
+	return User{
+		ID:             event.Data.ID,
+		FirstName:      event.Data.FirstName,
+		LastName:       event.Data.LastName,
+		EmailAddresses: emails,
+		ImageURL:       event.Data.ImageURL,
+		Birthday:       event.Data.Birthday,
+		CreatedAt:      time.Unix(0, event.Data.CreatedAt*int64(time.Millisecond)).Format(time.RFC3339),
+		UpdatedAt:      time.Unix(0, event.Data.UpdatedAt*int64(time.Millisecond)).Format(time.RFC3339),
+		TraceID:        traceID,
+	}
+}
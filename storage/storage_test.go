@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchError(t *testing.T) {
+	errTimeout := errors.New("timeout")
+	var err error = &BatchError{Failures: map[string]error{
+		"456": errors.New("permission denied"),
+		"123": errTimeout,
+	}}
+
+	assert.Equal(t, "error saving 2 records: 123: timeout; 456: permission denied", err.Error())
+	assert.ErrorIs(t, err, errTimeout)
+
+	var batchErr *BatchError
+	assert.ErrorAs(t, err, &batchErr)
+	assert.Len(t, batchErr.Failures, 2)
+}
@@ -0,0 +1,1221 @@
+// Package storagetest gather the conformance tests of the storage backends. Each backend runs them from its own
+// tests, so all of them have the same behavior.
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/perebaj/esaj/clerk"
+	"github.com/perebaj/esaj/esaj"
+	"github.com/perebaj/esaj/search"
+	"github.com/perebaj/esaj/storage"
+	"github.com/perebaj/esaj/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run runs the conformance tests. newStorage must return an empty storage for each test.
+func Run(t *testing.T, newStorage func(t *testing.T) storage.Storage) {
+	tests := map[string]func(t *testing.T, s storage.Storage){
+		"Seeds":           testSeeds,
+		"ReconcileSeeds":  testReconcileSeeds,
+		"SeedStatus":      testSeedStatus,
+		"ProcessOABUnion": testProcessOABUnion,
+		"ConcurrentOABs":  testConcurrentOABs,
+		"ProcessHistory":  testProcessHistory,
+		"Users":           testUsers,
+		"UserSoftDelete":  testUserSoftDelete,
+		"Documents":       testDocuments,
+		"Movements":       testMovements,
+		"QuerySeeds":      testQuerySeeds,
+		"QueryProcesses":  testQueryProcesses,
+		"Search":          testSearch,
+		"Privacy":         testPrivacy,
+		"PrivacyOrgs":     testPrivacyOrganizations,
+		"ProcessOABs":     testProcessOABs,
+		"Organizations":   testOrganizations,
+		"Annotations":     testAnnotations,
+		"AccessEvents":    testAccessEvents,
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test(t, newStorage(t))
+		})
+	}
+}
+
+func testSeeds(t *testing.T, s storage.Storage) {
+	ctx := tracing.SetTraceIDInContext(context.Background(), "test-trace-id")
+
+	ps := []esaj.ProcessSeed{
+		{ProcessID: "789", OAB: esaj.MustParseOAB("123"), URL: "http://teste1.com"},
+		{ProcessID: "456", OAB: esaj.MustParseOAB("456"), URL: "http://example.com"},
+		{ProcessID: "123", OAB: esaj.MustParseOAB("123"), URL: "http://teste.com"},
+	}
+	require.NoError(t, s.SaveProcessSeeds(ctx, ps))
+
+	seeds, err := s.GetSeedsByOAB(ctx, esaj.MustParseOAB("123"))
+	require.NoError(t, err)
+	require.Len(t, seeds, 2)
+	assert.Equal(t, storage.SeedID("123", esaj.MustParseOAB("123")), seeds[0].ID)
+	assert.Equal(t, "123", seeds[0].ProcessID)
+	assert.Equal(t, esaj.MustParseOAB("123"), seeds[0].OAB)
+	assert.Equal(t, "http://teste.com", seeds[0].URL)
+	assert.Equal(t, storage.SeedPending, seeds[0].Status)
+	assert.False(t, seeds[0].CreatedAt.IsZero())
+	assert.Equal(t, "789", seeds[1].ProcessID)
+
+	// update a seed that already exists, keeping its creation time
+	created := seeds[0].CreatedAt
+	ps[2].URL = "http://teste.com/updated"
+	require.NoError(t, s.SaveProcessSeeds(ctx, ps[2:]))
+
+	seeds, err = s.GetSeedsByOAB(ctx, esaj.MustParseOAB("123"))
+	require.NoError(t, err)
+	require.Len(t, seeds, 2)
+	assert.Equal(t, "http://teste.com/updated", seeds[0].URL)
+	assert.True(t, seeds[0].CreatedAt.Equal(created))
+	assert.False(t, seeds[0].UpdatedAt.Before(created))
+
+	// the process found by another OAB has a seed of each one
+	ps[2].OAB = esaj.MustParseOAB("456")
+	require.NoError(t, s.SaveProcessSeeds(ctx, ps[2:]))
+
+	seeds, err = s.GetSeedsByOAB(ctx, esaj.MustParseOAB("456"))
+	require.NoError(t, err)
+	require.Len(t, seeds, 2)
+	assert.Equal(t, "123", seeds[0].ProcessID)
+	assert.Equal(t, storage.SeedID("123", esaj.MustParseOAB("456")), seeds[0].ID)
+
+	// saving the process by one of them ingests only its seed
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{ProcessID: "123", OAB: ps[2].OAB}))
+	seeds, err = s.GetSeedsByOAB(ctx, esaj.MustParseOAB("123"))
+	require.NoError(t, err)
+	require.Len(t, seeds, 2)
+	assert.Equal(t, esaj.MustParseOAB("123"), seeds[0].OAB)
+	assert.Equal(t, "http://teste.com/updated", seeds[0].URL)
+	assert.Equal(t, storage.SeedPending, seeds[0].Status)
+	seeds, err = s.GetSeedsByOAB(ctx, ps[2].OAB)
+	require.NoError(t, err)
+	assert.Equal(t, storage.SeedIngested, seeds[0].Status)
+
+	seeds, err = s.GetSeedsByOAB(ctx, esaj.MustParseOAB("999"))
+	require.NoError(t, err)
+	assert.Empty(t, seeds)
+}
+
+func testProcessOABUnion(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	pBasicInfo := esaj.ProcessBasicInfo{
+		OAB:         esaj.MustParseOAB("123"),
+		ProcessID:   "1007573-30.2024.8.26.0229",
+		ProcessForo: "0229",
+		ForoName:    "Foro de Hortolândia",
+		ProcessCode: "6D0008MAZ0000",
+		Judge:       "Judge",
+		Class:       "Habilitação de Crédito",
+		Claimant:    "Claimant",
+		Defendant:   "Defendant",
+		Vara:        "1ª Vara Cível",
+		URL:         "http://example.com",
+	}
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, pBasicInfo))
+
+	other := pBasicInfo
+	other.ProcessID = "1016358-63.2020.8.26.0053"
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, other))
+
+	// the same process saved by another OAB is found by both, with the last saved data
+	pBasicInfo.OAB = esaj.MustParseOAB("456")
+	pBasicInfo.ForoName = "Updated Foro"
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, pBasicInfo))
+	// saving with an OAB that the process already has doesn't duplicate it
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, pBasicInfo))
+
+	got, err := s.ProcessBasicInfoByOAB(ctx, esaj.MustParseOAB("123"))
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, "1007573-30.2024.8.26.0229", got[0].ProcessID)
+	assert.Equal(t, "1016358-63.2020.8.26.0053", got[1].ProcessID)
+
+	want := pBasicInfo
+	want.OAB = esaj.MustParseOAB("123")
+	assert.Equal(t, want, got[0])
+
+	got, err = s.ProcessBasicInfoByOAB(ctx, esaj.MustParseOAB("456"))
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, pBasicInfo, got[0])
+
+	got, err = s.ProcessBasicInfoByOAB(ctx, esaj.MustParseOAB("789"))
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func testSeedStatus(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	seed := esaj.ProcessSeed{ProcessID: "1007573-30.2024.8.26.0229", OAB: esaj.MustParseOAB("123"), URL: "http://example.com"}
+	require.NoError(t, s.SaveProcessSeeds(ctx, []esaj.ProcessSeed{seed}))
+
+	seeds, err := s.GetSeedsByOAB(ctx, seed.OAB)
+	require.NoError(t, err)
+	require.Len(t, seeds, 1)
+	assert.Equal(t, storage.SeedPending, seeds[0].Status)
+
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{
+		OAB:       seed.OAB,
+		ProcessID: seed.ProcessID,
+		URL:       seed.URL,
+	}))
+
+	seeds, err = s.GetSeedsByOAB(ctx, seed.OAB)
+	require.NoError(t, err)
+	require.Len(t, seeds, 1)
+	assert.Equal(t, storage.SeedIngested, seeds[0].Status)
+
+	// a seed found again is ingested again
+	require.NoError(t, s.SaveProcessSeeds(ctx, []esaj.ProcessSeed{seed}))
+
+	seeds, err = s.GetSeedsByOAB(ctx, seed.OAB)
+	require.NoError(t, err)
+	require.Len(t, seeds, 1)
+	assert.Equal(t, storage.SeedPending, seeds[0].Status)
+
+	// processes without a seed are saved too
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{
+		OAB:       seed.OAB,
+		ProcessID: "1016358-63.2020.8.26.0053",
+	}))
+	got, err := s.ProcessBasicInfoByOAB(ctx, seed.OAB)
+	require.NoError(t, err)
+	assert.Len(t, got, 2)
+}
+
+func testConcurrentOABs(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	const n = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{
+				OAB:       esaj.MustParseOAB(fmt.Sprint(100 + i)),
+				ProcessID: "1007573-30.2024.8.26.0229",
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	// no OAB is lost when the same process is saved at the same time
+	for i := 0; i < n; i++ {
+		got, err := s.ProcessBasicInfoByOAB(ctx, esaj.MustParseOAB(fmt.Sprint(100+i)))
+		require.NoError(t, err)
+		assert.Len(t, got, 1)
+	}
+}
+
+func testProcessHistory(t *testing.T, s storage.Storage) {
+	ctx := tracing.SetTraceIDInContext(context.Background(), "trace-1")
+
+	pBasicInfo := esaj.ProcessBasicInfo{
+		OAB:         esaj.MustParseOAB("123"),
+		ProcessID:   "1007573-30.2024.8.26.0229",
+		ProcessForo: "0229",
+		ForoName:    "Foro de Hortolândia",
+		Judge:       "Fulano",
+		Vara:        "1ª Vara Cível",
+		URL:         "http://example.com",
+	}
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, pBasicInfo))
+
+	// a scrape without changes, even by another OAB, is not a new snapshot
+	pBasicInfo.OAB = esaj.MustParseOAB("456")
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, pBasicInfo))
+
+	ctx = tracing.SetTraceIDInContext(ctx, "trace-2")
+	pBasicInfo.Judge = "Beltrano"
+	pBasicInfo.Vara = "2ª Vara Cível"
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, pBasicInfo))
+
+	history, err := s.ProcessHistory(ctx, pBasicInfo.ProcessID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+
+	first := history[0]
+	assert.NotEmpty(t, first.ID)
+	assert.Equal(t, pBasicInfo.ProcessID, first.ProcessID)
+	assert.Equal(t, "trace-1", first.TraceID)
+	assert.False(t, first.CreatedAt.IsZero())
+	assert.Equal(t, "Fulano", first.Process.Judge)
+	assert.Equal(t, "Foro de Hortolândia", first.Process.ForoName)
+	assert.True(t, first.Process.OAB.IsZero())
+	assert.Empty(t, first.Diff)
+
+	second := history[1]
+	assert.Greater(t, second.ID, first.ID)
+	assert.False(t, second.CreatedAt.Before(first.CreatedAt))
+	assert.Equal(t, "trace-2", second.TraceID)
+	assert.Equal(t, "Beltrano", second.Process.Judge)
+	assert.Equal(t, []storage.FieldChange{
+		{Field: "judge", From: "Fulano", To: "Beltrano"},
+		{Field: "vara", From: "1ª Vara Cível", To: "2ª Vara Cível"},
+	}, second.Diff)
+
+	history, err = s.ProcessHistory(ctx, "1016358-63.2020.8.26.0053")
+	require.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func userEvent() clerk.WebHookEvent {
+	return clerk.WebHookEvent{
+		Data: clerk.Data{
+			ID:        "123",
+			FirstName: "John",
+			LastName:  "Doe",
+			EmailAddresses: []clerk.EmailAddress{
+				{EmailAddress: "teste", ID: "123", LinkedTo: []any{"123"}, Object: "email"},
+			},
+			ImageURL:  "image",
+			Birthday:  "birday",
+			CreatedAt: 1654012591835,
+			UpdatedAt: 1654012591835,
+		},
+	}
+}
+
+func testUsers(t *testing.T, s storage.Storage) {
+	ctx := tracing.SetTraceIDInContext(context.Background(), "test-trace-id")
+	event := userEvent()
+
+	// a user that doesn't exist is empty, without an error
+	user, err := s.GetUser(ctx, event.Data.ID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.User{}, user)
+
+	require.NoError(t, s.SaveUser(ctx, event))
+
+	user, err = s.GetUser(ctx, event.Data.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "123", user.ID)
+	assert.Equal(t, "John", user.FirstName)
+	assert.Equal(t, "Doe", user.LastName)
+	assert.Len(t, user.EmailAddresses, 1)
+	assert.Equal(t, "image", user.ImageURL)
+	assert.Equal(t, "birday", user.Birthday)
+	assert.Equal(t, time.UnixMilli(1654012591835).Format(time.RFC3339), user.CreatedAt)
+	assert.Equal(t, time.UnixMilli(1654012591835).Format(time.RFC3339), user.UpdatedAt)
+	assert.Equal(t, "test-trace-id", user.TraceID)
+	assert.Empty(t, user.DeletedAt)
+
+	event.Data.FirstName = "Jane"
+	require.NoError(t, s.SaveUser(ctx, event))
+
+	user, err = s.GetUser(ctx, event.Data.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Jane", user.FirstName)
+	assert.Equal(t, "Doe", user.LastName)
+}
+
+func testUserSoftDelete(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	event := userEvent()
+
+	err := s.DeleteUser(ctx, event)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	require.NoError(t, s.SaveUser(ctx, event))
+	require.NoError(t, s.DeleteUser(ctx, event))
+
+	// the deleted user is kept, with the deletion time
+	user, err := s.GetUser(ctx, event.Data.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "John", user.FirstName)
+	deletedAt, err := time.Parse(time.RFC3339, user.DeletedAt)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), deletedAt, time.Minute)
+
+	// saving the user again replaces it, including the deletion
+	require.NoError(t, s.SaveUser(ctx, event))
+	user, err = s.GetUser(ctx, event.Data.ID)
+	require.NoError(t, err)
+	assert.Empty(t, user.DeletedAt)
+}
+
+func testDocuments(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	docs := []storage.Document{
+		{ID: "2", ProcessID: "123", Title: "Certidão de Publicação", Pages: 1, Path: "tmp/123_2.pdf", Size: 10, SHA256: "aa"},
+		{ID: "1", ProcessID: "123", Title: "Petição Inicial", Pages: 12, Path: "tmp/123_1.pdf", Size: 20, SHA256: "bb"},
+		{ID: "1", ProcessID: "456", Title: "Sentença", Pages: 3, Path: "tmp/456_1.pdf", Size: 30, SHA256: "cc"},
+	}
+	for _, d := range docs {
+		require.NoError(t, s.SaveDocument(ctx, d))
+	}
+
+	docs[0].Title = "Certidão"
+	require.NoError(t, s.SaveDocument(ctx, docs[0]))
+
+	got, err := s.DocumentsByProcess(ctx, "123")
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, "1", got[0].ID)
+	assert.Equal(t, "123", got[0].ProcessID)
+	assert.Equal(t, "Petição Inicial", got[0].Title)
+	assert.Equal(t, 12, got[0].Pages)
+	assert.Equal(t, "tmp/123_1.pdf", got[0].Path)
+	assert.Equal(t, int64(20), got[0].Size)
+	assert.Equal(t, "bb", got[0].SHA256)
+	assert.Equal(t, "Certidão", got[1].Title)
+	assert.False(t, got[1].CreatedAt.IsZero())
+
+	got, err = s.DocumentsByProcess(ctx, "789")
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func testMovements(t *testing.T, s storage.Storage) {
+	ctx := tracing.SetTraceIDInContext(context.Background(), "test-trace-id")
+
+	for _, p := range []esaj.ProcessBasicInfo{
+		{ProcessID: "1", OAB: esaj.MustParseOAB("123")},
+		{ProcessID: "2", OAB: esaj.MustParseOAB("123")},
+		{ProcessID: "2", OAB: esaj.MustParseOAB("456")},
+		{ProcessID: "3", OAB: esaj.MustParseOAB("789")},
+	} {
+		require.NoError(t, s.SaveProcessBasicInfo(ctx, p))
+	}
+
+	day := func(d int) time.Time {
+		return time.Date(2024, 8, d, 0, 0, 0, 0, time.UTC)
+	}
+	m1 := esaj.Movement{Date: day(2), Title: "Certidão de Publicação Expedida", Text: "Relação: 0123/2024"}
+	m2 := esaj.Movement{Date: day(1), Title: "Conclusos para Despacho"}
+
+	created, err := s.SaveMovements(ctx, "1", []esaj.Movement{
+		m1,
+		m2,
+		// the same movement, with other spaces
+		{Date: day(2), Title: " Certidão de  Publicação Expedida", Text: "Relação:\n0123/2024 "},
+	})
+	require.NoError(t, err)
+	require.Len(t, created, 2)
+	assert.Equal(t, storage.MovementID(m1), created[0].ID)
+	assert.Equal(t, "1", created[0].ProcessID)
+	assert.Equal(t, "test-trace-id", created[0].TraceID)
+
+	// saving a re-scrape is idempotent
+	created, err = s.SaveMovements(ctx, "1", []esaj.Movement{m2, m1})
+	require.NoError(t, err)
+	assert.Empty(t, created)
+
+	// the clock must move between the movements saved before and after since
+	time.Sleep(10 * time.Millisecond)
+	since := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	m3 := esaj.Movement{Date: day(1), Title: "Juntada de Petição"}
+	_, err = s.SaveMovements(ctx, "2", []esaj.Movement{m3})
+	require.NoError(t, err)
+	_, err = s.SaveMovements(ctx, "3", []esaj.Movement{m1})
+	require.NoError(t, err)
+
+	ids := func(movements []storage.Movement) []string {
+		var got []string
+		for _, m := range movements {
+			got = append(got, m.ProcessID+"/"+m.Title)
+		}
+		return got
+	}
+
+	// ordered by date and process ID
+	movements, err := s.MovementsByOAB(ctx, esaj.MustParseOAB("123"), time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1/Conclusos para Despacho", "2/Juntada de Petição", "1/Certidão de Publicação Expedida"},
+		ids(movements))
+	assert.True(t, movements[0].Date.Equal(day(1)))
+	assert.Equal(t, "Relação: 0123/2024", movements[2].Text)
+	assert.False(t, movements[2].CreatedAt.IsZero())
+
+	movements, err = s.MovementsByOAB(ctx, esaj.MustParseOAB("123"), since)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2/Juntada de Petição"}, ids(movements))
+
+	movements, err = s.MovementsByOAB(ctx, esaj.MustParseOAB("456"), time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2/Juntada de Petição"}, ids(movements))
+
+	movements, err = s.MovementsByOAB(ctx, esaj.MustParseOAB("999"), time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, movements)
+
+	// unread movements by user
+	require.NoError(t, s.MarkMovementsRead(ctx, "user-1", "1", []string{storage.MovementID(m1), storage.MovementID(m2)}))
+	// the same movement of another process is still unread
+	require.NoError(t, s.MarkMovementsRead(ctx, "user-1", "2", []string{storage.MovementID(m1)}))
+
+	movements, err = s.UnreadMovements(ctx, "user-1", esaj.MustParseOAB("123"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2/Juntada de Petição"}, ids(movements))
+
+	movements, err = s.UnreadMovements(ctx, "user-2", esaj.MustParseOAB("123"))
+	require.NoError(t, err)
+	assert.Len(t, movements, 3)
+
+	movements, err = s.UnreadMovements(ctx, "user-1", esaj.MustParseOAB("789"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3/Certidão de Publicação Expedida"}, ids(movements))
+
+	// the movements saved before an OAB was added to their process are found by it
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{ProcessID: "3", OAB: esaj.MustParseOAB("999")}))
+	movements, err = s.MovementsByOAB(ctx, esaj.MustParseOAB("999"), time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3/Certidão de Publicação Expedida"}, ids(movements))
+}
+
+func testQuerySeeds(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	oab := esaj.MustParseOAB("123")
+
+	// saved one by one, so the update times grow with the order of the IDs below
+	for _, id := range []string{"3", "1", "5", "2", "4"} {
+		require.NoError(t, s.SaveProcessSeeds(ctx, []esaj.ProcessSeed{{ProcessID: id, OAB: oab, URL: "http://example.com"}}))
+	}
+	require.NoError(t, s.SaveProcessSeeds(ctx, []esaj.ProcessSeed{{ProcessID: "6", OAB: esaj.MustParseOAB("456")}}))
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{ProcessID: "5", OAB: oab}))
+
+	seedIDs := func(q storage.SeedQuery) []string {
+		var ids []string
+		for {
+			page, err := s.QuerySeeds(ctx, q)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(page.Seeds), q.PageSize)
+			for _, seed := range page.Seeds {
+				ids = append(ids, seed.ProcessID)
+			}
+			if page.NextCursor == "" {
+				return ids
+			}
+			q.Cursor = page.NextCursor
+		}
+	}
+
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, seedIDs(storage.SeedQuery{OAB: oab, PageSize: 2}))
+	assert.Equal(t, []string{"5", "4", "3", "2", "1"}, seedIDs(storage.SeedQuery{OAB: oab, PageSize: 2, Desc: true}))
+	assert.Equal(t, []string{"3", "1", "5", "2", "4"},
+		seedIDs(storage.SeedQuery{OAB: oab, PageSize: 3, OrderBy: storage.OrderUpdatedAt}))
+	assert.Equal(t, []string{"4", "2", "5", "1", "3"},
+		seedIDs(storage.SeedQuery{OAB: oab, PageSize: 1, OrderBy: storage.OrderUpdatedAt, Desc: true}))
+	assert.Equal(t, []string{"1", "2", "3", "4"}, seedIDs(storage.SeedQuery{OAB: oab, PageSize: 5, Status: storage.SeedPending}))
+	assert.Equal(t, []string{"5"}, seedIDs(storage.SeedQuery{OAB: oab, PageSize: 5, Status: storage.SeedIngested}))
+
+	// the page with all the seeds has no next page
+	page, err := s.QuerySeeds(ctx, storage.SeedQuery{OAB: oab, PageSize: 5})
+	require.NoError(t, err)
+	assert.Len(t, page.Seeds, 5)
+	assert.Empty(t, page.NextCursor)
+	assert.Equal(t, oab, page.Seeds[0].OAB)
+
+	page, err = s.QuerySeeds(ctx, storage.SeedQuery{OAB: esaj.MustParseOAB("999")})
+	require.NoError(t, err)
+	assert.Empty(t, page.Seeds)
+
+	// a cursor of another order is rejected
+	page, err = s.QuerySeeds(ctx, storage.SeedQuery{OAB: oab, PageSize: 1})
+	require.NoError(t, err)
+	_, err = s.QuerySeeds(ctx, storage.SeedQuery{OAB: oab, Cursor: page.NextCursor, OrderBy: storage.OrderUpdatedAt})
+	assert.ErrorIs(t, err, storage.ErrInvalidQuery)
+
+	_, err = s.QuerySeeds(ctx, storage.SeedQuery{OAB: oab, OrderBy: storage.OrderClass})
+	assert.ErrorIs(t, err, storage.ErrInvalidQuery)
+	_, err = s.QuerySeeds(ctx, storage.SeedQuery{OAB: oab, Cursor: "invalid"})
+	assert.ErrorIs(t, err, storage.ErrInvalidQuery)
+}
+
+func testQueryProcesses(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	oab := esaj.MustParseOAB("123")
+
+	// saved in this order, so the update times grow with it
+	processes := []esaj.ProcessBasicInfo{
+		{ProcessID: "3", ProcessForo: "0053", Class: "Procedimento Comum Cível", Situation: "Em andamento"},
+		{ProcessID: "1", ProcessForo: "0100", Class: "Execução Fiscal", Situation: "Em andamento"},
+		{ProcessID: "5", ProcessForo: "0053", Class: "Execução Fiscal", Situation: "Extinto"},
+		{ProcessID: "2", ProcessForo: "0053", Class: "Procedimento Comum Cível", Situation: "Em andamento"},
+		{ProcessID: "4", ProcessForo: "0100", Class: "Procedimento Comum Cível", Situation: "Suspenso"},
+	}
+	for _, p := range processes {
+		p.OAB = oab
+		require.NoError(t, s.SaveProcessBasicInfo(ctx, p))
+	}
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{ProcessID: "6", OAB: esaj.MustParseOAB("456")}))
+
+	processIDs := func(q storage.ProcessQuery) []string {
+		var ids []string
+		for {
+			page, err := s.QueryProcesses(ctx, q)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(page.Processes), q.PageSize)
+			for _, p := range page.Processes {
+				assert.Equal(t, oab, p.OAB)
+				ids = append(ids, p.ProcessID)
+			}
+			if page.NextCursor == "" {
+				return ids
+			}
+			q.Cursor = page.NextCursor
+		}
+	}
+
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, processIDs(storage.ProcessQuery{OAB: oab, PageSize: 2}))
+	assert.Equal(t, []string{"5", "4", "3", "2", "1"}, processIDs(storage.ProcessQuery{OAB: oab, PageSize: 3, Desc: true}))
+	assert.Equal(t, []string{"3", "1", "5", "2", "4"},
+		processIDs(storage.ProcessQuery{OAB: oab, PageSize: 2, OrderBy: storage.OrderUpdatedAt}))
+	assert.Equal(t, []string{"4", "2", "5", "1", "3"},
+		processIDs(storage.ProcessQuery{OAB: oab, PageSize: 2, OrderBy: storage.OrderUpdatedAt, Desc: true}))
+	assert.Equal(t, []string{"1", "5", "2", "3", "4"},
+		processIDs(storage.ProcessQuery{OAB: oab, PageSize: 2, OrderBy: storage.OrderClass}))
+	assert.Equal(t, []string{"4", "1", "5", "3", "2"},
+		processIDs(storage.ProcessQuery{OAB: oab, PageSize: 1, OrderBy: storage.OrderForo, Desc: true}))
+
+	// filters
+	assert.Equal(t, []string{"2", "3", "5"}, processIDs(storage.ProcessQuery{OAB: oab, PageSize: 2, Foro: "0053"}))
+	assert.Equal(t, []string{"2", "3"}, processIDs(storage.ProcessQuery{
+		OAB: oab, PageSize: 1, Foro: "0053", Class: "Procedimento Comum Cível", Situation: "Em andamento",
+	}))
+	assert.Equal(t, []string{"4", "1"}, processIDs(storage.ProcessQuery{
+		OAB: oab, PageSize: 1, Foro: "0100", OrderBy: storage.OrderUpdatedAt, Desc: true,
+	}))
+	assert.Empty(t, processIDs(storage.ProcessQuery{OAB: oab, PageSize: 1, Situation: "Arquivado"}))
+
+	// the situation is saved with the process
+	page, err := s.QueryProcesses(ctx, storage.ProcessQuery{OAB: oab, PageSize: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "Em andamento", page.Processes[0].Situation)
+	assert.Equal(t, "Execução Fiscal", page.Processes[0].Class)
+
+	_, err = s.QueryProcesses(ctx, storage.ProcessQuery{OAB: oab, OrderBy: "judge"})
+	assert.ErrorIs(t, err, storage.ErrInvalidQuery)
+	_, err = s.QueryProcesses(ctx, storage.ProcessQuery{OAB: oab, PageSize: storage.MaxPageSize + 1})
+	assert.ErrorIs(t, err, storage.ErrInvalidQuery)
+	_, err = s.QueryProcesses(ctx, storage.ProcessQuery{OAB: oab, Cursor: page.NextCursor, Desc: true})
+	assert.ErrorIs(t, err, storage.ErrInvalidQuery)
+}
+
+func testSearch(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	oab, other := esaj.MustParseOAB("123"), esaj.MustParseOAB("456")
+
+	processes := []esaj.ProcessBasicInfo{
+		{
+			ProcessID: "1", OAB: oab, Class: "Execução Fiscal", Subject: "Dívida Ativa",
+			Claimant: "Município de São Paulo Advogado: Ana Lima", Defendant: "João Souza",
+			Judge: "Maria Pereira", Vara: "1ª Vara de Execuções Fiscais",
+		},
+		{
+			ProcessID: "2", OAB: oab, Class: "Procedimento Comum Cível", Subject: "Indenização por Dano Moral",
+			Claimant: "José Pereira", Defendant: "Banco Exemplo S.A. Advogada: Carla Souza",
+			Judge: "Paulo Lima", Vara: "2ª Vara Cível",
+		},
+		{
+			ProcessID: "3", OAB: other, Class: "Execução de Título Extrajudicial",
+			Claimant: "João Souza", Defendant: "Pedro Alves", Vara: "3ª Vara Cível",
+		},
+	}
+	for _, p := range processes {
+		require.NoError(t, s.SaveProcessBasicInfo(ctx, p))
+	}
+
+	searchIDs := func(q search.Query) []string {
+		results, err := s.SearchProcesses(ctx, q)
+		require.NoError(t, err)
+		ids := []string{}
+		for _, r := range results {
+			ids = append(ids, r.Process.ProcessID)
+		}
+		return ids
+	}
+
+	// accent-insensitive, scoped by the OABs
+	assert.Equal(t, []string{"1"}, searchIDs(search.Query{Text: "JOAO", OABs: []esaj.OAB{oab}}))
+	assert.Equal(t, []string{"1", "3"}, searchIDs(search.Query{Text: "joão souza", OABs: []esaj.OAB{oab, other}}))
+	assert.Empty(t, searchIDs(search.Query{Text: "pedro alves", OABs: []esaj.OAB{oab}}))
+
+	// prefixes, and all the terms must match
+	assert.Equal(t, []string{"1", "3"}, searchIDs(search.Query{Text: "execu", OABs: []esaj.OAB{oab, other}}))
+	assert.Equal(t, []string{"3"}, searchIDs(search.Query{Text: "execução pedro", OABs: []esaj.OAB{oab, other}}))
+
+	// the party ranks above the judge and the lawyers are split from the parties
+	results, err := s.SearchProcesses(ctx, search.Query{Text: "pereira", OABs: []esaj.OAB{oab}})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "2", results[0].Process.ProcessID)
+	assert.Equal(t, []search.Field{search.FieldParty}, results[0].Fields)
+	assert.Equal(t, []search.Field{search.FieldJudge}, results[1].Fields)
+	assert.Greater(t, results[0].Score, results[1].Score)
+	assert.Equal(t, oab, results[0].Process.OAB)
+	assert.Equal(t, "Indenização por Dano Moral", results[0].Process.Subject)
+
+	results, err = s.SearchProcesses(ctx, search.Query{Text: "ana lima", OABs: []esaj.OAB{oab}})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, []search.Field{search.FieldLawyer}, results[0].Fields)
+
+	assert.Equal(t, []string{"2"}, searchIDs(search.Query{Text: "dano moral", OABs: []esaj.OAB{oab}}))
+	assert.Equal(t, []string{"1"}, searchIDs(search.Query{Text: "vara de execucoes", OABs: []esaj.OAB{oab}}))
+	assert.Equal(t, []string{"1"}, searchIDs(search.Query{Text: "souza", OABs: []esaj.OAB{oab}, Limit: 1}))
+
+	// a process found by another OAB is found by both, with the OAB of the query
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{
+		ProcessID: "3", OAB: oab, Class: "Execução de Título Extrajudicial",
+		Claimant: "João Souza", Defendant: "Pedro Alves Advogado: Rui Costa", Vara: "3ª Vara Cível",
+	}))
+	results, err = s.SearchProcesses(ctx, search.Query{Text: "pedro", OABs: []esaj.OAB{oab, other}})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, oab, results[0].Process.OAB)
+	assert.Equal(t, []string{"3"}, searchIDs(search.Query{Text: "rui costa", OABs: []esaj.OAB{other}}))
+
+	// a saved process is indexed again
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{
+		ProcessID: "2", OAB: oab, Class: "Procedimento Comum Cível", Claimant: "José Pereira", Defendant: "Outro Banco",
+	}))
+	assert.Empty(t, searchIDs(search.Query{Text: "exemplo", OABs: []esaj.OAB{oab}}))
+	assert.Equal(t, []string{"2"}, searchIDs(search.Query{Text: "outro banco", OABs: []esaj.OAB{oab}}))
+
+	indexed, err := s.RebuildSearchIndex(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, indexed)
+	assert.Equal(t, []string{"1", "3"}, searchIDs(search.Query{Text: "joao", OABs: []esaj.OAB{oab}}))
+	assert.Equal(t, []string{"3"}, searchIDs(search.Query{Text: "joao", OABs: []esaj.OAB{other}}))
+
+	for _, q := range []search.Query{
+		{Text: "de da do", OABs: []esaj.OAB{oab}},
+		{Text: "joao"},
+		{Text: "joao", OABs: []esaj.OAB{oab}, Limit: search.MaxLimit + 1},
+	} {
+		_, err := s.SearchProcesses(ctx, q)
+		assert.ErrorIs(t, err, search.ErrInvalidQuery)
+	}
+}
+
+func testPrivacy(t *testing.T, s storage.Storage) {
+	ctx := tracing.SetTraceIDInContext(context.Background(), "test-trace-id")
+	oab := esaj.MustParseOAB("123")
+
+	// export of a user with the movements it read
+	_, err := s.ExportUser(ctx, "123")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	require.NoError(t, s.SaveUser(ctx, userEvent()))
+	require.NoError(t, s.MarkMovementsRead(ctx, "123", "2", []string{"b"}))
+	require.NoError(t, s.MarkMovementsRead(ctx, "123", "1", []string{"a"}))
+
+	export, err := s.ExportUser(ctx, "123")
+	require.NoError(t, err)
+	assert.Equal(t, "John", export.User.FirstName)
+	require.Len(t, export.MovementReads, 2)
+	assert.Equal(t, "1", export.MovementReads[0].ProcessID)
+	assert.Equal(t, "a", export.MovementReads[0].MovementID)
+	assert.False(t, export.MovementReads[0].ReadAt.IsZero())
+	assert.Equal(t, "2", export.MovementReads[1].ProcessID)
+
+	// only the users deleted before the time are purged
+	other := userEvent()
+	other.Data.ID = "456"
+	require.NoError(t, s.SaveUser(ctx, other))
+	require.NoError(t, s.MarkMovementsRead(ctx, "456", "1", []string{"a"}))
+	require.NoError(t, s.DeleteUser(ctx, userEvent()))
+
+	purged, err := s.PurgeUsers(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, purged)
+
+	purged, err = s.PurgeUsers(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"123"}, purged)
+
+	user, err := s.GetUser(ctx, "123")
+	require.NoError(t, err)
+	assert.Equal(t, storage.User{}, user)
+	_, err = s.ExportUser(ctx, "123")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	export, err = s.ExportUser(ctx, "456")
+	require.NoError(t, err)
+	assert.Len(t, export.MovementReads, 1)
+
+	// anonymization of the processes, their history, their movements and the search index
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{
+		ProcessID: "1", OAB: oab, Class: "Procedimento Comum Cível", Claimant: "Jose da Silva",
+		Defendant: "Banco Exemplo S.A.",
+	}))
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{
+		ProcessID: "1", OAB: oab, Class: "Procedimento Comum Cível", Claimant: "José  da Silva Advogado: Ana Lima",
+		Defendant: "Banco Exemplo S.A.",
+	}))
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{
+		ProcessID: "2", OAB: oab, Class: "Execução Fiscal", Claimant: "Fazenda", Defendant: "José da Silveira",
+	}))
+	m := esaj.Movement{Date: time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC), Title: "Citação de JOSÉ DA SILVA"}
+	_, err = s.SaveMovements(ctx, "1", []esaj.Movement{m})
+	require.NoError(t, err)
+
+	changed, err := s.AnonymizeParty(ctx, "jose da silva")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, changed)
+
+	processes, err := s.ProcessBasicInfoByOAB(ctx, oab)
+	require.NoError(t, err)
+	require.Len(t, processes, 2)
+	assert.Equal(t, storage.Anonymized+" Advogado: Ana Lima", processes[0].Claimant)
+	assert.Equal(t, "José da Silveira", processes[1].Defendant)
+
+	history, err := s.ProcessHistory(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	for _, snapshot := range history {
+		assert.True(t, strings.HasPrefix(snapshot.Process.Claimant, storage.Anonymized), snapshot.Process.Claimant)
+		for _, c := range snapshot.Diff {
+			assert.NotContains(t, c.From+c.To, "Silva ")
+		}
+	}
+
+	movements, err := s.MovementsByOAB(ctx, oab, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, movements, 1)
+	assert.Equal(t, "Citação de "+storage.Anonymized, movements[0].Title)
+	assert.Equal(t, storage.MovementID(m), movements[0].ID)
+
+	results, err := s.SearchProcesses(ctx, search.Query{Text: "silva", OABs: []esaj.OAB{oab}})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	// the processes and movements saved later are anonymized, and the original movement is not saved again
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{
+		ProcessID: "3", OAB: oab, Claimant: "Jose da Silva", Defendant: "Fazenda",
+	}))
+	created, err := s.SaveMovements(ctx, "1", []esaj.Movement{m, {Date: m.Date, Title: "Intimação de José da Silva"}})
+	require.NoError(t, err)
+	require.Len(t, created, 1)
+	assert.Equal(t, "Intimação de "+storage.Anonymized, created[0].Title)
+
+	processes, err = s.ProcessBasicInfoByOAB(ctx, oab)
+	require.NoError(t, err)
+	require.Len(t, processes, 3)
+	assert.Equal(t, storage.Anonymized, processes[2].Claimant)
+
+	// audit records, by subject
+	for i, a := range []storage.PrivacyAudit{
+		{ID: "b", Operation: storage.PrivacyExport, Subject: "456", Actor: "admin", Records: []string{}},
+		{ID: "a", Operation: storage.PrivacyAnonymize, Subject: "hash", Actor: "admin", Records: []string{"1"}},
+		{ID: "c", Operation: storage.PrivacyPurge, Subject: "123", Actor: "admin", Records: []string{}},
+	} {
+		a.CreatedAt = time.Date(2024, 8, 1, 0, 0, i/2, 0, time.UTC)
+		a.TraceID = "test-trace-id"
+		require.NoError(t, s.SavePrivacyAudit(ctx, a))
+	}
+
+	audits, err := s.PrivacyAudits(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, audits, 3)
+	assert.Equal(t, "a", audits[0].ID)
+	assert.Equal(t, storage.PrivacyAnonymize, audits[0].Operation)
+	assert.Equal(t, []string{"1"}, audits[0].Records)
+	assert.Equal(t, "test-trace-id", audits[0].TraceID)
+	assert.True(t, audits[0].CreatedAt.Equal(time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "b", audits[1].ID)
+	assert.Equal(t, "c", audits[2].ID)
+
+	audits, err = s.PrivacyAudits(ctx, "456")
+	require.NoError(t, err)
+	require.Len(t, audits, 1)
+	assert.Equal(t, storage.PrivacyExport, audits[0].Operation)
+	assert.Equal(t, "admin", audits[0].Actor)
+}
+
+func testReconcileSeeds(t *testing.T, s storage.Storage) {
+	ctx := tracing.SetTraceIDInContext(context.Background(), "test-trace-id")
+	oab, other := esaj.MustParseOAB("123"), esaj.MustParseOAB("456")
+
+	seeds := []esaj.ProcessSeed{
+		{ProcessID: "1", OAB: oab, URL: "http://example.com/1"},
+		{ProcessID: "2", OAB: oab, URL: "http://example.com/2"},
+		{ProcessID: "3", OAB: oab, URL: "http://example.com/3"},
+	}
+	require.NoError(t, s.SaveProcessSeeds(ctx, seeds))
+	for _, p := range []esaj.ProcessBasicInfo{
+		{ProcessID: "1", OAB: oab, Claimant: "João Souza"},
+		{ProcessID: "2", OAB: oab, Claimant: "João Souza"},
+		{ProcessID: "2", OAB: other, Claimant: "João Souza"},
+		// a process of the OAB whose seed moved to the other OAB
+		{ProcessID: "4", OAB: oab, Claimant: "João Souza"},
+	} {
+		require.NoError(t, s.SaveProcessBasicInfo(ctx, p))
+	}
+	// the seeds of the other OAB, of the process 2 too, are not reconciled
+	require.NoError(t, s.SaveProcessSeeds(ctx, []esaj.ProcessSeed{{ProcessID: "2", OAB: other}, {ProcessID: "4", OAB: other}}))
+
+	// the processes 2, 3 and 4 are not found anymore
+	removed, err := s.ReconcileSeeds(ctx, oab, seeds[:1])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2", "3", "4"}, removed)
+
+	got, err := s.GetSeedsByOAB(ctx, oab)
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	assert.True(t, got[0].RemovedAt.IsZero())
+	assert.WithinDuration(t, time.Now(), got[1].RemovedAt, time.Minute)
+	assert.False(t, got[2].RemovedAt.IsZero())
+	got, err = s.GetSeedsByOAB(ctx, other)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.True(t, got[0].RemovedAt.IsZero())
+	assert.True(t, got[1].RemovedAt.IsZero())
+
+	processIDs := func(oab esaj.OAB) []string {
+		processes, err := s.ProcessBasicInfoByOAB(ctx, oab)
+		require.NoError(t, err)
+		ids := []string{}
+		for _, p := range processes {
+			ids = append(ids, p.ProcessID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"1"}, processIDs(oab))
+	assert.Equal(t, []string{"2"}, processIDs(other))
+
+	results, err := s.SearchProcesses(ctx, search.Query{Text: "joao", OABs: []esaj.OAB{oab}})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "1", results[0].Process.ProcessID)
+
+	// the change event is in the history of the process
+	history, err := s.ProcessHistory(ctx, "2")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, []storage.FieldChange{{Field: storage.OABRemoved, From: oab.String()}}, history[1].Diff)
+	assert.Equal(t, "João Souza", history[1].Process.Claimant)
+	assert.Equal(t, "test-trace-id", history[1].TraceID)
+
+	// the removed seeds and processes are not reconciled again
+	removed, err = s.ReconcileSeeds(ctx, oab, seeds[:1])
+	require.NoError(t, err)
+	assert.Empty(t, removed)
+	history, err = s.ProcessHistory(ctx, "2")
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	// a seed found again is not removed anymore, and its process gets the OAB back when saved
+	require.NoError(t, s.SaveProcessSeeds(ctx, seeds[1:2]))
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{ProcessID: "2", OAB: oab, Claimant: "João Souza"}))
+	got, err = s.GetSeedsByOAB(ctx, oab)
+	require.NoError(t, err)
+	assert.True(t, got[1].RemovedAt.IsZero())
+	assert.Equal(t, []string{"1", "2"}, processIDs(oab))
+
+	// an empty search removes all of them
+	removed, err = s.ReconcileSeeds(ctx, oab, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, removed)
+	assert.Empty(t, processIDs(oab))
+}
+
+func testProcessOABs(t *testing.T, s storage.Storage) {
+	ctx := tracing.SetTraceIDInContext(context.Background(), "test-trace-id")
+
+	_, err := s.ProcessOABs(ctx, "1")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{ProcessID: "1", OAB: esaj.MustParseOAB("456")}))
+	require.NoError(t, s.SaveProcessBasicInfo(ctx, esaj.ProcessBasicInfo{ProcessID: "1", OAB: esaj.MustParseOAB("123")}))
+
+	oabs, err := s.ProcessOABs(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, []esaj.OAB{esaj.MustParseOAB("123"), esaj.MustParseOAB("456")}, oabs)
+}
+
+func testOrganizations(t *testing.T, s storage.Storage) {
+	ctx := tracing.SetTraceIDInContext(context.Background(), "test-trace-id")
+
+	_, err := s.GetOrganization(ctx, "firm")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	err = s.SaveMember(ctx, storage.Member{OrganizationID: "firm", UserID: "u1", Role: storage.RoleOwner})
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	org := storage.Organization{
+		ID:   "firm",
+		Name: "Silva Advogados",
+		OABs: []esaj.OAB{esaj.MustParseOAB("456"), esaj.MustParseOAB("123")},
+	}
+	require.NoError(t, s.SaveOrganization(ctx, org))
+
+	got, err := s.GetOrganization(ctx, "firm")
+	require.NoError(t, err)
+	assert.Equal(t, "Silva Advogados", got.Name)
+	assert.Equal(t, []esaj.OAB{esaj.MustParseOAB("123"), esaj.MustParseOAB("456")}, got.OABs)
+	assert.False(t, got.CreatedAt.IsZero())
+
+	// replacing the organization replaces its OABs and keeps its creation time
+	created := got.CreatedAt
+	org.Name = "Silva & Souza"
+	org.OABs = []esaj.OAB{esaj.MustParseOAB("789")}
+	require.NoError(t, s.SaveOrganization(ctx, org))
+
+	got, err = s.GetOrganization(ctx, "firm")
+	require.NoError(t, err)
+	assert.Equal(t, "Silva & Souza", got.Name)
+	assert.Equal(t, []esaj.OAB{esaj.MustParseOAB("789")}, got.OABs)
+	assert.True(t, got.CreatedAt.Equal(created))
+	assert.False(t, got.UpdatedAt.Before(created))
+
+	// members, and the memberships of a user in many organizations
+	require.NoError(t, s.SaveOrganization(ctx, storage.Organization{ID: "other", Name: "Souza"}))
+	require.NoError(t, s.SaveMember(ctx, storage.Member{OrganizationID: "firm", UserID: "u2", Role: storage.RoleMember}))
+	require.NoError(t, s.SaveMember(ctx, storage.Member{OrganizationID: "firm", UserID: "u1", Role: storage.RoleOwner}))
+	require.NoError(t, s.SaveMember(ctx, storage.Member{OrganizationID: "other", UserID: "u2", Role: storage.RoleAdmin}))
+
+	members, err := s.Members(ctx, "firm")
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+	assert.Equal(t, "u1", members[0].UserID)
+	assert.Equal(t, storage.RoleOwner, members[0].Role)
+	assert.Equal(t, "u2", members[1].UserID)
+	assert.False(t, members[1].CreatedAt.IsZero())
+
+	memberships, err := s.UserMemberships(ctx, "u2")
+	require.NoError(t, err)
+	require.Len(t, memberships, 2)
+	assert.Equal(t, "firm", memberships[0].OrganizationID)
+	assert.Equal(t, storage.RoleMember, memberships[0].Role)
+	assert.Equal(t, "other", memberships[1].OrganizationID)
+	assert.Equal(t, storage.RoleAdmin, memberships[1].Role)
+
+	// changing the role keeps the creation time
+	created = memberships[0].CreatedAt
+	require.NoError(t, s.SaveMember(ctx, storage.Member{OrganizationID: "firm", UserID: "u2", Role: storage.RoleAdmin}))
+	member, err := s.GetMember(ctx, "firm", "u2")
+	require.NoError(t, err)
+	assert.Equal(t, storage.RoleAdmin, member.Role)
+	assert.True(t, member.CreatedAt.Equal(created))
+
+	require.NoError(t, s.RemoveMember(ctx, "firm", "u2"))
+	_, err = s.GetMember(ctx, "firm", "u2")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	require.ErrorIs(t, s.RemoveMember(ctx, "firm", "u2"), storage.ErrNotFound)
+
+	memberships, err = s.UserMemberships(ctx, "u2")
+	require.NoError(t, err)
+	require.Len(t, memberships, 1)
+	assert.Equal(t, "other", memberships[0].OrganizationID)
+}
+
+func testPrivacyOrganizations(t *testing.T, s storage.Storage) {
+	ctx := tracing.SetTraceIDInContext(context.Background(), "test-trace-id")
+	oabs := []esaj.OAB{esaj.MustParseOAB("123")}
+
+	require.NoError(t, s.SaveUser(ctx, userEvent()))
+	require.NoError(t, s.SaveOrganization(ctx, storage.Organization{ID: "firm", OABs: oabs}))
+	require.NoError(t, s.SaveOrganization(ctx, storage.Organization{ID: "other", OABs: oabs}))
+	require.NoError(t, s.SaveMember(ctx, storage.Member{OrganizationID: "other", UserID: "123", Role: storage.RoleMember}))
+	require.NoError(t, s.SaveMember(ctx, storage.Member{OrganizationID: "firm", UserID: "123", Role: storage.RoleOwner}))
+	require.NoError(t, s.SaveMember(ctx, storage.Member{OrganizationID: "firm", UserID: "456", Role: storage.RoleOwner}))
+	for _, a := range []storage.Annotation{
+		{ID: "a2", OrganizationID: "other", ProcessID: "1", AuthorID: "123", Text: "ligar para o cliente"},
+		{ID: "a1", OrganizationID: "firm", ProcessID: "1", AuthorID: "123", Text: "prazo em 15 dias"},
+		{ID: "a2", OrganizationID: "firm", ProcessID: "1", AuthorID: "456", Text: "audiência marcada"},
+	} {
+		require.NoError(t, s.SaveAnnotation(ctx, a))
+	}
+
+	// the export has the memberships and the annotations written by the user
+	export, err := s.ExportUser(ctx, "123")
+	require.NoError(t, err)
+	require.Len(t, export.Memberships, 2)
+	assert.Equal(t, "firm", export.Memberships[0].OrganizationID)
+	assert.Equal(t, storage.RoleOwner, export.Memberships[0].Role)
+	assert.Equal(t, "other", export.Memberships[1].OrganizationID)
+	require.Len(t, export.Annotations, 2)
+	assert.Equal(t, "firm", export.Annotations[0].OrganizationID)
+	assert.Equal(t, "prazo em 15 dias", export.Annotations[0].Text)
+	assert.Equal(t, "other", export.Annotations[1].OrganizationID)
+
+	// the purge removes the memberships, and the annotations are kept without their author
+	require.NoError(t, s.DeleteUser(ctx, userEvent()))
+	purged, err := s.PurgeUsers(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"123"}, purged)
+
+	memberships, err := s.UserMemberships(ctx, "123")
+	require.NoError(t, err)
+	assert.Empty(t, memberships)
+	members, err := s.Members(ctx, "firm")
+	require.NoError(t, err)
+	require.Len(t, members, 1)
+	assert.Equal(t, "456", members[0].UserID)
+
+	annotations, err := s.Annotations(ctx, "firm", "1")
+	require.NoError(t, err)
+	require.Len(t, annotations, 2)
+	assert.Equal(t, "", annotations[0].AuthorID)
+	assert.Equal(t, "prazo em 15 dias", annotations[0].Text)
+	assert.Equal(t, "456", annotations[1].AuthorID)
+	annotations, err = s.Annotations(ctx, "other", "1")
+	require.NoError(t, err)
+	require.Len(t, annotations, 1)
+	assert.Equal(t, "", annotations[0].AuthorID)
+}
+
+func testAnnotations(t *testing.T, s storage.Storage) {
+	ctx := tracing.SetTraceIDInContext(context.Background(), "test-trace-id")
+
+	err := s.SaveAnnotation(ctx, storage.Annotation{ID: "a1", OrganizationID: "firm", ProcessID: "1", Text: "x"})
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	// two firms that share the OAB of the process
+	shared := []esaj.OAB{esaj.MustParseOAB("123")}
+	require.NoError(t, s.SaveOrganization(ctx, storage.Organization{ID: "firm", OABs: shared}))
+	require.NoError(t, s.SaveOrganization(ctx, storage.Organization{ID: "other", OABs: shared}))
+
+	require.NoError(t, s.SaveAnnotation(ctx, storage.Annotation{
+		ID: "a2", OrganizationID: "firm", ProcessID: "1", AuthorID: "u1", Text: "ligar para o cliente",
+	}))
+	require.NoError(t, s.SaveAnnotation(ctx, storage.Annotation{
+		ID: "a1", OrganizationID: "firm", ProcessID: "1", AuthorID: "u2", Text: "prazo em 15 dias",
+	}))
+	require.NoError(t, s.SaveAnnotation(ctx, storage.Annotation{
+		ID: "a3", OrganizationID: "firm", ProcessID: "2", AuthorID: "u1", Text: "outro processo",
+	}))
+	require.NoError(t, s.SaveAnnotation(ctx, storage.Annotation{
+		ID: "a1", OrganizationID: "other", ProcessID: "1", AuthorID: "u3", Text: "estratégia da outra banca",
+	}))
+
+	annotations, err := s.Annotations(ctx, "firm", "1")
+	require.NoError(t, err)
+	require.Len(t, annotations, 2)
+	assert.Equal(t, "a2", annotations[0].ID)
+	assert.Equal(t, "ligar para o cliente", annotations[0].Text)
+	assert.Equal(t, "u1", annotations[0].AuthorID)
+	assert.Equal(t, "firm", annotations[0].OrganizationID)
+	assert.False(t, annotations[0].CreatedAt.IsZero())
+	assert.Equal(t, "a1", annotations[1].ID)
+	assert.Equal(t, "prazo em 15 dias", annotations[1].Text)
+
+	// the annotations are private to the organization, even with the same ID and process
+	annotations, err = s.Annotations(ctx, "other", "1")
+	require.NoError(t, err)
+	require.Len(t, annotations, 1)
+	assert.Equal(t, "estratégia da outra banca", annotations[0].Text)
+
+	// editing keeps the creation time and the order
+	a, err := s.GetAnnotation(ctx, "firm", "a2")
+	require.NoError(t, err)
+	a.Text = "cliente avisado"
+	require.NoError(t, s.SaveAnnotation(ctx, a))
+
+	edited, err := s.GetAnnotation(ctx, "firm", "a2")
+	require.NoError(t, err)
+	assert.Equal(t, "cliente avisado", edited.Text)
+	assert.True(t, edited.CreatedAt.Equal(a.CreatedAt))
+	assert.False(t, edited.UpdatedAt.Before(a.CreatedAt))
+
+	require.NoError(t, s.DeleteAnnotation(ctx, "firm", "a1"))
+	require.ErrorIs(t, s.DeleteAnnotation(ctx, "firm", "a1"), storage.ErrNotFound)
+	_, err = s.GetAnnotation(ctx, "firm", "a1")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	annotations, err = s.Annotations(ctx, "firm", "1")
+	require.NoError(t, err)
+	require.Len(t, annotations, 1)
+	assert.Equal(t, "a2", annotations[0].ID)
+
+	// the annotation of the other organization is kept
+	_, err = s.GetAnnotation(ctx, "other", "a1")
+	require.NoError(t, err)
+}
+
+func testAccessEvents(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	base := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	var events []storage.AccessEvent
+	for i := 0; i < 5; i++ {
+		events = append(events, storage.AccessEvent{
+			ID:             fmt.Sprintf("e%d", 4-i),
+			UserID:         "u1",
+			OrganizationID: "silva",
+			TraceID:        "test-trace-id",
+			Action:         storage.AccessRead,
+			Resource:       storage.ProcessResource("1"),
+			CreatedAt:      base.Add(time.Duration(i/2) * time.Minute),
+		})
+	}
+	events[4].OrganizationID = "souza"
+	events[4].Action = storage.AccessWrite
+	require.NoError(t, s.SaveAccessEvents(ctx, events))
+
+	// the saved events are never changed
+	changed := events[0]
+	changed.Resource = storage.OABResource(esaj.MustParseOAB("123"))
+	require.NoError(t, s.SaveAccessEvents(ctx, []storage.AccessEvent{changed}))
+
+	// ordered by creation time and ID, across the pages
+	var ids []string
+	q := storage.AccessQuery{PageSize: 2}
+	for {
+		page, err := s.QueryAccessEvents(ctx, q)
+		require.NoError(t, err)
+		for _, e := range page.Events {
+			ids = append(ids, e.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{"e3", "e4", "e1", "e2", "e0"}, ids)
+
+	page, err := s.QueryAccessEvents(ctx, storage.AccessQuery{OrganizationID: "silva", Since: base.Add(time.Minute)})
+	require.NoError(t, err)
+	require.Len(t, page.Events, 2)
+	assert.Equal(t, "e1", page.Events[0].ID)
+	assert.Equal(t, "u1", page.Events[0].UserID)
+	assert.Equal(t, "test-trace-id", page.Events[0].TraceID)
+	assert.Equal(t, storage.ProcessResource("1"), page.Events[0].Resource)
+	assert.True(t, page.Events[0].CreatedAt.Equal(base.Add(time.Minute)))
+	assert.Empty(t, page.NextCursor)
+
+	page, err = s.QueryAccessEvents(ctx, storage.AccessQuery{
+		Resource: storage.ProcessResource("1"), Until: base.Add(time.Minute),
+	})
+	require.NoError(t, err)
+	require.Len(t, page.Events, 2)
+	assert.Equal(t, "e4", page.Events[1].ID)
+
+	page, err = s.QueryAccessEvents(ctx, storage.AccessQuery{UserID: "u2"})
+	require.NoError(t, err)
+	assert.Empty(t, page.Events)
+
+	for _, q := range []storage.AccessQuery{
+		{PageSize: storage.MaxPageSize + 1},
+		{Cursor: "!"},
+		{Since: base, Until: base},
+	} {
+		_, err := s.QueryAccessEvents(ctx, q)
+		require.ErrorIs(t, err, storage.ErrInvalidQuery)
+	}
+}